@@ -50,6 +50,21 @@ func main() {
 
 	corsOrigins := strings.Split(envOr("KAPOK_CORS_ORIGINS", "http://localhost:3000,http://localhost:3001,http://localhost:5173"), ",")
 
+	// GraphiQL page per tenant, off unless enabled, for the listed roles. Its
+	// assets load from a CDN or a self-hosted copy and need integrity hashes.
+	graphiQL := gql.GraphiQLConfig{
+		Enabled: envOr("KAPOK_GRAPHIQL_ENABLED", "false") == "true",
+		Roles:   strings.Split(envOr("KAPOK_GRAPHIQL_ROLES", gql.AdminRole), ","),
+		Assets:  gql.DefaultGraphiQLAssets(envOr("KAPOK_GRAPHIQL_ASSETS_URL", "https://unpkg.com")),
+	}
+	graphiQL.Assets.Stylesheet.Integrity = envOr("KAPOK_GRAPHIQL_SRI_STYLESHEET", "")
+	graphiQL.Assets.React.Integrity = envOr("KAPOK_GRAPHIQL_SRI_REACT", "")
+	graphiQL.Assets.ReactDOM.Integrity = envOr("KAPOK_GRAPHIQL_SRI_REACT_DOM", "")
+	graphiQL.Assets.GraphiQL.Integrity = envOr("KAPOK_GRAPHIQL_SRI_GRAPHIQL", "")
+	if err := graphiQL.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid GraphiQL configuration")
+	}
+
 	// Connect to database
 	db, err := database.NewDB(ctx, dbCfg, log.Logger)
 	if err != nil {
@@ -97,17 +112,46 @@ func main() {
 		defer scheduler.Stop()
 	}
 
+	// GraphQL handler; its LISTEN connection for subscriptions is released on exit
+	gqlHandler := gql.NewHandler(db, log.Logger)
+	defer gqlHandler.Close()
+
+	// Regenerate tenant schemas on DDL instead of waiting for the cache TTL
+	if err := migrator.InstallSchemaChangeTriggers(ctx); err != nil {
+		log.Warn().Err(err).Msg("schema change triggers not installed, schemas refresh on cache expiry only")
+	}
+	if stopWatching, err := gqlHandler.WatchSchemaChanges(); err != nil {
+		log.Warn().Err(err).Msg("failed to watch schema changes")
+	} else {
+		defer stopWatching()
+	}
+	gqlHandler.SetDefaultQueryLimits(tenant.QueryLimits{
+		MaxDepth: envInt("KAPOK_GRAPHQL_MAX_DEPTH", gql.DefaultMaxQueryDepth),
+		MaxNodes: envInt("KAPOK_GRAPHQL_MAX_NODES", gql.DefaultMaxQueryNodes),
+		MaxCost:  envInt("KAPOK_GRAPHQL_MAX_COST", gql.DefaultMaxQueryCost),
+	})
+
 	// Wire dependencies
 	deps := &api.Dependencies{
 		DB:          db,
 		JWTManager:  auth.NewJWTManager(jwtSecret),
 		Provisioner: tenant.NewProvisioner(db, log.Logger),
-		GQLHandler:    gql.NewHandler(db, log.Logger),
+		GQLHandler:    gqlHandler,
 		BackupService: backupSvc,
+		Operations:    gql.NewOperationRepository(db),
+		Permissions:   gql.NewPermissionRepository(db),
+		Actions:       gql.NewActionRepository(db),
+		RemoteSchemas: gql.NewRemoteSchemaRepository(db),
 		Logger:        log.Logger,
 		CORSOrigins: corsOrigins,
+		GraphiQL:    graphiQL,
 	}
 
+	// Browser graphql-ws clients authenticate in connection_init and may connect
+	// from the origins allowed for CORS
+	gqlHandler.SetWebSocketAuthenticator(api.GraphQLWebSocketAuthenticator(deps))
+	gqlHandler.SetAllowedOrigins(corsOrigins)
+
 	router := api.NewRouter(deps)
 
 	addr := fmt.Sprintf("%s:%d", serverHost, serverPort)
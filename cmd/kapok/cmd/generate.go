@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/kapok/kapok/internal/database"
+	gql "github.com/kapok/kapok/internal/graphql"
 	"github.com/kapok/kapok/pkg/config"
 	"github.com/kapok/kapok/pkg/codegen"
 	"github.com/kapok/kapok/pkg/codegen/react"
@@ -18,6 +24,10 @@ var (
 	generateSchema      string
 	generateProjectName string
 	generateSDKImport   string
+	generateOutputFile  string
+	generateServerURL   string
+	generateTitle       string
+	generateSDLFile     string
 )
 
 // generateCmd represents the generate command
@@ -29,6 +39,8 @@ var generateCmd = &cobra.Command{
 Example:
   kapok generate sdk                         # Generate TypeScript SDK
   kapok generate react                       # Generate React hooks
+  kapok generate openapi                     # Generate an OpenAPI document
+  kapok generate graphql-schema              # Generate the GraphQL schema (SDL)
   kapok generate sdk --output-dir ./client   # Generate to custom directory
   kapok generate sdk --schema tenant_123    # Generate for specific schema`,
 }
@@ -71,10 +83,51 @@ Example:
 	RunE: runGenerateReact,
 }
 
+// openapiCmd represents the openapi subcommand
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Generate an OpenAPI 3.1 document from database schema",
+	Long: `Generate an OpenAPI 3.1 document describing the REST endpoints of a schema's tables,
+for Swagger and other OpenAPI tooling.
+
+The document includes:
+  - List, get, create, update and delete operations for each table
+  - Row and request schemas with nullability and formats
+  - Bearer token authentication
+  - Error responses and their codes
+
+Running servers also serve the document of each tenant, for the caller's role,
+at /api/v1/tenants/{tenantId}/openapi.json.
+
+Example:
+  kapok generate openapi
+  kapok generate openapi --schema tenant_123 --output ./openapi.json
+  kapok generate openapi --server-url https://api.example.com/api/v1/tenants/<tenant-id>/rest`,
+	RunE: runGenerateOpenAPI,
+}
+
+// graphqlSchemaCmd represents the graphql-schema subcommand
+var graphqlSchemaCmd = &cobra.Command{
+	Use:   "graphql-schema",
+	Short: "Generate the GraphQL schema (SDL) from database schema",
+	Long: `Generate the GraphQL schema of a schema's tables in the schema definition
+language, for code generators, linters and editors.
+
+Running servers also serve the schema of each tenant, for the caller's role,
+at /api/v1/tenants/{tenantId}/graphql/schema.graphql.
+
+Example:
+  kapok generate graphql-schema
+  kapok generate graphql-schema --schema tenant_123 --output ./schema.graphql`,
+	RunE: runGenerateGraphQLSchema,
+}
+
 func init() {
 	rootCmd.AddCommand(generateCmd)
 	generateCmd.AddCommand(sdkCmd)
 	generateCmd.AddCommand(reactCmd)
+	generateCmd.AddCommand(openapiCmd)
+	generateCmd.AddCommand(graphqlSchemaCmd)
 
 	// SDK command flags
 	sdkCmd.Flags().StringVar(&generateOutputDir, "output-dir", "./sdk/typescript", "Output directory for generated SDK")
@@ -86,6 +139,16 @@ func init() {
 	reactCmd.Flags().StringVarP(&generateSchema, "schema", "s", "public", "PostgreSQL schema name")
 	reactCmd.Flags().StringVar(&generateProjectName, "project-name", "kapok-react", "NPM package name for the React hooks")
 	reactCmd.Flags().StringVar(&generateSDKImport, "sdk-import", "../typescript", "Import path for TypeScript SDK")
+
+	// OpenAPI command flags
+	openapiCmd.Flags().StringVarP(&generateOutputFile, "output", "o", "./openapi.json", "Output file for the OpenAPI document")
+	openapiCmd.Flags().StringVarP(&generateSchema, "schema", "s", "public", "PostgreSQL schema name")
+	openapiCmd.Flags().StringVar(&generateServerURL, "server-url", "", "Base URL of the REST endpoints, e.g. https://api.example.com/api/v1/tenants/<tenant-id>/rest")
+	openapiCmd.Flags().StringVar(&generateTitle, "title", "", "Title of the document (defaults to the schema name)")
+
+	// GraphQL schema command flags
+	graphqlSchemaCmd.Flags().StringVarP(&generateSDLFile, "output", "o", "./schema.graphql", "Output file for the GraphQL schema")
+	graphqlSchemaCmd.Flags().StringVarP(&generateSchema, "schema", "s", "public", "PostgreSQL schema name")
 }
 
 func runGenerateSDK(cmd *cobra.Command, args []string) error {
@@ -221,6 +284,121 @@ func runGenerateReact(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runGenerateOpenAPI(cmd *cobra.Command, args []string) error {
+	log.Info().Msg("Starting OpenAPI generation...")
+
+	// Load configuration with defaults
+	cfg := config.Defaults()
+
+	log.Info().
+		Str("schema", generateSchema).
+		Str("output", generateOutputFile).
+		Msg("Introspecting database schema...")
+
+	metadata, err := introspectMetadata(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+
+	doc, err := gql.GenerateOpenAPI(generateSchema, metadata, gql.OpenAPIOptions{
+		Title:     generateTitle,
+		ServerURL: generateServerURL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate OpenAPI document: %w", err)
+	}
+
+	if err := writeJSONFile(generateOutputFile, doc); err != nil {
+		return fmt.Errorf("failed to write OpenAPI document: %w", err)
+	}
+
+	log.Info().
+		Str("output", generateOutputFile).
+		Int("tables", len(metadata.Tables)).
+		Int("paths", len(doc.Paths)).
+		Msg("✓ OpenAPI generation complete!")
+
+	return nil
+}
+
+func runGenerateGraphQLSchema(cmd *cobra.Command, args []string) error {
+	log.Info().Msg("Starting GraphQL schema generation...")
+
+	// Load configuration with defaults
+	cfg := config.Defaults()
+
+	log.Info().
+		Str("schema", generateSchema).
+		Str("output", generateSDLFile).
+		Msg("Introspecting database schema...")
+
+	metadata, err := introspectMetadata(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+
+	sdl, err := gql.GenerateSDL(generateSchema, metadata)
+	if err != nil {
+		return fmt.Errorf("failed to generate GraphQL schema: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(generateSDLFile), 0755); err != nil {
+		return fmt.Errorf("failed to write GraphQL schema: %w", err)
+	}
+	if err := os.WriteFile(generateSDLFile, []byte(sdl), 0644); err != nil {
+		return fmt.Errorf("failed to write GraphQL schema: %w", err)
+	}
+
+	log.Info().
+		Str("output", generateSDLFile).
+		Int("tables", len(metadata.Tables)).
+		Msg("✓ GraphQL schema generation complete!")
+
+	return nil
+}
+
+// introspectMetadata connects to the database and introspects generateSchema
+// the way the server does, so generated artifacts match what it serves
+func introspectMetadata(ctx context.Context, cfg *config.Config) (*gql.SchemaMetadata, error) {
+	db, err := database.NewDB(ctx, database.Config{
+		Host:     cfg.Database.Host,
+		Port:     cfg.Database.Port,
+		Database: cfg.Database.Database,
+		User:     cfg.Database.User,
+		Password: cfg.Database.Password,
+		SSLMode:  cfg.Database.SSLMode,
+	}, log.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	metadata, err := gql.NewIntrospector(db).Inspect(ctx, generateSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect schema: %w", err)
+	}
+
+	if len(metadata.Tables) == 0 {
+		log.Warn().
+			Str("schema", generateSchema).
+			Msg("No tables found in schema")
+		return nil, fmt.Errorf("no tables found in schema '%s'", generateSchema)
+	}
+	return metadata, nil
+}
+
+// writeJSONFile writes v as indented JSON, creating the file's directory
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
 // connectToDatabase creates a database connection from config
 func connectToDatabase(cfg *config.Config) (*sql.DB, error) {
 	// Build connection string
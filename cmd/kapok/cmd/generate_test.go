@@ -158,3 +158,52 @@ func TestSDKCommand_Examples(t *testing.T) {
 	assert.Contains(t, sdkCmd.Long, "Example:")
 	assert.Contains(t, sdkCmd.Long, "kapok generate sdk")
 }
+
+// OpenAPI Command Tests
+
+func TestOpenAPICommand_Flags(t *testing.T) {
+	assert.Equal(t, "openapi", openapiCmd.Use)
+	assert.Contains(t, generateCmd.Long, "kapok generate openapi")
+
+	outputFlag := openapiCmd.Flags().Lookup("output")
+	require.NotNil(t, outputFlag)
+	assert.Equal(t, "./openapi.json", outputFlag.DefValue)
+
+	schemaFlag := openapiCmd.Flags().Lookup("schema")
+	require.NotNil(t, schemaFlag)
+	assert.Equal(t, "public", schemaFlag.DefValue)
+
+	assert.NotNil(t, openapiCmd.Flags().Lookup("server-url"))
+	assert.NotNil(t, openapiCmd.Flags().Lookup("title"))
+}
+
+func TestGenerateOpenAPI_InvalidConfig(t *testing.T) {
+	// Run without a database should fail on the connection
+	err := runGenerateOpenAPI(openapiCmd, []string{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "database")
+}
+
+// GraphQL Schema Command Tests
+
+func TestGraphQLSchemaCommand_Flags(t *testing.T) {
+	assert.Equal(t, "graphql-schema", graphqlSchemaCmd.Use)
+	assert.Contains(t, generateCmd.Long, "kapok generate graphql-schema")
+
+	outputFlag := graphqlSchemaCmd.Flags().Lookup("output")
+	require.NotNil(t, outputFlag)
+	assert.Equal(t, "./schema.graphql", outputFlag.DefValue)
+	// The openapi command keeps its own output default
+	assert.Equal(t, "./openapi.json", generateOutputFile)
+
+	schemaFlag := graphqlSchemaCmd.Flags().Lookup("schema")
+	require.NotNil(t, schemaFlag)
+	assert.Equal(t, "public", schemaFlag.DefValue)
+}
+
+func TestGenerateGraphQLSchema_InvalidConfig(t *testing.T) {
+	// Run without a database should fail on the connection
+	err := runGenerateGraphQLSchema(graphqlSchemaCmd, []string{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "database")
+}
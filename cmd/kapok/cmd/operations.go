@@ -0,0 +1,9 @@
+package cmd
+
+import (
+	operationscmd "github.com/kapok/kapok/cmd/kapok/operations"
+)
+
+func init() {
+	rootCmd.AddCommand(operationscmd.NewOperationsCommand())
+}
@@ -128,6 +128,11 @@ func TestTenantCommands_Help(t *testing.T) {
 			args:    []string{"tenant", "delete", "--help"},
 			wantOut: "delete",
 		},
+		{
+			name:    "operations register help",
+			args:    []string{"operations", "register", "--help"},
+			wantOut: "allowlisted",
+		},
 	}
 
 	for _, tt := range tests {
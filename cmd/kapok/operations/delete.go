@@ -0,0 +1,44 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+
+	gql "github.com/kapok/kapok/internal/graphql"
+	"github.com/spf13/cobra"
+)
+
+// NewDeleteCommand creates the operations delete command.
+func NewDeleteCommand() *cobra.Command {
+	var tenantID string
+
+	cmd := &cobra.Command{
+		Use:   "delete HASH",
+		Short: "Delete a persisted operation",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDelete(tenantID, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&tenantID, "tenant-id", "", "Tenant ID the operation belongs to")
+	cmd.MarkFlagRequired("tenant-id")
+	return cmd
+}
+
+func runDelete(tenantID, hash string) error {
+	ctx := context.Background()
+
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := gql.NewOperationRepository(db).Delete(ctx, tenantID, hash); err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+
+	fmt.Printf("Operation %s deleted.\n", hash)
+	return nil
+}
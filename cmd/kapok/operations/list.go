@@ -0,0 +1,55 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+
+	gql "github.com/kapok/kapok/internal/graphql"
+	"github.com/spf13/cobra"
+)
+
+// NewListCommand creates the operations list command.
+func NewListCommand() *cobra.Command {
+	var tenantID string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the persisted operations of a tenant",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList(tenantID, all)
+		},
+	}
+
+	cmd.Flags().StringVar(&tenantID, "tenant-id", "", "Tenant ID to list operations for")
+	cmd.Flags().BoolVar(&all, "all", false, "Include automatic persisted queries")
+	cmd.MarkFlagRequired("tenant-id")
+	return cmd
+}
+
+func runList(tenantID string, all bool) error {
+	ctx := context.Background()
+
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ops, err := gql.NewOperationRepository(db).List(ctx, tenantID, !all)
+	if err != nil {
+		return fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	if len(ops) == 0 {
+		fmt.Println("No operations found.")
+		return nil
+	}
+
+	fmt.Printf("%-64s  %-11s  %-19s  %s\n", "HASH", "ALLOWLISTED", "CREATED", "NAME")
+	for _, op := range ops {
+		fmt.Printf("%-64s  %-11t  %-19s  %s\n",
+			op.Hash, op.Allowlisted, op.CreatedAt.Format("2006-01-02 15:04:05"), op.Name)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gql "github.com/kapok/kapok/internal/graphql"
+	"github.com/spf13/cobra"
+)
+
+// NewRegisterCommand creates the operations register command.
+func NewRegisterCommand() *cobra.Command {
+	var tenantID, name string
+
+	cmd := &cobra.Command{
+		Use:   "register FILE...",
+		Short: "Allowlist GraphQL operations for a tenant",
+		Long: "Registers the GraphQL document of each file (use - for stdin) as an allowlisted " +
+			"operation of the tenant. Its sha256 hash is what persisted query clients send.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if name != "" && len(args) > 1 {
+				return fmt.Errorf("--name can only be used with a single file")
+			}
+			return runRegister(tenantID, name, args)
+		},
+	}
+
+	cmd.Flags().StringVar(&tenantID, "tenant-id", "", "Tenant ID to register operations for")
+	cmd.Flags().StringVar(&name, "name", "", "Operation name (defaults to the file name)")
+	cmd.MarkFlagRequired("tenant-id")
+	return cmd
+}
+
+func runRegister(tenantID, name string, files []string) error {
+	ctx := context.Background()
+
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := gql.NewOperationRepository(db)
+	for _, file := range files {
+		query, err := readDocument(file)
+		if err != nil {
+			return err
+		}
+
+		opName := name
+		if opName == "" && file != "-" {
+			opName = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+
+		op := &gql.PersistedOperation{TenantID: tenantID, Name: opName, Query: query, Allowlisted: true}
+		if err := repo.Register(ctx, op); err != nil {
+			return fmt.Errorf("failed to register %s: %w", file, err)
+		}
+		fmt.Printf("Registered %s  %s\n", op.Hash, op.Name)
+	}
+	return nil
+}
+
+// readDocument reads a GraphQL document from a file, or stdin for "-"
+func readDocument(file string) (string, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("%s is empty", file)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,53 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+// NewStrictCommand creates the operations strict command.
+func NewStrictCommand() *cobra.Command {
+	var tenantID string
+
+	cmd := &cobra.Command{
+		Use:       "strict on|off",
+		Short:     "Restrict a tenant's GraphQL endpoint to allowlisted operations",
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: []string{"on", "off"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStrict(tenantID, args[0] == "on")
+		},
+	}
+
+	cmd.Flags().StringVar(&tenantID, "tenant-id", "", "Tenant ID to configure")
+	cmd.MarkFlagRequired("tenant-id")
+	return cmd
+}
+
+func runStrict(tenantID string, enabled bool) error {
+	ctx := context.Background()
+
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	t, err := tenant.NewProvisioner(db, logger).SetStrictOperations(ctx, tenantID, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+
+	if t.StrictOperations {
+		fmt.Printf("Tenant '%s' now only runs allowlisted operations.\n", t.Name)
+	} else {
+		fmt.Printf("Tenant '%s' accepts any operation.\n", t.Name)
+	}
+	return nil
+}
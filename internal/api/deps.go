@@ -16,6 +16,11 @@ type Dependencies struct {
 	Provisioner   *tenant.Provisioner
 	GQLHandler    *gql.Handler
 	BackupService *backup.Service
+	Operations    *gql.OperationRepository
+	Permissions   *gql.PermissionRepository
+	Actions       *gql.ActionRepository
+	RemoteSchemas *gql.RemoteSchemaRepository
 	Logger        zerolog.Logger
 	CORSOrigins   []string
+	GraphiQL      gql.GraphiQLConfig
 }
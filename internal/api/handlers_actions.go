@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	gql "github.com/kapok/kapok/internal/graphql"
+)
+
+// ListActions returns the actions of a tenant.
+func ListActions(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		actions, err := deps.Actions.List(r.Context(), tenantID)
+		if err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to list actions")
+			errorResponse(w, http.StatusInternalServerError, "failed to list actions")
+			return
+		}
+		redacted := make([]*gql.Action, 0, len(actions))
+		for _, action := range actions {
+			redacted = append(redacted, action.Redacted())
+		}
+		writeJSON(w, http.StatusOK, redacted)
+	}
+}
+
+// GetAction returns one action of a tenant.
+func GetAction(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		action, err := deps.Actions.Get(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "name"))
+		if err != nil {
+			if errors.Is(err, gql.ErrActionNotFound) {
+				errorResponse(w, http.StatusNotFound, "action not found")
+				return
+			}
+			errorResponse(w, http.StatusInternalServerError, "failed to get action")
+			return
+		}
+		writeJSON(w, http.StatusOK, action.Redacted())
+	}
+}
+
+// PutAction creates or replaces an action. The action must fit the tenant's
+// schema: its types must exist and its name must not be taken. Headers sent as
+// gql.RedactedHeader keep their stored values.
+func PutAction(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		var action gql.Action
+		if err := readJSON(r, &action); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		action.TenantID = tenantID
+		action.Name = chi.URLParam(r, "name")
+		if err := action.Validate(); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if action.HasRedactedHeaders() {
+			var stored map[string]string
+			existing, err := deps.Actions.Get(r.Context(), tenantID, action.Name)
+			if err == nil {
+				stored = existing.Headers
+			} else if !errors.Is(err, gql.ErrActionNotFound) {
+				errorResponse(w, http.StatusInternalServerError, "failed to get action")
+				return
+			}
+			if err := gql.RestoreHeaders(action.Headers, stored); err != nil {
+				errorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+		if err != nil {
+			errorResponse(w, http.StatusNotFound, "tenant not found")
+			return
+		}
+
+		if deps.GQLHandler != nil {
+			if err := deps.GQLHandler.CheckAction(r.Context(), t, &action); err != nil {
+				errorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		if err := deps.Actions.Put(r.Context(), &action); err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to save action")
+			errorResponse(w, http.StatusInternalServerError, "failed to save action")
+			return
+		}
+		if deps.GQLHandler != nil {
+			deps.GQLHandler.InvalidateActions(t.ID, t.SchemaName)
+		}
+		writeJSON(w, http.StatusOK, action.Redacted())
+	}
+}
+
+// DeleteAction removes an action.
+func DeleteAction(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+		if err != nil {
+			errorResponse(w, http.StatusNotFound, "tenant not found")
+			return
+		}
+
+		if err := deps.Actions.Delete(r.Context(), tenantID, chi.URLParam(r, "name")); err != nil {
+			if errors.Is(err, gql.ErrActionNotFound) {
+				errorResponse(w, http.StatusNotFound, "action not found")
+				return
+			}
+			errorResponse(w, http.StatusInternalServerError, "failed to delete action")
+			return
+		}
+		if deps.GQLHandler != nil {
+			deps.GQLHandler.InvalidateActions(t.ID, t.SchemaName)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	}
+}
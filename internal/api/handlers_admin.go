@@ -118,6 +118,36 @@ func DeleteTenant(deps *Dependencies) http.HandlerFunc {
 	}
 }
 
+// UpdateQueryLimits sets the GraphQL depth, node count and cost limits of a tenant.
+// Omitted or zero limits fall back to the server defaults.
+func UpdateQueryLimits(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		var req tenant.QueryLimits
+		if err := readJSON(r, &req); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := req.Validate(); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		t, err := deps.Provisioner.UpdateQueryLimits(r.Context(), id, req)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				errorResponse(w, http.StatusNotFound, "tenant not found")
+				return
+			}
+			deps.Logger.Error().Err(err).Str("tenant_id", id).Msg("failed to update query limits")
+			errorResponse(w, http.StatusInternalServerError, "failed to update query limits")
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
 // Metrics returns time-series metrics matching the MetricsResponse UI type.
 func Metrics(deps *Dependencies) http.HandlerFunc {
 	type dataPoint struct {
@@ -1,29 +1,180 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	gql "github.com/kapok/kapok/internal/graphql"
 	"github.com/kapok/kapok/internal/tenant"
 )
 
+// gqlRoleHeader selects which of the caller's roles a GraphQL request runs as
+const gqlRoleHeader = "X-Kapok-Role"
+
 // GraphQLProxy extracts tenantId from the URL, loads the tenant, injects it
 // into the request context, and delegates to the existing graphql.Handler.
 func GraphQLProxy(deps *Dependencies) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tenantID := chi.URLParam(r, "tenantId")
-		if tenantID == "" {
-			errorResponse(w, http.StatusBadRequest, "tenantId is required")
+		r, ok := tenantRequest(deps, w, r)
+		if !ok {
 			return
 		}
+		deps.GQLHandler.ServeHTTP(w, r)
+	}
+}
 
-		t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+// GraphQLGet serves GraphQL GET requests. Browsers cannot send an Authorization
+// header with a WebSocket upgrade, so upgrades without one reach the handler with
+// the tenant only; the client authenticates in its connection_init message.
+func GraphQLGet(deps *Dependencies) http.HandlerFunc {
+	authenticated := AuthMiddleware(deps)(GraphQLProxy(deps))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || !websocket.IsWebSocketUpgrade(r) {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+
+		t, err := deps.Provisioner.GetTenantByID(r.Context(), chi.URLParam(r, "tenantId"))
 		if err != nil {
 			errorResponse(w, http.StatusNotFound, "tenant not found")
 			return
 		}
+		deps.GQLHandler.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), t)))
+	}
+}
+
+// GraphQLWebSocketAuthenticator validates the bearer token graphql-ws clients send
+// in connection_init and builds their session like GraphQL requests get theirs.
+// The socket closes when the token expires.
+func GraphQLWebSocketAuthenticator(deps *Dependencies) gql.WebSocketAuthenticator {
+	return func(ctx context.Context, t *tenant.Tenant, token, role string) (*gql.Session, error) {
+		claims, err := deps.JWTManager.ValidateToken(token)
+		if err != nil {
+			return nil, err
+		}
+		if !claimsTenant(claims, t) {
+			return nil, errors.New("token is not valid for this tenant")
+		}
+		session, ok := claimsSession(map[string]interface{}(claims), role, t)
+		if !ok {
+			return nil, errors.New("role not granted")
+		}
+		return session, nil
+	}
+}
 
-		ctx := tenant.WithTenant(r.Context(), t)
-		deps.GQLHandler.ServeHTTP(w, r.WithContext(ctx))
+// tenantRequest loads the tenant of the URL and injects it, with the caller's
+// session, into the request context. It writes the error response and returns
+// false when the tenant is unknown or the caller may not use it.
+func tenantRequest(deps *Dependencies, w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	tenantID := chi.URLParam(r, "tenantId")
+	if tenantID == "" {
+		errorResponse(w, http.StatusBadRequest, "tenantId is required")
+		return nil, false
+	}
+
+	t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+	if err != nil {
+		errorResponse(w, http.StatusNotFound, "tenant not found")
+		return nil, false
+	}
+	return withTenantSession(w, r, t)
+}
+
+// withTenantSession injects the tenant and the caller's session into the
+// request context. It writes the error response and returns false when the
+// token belongs to another tenant or the role is not granted.
+func withTenantSession(w http.ResponseWriter, r *http.Request, t *tenant.Tenant) (*http.Request, bool) {
+	claims, _ := r.Context().Value(claimsContextKey).(map[string]interface{})
+	if !claimsTenant(claims, t) {
+		errorResponse(w, http.StatusForbidden, "forbidden: token is not valid for this tenant")
+		return nil, false
+	}
+
+	session, ok := graphQLSession(r, t)
+	if !ok {
+		errorResponse(w, http.StatusForbidden, "forbidden: role not granted")
+		return nil, false
+	}
+
+	ctx := tenant.WithTenant(r.Context(), t)
+	ctx = gql.WithSession(ctx, session)
+	return r.WithContext(ctx), true
+}
+
+// graphQLSession builds the session GraphQL permissions are evaluated against
+// from the JWT claims. The role is the one asked for in X-Kapok-Role, which the
+// token must grant; otherwise admin when granted, else the token's first role.
+func graphQLSession(r *http.Request, t *tenant.Tenant) (*gql.Session, bool) {
+	claims, _ := r.Context().Value(claimsContextKey).(map[string]interface{})
+	return claimsSession(claims, r.Header.Get(gqlRoleHeader), t)
+}
+
+// claimsTenant reports whether JWT claims may act on tenant t: tenant tokens
+// only on their own tenant, platform admin tokens, which carry the admin role
+// and no tenant, on any
+func claimsTenant(claims map[string]interface{}, t *tenant.Tenant) bool {
+	tenantID, _ := claims["tenant_id"].(string)
+	if tenantID == "" {
+		return hasRole(claims, gql.AdminRole)
+	}
+	return tenantID == t.ID
+}
+
+// claimsSession builds the session of JWT claims running as role, or as the
+// default role of the claims when role is empty
+func claimsSession(claims map[string]interface{}, role string, t *tenant.Tenant) (*gql.Session, bool) {
+	roles := claimRoles(claims)
+	switch {
+	case role != "":
+		if !hasRole(claims, role) {
+			return nil, false
+		}
+	case hasRole(claims, gql.AdminRole):
+		role = gql.AdminRole
+	case len(roles) > 0:
+		role = roles[0]
+	}
+
+	vars := map[string]string{
+		"x-kapok-role":      role,
+		"x-kapok-roles":     strings.Join(roles, ","),
+		"x-kapok-tenant-id": t.ID,
+	}
+	if sub, ok := claims["sub"].(string); ok {
+		vars["x-kapok-user-id"] = sub
+	}
+	if email, ok := claims["email"].(string); ok {
+		vars["x-kapok-user-email"] = email
+	}
+	session := &gql.Session{Role: role, Variables: vars}
+	if exp, err := jwt.MapClaims(claims).GetExpirationTime(); err == nil && exp != nil {
+		session.ExpiresAt = exp.Time
+	}
+	return session, true
+}
+
+// claimRoles lists the roles of JWT claims, in either of the formats hasRole accepts
+func claimRoles(claims map[string]interface{}) []string {
+	var roles []string
+	switch v := claims["roles"].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				roles = append(roles, s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				roles = append(roles, s)
+			}
+		}
 	}
+	return roles
 }
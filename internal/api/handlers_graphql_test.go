@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kapok/kapok/internal/auth"
+	gql "github.com/kapok/kapok/internal/graphql"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testJWTSecret = "test-secret-key-that-is-at-least-32-chars"
+
+func TestWithTenantSession_TenantClaim(t *testing.T) {
+	deps := &Dependencies{JWTManager: auth.NewJWTManager(testJWTSecret)}
+	tenantB := &tenant.Tenant{ID: "tenant-b", SchemaName: "tenant_b"}
+
+	var session *gql.Session
+	handler := AuthMiddleware(deps)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, ok := withTenantSession(w, r, tenantB)
+		if !ok {
+			return
+		}
+		session = gql.SessionFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(user *auth.User) *httptest.ResponseRecorder {
+		token, err := deps.JWTManager.GenerateToken(user, nil)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tenants/tenant-b/graphql", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		session = nil
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A token issued for another tenant is rejected, even with its admin role
+	rec := request(&auth.User{ID: "u1", TenantID: "tenant-a", Roles: []string{gql.AdminRole}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "token is not valid for this tenant")
+	assert.Nil(t, session)
+
+	// A token of the tenant gets its session
+	rec = request(&auth.User{ID: "u2", TenantID: "tenant-b", Roles: []string{"user"}})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	require.NotNil(t, session)
+	assert.Equal(t, "user", session.Role)
+	assert.Equal(t, "tenant-b", session.Variables["x-kapok-tenant-id"])
+
+	// Platform admins are not bound to a tenant; other tenantless tokens are
+	rec = request(&auth.User{ID: "root", Roles: []string{gql.AdminRole}})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	require.NotNil(t, session)
+	assert.Equal(t, gql.AdminRole, session.Role)
+
+	rec = request(&auth.User{ID: "u3", Roles: []string{"user"}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestGraphQLWebSocketAuthenticator_TenantClaim(t *testing.T) {
+	deps := &Dependencies{JWTManager: auth.NewJWTManager(testJWTSecret)}
+	authenticate := GraphQLWebSocketAuthenticator(deps)
+	tenantB := &tenant.Tenant{ID: "tenant-b", SchemaName: "tenant_b"}
+
+	token, err := deps.JWTManager.GenerateToken(&auth.User{ID: "u1", TenantID: "tenant-a", Roles: []string{gql.AdminRole}}, nil)
+	require.NoError(t, err)
+	_, err = authenticate(context.Background(), tenantB, token, "")
+	assert.EqualError(t, err, "token is not valid for this tenant")
+
+	token, err = deps.JWTManager.GenerateToken(&auth.User{ID: "u2", TenantID: "tenant-b", Roles: []string{"user"}}, nil)
+	require.NoError(t, err)
+	session, err := authenticate(context.Background(), tenantB, token, "")
+	require.NoError(t, err)
+	assert.Equal(t, "user", session.Role)
+	assert.WithinDuration(t, time.Now().Add(auth.TokenExpiry), session.ExpiresAt, time.Minute)
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	gql "github.com/kapok/kapok/internal/graphql"
+)
+
+type registerOperationRequest struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+type strictOperationsRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ListOperations returns the persisted operations of a tenant. Pass
+// ?allowlisted=true to skip automatic persisted queries.
+func ListOperations(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+		allowlisted := r.URL.Query().Get("allowlisted") == "true"
+
+		ops, err := deps.Operations.List(r.Context(), tenantID, allowlisted)
+		if err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to list operations")
+			errorResponse(w, http.StatusInternalServerError, "failed to list operations")
+			return
+		}
+		if ops == nil {
+			ops = []*gql.PersistedOperation{}
+		}
+		writeJSON(w, http.StatusOK, ops)
+	}
+}
+
+// RegisterOperation adds an operation to the allowlist of a tenant.
+func RegisterOperation(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		var req registerOperationRequest
+		if err := readJSON(r, &req); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			errorResponse(w, http.StatusBadRequest, "query is required")
+			return
+		}
+
+		if _, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID); err != nil {
+			errorResponse(w, http.StatusNotFound, "tenant not found")
+			return
+		}
+
+		op := &gql.PersistedOperation{
+			TenantID:    tenantID,
+			Name:        req.Name,
+			Query:       req.Query,
+			Allowlisted: true,
+		}
+		if err := deps.Operations.Register(r.Context(), op); err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to register operation")
+			errorResponse(w, http.StatusInternalServerError, "failed to register operation")
+			return
+		}
+		deps.GQLHandler.InvalidateOperation(tenantID, op.Hash)
+		writeJSON(w, http.StatusCreated, op)
+	}
+}
+
+// DeleteOperation removes a persisted operation of a tenant.
+func DeleteOperation(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+		hash := chi.URLParam(r, "hash")
+
+		if err := deps.Operations.Delete(r.Context(), tenantID, hash); err != nil {
+			if errors.Is(err, gql.ErrOperationNotFound) {
+				errorResponse(w, http.StatusNotFound, "operation not found")
+				return
+			}
+			errorResponse(w, http.StatusInternalServerError, "failed to delete operation")
+			return
+		}
+		deps.GQLHandler.InvalidateOperation(tenantID, hash)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	}
+}
+
+// SetStrictOperations turns the allowlist of a tenant on or off. In strict mode
+// the tenant's GraphQL endpoint only runs registered operations.
+func SetStrictOperations(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		var req strictOperationsRequest
+		if err := readJSON(r, &req); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		t, err := deps.Provisioner.SetStrictOperations(r.Context(), id, req.Enabled)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				errorResponse(w, http.StatusNotFound, "tenant not found")
+				return
+			}
+			deps.Logger.Error().Err(err).Str("tenant_id", id).Msg("failed to update strict operations")
+			errorResponse(w, http.StatusInternalServerError, "failed to update strict operations")
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	gql "github.com/kapok/kapok/internal/graphql"
+)
+
+type putPermissionsRequest struct {
+	Tables map[string]gql.TablePermission `json:"tables"`
+}
+
+// ListPermissions returns the role permissions of a tenant.
+func ListPermissions(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		perms, err := deps.Permissions.List(r.Context(), tenantID)
+		if err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to list permissions")
+			errorResponse(w, http.StatusInternalServerError, "failed to list permissions")
+			return
+		}
+		if perms == nil {
+			perms = []*gql.RolePermissions{}
+		}
+		writeJSON(w, http.StatusOK, perms)
+	}
+}
+
+// GetPermissions returns the permissions of one role of a tenant.
+func GetPermissions(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+		role := chi.URLParam(r, "role")
+
+		perms, err := deps.Permissions.Get(r.Context(), tenantID, role)
+		if err != nil {
+			if errors.Is(err, gql.ErrPermissionsNotFound) {
+				errorResponse(w, http.StatusNotFound, "permissions not found")
+				return
+			}
+			errorResponse(w, http.StatusInternalServerError, "failed to get permissions")
+			return
+		}
+		writeJSON(w, http.StatusOK, perms)
+	}
+}
+
+// PutPermissions creates or replaces the permissions of a role. Once a tenant has
+// permissions, roles without any are denied access to its GraphQL endpoint.
+func PutPermissions(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		var req putPermissionsRequest
+		if err := readJSON(r, &req); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		perms := &gql.RolePermissions{
+			TenantID: tenantID,
+			Role:     chi.URLParam(r, "role"),
+			Tables:   req.Tables,
+		}
+		if err := perms.Validate(); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+		if err != nil {
+			errorResponse(w, http.StatusNotFound, "tenant not found")
+			return
+		}
+
+		if err := deps.Permissions.Put(r.Context(), perms); err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to save permissions")
+			errorResponse(w, http.StatusInternalServerError, "failed to save permissions")
+			return
+		}
+		if deps.GQLHandler != nil {
+			deps.GQLHandler.InvalidatePermissions(t.ID, t.SchemaName)
+		}
+		writeJSON(w, http.StatusOK, perms)
+	}
+}
+
+// DeletePermissions removes the permissions of a role.
+func DeletePermissions(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+		role := chi.URLParam(r, "role")
+
+		t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+		if err != nil {
+			errorResponse(w, http.StatusNotFound, "tenant not found")
+			return
+		}
+
+		if err := deps.Permissions.Delete(r.Context(), tenantID, role); err != nil {
+			if errors.Is(err, gql.ErrPermissionsNotFound) {
+				errorResponse(w, http.StatusNotFound, "permissions not found")
+				return
+			}
+			errorResponse(w, http.StatusInternalServerError, "failed to delete permissions")
+			return
+		}
+		if deps.GQLHandler != nil {
+			deps.GQLHandler.InvalidatePermissions(t.ID, t.SchemaName)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	gql "github.com/kapok/kapok/internal/graphql"
+)
+
+// ListRemoteSchemas returns the remote schemas of a tenant.
+func ListRemoteSchemas(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		remotes, err := deps.RemoteSchemas.List(r.Context(), tenantID)
+		if err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to list remote schemas")
+			errorResponse(w, http.StatusInternalServerError, "failed to list remote schemas")
+			return
+		}
+		redacted := make([]*gql.RemoteSchema, 0, len(remotes))
+		for _, remote := range remotes {
+			redacted = append(redacted, remote.Redacted())
+		}
+		writeJSON(w, http.StatusOK, redacted)
+	}
+}
+
+// GetRemoteSchema returns one remote schema of a tenant.
+func GetRemoteSchema(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		remote, err := deps.RemoteSchemas.Get(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "name"))
+		if err != nil {
+			if errors.Is(err, gql.ErrRemoteSchemaNotFound) {
+				errorResponse(w, http.StatusNotFound, "remote schema not found")
+				return
+			}
+			errorResponse(w, http.StatusInternalServerError, "failed to get remote schema")
+			return
+		}
+		writeJSON(w, http.StatusOK, remote.Redacted())
+	}
+}
+
+// PutRemoteSchema creates or replaces a remote schema. The service must answer
+// introspection and its fields, types and joins must fit the tenant's schema.
+// Headers sent as gql.RedactedHeader keep their stored values.
+func PutRemoteSchema(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		var remote gql.RemoteSchema
+		if err := readJSON(r, &remote); err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		remote.TenantID = tenantID
+		remote.Name = chi.URLParam(r, "name")
+		if err := remote.Validate(); err != nil {
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if remote.HasRedactedHeaders() {
+			var stored map[string]string
+			existing, err := deps.RemoteSchemas.Get(r.Context(), tenantID, remote.Name)
+			if err == nil {
+				stored = existing.Headers
+			} else if !errors.Is(err, gql.ErrRemoteSchemaNotFound) {
+				errorResponse(w, http.StatusInternalServerError, "failed to get remote schema")
+				return
+			}
+			if err := gql.RestoreHeaders(remote.Headers, stored); err != nil {
+				errorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+		if err != nil {
+			errorResponse(w, http.StatusNotFound, "tenant not found")
+			return
+		}
+
+		if deps.GQLHandler != nil {
+			if err := deps.GQLHandler.CheckRemoteSchema(r.Context(), t, &remote); err != nil {
+				errorResponse(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		if err := deps.RemoteSchemas.Put(r.Context(), &remote); err != nil {
+			deps.Logger.Error().Err(err).Str("tenant_id", tenantID).Msg("failed to save remote schema")
+			errorResponse(w, http.StatusInternalServerError, "failed to save remote schema")
+			return
+		}
+		if deps.GQLHandler != nil {
+			deps.GQLHandler.InvalidateRemoteSchemas(t.ID, t.SchemaName)
+		}
+		writeJSON(w, http.StatusOK, remote.Redacted())
+	}
+}
+
+// DeleteRemoteSchema removes a remote schema.
+func DeleteRemoteSchema(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := chi.URLParam(r, "id")
+
+		t, err := deps.Provisioner.GetTenantByID(r.Context(), tenantID)
+		if err != nil {
+			errorResponse(w, http.StatusNotFound, "tenant not found")
+			return
+		}
+
+		if err := deps.RemoteSchemas.Delete(r.Context(), tenantID, chi.URLParam(r, "name")); err != nil {
+			if errors.Is(err, gql.ErrRemoteSchemaNotFound) {
+				errorResponse(w, http.StatusNotFound, "remote schema not found")
+				return
+			}
+			errorResponse(w, http.StatusInternalServerError, "failed to delete remote schema")
+			return
+		}
+		if deps.GQLHandler != nil {
+			deps.GQLHandler.InvalidateRemoteSchemas(t.ID, t.SchemaName)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+	}
+}
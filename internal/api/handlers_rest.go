@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RESTProxy serves the REST endpoints of a tenant's tables, which the generated
+// TypeScript SDK calls, through the GraphQL handler. Requests run with the same
+// tenant, role and permissions as GraphQLProxy requests.
+func RESTProxy(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, ok := tenantRequest(deps, w, r)
+		if !ok {
+			return
+		}
+		deps.GQLHandler.ServeREST(w, r, chi.URLParam(r, "table"), chi.URLParam(r, "id"))
+	}
+}
+
+// OpenAPIDocument serves the OpenAPI document of a tenant's REST endpoints, as
+// the caller's role sees them
+func OpenAPIDocument(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, ok := tenantRequest(deps, w, r)
+		if !ok {
+			return
+		}
+		deps.GQLHandler.ServeOpenAPI(w, r, restBaseURL(r))
+	}
+}
+
+// restBaseURL returns the absolute URL of the REST endpoints of the request's
+// tenant, e.g. https://api.example.com/api/v1/tenants/<id>/rest
+func restBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/v1/tenants/%s/rest", scheme, r.Host, url.PathEscape(chi.URLParam(r, "tenantId")))
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	gql "github.com/kapok/kapok/internal/graphql"
+)
+
+// GraphQLSchema serves a tenant's schema, as the caller's role sees it, in the
+// GraphQL schema definition language
+func GraphQLSchema(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, ok := tenantRequest(deps, w, r)
+		if !ok {
+			return
+		}
+		deps.GQLHandler.ServeSDL(w, r)
+	}
+}
+
+// GraphiQL serves the GraphiQL page of a tenant. Browsers open the page without
+// the admin session's token, so the page itself is public and asks GraphiQLAccess
+// whether the token it is handed may use it.
+func GraphiQL(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !deps.GraphiQL.Enabled {
+			errorResponse(w, http.StatusNotFound, "graphiql is disabled")
+			return
+		}
+		base := "/api/v1/tenants/" + url.PathEscape(chi.URLParam(r, "tenantId"))
+		gql.ServeGraphiQL(w, gql.GraphiQLPage{
+			Title:     "Tenant " + chi.URLParam(r, "tenantId"),
+			Endpoint:  base + "/graphql",
+			AccessURL: base + "/graphiql/access",
+			Assets:    deps.GraphiQL.Assets,
+		})
+	}
+}
+
+// GraphiQLAccess answers 204 when the caller's role may use the tenant's
+// GraphiQL page
+func GraphiQLAccess(deps *Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !deps.GraphiQL.Enabled {
+			errorResponse(w, http.StatusNotFound, "graphiql is disabled")
+			return
+		}
+		r, ok := tenantRequest(deps, w, r)
+		if !ok {
+			return
+		}
+		if session := gql.SessionFromContext(r.Context()); session == nil || !deps.GraphiQL.Allows(session.Role) {
+			errorResponse(w, http.StatusForbidden, "forbidden: graphiql is not enabled for this role")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	gql "github.com/kapok/kapok/internal/graphql"
 )
 
 type contextKeyType string
@@ -24,8 +25,9 @@ func NewRouter(deps *Dependencies) http.Handler {
 	r.Use(chimw.RealIP)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   deps.CORSOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", gqlRoleHeader, gql.TransactionHeader, gql.CorrelationHeader},
+		ExposedHeaders:   []string{gql.CorrelationHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -38,6 +40,12 @@ func NewRouter(deps *Dependencies) http.Handler {
 	// Public routes
 	r.Post("/api/v1/auth/login", Login(deps))
 
+	// GraphiQL page; it checks its token against /graphiql/access
+	r.Get("/api/v1/tenants/{tenantId}/graphiql", GraphiQL(deps))
+
+	// GraphQL over GET; graphql-ws upgrades may authenticate in connection_init
+	r.Get("/api/v1/tenants/{tenantId}/graphql", GraphQLGet(deps))
+
 	// Authenticated routes
 	r.Group(func(r chi.Router) {
 		r.Use(AuthMiddleware(deps))
@@ -52,6 +60,31 @@ func NewRouter(deps *Dependencies) http.Handler {
 			r.Get("/api/v1/admin/tenants/{id}", GetTenant(deps))
 			r.Post("/api/v1/admin/tenants", CreateTenant(deps))
 			r.Delete("/api/v1/admin/tenants/{id}", DeleteTenant(deps))
+			r.Put("/api/v1/admin/tenants/{id}/query-limits", UpdateQueryLimits(deps))
+			r.Put("/api/v1/admin/tenants/{id}/strict-operations", SetStrictOperations(deps))
+
+			// Persisted operations (APQ and allowlist)
+			r.Get("/api/v1/admin/tenants/{id}/operations", ListOperations(deps))
+			r.Post("/api/v1/admin/tenants/{id}/operations", RegisterOperation(deps))
+			r.Delete("/api/v1/admin/tenants/{id}/operations/{hash}", DeleteOperation(deps))
+
+			// Per-role GraphQL permissions
+			r.Get("/api/v1/admin/tenants/{id}/permissions", ListPermissions(deps))
+			r.Get("/api/v1/admin/tenants/{id}/permissions/{role}", GetPermissions(deps))
+			r.Put("/api/v1/admin/tenants/{id}/permissions/{role}", PutPermissions(deps))
+			r.Delete("/api/v1/admin/tenants/{id}/permissions/{role}", DeletePermissions(deps))
+
+			// Custom GraphQL actions served by HTTP handlers
+			r.Get("/api/v1/admin/tenants/{id}/actions", ListActions(deps))
+			r.Get("/api/v1/admin/tenants/{id}/actions/{name}", GetAction(deps))
+			r.Put("/api/v1/admin/tenants/{id}/actions/{name}", PutAction(deps))
+			r.Delete("/api/v1/admin/tenants/{id}/actions/{name}", DeleteAction(deps))
+
+			// Remote GraphQL services merged into the tenant schema
+			r.Get("/api/v1/admin/tenants/{id}/remote-schemas", ListRemoteSchemas(deps))
+			r.Get("/api/v1/admin/tenants/{id}/remote-schemas/{name}", GetRemoteSchema(deps))
+			r.Put("/api/v1/admin/tenants/{id}/remote-schemas/{name}", PutRemoteSchema(deps))
+			r.Delete("/api/v1/admin/tenants/{id}/remote-schemas/{name}", DeleteRemoteSchema(deps))
 			r.Get("/api/v1/admin/metrics", Metrics(deps))
 
 			// Backup routes
@@ -64,6 +97,19 @@ func NewRouter(deps *Dependencies) http.Handler {
 
 		// GraphQL proxy
 		r.Post("/api/v1/tenants/{tenantId}/graphql", GraphQLProxy(deps))
+		r.Get("/api/v1/tenants/{tenantId}/graphql/schema.graphql", GraphQLSchema(deps))
+		r.Get("/api/v1/tenants/{tenantId}/graphiql/access", GraphiQLAccess(deps))
+
+		// REST endpoints of the tenant's tables, as called by the TypeScript SDK
+		r.Get("/api/v1/tenants/{tenantId}/rest/{table}", RESTProxy(deps))
+		r.Post("/api/v1/tenants/{tenantId}/rest/{table}", RESTProxy(deps))
+		r.Get("/api/v1/tenants/{tenantId}/rest/{table}/{id}", RESTProxy(deps))
+		r.Put("/api/v1/tenants/{tenantId}/rest/{table}/{id}", RESTProxy(deps))
+		r.Patch("/api/v1/tenants/{tenantId}/rest/{table}/{id}", RESTProxy(deps))
+		r.Delete("/api/v1/tenants/{tenantId}/rest/{table}/{id}", RESTProxy(deps))
+
+		// OpenAPI document of the REST endpoints, for the caller's role
+		r.Get("/api/v1/tenants/{tenantId}/openapi.json", OpenAPIDocument(deps))
 	})
 
 	return r
@@ -23,6 +23,19 @@ type Config struct {
 	SSLMode         string
 }
 
+// ConnectionString builds the lib/pq connection string for this configuration
+func (c Config) ConnectionString() string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		c.Host,
+		c.Port,
+		c.User,
+		c.Password,
+		c.Database,
+		c.SSLMode,
+	)
+}
+
 // DB wraps a sql.DB with additional context and logging
 type DB struct {
 	*sql.DB
@@ -32,19 +45,8 @@ type DB struct {
 
 // NewDB creates a new database connection with connection pooling
 func NewDB(ctx context.Context, config Config, logger zerolog.Logger) (*DB, error) {
-	// Build connection string
-	connStr := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		config.Host,
-		config.Port,
-		config.User,
-		config.Password,
-		config.Database,
-		config.SSLMode,
-	)
-
 	// Open connection
-	sqlDB, err := sql.Open("postgres", connStr)
+	sqlDB, err := sql.Open("postgres", config.ConnectionString())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
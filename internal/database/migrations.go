@@ -118,6 +118,10 @@ func (m *Migrator) CreateControlDatabase(ctx context.Context) error {
 		"ALTER TABLE tenants ADD COLUMN IF NOT EXISTS isolation_level VARCHAR(20) DEFAULT 'schema'",
 		"ALTER TABLE tenants ADD COLUMN IF NOT EXISTS storage_used_bytes BIGINT DEFAULT 0",
 		"ALTER TABLE tenants ADD COLUMN IF NOT EXISTS last_activity TIMESTAMP",
+		"ALTER TABLE tenants ADD COLUMN IF NOT EXISTS max_query_depth INT",
+		"ALTER TABLE tenants ADD COLUMN IF NOT EXISTS max_query_nodes INT",
+		"ALTER TABLE tenants ADD COLUMN IF NOT EXISTS max_query_cost INT",
+		"ALTER TABLE tenants ADD COLUMN IF NOT EXISTS strict_operations BOOLEAN DEFAULT false",
 	}
 	for _, stmt := range tenantExtensions {
 		if _, err := tx.ExecContext(ctx, stmt); err != nil {
@@ -197,6 +201,64 @@ func (m *Migrator) CreateControlDatabase(ctx context.Context) error {
 		return fmt.Errorf("failed to create backup_schedules table: %w", err)
 	}
 
+	// Create persisted_operations table for GraphQL persisted queries and allowlists
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS persisted_operations (
+			tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+			hash VARCHAR(64) NOT NULL,
+			name VARCHAR(256) NOT NULL DEFAULT '',
+			query TEXT NOT NULL,
+			allowlisted BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (tenant_id, hash)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create persisted_operations table: %w", err)
+	}
+
+	// Create tenant_permissions table for per-role GraphQL permissions
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS tenant_permissions (
+			tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+			role VARCHAR(64) NOT NULL,
+			tables JSONB NOT NULL DEFAULT '{}',
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (tenant_id, role)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant_permissions table: %w", err)
+	}
+
+	// Create tenant_actions table for custom GraphQL actions served by HTTP handlers
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS tenant_actions (
+			tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+			name VARCHAR(128) NOT NULL,
+			definition JSONB NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (tenant_id, name)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant_actions table: %w", err)
+	}
+
+	// Create tenant_remote_schemas table for GraphQL services merged into tenant schemas
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS tenant_remote_schemas (
+			tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+			name VARCHAR(128) NOT NULL,
+			definition JSONB NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (tenant_id, name)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant_remote_schemas table: %w", err)
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
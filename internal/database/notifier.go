@@ -0,0 +1,136 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// notifierMinReconnect and notifierMaxReconnect bound the LISTEN connection retry backoff
+	notifierMinReconnect = 1 * time.Second
+	notifierMaxReconnect = 30 * time.Second
+
+	// notifierBuffer is the number of notifications queued per subscriber
+	notifierBuffer = 64
+)
+
+// Notifier multiplexes Postgres LISTEN/NOTIFY channels over a single dedicated
+// connection. Channels are LISTENed while they have at least one subscriber.
+type Notifier struct {
+	listener *pq.Listener
+	logger   zerolog.Logger
+
+	listenMu sync.Mutex
+	mu       sync.Mutex
+	subs     map[string]map[chan *pq.Notification]struct{}
+}
+
+// NewNotifier opens the LISTEN connection for the given configuration
+func NewNotifier(config Config, logger zerolog.Logger) *Notifier {
+	n := &Notifier{
+		logger: logger,
+		subs:   make(map[string]map[chan *pq.Notification]struct{}),
+	}
+	n.listener = pq.NewListener(config.ConnectionString(), notifierMinReconnect, notifierMaxReconnect, n.event)
+	go n.run()
+	return n
+}
+
+// Subscribe starts listening on channel. Notifications are delivered on the
+// returned channel; a nil notification means the connection was re-established
+// and notifications may have been missed. The cancel function must be called
+// once the subscriber is done.
+func (n *Notifier) Subscribe(channel string) (<-chan *pq.Notification, func(), error) {
+	ch := make(chan *pq.Notification, notifierBuffer)
+
+	// listenMu orders LISTEN/UNLISTEN; mu is never held while they run because
+	// the listener blocks on its Notify channel, which run() drains under mu
+	n.listenMu.Lock()
+	defer n.listenMu.Unlock()
+
+	n.mu.Lock()
+	_, listening := n.subs[channel]
+	n.mu.Unlock()
+	if !listening {
+		if err := n.listener.Listen(channel); err != nil && err != pq.ErrChannelAlreadyOpen {
+			return nil, nil, err
+		}
+	}
+
+	n.mu.Lock()
+	if n.subs[channel] == nil {
+		n.subs[channel] = make(map[chan *pq.Notification]struct{})
+	}
+	n.subs[channel][ch] = struct{}{}
+	n.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			n.listenMu.Lock()
+			defer n.listenMu.Unlock()
+
+			n.mu.Lock()
+			subs := n.subs[channel]
+			delete(subs, ch)
+			close(ch)
+			empty := len(subs) == 0
+			if empty {
+				delete(n.subs, channel)
+			}
+			n.mu.Unlock()
+
+			if empty {
+				if err := n.listener.Unlisten(channel); err != nil && err != pq.ErrChannelNotOpen {
+					n.logger.Warn().Err(err).Str("channel", channel).Msg("failed to unlisten")
+				}
+			}
+		})
+	}
+	return ch, cancel, nil
+}
+
+// Close stops listening on all channels
+func (n *Notifier) Close() error {
+	return n.listener.Close()
+}
+
+// run dispatches incoming notifications to the subscribers of their channel
+func (n *Notifier) run() {
+	for notification := range n.listener.Notify {
+		n.mu.Lock()
+		if notification == nil {
+			// Reconnected: every subscriber may have missed notifications
+			for _, subs := range n.subs {
+				n.deliver(subs, nil)
+			}
+		} else {
+			n.deliver(n.subs[notification.Channel], notification)
+		}
+		n.mu.Unlock()
+	}
+}
+
+// deliver sends without blocking so one slow subscriber cannot stall the others
+func (n *Notifier) deliver(subs map[chan *pq.Notification]struct{}, notification *pq.Notification) {
+	for ch := range subs {
+		select {
+		case ch <- notification:
+		default:
+			n.logger.Warn().Msg("notification dropped: subscriber is not keeping up")
+		}
+	}
+}
+
+// event logs connection state changes of the LISTEN connection
+func (n *Notifier) event(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventConnectionAttemptFailed, pq.ListenerEventDisconnected:
+		n.logger.Warn().Err(err).Msg("notification listener connection lost")
+	case pq.ListenerEventReconnected:
+		n.logger.Info().Msg("notification listener reconnected")
+	}
+}
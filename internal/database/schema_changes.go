@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// SchemaChangeChannel is the NOTIFY channel carrying the name of every schema
+	// altered by DDL
+	SchemaChangeChannel = "kapok_schema_changes"
+
+	// SkipSchemaChangeSetting silences the schema change notifications of a
+	// transaction when set to 'on' with SET LOCAL, for DDL issued by Kapok itself
+	// that does not change the shape of a schema (e.g. change triggers)
+	SkipSchemaChangeSetting = "kapok.skip_schema_change"
+
+	// schemaChangeFunction names the event trigger function and prefixes its triggers
+	schemaChangeFunction = "kapok_notify_schema_change"
+)
+
+// schemaChangeSQL returns the statements installing the event triggers that
+// notify SchemaChangeChannel. ddl_command_end covers CREATE and ALTER;
+// dropped objects are only reported to sql_drop.
+func schemaChangeSQL() []string {
+	return []string{
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION public.%[1]s() RETURNS event_trigger AS $$
+DECLARE
+	changed text;
+BEGIN
+	IF current_setting('%[2]s', true) = 'on' THEN
+		RETURN;
+	END IF;
+	IF TG_EVENT = 'sql_drop' THEN
+		FOR changed IN
+			SELECT DISTINCT COALESCE(schema_name, CASE WHEN object_type = 'schema' THEN object_identity END)
+			FROM pg_event_trigger_dropped_objects()
+		LOOP
+			IF changed IS NOT NULL AND changed NOT LIKE 'pg\_%%' AND changed <> 'information_schema' THEN
+				PERFORM pg_notify('%[3]s', changed);
+			END IF;
+		END LOOP;
+	ELSE
+		FOR changed IN
+			SELECT DISTINCT schema_name FROM pg_event_trigger_ddl_commands()
+		LOOP
+			IF changed IS NOT NULL AND changed NOT LIKE 'pg\_%%' AND changed <> 'information_schema' THEN
+				PERFORM pg_notify('%[3]s', changed);
+			END IF;
+		END LOOP;
+	END IF;
+END;
+$$ LANGUAGE plpgsql`, schemaChangeFunction, SkipSchemaChangeSetting, SchemaChangeChannel),
+		fmt.Sprintf(`DROP EVENT TRIGGER IF EXISTS %s_ddl`, schemaChangeFunction),
+		fmt.Sprintf(`CREATE EVENT TRIGGER %[1]s_ddl ON ddl_command_end EXECUTE FUNCTION public.%[1]s()`, schemaChangeFunction),
+		fmt.Sprintf(`DROP EVENT TRIGGER IF EXISTS %s_drop`, schemaChangeFunction),
+		fmt.Sprintf(`CREATE EVENT TRIGGER %[1]s_drop ON sql_drop EXECUTE FUNCTION public.%[1]s()`, schemaChangeFunction),
+	}
+}
+
+// InstallSchemaChangeTriggers installs the event triggers notifying
+// SchemaChangeChannel after DDL in any schema, so every replica can drop the
+// schemas it generated from it. Event triggers require a superuser.
+func (m *Migrator) InstallSchemaChangeTriggers(ctx context.Context) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Reinstalling is DDL too; it changes no tenant schema
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`SET LOCAL %s = 'on'`, SkipSchemaChangeSetting)); err != nil {
+		return fmt.Errorf("failed to install schema change triggers: %w", err)
+	}
+	for _, stmt := range schemaChangeSQL() {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to install schema change triggers: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	m.logger.Info().Str("channel", SchemaChangeChannel).Msg("schema change triggers installed")
+	return nil
+}
@@ -0,0 +1,745 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/kapok/kapok/internal/database"
+	"github.com/kapok/kapok/internal/tenant"
+)
+
+// Root types an action is merged into
+const (
+	ActionQuery    = "query"
+	ActionMutation = "mutation"
+)
+
+const (
+	// DefaultActionTimeout bounds action calls without a timeout of their own
+	DefaultActionTimeout = 30 * time.Second
+
+	// maxActionTimeout bounds the timeout an action may declare
+	maxActionTimeout = 5 * time.Minute
+
+	// maxActionResponseSize bounds the response body of an action handler (10 MB)
+	maxActionResponseSize = 10 << 20
+)
+
+// ErrActionNotFound is returned when a tenant has no action of a name
+var ErrActionNotFound = errors.New("action not found")
+
+var (
+	// graphQLName matches GraphQL names
+	graphQLName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+	// actionErrorCode matches the codes handlers may report their errors with
+	actionErrorCode = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+)
+
+// actionClient calls action handlers; timeouts are set per call
+var actionClient = &http.Client{}
+
+// ActionField is an argument of an action or a field of its output type. Type is
+// a GraphQL type reference such as String!, [Int!] or DateTime, naming a
+// built-in or custom scalar or one of the tenant's enums.
+type ActionField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+// Action is custom business logic of a tenant, served by an HTTP handler and
+// merged into the Query or Mutation root as a field of its name.
+//
+// OutputType is the type reference of the result. When OutputFields are set it
+// names the object type they define, e.g. InviteResult!; other actions may
+// return that type too. Calls POST the arguments and the session variables to
+// HandlerURL with Headers, and the response must match OutputType. Actions run
+// outside of @transaction, since their effects cannot be rolled back.
+//
+// On tenants with permissions, Roles lists the roles besides admin that may
+// call the action.
+type Action struct {
+	TenantID       string            `json:"tenant_id"`
+	Name           string            `json:"name"`
+	Kind           string            `json:"kind"`
+	Description    string            `json:"description,omitempty"`
+	Arguments      []ActionField     `json:"arguments,omitempty"`
+	OutputType     string            `json:"output_type"`
+	OutputFields   []ActionField     `json:"output_fields,omitempty"`
+	HandlerURL     string            `json:"handler_url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	Roles          []string          `json:"roles,omitempty"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// Validate checks the names, type references, handler URL, headers and timeout
+// of the action. Whether the types exist is checked when the schema is generated.
+func (a *Action) Validate() error {
+	if !graphQLName.MatchString(a.Name) || strings.HasPrefix(a.Name, "__") {
+		return fmt.Errorf("invalid action name: %s", a.Name)
+	}
+	if a.Kind != ActionQuery && a.Kind != ActionMutation {
+		return fmt.Errorf("kind must be %s or %s", ActionQuery, ActionMutation)
+	}
+	if err := validateActionFields("argument", a.Arguments); err != nil {
+		return err
+	}
+	if a.OutputType == "" {
+		return fmt.Errorf("output_type is required")
+	}
+	if _, err := parseTypeRef(a.OutputType, func(string) graphql.Type { return graphql.String }); err != nil {
+		return fmt.Errorf("invalid output_type: %w", err)
+	}
+	if len(a.OutputFields) > 0 {
+		if builtinScalars[namedTypeRef(a.OutputType)] {
+			return fmt.Errorf("output type %s is a built-in scalar", namedTypeRef(a.OutputType))
+		}
+		if err := validateActionFields("output field", a.OutputFields); err != nil {
+			return err
+		}
+	}
+	u, err := url.Parse(a.HandlerURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("handler_url must be an absolute http or https URL")
+	}
+	for name := range a.Headers {
+		if !headerName.MatchString(name) {
+			return fmt.Errorf("invalid header name: %s", name)
+		}
+	}
+	if a.TimeoutSeconds < 0 || time.Duration(a.TimeoutSeconds)*time.Second > maxActionTimeout {
+		return fmt.Errorf("timeout_seconds must be between 0 and %d", int(maxActionTimeout/time.Second))
+	}
+	for _, role := range a.Roles {
+		if role == "" {
+			return fmt.Errorf("roles must not be empty")
+		}
+	}
+	return nil
+}
+
+// Redacted returns a copy of the action for API responses, with its header
+// values replaced by RedactedHeader
+func (a *Action) Redacted() *Action {
+	redacted := *a
+	redacted.Headers = RedactHeaders(a.Headers)
+	return &redacted
+}
+
+// HasRedactedHeaders reports whether the values of some headers are to be
+// restored from the stored action
+func (a *Action) HasRedactedHeaders() bool {
+	return hasRedactedHeaders(a.Headers)
+}
+
+func validateActionFields(kind string, fields []ActionField) error {
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if !graphQLName.MatchString(f.Name) || strings.HasPrefix(f.Name, "__") {
+			return fmt.Errorf("invalid %s name: %s", kind, f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate %s: %s", kind, f.Name)
+		}
+		seen[f.Name] = true
+		if _, err := parseTypeRef(f.Type, func(string) graphql.Type { return graphql.String }); err != nil {
+			return fmt.Errorf("invalid type of %s %s: %w", kind, f.Name, err)
+		}
+	}
+	return nil
+}
+
+// timeout returns how long a call of the action may take
+func (a *Action) timeout() time.Duration {
+	if a.TimeoutSeconds <= 0 {
+		return DefaultActionTimeout
+	}
+	return time.Duration(a.TimeoutSeconds) * time.Second
+}
+
+// allows reports whether a role of a tenant with permissions may call the action
+func (a *Action) allows(role string) bool {
+	for _, r := range a.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTypeRef parses a GraphQL type reference such as [String!]!, looking its
+// named type up with lookup
+func parseTypeRef(ref string, lookup func(name string) graphql.Type) (graphql.Type, error) {
+	ref = strings.TrimSpace(ref)
+	if strings.HasSuffix(ref, "!") {
+		inner := strings.TrimSpace(strings.TrimSuffix(ref, "!"))
+		if strings.HasSuffix(inner, "!") {
+			return nil, fmt.Errorf("invalid type %s", ref)
+		}
+		t, err := parseTypeRef(inner, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return graphql.NewNonNull(t), nil
+	}
+	if strings.HasPrefix(ref, "[") && strings.HasSuffix(ref, "]") {
+		t, err := parseTypeRef(ref[1:len(ref)-1], lookup)
+		if err != nil {
+			return nil, err
+		}
+		return graphql.NewList(t), nil
+	}
+	if !graphQLName.MatchString(ref) {
+		return nil, fmt.Errorf("invalid type %s", ref)
+	}
+	t := lookup(ref)
+	if t == nil {
+		return nil, fmt.Errorf("unknown type %s", ref)
+	}
+	return t, nil
+}
+
+// namedTypeRef returns the name a type reference wraps, e.g. Post of [Post!]!
+func namedTypeRef(ref string) string {
+	return strings.Trim(ref, "[]! \t")
+}
+
+// actionScalars returns the types action arguments and output fields may name:
+// the built-in and custom scalars and the tenant's enums
+func (g *SchemaGenerator) actionScalars() map[string]graphql.Type {
+	named := map[string]graphql.Type{
+		"String": graphql.String, "Int": graphql.Int, "Float": graphql.Float,
+		"Boolean": graphql.Boolean, "ID": graphql.ID,
+	}
+	for _, s := range []*graphql.Scalar{JSONScalar, DateTimeScalar, DateScalar, BigIntScalar, DecimalScalar, UUIDScalar, BytesScalar} {
+		named[s.Name()] = s
+	}
+	for _, e := range g.enums {
+		named[e.Name()] = e
+	}
+	return named
+}
+
+// addActionFields adds the fields of the actions to the Query and Mutation roots.
+// Output object types are built first so actions may share them. tableTypes are
+// the type names taken by tables.
+func (g *SchemaGenerator) addActionFields(actions []Action, tableTypes map[string]*graphql.Object, queryFields, mutationFields graphql.Fields) error {
+	scalars := g.actionScalars()
+	lookupScalar := func(name string) graphql.Type { return scalars[name] }
+
+	taken := make(map[string]bool, len(tableTypes))
+	for _, t := range tableTypes {
+		taken[t.Name()] = true
+	}
+
+	objects := make(map[string]*graphql.Object)
+	definedBy := make(map[string]string)
+	for _, action := range actions {
+		if len(action.OutputFields) == 0 {
+			continue
+		}
+		name := namedTypeRef(action.OutputType)
+		if other, ok := definedBy[name]; ok {
+			return fmt.Errorf("action %s: output type %s is already defined by action %s", action.Name, name, other)
+		}
+		if scalars[name] != nil || taken[name] {
+			return fmt.Errorf("action %s: output type %s conflicts with an existing type", action.Name, name)
+		}
+		fields := graphql.Fields{}
+		for _, f := range action.OutputFields {
+			t, err := parseTypeRef(f.Type, lookupScalar)
+			if err != nil {
+				return fmt.Errorf("action %s: output field %s: %w", action.Name, f.Name, err)
+			}
+			fields[f.Name] = &graphql.Field{Type: t.(graphql.Output), Description: f.Description}
+		}
+		objects[name] = graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: fields})
+		definedBy[name] = action.Name
+	}
+	lookupOutput := func(name string) graphql.Type {
+		if obj, ok := objects[name]; ok {
+			return obj
+		}
+		return scalars[name]
+	}
+
+	for _, action := range actions {
+		rootFields, root := queryFields, "Query"
+		if action.Kind == ActionMutation {
+			rootFields, root = mutationFields, "Mutation"
+		}
+		if rootFields[action.Name] != nil {
+			return fmt.Errorf("action %s conflicts with an existing %s field", action.Name, root)
+		}
+
+		args := graphql.FieldConfigArgument{}
+		for _, arg := range action.Arguments {
+			t, err := parseTypeRef(arg.Type, lookupScalar)
+			if err != nil {
+				return fmt.Errorf("action %s: argument %s: %w", action.Name, arg.Name, err)
+			}
+			args[arg.Name] = &graphql.ArgumentConfig{Type: t.(graphql.Input), Description: arg.Description}
+		}
+		output, err := parseTypeRef(action.OutputType, lookupOutput)
+		if err != nil {
+			return fmt.Errorf("action %s: output type: %w", action.Name, err)
+		}
+
+		rootFields[action.Name] = &graphql.Field{
+			Type:        output.(graphql.Output),
+			Args:        args,
+			Description: action.Description,
+			Resolve:     g.resolver.ResolveAction(action, args, output.(graphql.Output)),
+		}
+	}
+	return nil
+}
+
+// ActionError is a failed action call as reported to clients. Handlers may
+// report their own code and message; calls that fail otherwise are reported
+// with ACTION_FAILED or TIMEOUT and logged under CorrelationID.
+type ActionError struct {
+	Action        string
+	Code          string
+	Message       string
+	CorrelationID string
+}
+
+func (e *ActionError) Error() string {
+	return e.Message
+}
+
+// Extensions reports the error details in the GraphQL error's extensions
+func (e *ActionError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code, "action": e.Action}
+	if e.CorrelationID != "" {
+		ext["correlationId"] = e.CorrelationID
+	}
+	return ext
+}
+
+// actionPayload is the body POSTed to action handlers
+type actionPayload struct {
+	Action           actionPayloadName      `json:"action"`
+	Input            map[string]interface{} `json:"input"`
+	SessionVariables map[string]string      `json:"session_variables"`
+}
+
+type actionPayloadName struct {
+	Name string `json:"name"`
+}
+
+// actionHandlerError is the body handlers may answer failed calls with
+type actionHandlerError struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+// ResolveAction returns a function that calls the handler of an action with the
+// field's arguments and the caller's session, and checks its response against
+// the output type
+func (r *Resolver) ResolveAction(action Action, args graphql.FieldConfigArgument, output graphql.Output) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		input := make(map[string]interface{}, len(p.Args))
+		for name, value := range p.Args {
+			if arg, ok := args[name]; ok {
+				input[name] = actionInput(arg.Type, value)
+			}
+		}
+		body, err := json.Marshal(actionPayload{
+			Action:           actionPayloadName{Name: action.Name},
+			Input:            input,
+			SessionVariables: actionSessionVariables(p.Context),
+		})
+		if err != nil {
+			return nil, r.actionError(p.Context, action, ActionFailedCode, fmt.Sprintf("action %s failed", action.Name), err)
+		}
+
+		ctx, cancel := context.WithTimeout(p.Context, action.timeout())
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, action.HandlerURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, r.actionError(p.Context, action, ActionFailedCode, fmt.Sprintf("action %s failed", action.Name), err)
+		}
+		for name, value := range action.Headers {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if id := correlationID(p.Context); id != "" {
+			req.Header.Set(CorrelationHeader, id)
+		}
+
+		resp, err := actionClient.Do(req)
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, r.actionError(p.Context, action, TimeoutCode, fmt.Sprintf("action %s timed out", action.Name), err)
+			}
+			return nil, r.actionError(p.Context, action, ActionFailedCode, fmt.Sprintf("action %s failed", action.Name), err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxActionResponseSize+1))
+		if err == nil && len(data) > maxActionResponseSize {
+			err = fmt.Errorf("response exceeds %d bytes", maxActionResponseSize)
+		}
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, r.actionError(p.Context, action, TimeoutCode, fmt.Sprintf("action %s timed out", action.Name), err)
+			}
+			return nil, r.actionError(p.Context, action, ActionFailedCode, fmt.Sprintf("action %s failed", action.Name), err)
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, r.handlerError(p.Context, action, resp.StatusCode, data)
+		}
+
+		var result interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&result); err != nil {
+			return nil, r.actionError(p.Context, action, ActionFailedCode,
+				fmt.Sprintf("action %s returned an invalid response: not JSON", action.Name), err)
+		}
+		value, err := decodeActionValue(output, result, "result")
+		if err != nil {
+			return nil, r.actionError(p.Context, action, ActionFailedCode,
+				fmt.Sprintf("action %s returned an invalid response: %s", action.Name, err), err)
+		}
+		return value, nil
+	}
+}
+
+// handlerError reports a non-2xx response, with the handler's message and code
+// when it answered with them
+func (r *Resolver) handlerError(ctx context.Context, action Action, status int, body []byte) error {
+	var reported actionHandlerError
+	json.Unmarshal(body, &reported)
+	cause := fmt.Errorf("handler responded with status %d", status)
+
+	code := ActionFailedCode
+	if actionErrorCode.MatchString(reported.Code) {
+		code = reported.Code
+	}
+	message := reported.Message
+	if message == "" {
+		message = fmt.Sprintf("action %s failed with status %d", action.Name, status)
+	}
+	return r.actionError(ctx, action, code, message, cause)
+}
+
+// actionError logs a failed call under the request's correlation ID and returns
+// the error clients see
+func (r *Resolver) actionError(ctx context.Context, action Action, code, message string, cause error) error {
+	e := &ActionError{Action: action.Name, Code: code, Message: message, CorrelationID: correlationID(ctx)}
+	r.logger.Warn().
+		Err(cause).
+		Str("action", action.Name).
+		Str("code", code).
+		Str("correlation_id", e.CorrelationID).
+		Msg("action failed")
+	return e
+}
+
+// actionSessionVariables returns the session variables sent to action handlers
+// and remote schemas, which always include the tenant
+func actionSessionVariables(ctx context.Context) map[string]string {
+	vars := make(map[string]string)
+	if s := SessionFromContext(ctx); s != nil {
+		for name, value := range s.Variables {
+			vars[name] = value
+		}
+		if s.Role != "" {
+			vars["x-kapok-role"] = s.Role
+		}
+	}
+	if t, err := tenant.GetTenant(ctx); err == nil && vars["x-kapok-tenant-id"] == "" {
+		vars["x-kapok-tenant-id"] = t.ID
+	}
+	return vars
+}
+
+// actionInput converts a parsed argument back to its JSON form, e.g. DateTime
+// values to RFC 3339 strings
+func actionInput(t graphql.Input, value interface{}) interface{} {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	if value == nil {
+		return nil
+	}
+	switch t := t.(type) {
+	case *graphql.List:
+		items, ok := value.([]interface{})
+		if !ok {
+			return actionInput(t.OfType, value)
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = actionInput(t.OfType, item)
+		}
+		return out
+	case *graphql.Scalar:
+		return t.Serialize(value)
+	case *graphql.Enum:
+		return t.Serialize(value)
+	}
+	return value
+}
+
+// decodeActionValue checks a handler's response against the output type and
+// parses its scalars and enums. Fields the type does not declare are dropped.
+func decodeActionValue(t graphql.Output, value interface{}, path string) (interface{}, error) {
+	nonNull, required := t.(*graphql.NonNull)
+	if required {
+		t = nonNull.OfType
+	}
+	if value == nil {
+		if required {
+			return nil, fmt.Errorf("%s must not be null", path)
+		}
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *graphql.List:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list", path)
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			v, err := decodeActionValue(t.OfType, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case *graphql.Object:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be an object", path)
+		}
+		out := make(map[string]interface{}, len(t.Fields()))
+		for name, field := range t.Fields() {
+			v, err := decodeActionValue(field.Type, obj[name], path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			out[name] = v
+		}
+		return out, nil
+	case *graphql.Enum:
+		s, _ := value.(string)
+		if v := t.ParseValue(s); s != "" && v != nil {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s must be a %s value", path, t.Name())
+	case *graphql.Scalar:
+		if v := parseActionScalar(t, value); v != nil {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s must be a %s", path, t.Name())
+	}
+	return nil, fmt.Errorf("%s has an unsupported type", path)
+}
+
+// parseActionScalar parses a scalar of a handler's response, decoded with
+// json.Number; it returns nil when the value does not fit the scalar. Built-in
+// scalars are checked strictly instead of being coerced.
+func parseActionScalar(t *graphql.Scalar, value interface{}) interface{} {
+	n, isNumber := value.(json.Number)
+	switch t {
+	case graphql.String:
+		if s, ok := value.(string); ok {
+			return s
+		}
+		return nil
+	case graphql.Boolean:
+		if b, ok := value.(bool); ok {
+			return b
+		}
+		return nil
+	case graphql.ID:
+		if s, ok := value.(string); ok {
+			return s
+		}
+		if i, err := n.Int64(); isNumber && err == nil {
+			return fmt.Sprint(i)
+		}
+		return nil
+	case graphql.Int:
+		if i, err := n.Int64(); isNumber && err == nil && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int(i)
+		}
+		return nil
+	case graphql.Float:
+		if f, err := n.Float64(); isNumber && err == nil {
+			return f
+		}
+		return nil
+	case JSONScalar:
+		return value
+	}
+	if isNumber {
+		// Custom numeric scalars parse numbers from their exact string form
+		if v := t.ParseValue(n.String()); v != nil {
+			return v
+		}
+		if f, err := n.Float64(); err == nil {
+			return t.ParseValue(f)
+		}
+		return nil
+	}
+	return t.ParseValue(value)
+}
+
+// CheckAction generates the tenant's schema with the action added to its
+// actions, or replacing the one of its name, and reports why it cannot be merged
+func (h *Handler) CheckAction(ctx context.Context, t *tenant.Tenant, action *Action) error {
+	var actions []Action
+	if h.actions != nil {
+		existing, err := h.actions.List(ctx, t.ID)
+		if err != nil {
+			return err
+		}
+		for _, a := range existing {
+			if a.Name != action.Name {
+				actions = append(actions, *a)
+			}
+		}
+	}
+	actions = append(actions, *action)
+
+	remotes, err := h.getRemoteSchemas(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	metadata, err := h.introspector.Inspect(ctx, t.SchemaName)
+	if err != nil {
+		return fmt.Errorf("introspection failed: %w", err)
+	}
+	metadata.Actions = actions
+	metadata.RemoteSchemas = remotes
+	_, err = h.generator.Generate(t.SchemaName, metadata)
+	return err
+}
+
+// ActionStore loads the actions of tenants
+type ActionStore interface {
+	List(ctx context.Context, tenantID string) ([]*Action, error)
+}
+
+// ActionRepository stores actions in the control database
+type ActionRepository struct {
+	db *database.DB
+}
+
+// NewActionRepository creates a new action repository
+func NewActionRepository(db *database.DB) *ActionRepository {
+	return &ActionRepository{db: db}
+}
+
+// List returns the actions of a tenant, ordered by name
+func (r *ActionRepository) List(ctx context.Context, tenantID string) ([]*Action, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT tenant_id, name, definition, updated_at
+		FROM tenant_actions WHERE tenant_id = $1
+		ORDER BY name
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list actions: %w", err)
+	}
+	defer rows.Close()
+
+	var actions []*Action
+	for rows.Next() {
+		a, err := scanAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+// Get returns one action of a tenant
+func (r *ActionRepository) Get(ctx context.Context, tenantID, name string) (*Action, error) {
+	a, err := scanAction(r.db.QueryRowContext(ctx, `
+		SELECT tenant_id, name, definition, updated_at
+		FROM tenant_actions WHERE tenant_id = $1 AND name = $2
+	`, tenantID, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrActionNotFound, name)
+	}
+	return a, err
+}
+
+// Put creates or replaces an action
+func (r *ActionRepository) Put(ctx context.Context, a *Action) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	definition, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to encode action: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO tenant_actions (tenant_id, name, definition)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, name) DO UPDATE SET definition = EXCLUDED.definition, updated_at = NOW()
+		RETURNING updated_at
+	`, a.TenantID, a.Name, definition).Scan(&a.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save action: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an action
+func (r *ActionRepository) Delete(ctx context.Context, tenantID, name string) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM tenant_actions WHERE tenant_id = $1 AND name = $2
+	`, tenantID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete action: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrActionNotFound, name)
+	}
+	return nil
+}
+
+// scanAction reads an action; the key columns win over the stored definition
+func scanAction(row rowScanner) (*Action, error) {
+	a := &Action{}
+	var tenantID, name string
+	var definition []byte
+	var updatedAt time.Time
+	if err := row.Scan(&tenantID, &name, &definition, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan action: %w", err)
+	}
+	if err := json.Unmarshal(definition, a); err != nil {
+		return nil, fmt.Errorf("failed to decode action: %w", err)
+	}
+	a.TenantID, a.Name, a.UpdatedAt = tenantID, name, updatedAt
+	return a, nil
+}
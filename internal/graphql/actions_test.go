@@ -0,0 +1,384 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func inviteAction(handlerURL string) Action {
+	return Action{
+		Name:        "sendInvite",
+		Kind:        ActionMutation,
+		Description: "Invites a user by email",
+		Arguments: []ActionField{
+			{Name: "email", Type: "String!"},
+			{Name: "expiresAt", Type: "DateTime"},
+			{Name: "mood", Type: "Mood"},
+		},
+		OutputType: "InviteResult!",
+		OutputFields: []ActionField{
+			{Name: "id", Type: "ID!"},
+			{Name: "sent", Type: "Boolean!"},
+			{Name: "count", Type: "BigInt"},
+			{Name: "mood", Type: "Mood"},
+			{Name: "tags", Type: "[String!]"},
+		},
+		HandlerURL: handlerURL,
+		Headers:    map[string]string{"X-Action-Secret": "s3cret"},
+	}
+}
+
+func actionTestSchema(t *testing.T, actions ...Action) *graphql.Schema {
+	t.Helper()
+	tables := orderTestTables()
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables:  []Table{tables["authors"], tables["posts"]},
+		Enums:   []Enum{{Name: "mood", Values: []string{"happy", "in progress"}}},
+		Actions: actions,
+	})
+	require.NoError(t, err)
+	return schema
+}
+
+func TestAction_Validate(t *testing.T) {
+	valid := inviteAction("https://hooks.example.com/invite")
+	require.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name   string
+		modify func(a *Action)
+		want   string
+	}{
+		{"name", func(a *Action) { a.Name = "send-invite" }, "invalid action name"},
+		{"reserved name", func(a *Action) { a.Name = "__invite" }, "invalid action name"},
+		{"kind", func(a *Action) { a.Kind = "subscription" }, "kind must be"},
+		{"argument name", func(a *Action) { a.Arguments[0].Name = "e mail" }, "invalid argument name"},
+		{"duplicate argument", func(a *Action) { a.Arguments[1].Name = "email" }, "duplicate argument"},
+		{"argument type", func(a *Action) { a.Arguments[0].Type = "String!!" }, "invalid type of argument email"},
+		{"missing output", func(a *Action) { a.OutputType = "" }, "output_type is required"},
+		{"output type", func(a *Action) { a.OutputType = "[Invite" }, "invalid output_type"},
+		{"builtin output object", func(a *Action) { a.OutputType = "String" }, "built-in scalar"},
+		{"handler url", func(a *Action) { a.HandlerURL = "/invite" }, "handler_url"},
+		{"handler scheme", func(a *Action) { a.HandlerURL = "ftp://example.com/invite" }, "handler_url"},
+		{"header", func(a *Action) { a.Headers = map[string]string{"X Secret": "v"} }, "invalid header name"},
+		{"header injection", func(a *Action) { a.Headers = map[string]string{"X-Secret:": "v"} }, "invalid header name"},
+		{"timeout", func(a *Action) { a.TimeoutSeconds = 3600 }, "timeout_seconds"},
+		{"role", func(a *Action) { a.Roles = []string{""} }, "roles must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := inviteAction("https://hooks.example.com/invite")
+			tt.modify(&a)
+			err := a.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	assert.Equal(t, DefaultActionTimeout, valid.timeout())
+	valid.TimeoutSeconds = 5
+	assert.Equal(t, 5*time.Second, valid.timeout())
+}
+
+func TestAction_Redacted(t *testing.T) {
+	a := inviteAction("https://hooks.example.com/invite")
+	a.Headers = map[string]string{"X-Secret": "s3cret"}
+
+	redacted := a.Redacted()
+	assert.Equal(t, map[string]string{"X-Secret": RedactedHeader}, redacted.Headers)
+	assert.Equal(t, "s3cret", a.Headers["X-Secret"], "the stored action is left as is")
+	require.True(t, redacted.HasRedactedHeaders())
+	require.NoError(t, RestoreHeaders(redacted.Headers, a.Headers))
+	assert.Equal(t, a.Headers, redacted.Headers)
+}
+
+func TestParseTypeRef(t *testing.T) {
+	lookup := func(name string) graphql.Type {
+		if name == "Int" {
+			return graphql.Int
+		}
+		return nil
+	}
+	for ref, want := range map[string]string{
+		"Int":      "Int",
+		"Int!":     "Int!",
+		"[Int]":    "[Int]",
+		"[Int!]!":  "[Int!]!",
+		"[[Int]]":  "[[Int]]",
+		" [Int]! ": "[Int]!",
+	} {
+		typ, err := parseTypeRef(ref, lookup)
+		require.NoError(t, err, ref)
+		assert.Equal(t, want, typ.String())
+	}
+	for _, ref := range []string{"", "Int!!", "[Int", "In-t", "Float"} {
+		_, err := parseTypeRef(ref, lookup)
+		assert.Error(t, err, ref)
+	}
+	assert.Equal(t, "Post", namedTypeRef("[Post!]!"))
+}
+
+func TestSchemaGenerator_Actions(t *testing.T) {
+	lookup := inviteAction("https://hooks.example.com/invite")
+	lookup.Name, lookup.Kind = "lookupInvite", ActionQuery
+	lookup.Arguments = []ActionField{{Name: "ids", Type: "[ID!]!"}}
+	lookup.OutputType, lookup.OutputFields = "[InviteResult!]", nil
+	schema := actionTestSchema(t, inviteAction("https://hooks.example.com/invite"), lookup)
+
+	send := schema.MutationType().Fields()["sendInvite"]
+	require.NotNil(t, send)
+	assert.Equal(t, "InviteResult!", send.Type.String())
+	assert.Equal(t, "Invites a user by email", send.Description)
+	args := map[string]string{}
+	for _, arg := range send.Args {
+		args[arg.Name()] = arg.Type.String()
+	}
+	assert.Equal(t, map[string]string{"email": "String!", "expiresAt": "DateTime", "mood": "Mood"}, args)
+
+	// Actions share output types
+	find := schema.QueryType().Fields()["lookupInvite"]
+	require.NotNil(t, find)
+	assert.Equal(t, "[InviteResult!]", find.Type.String())
+	result, ok := schema.Type("InviteResult").(*graphql.Object)
+	require.True(t, ok)
+	assert.Equal(t, "BigInt", result.Fields()["count"].Type.String())
+	assert.Equal(t, "[String!]", result.Fields()["tags"].Type.String())
+
+	// Generated fields are kept
+	assert.NotNil(t, schema.QueryType().Fields()["posts"])
+}
+
+func TestSchemaGenerator_ActionErrors(t *testing.T) {
+	tables := orderTestTables()
+	generate := func(actions ...Action) error {
+		_, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+			Tables:  []Table{tables["authors"], tables["posts"]},
+			Enums:   []Enum{{Name: "mood", Values: []string{"happy", "in progress"}}},
+			Actions: actions,
+		})
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		actions func() []Action
+		want    string
+	}{
+		{"root field", func() []Action {
+			a := inviteAction("https://hooks.example.com")
+			a.Name, a.Kind = "posts", ActionQuery
+			return []Action{a}
+		}, "conflicts with an existing Query field"},
+		{"table type", func() []Action {
+			a := inviteAction("https://hooks.example.com")
+			a.OutputType = "Posts"
+			return []Action{a}
+		}, "output type Posts conflicts"},
+		{"scalar type", func() []Action {
+			a := inviteAction("https://hooks.example.com")
+			a.OutputType = "JSON"
+			return []Action{a}
+		}, "output type JSON conflicts"},
+		{"unknown argument type", func() []Action {
+			a := inviteAction("https://hooks.example.com")
+			a.Arguments = []ActionField{{Name: "post", Type: "Posts"}}
+			return []Action{a}
+		}, "argument post: unknown type Posts"},
+		{"unknown enum", func() []Action {
+			a := inviteAction("https://hooks.example.com")
+			a.Arguments = []ActionField{{Name: "color", Type: "Color"}}
+			return []Action{a}
+		}, "argument color: unknown type Color"},
+		{"unknown output type", func() []Action {
+			a := inviteAction("https://hooks.example.com")
+			a.OutputFields = nil
+			return []Action{a}
+		}, "output type: unknown type InviteResult"},
+		{"output type defined twice", func() []Action {
+			a, b := inviteAction("https://hooks.example.com"), inviteAction("https://hooks.example.com")
+			a.Arguments, b.Arguments = nil, nil
+			a.OutputFields, b.OutputFields = a.OutputFields[:2], b.OutputFields[:2]
+			b.Name = "resendInvite"
+			return []Action{a, b}
+		}, "already defined by action sendInvite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := generate(tt.actions()...)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestRolePermissions_ApplyActions(t *testing.T) {
+	a, b := inviteAction("https://hooks.example.com"), inviteAction("https://hooks.example.com")
+	a.Roles = []string{"author"}
+	b.Name = "resendInvite"
+	metadata := authorPermissions().apply(&SchemaMetadata{Actions: []Action{a, b}})
+	require.Len(t, metadata.Actions, 1)
+	assert.Equal(t, "sendInvite", metadata.Actions[0].Name)
+}
+
+// actionRequest is what the test handlers received
+type actionRequest struct {
+	header  http.Header
+	payload map[string]interface{}
+}
+
+func actionTestServer(t *testing.T, status int, response string) (*httptest.Server, *actionRequest) {
+	t.Helper()
+	received := &actionRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.header = r.Header.Clone()
+		json.NewDecoder(r.Body).Decode(&received.payload)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func runAction(ctx context.Context, schema *graphql.Schema, query string) *graphql.Result {
+	return graphql.Do(graphql.Params{Schema: *schema, RequestString: query, Context: ctx})
+}
+
+func actionContext() context.Context {
+	ctx := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: "t1", SchemaName: "tenant_test"})
+	ctx = withCorrelationID(ctx, "req-1")
+	return WithSession(ctx, &Session{Role: "author", Variables: map[string]string{
+		"x-kapok-user-id": "42",
+		"x-kapok-roles":   "author,editor",
+	}})
+}
+
+func actionErrorExtensions(t *testing.T, result *graphql.Result) map[string]interface{} {
+	t.Helper()
+	require.Len(t, result.Errors, 1)
+	return gqlerrors.FormatError(result.Errors[0]).Extensions
+}
+
+func TestResolveAction(t *testing.T) {
+	srv, received := actionTestServer(t, http.StatusOK,
+		`{"id": 7, "sent": true, "count": 9007199254740993, "mood": "in_progress", "tags": ["a"], "extra": 1}`)
+	schema := actionTestSchema(t, inviteAction(srv.URL))
+
+	result := runAction(actionContext(), schema, `mutation {
+		sendInvite(email: "ada@example.com", expiresAt: "2026-01-02T03:04:05Z", mood: in_progress) { id sent count mood tags }
+	}`)
+	require.Empty(t, result.Errors)
+	assert.Equal(t, map[string]interface{}{"sendInvite": map[string]interface{}{
+		"id": "7", "sent": true, "count": "9007199254740993", "mood": "in_progress", "tags": []interface{}{"a"},
+	}}, result.Data)
+
+	// The handler gets the arguments as clients send them, and the session
+	assert.Equal(t, map[string]interface{}{"name": "sendInvite"}, received.payload["action"])
+	assert.Equal(t, map[string]interface{}{
+		"email": "ada@example.com", "expiresAt": "2026-01-02T03:04:05Z", "mood": "in_progress",
+	}, received.payload["input"])
+	assert.Equal(t, map[string]interface{}{
+		"x-kapok-role":      "author",
+		"x-kapok-roles":     "author,editor",
+		"x-kapok-user-id":   "42",
+		"x-kapok-tenant-id": "t1",
+	}, received.payload["session_variables"])
+	assert.Equal(t, "s3cret", received.header.Get("X-Action-Secret"))
+	assert.Equal(t, "application/json", received.header.Get("Content-Type"))
+	assert.Equal(t, "req-1", received.header.Get(CorrelationHeader))
+}
+
+func TestResolveAction_InvalidResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"not json", `ok`, "not JSON"},
+		{"null result", `null`, "result must not be null"},
+		{"missing field", `{"id": "1"}`, "result.sent must not be null"},
+		{"wrong scalar", `{"id": "1", "sent": "yes"}`, "result.sent must be a Boolean"},
+		{"wrong enum", `{"id": "1", "sent": true, "mood": "sad"}`, "result.mood must be a Mood value"},
+		{"wrong list", `{"id": "1", "sent": true, "tags": "a"}`, "result.tags must be a list"},
+		{"null item", `{"id": "1", "sent": true, "tags": [null]}`, "result.tags[0] must not be null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := actionTestServer(t, http.StatusOK, tt.response)
+			schema := actionTestSchema(t, inviteAction(srv.URL))
+
+			result := runAction(actionContext(), schema, `mutation { sendInvite(email: "a@b.c") { id } }`)
+			ext := actionErrorExtensions(t, result)
+			assert.Contains(t, result.Errors[0].Message, tt.want)
+			assert.Equal(t, ActionFailedCode, ext["code"])
+			assert.Equal(t, "sendInvite", ext["action"])
+			assert.Equal(t, "req-1", ext["correlationId"])
+		})
+	}
+}
+
+func TestResolveAction_HandlerErrors(t *testing.T) {
+	t.Run("reported code", func(t *testing.T) {
+		srv, _ := actionTestServer(t, http.StatusBadRequest, `{"message": "already invited", "code": "ALREADY_INVITED"}`)
+		schema := actionTestSchema(t, inviteAction(srv.URL))
+
+		result := runAction(actionContext(), schema, `mutation { sendInvite(email: "a@b.c") { id } }`)
+		ext := actionErrorExtensions(t, result)
+		assert.Equal(t, "already invited", result.Errors[0].Message)
+		assert.Equal(t, "ALREADY_INVITED", ext["code"])
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		srv, _ := actionTestServer(t, http.StatusInternalServerError, `{"code": "oops <b>"}`)
+		schema := actionTestSchema(t, inviteAction(srv.URL))
+
+		result := runAction(actionContext(), schema, `mutation { sendInvite(email: "a@b.c") { id } }`)
+		ext := actionErrorExtensions(t, result)
+		assert.Equal(t, "action sendInvite failed with status 500", result.Errors[0].Message)
+		assert.Equal(t, ActionFailedCode, ext["code"])
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv, _ := actionTestServer(t, http.StatusOK, `{}`)
+		schema := actionTestSchema(t, inviteAction(srv.URL))
+		srv.Close()
+
+		result := runAction(actionContext(), schema, `mutation { sendInvite(email: "a@b.c") { id } }`)
+		ext := actionErrorExtensions(t, result)
+		assert.Equal(t, "action sendInvite failed", result.Errors[0].Message)
+		assert.Equal(t, ActionFailedCode, ext["code"])
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer srv.Close()
+		defer close(release)
+		// The caller's deadline bounds the call too; graphql.Do would abandon the
+		// execution at that deadline, so the resolver is called directly
+		ctx, cancel := context.WithTimeout(actionContext(), 50*time.Millisecond)
+		defer cancel()
+		action := inviteAction(srv.URL)
+		resolve := NewResolver(nil).ResolveAction(action, graphql.FieldConfigArgument{}, graphql.String)
+		_, err := resolve(graphql.ResolveParams{Context: ctx, Args: map[string]interface{}{}})
+		var actionErr *ActionError
+		require.ErrorAs(t, err, &actionErr)
+		assert.Equal(t, "action sendInvite timed out", actionErr.Message)
+		assert.Equal(t, TimeoutCode, actionErr.Code)
+	})
+}
@@ -0,0 +1,359 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+	"github.com/lib/pq"
+)
+
+// aggregateFunctions lists the per-column aggregates, in the order they are selected
+var aggregateFunctions = []string{"sum", "avg", "min", "max"}
+
+// aggregateCountAlias is the alias of the row count, kept apart from the names of
+// the grouped columns
+const aggregateCountAlias = "__kapok_count"
+
+// aggregateFieldType returns the type of an aggregate of a column. Sums keep the
+// column's type, widened to BigInt for Int columns as Postgres does; averages are
+// Decimal so bigint and numeric columns keep their precision.
+func (g *SchemaGenerator) aggregateFieldType(fn string, col Column) graphql.Type {
+	fieldType := g.getGraphQLType(col.DataType)
+	switch {
+	case fn == "avg":
+		return DecimalScalar
+	case fn == "sum" && fieldType == graphql.Int:
+		return BigIntScalar
+	}
+	return fieldType
+}
+
+// aggregateColumns splits a table's columns into those that can be summed/averaged
+// (numeric) and those that can only be compared with min/max (numeric and dates)
+func (g *SchemaGenerator) aggregateColumns(table Table) (numeric, comparable []Column) {
+	for _, col := range table.Columns {
+		switch g.getGraphQLType(col.DataType) {
+		case graphql.Int, graphql.Float, BigIntScalar, DecimalScalar:
+			numeric = append(numeric, col)
+			comparable = append(comparable, col)
+			continue
+		case DateTimeScalar, DateScalar:
+			comparable = append(comparable, col)
+			continue
+		}
+		// Times of day are exposed as strings but still ordered
+		dataType := strings.ToLower(col.DataType)
+		if strings.HasPrefix(dataType, "time ") || dataType == "time" {
+			comparable = append(comparable, col)
+		}
+	}
+	return numeric, comparable
+}
+
+// buildSelectColumn creates the <Type>SelectColumn enum naming the columns of a table
+func (g *SchemaGenerator) buildSelectColumn(table Table) *graphql.Enum {
+	values := graphql.EnumValueConfigMap{}
+	for _, col := range table.Columns {
+		values[strcase.ToLowerCamel(col.Name)] = &graphql.EnumValueConfig{Value: col.Name}
+	}
+	return graphql.NewEnum(graphql.EnumConfig{
+		Name:   strcase.ToCamel(table.Name) + "SelectColumn",
+		Values: values,
+	})
+}
+
+// buildAggregate creates the <Type>Aggregate object returned by aggregate fields.
+// Each result carries the group keys (when groupBy is used), count, and per-column
+// sum/avg/min/max sub-objects.
+func (g *SchemaGenerator) buildAggregate(table Table) *graphql.Object {
+	typeName := strcase.ToCamel(table.Name)
+	numeric, comparable := g.aggregateColumns(table)
+
+	fields := graphql.Fields{
+		"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	}
+
+	keyFields := graphql.Fields{}
+	for _, col := range table.Columns {
+		keyFields[strcase.ToLowerCamel(col.Name)] = &graphql.Field{Type: g.getGraphQLType(col.DataType)}
+	}
+	fields["keys"] = &graphql.Field{
+		Type: graphql.NewObject(graphql.ObjectConfig{
+			Name:   typeName + "GroupKeys",
+			Fields: keyFields,
+		}),
+	}
+
+	for _, fn := range aggregateFunctions {
+		cols := comparable
+		if fn == "sum" || fn == "avg" {
+			cols = numeric
+		}
+		// GraphQL objects need at least one field
+		if len(cols) == 0 {
+			continue
+		}
+
+		fnFields := graphql.Fields{}
+		for _, col := range cols {
+			fnFields[strcase.ToLowerCamel(col.Name)] = &graphql.Field{Type: g.aggregateFieldType(fn, col)}
+		}
+		fields[fn] = &graphql.Field{
+			Type: graphql.NewObject(graphql.ObjectConfig{
+				Name:   typeName + "Aggregate" + strcase.ToCamel(fn) + "Fields",
+				Fields: fnFields,
+			}),
+		}
+	}
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name:   typeName + "Aggregate",
+		Fields: fields,
+	})
+}
+
+// aggregateArgs returns the arguments accepted by root and relation aggregate fields
+func aggregateArgs(boolExp *graphql.InputObject, selectColumn *graphql.Enum) graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"where": &graphql.ArgumentConfig{
+			Type: boolExp,
+		},
+		"groupBy": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.NewNonNull(selectColumn)),
+		},
+	}
+}
+
+// ResolveAggregate returns a function that computes count/sum/avg/min/max over a table.
+// When fkColumn is set the rows are restricted to the children of the parent object
+// (hasMany aggregate), using parentColumn to read the parent's key; sibling parents
+// are batched into one grouped query when a request loader is available.
+func (r *Resolver) ResolveAggregate(schemaName string, table Table, numeric, comparable []Column, fkColumn, parentColumn string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		// Validate identifiers to prevent SQL injection
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := validateIdentifier(table.Name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+
+		plan, err := newAggregatePlan(numeric, comparable, p.Args)
+		if err != nil {
+			return nil, err
+		}
+		where, _ := p.Args["where"].(map[string]interface{})
+
+		var parentValue interface{}
+		if fkColumn != "" {
+			if err := validateIdentifier(fkColumn); err != nil {
+				return nil, fmt.Errorf("invalid column name")
+			}
+			source, ok := p.Source.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			value, ok := source[strcase.ToLowerCamel(parentColumn)]
+			if !ok || value == nil {
+				return nil, nil
+			}
+			parentValue = value
+
+			// Batch with sibling resolvers when a request loader is available
+			if loader := loaderFromContext(p.Context); loader != nil {
+				return r.loadAggregate(p, loader, schemaName, table, plan, fkColumn, parentValue)
+			}
+		}
+
+		args := &queryArgs{}
+		from, err := tableSource(p.Context, schemaName, table, args)
+		if err != nil {
+			return nil, err
+		}
+		var conds []string
+		if fkColumn != "" {
+			conds = append(conds, fmt.Sprintf(`"%s" = %s`, fkColumn, args.add(parentValue)))
+		}
+		if cond, err := buildWhere(table, where, args); err != nil {
+			return nil, err
+		} else if cond != "" {
+			conds = append(conds, cond)
+		}
+
+		query := plan.query(from, conds, "")
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(p.Context, err, "aggregate query failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read aggregate results")
+		}
+		return plan.results(results), nil
+	}
+}
+
+// aggregateParentAlias is the alias of the parent key in batched hasMany aggregates
+const aggregateParentAlias = "__kapok_parent"
+
+// loadAggregate batches a hasMany aggregate: one query grouped by the foreign key
+// computes the aggregates of every parent of the level
+func (r *Resolver) loadAggregate(p graphql.ResolveParams, l *Loader, schemaName string, table Table, plan *aggregatePlan, fkColumn string, parentValue interface{}) (interface{}, error) {
+	// Fields with different arguments cannot share a batch
+	argsKey, err := json.Marshal(p.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+	batchKey := fmt.Sprintf("aggregate:%s.%s.%s:%s", schemaName, table.Name, fkColumn, argsKey)
+	where, _ := p.Args["where"].(map[string]interface{})
+
+	thunk := l.load(p.Context, batchKey, parentValue, func(ctx context.Context, keys []interface{}) (map[string][]map[string]interface{}, error) {
+		args := &queryArgs{}
+		from, err := tableSource(ctx, schemaName, table, args)
+		if err != nil {
+			return nil, err
+		}
+		conds := []string{fmt.Sprintf(`"%s" = ANY(%s)`, fkColumn, args.add(pq.Array(keys)))}
+		if cond, err := buildWhere(table, where, args); err != nil {
+			return nil, err
+		} else if cond != "" {
+			conds = append(conds, cond)
+		}
+
+		query := plan.query(from, conds, fkColumn)
+		rows, err := r.conn(ctx).QueryContext(ctx, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(ctx, err, "aggregate query failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read aggregate results")
+		}
+		return groupRows(results, strcase.ToLowerCamel(aggregateParentAlias)), nil
+	})
+
+	return func() (interface{}, error) {
+		rows, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		// Without groups every parent has one aggregate, even without children
+		if len(rows) == 0 && len(plan.groupCols) == 0 {
+			rows = []map[string]interface{}{{strcase.ToLowerCamel(aggregateCountAlias): 0}}
+		}
+		return plan.results(rows), nil
+	}, nil
+}
+
+// aggregatePlan is the select list of an aggregate query: the group keys, the
+// count, then one expression per aggregate and column
+type aggregatePlan struct {
+	groupCols []string
+	selects   []string
+	slots     []aggregateSlot
+}
+
+// aggregateSlot maps a selected aggregate back to its place in the result
+type aggregateSlot struct {
+	fn    string
+	field string
+	key   string
+}
+
+// newAggregatePlan builds the select list of an aggregate field's arguments
+func newAggregatePlan(numeric, comparable []Column, fieldArgs map[string]interface{}) (*aggregatePlan, error) {
+	plan := &aggregatePlan{}
+
+	// groupBy values come from the SelectColumn enum, i.e. raw column names
+	if groupBy, ok := fieldArgs["groupBy"].([]interface{}); ok {
+		for _, v := range groupBy {
+			col, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid groupBy column")
+			}
+			if err := validateIdentifier(col); err != nil {
+				return nil, fmt.Errorf("invalid groupBy column")
+			}
+			plan.groupCols = append(plan.groupCols, col)
+			plan.selects = append(plan.selects, fmt.Sprintf(`"%s"`, col))
+		}
+	}
+
+	plan.selects = append(plan.selects, fmt.Sprintf(`COUNT(*) AS "%s"`, aggregateCountAlias))
+	for _, fn := range aggregateFunctions {
+		cols := comparable
+		if fn == "sum" || fn == "avg" {
+			cols = numeric
+		}
+		for _, col := range cols {
+			if err := validateIdentifier(col.Name); err != nil {
+				return nil, fmt.Errorf("invalid column name")
+			}
+			expr := fmt.Sprintf(`%s("%s")`, strings.ToUpper(fn), col.Name)
+			if fn == "avg" {
+				// Averages of float columns are float8 otherwise
+				expr += "::numeric"
+			}
+			// Positional aliases keep identical function names from colliding
+			alias := fmt.Sprintf("__kapok_agg_%d", len(plan.slots))
+			plan.selects = append(plan.selects, fmt.Sprintf(`%s AS "%s"`, expr, alias))
+			plan.slots = append(plan.slots, aggregateSlot{fn: fn, field: strcase.ToLowerCamel(col.Name), key: strcase.ToLowerCamel(alias)})
+		}
+	}
+	return plan, nil
+}
+
+// query renders the aggregate query over from. A parent column groups the rows
+// per parent first, selected as aggregateParentAlias.
+func (plan *aggregatePlan) query(from string, conds []string, parentColumn string) string {
+	selects := plan.selects
+	var groups []string
+	if parentColumn != "" {
+		selects = append([]string{fmt.Sprintf(`"%s" AS "%s"`, parentColumn, aggregateParentAlias)}, selects...)
+		groups = append(groups, fmt.Sprintf(`"%s"`, parentColumn))
+	}
+	groups = append(groups, plan.selects[:len(plan.groupCols)]...)
+
+	query := fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(selects, ", "), from)
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if len(groups) > 0 {
+		quoted := strings.Join(groups, ", ")
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", quoted, quoted)
+	}
+	return query
+}
+
+// results reshapes the flat rows into Aggregate objects
+func (plan *aggregatePlan) results(rows []map[string]interface{}) []map[string]interface{} {
+	aggregates := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		keys := make(map[string]interface{})
+		for _, col := range plan.groupCols {
+			field := strcase.ToLowerCamel(col)
+			keys[field] = row[field]
+		}
+
+		entry := map[string]interface{}{
+			"keys":  keys,
+			"count": row[strcase.ToLowerCamel(aggregateCountAlias)],
+		}
+		for _, fn := range aggregateFunctions {
+			entry[fn] = make(map[string]interface{})
+		}
+		for _, slot := range plan.slots {
+			entry[slot.fn].(map[string]interface{})[slot.field] = row[slot.key]
+		}
+		aggregates = append(aggregates, entry)
+	}
+	return aggregates
+}
@@ -0,0 +1,104 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateColumns(t *testing.T) {
+	gen := NewSchemaGenerator(NewResolver(nil))
+	tables := orderTestTables()
+
+	numeric, comparable := gen.aggregateColumns(tables["posts"])
+
+	var numericNames, comparableNames []string
+	for _, c := range numeric {
+		numericNames = append(numericNames, c.Name)
+	}
+	for _, c := range comparable {
+		comparableNames = append(comparableNames, c.Name)
+	}
+	assert.Equal(t, []string{"id", "author_id"}, numericNames)
+	assert.Equal(t, []string{"id", "created_at", "author_id"}, comparableNames)
+}
+
+func TestAggregateFieldType(t *testing.T) {
+	gen := NewSchemaGenerator(NewResolver(nil))
+	cases := []struct {
+		fn, dataType string
+		expected     graphql.Type
+	}{
+		{"sum", "integer", BigIntScalar},
+		{"sum", "bigint", BigIntScalar},
+		{"sum", "numeric", DecimalScalar},
+		{"sum", "double precision", graphql.Float},
+		{"avg", "bigint", DecimalScalar},
+		{"avg", "real", DecimalScalar},
+		{"min", "integer", graphql.Int},
+		{"max", "timestamp with time zone", DateTimeScalar},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, gen.aggregateFieldType(tc.fn, Column{Name: "x", DataType: tc.dataType}), tc.fn+" "+tc.dataType)
+	}
+}
+
+func TestGenerate_AggregateFields(t *testing.T) {
+	gen := NewSchemaGenerator(NewResolver(nil))
+	tables := orderTestTables()
+	schema, err := gen.Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{tables["authors"], tables["posts"]},
+	})
+	require.NoError(t, err)
+
+	root := schema.QueryType().Fields()["postsAggregate"]
+	require.NotNil(t, root, "postsAggregate root field should be generated")
+
+	aggregate, ok := schema.Type("PostsAggregate").(*graphql.Object)
+	require.True(t, ok)
+	for _, name := range []string{"count", "keys", "sum", "avg", "min", "max"} {
+		assert.Contains(t, aggregate.Fields(), name)
+	}
+
+	sum := schema.Type("PostsAggregateSumFields").(*graphql.Object).Fields()
+	assert.Equal(t, BigIntScalar, sum["id"].Type, "sums of Int columns outgrow 32 bits")
+	avg := schema.Type("PostsAggregateAvgFields").(*graphql.Object).Fields()
+	assert.Equal(t, DecimalScalar, avg["id"].Type)
+
+	authors, ok := schema.Type("Authors").(*graphql.Object)
+	require.True(t, ok)
+	assert.Contains(t, authors.Fields(), "postsAggregate", "hasMany relations expose a nested aggregate")
+}
+
+func TestAggregatePlan_GroupsByParent(t *testing.T) {
+	table := filterTestTable()
+	plan, err := newAggregatePlan(table.Columns[2:3], table.Columns[:1], map[string]interface{}{
+		"groupBy": []interface{}{"is_published"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		`SELECT "author_id" AS "__kapok_parent", "is_published", COUNT(*) AS "__kapok_count", SUM("view_count") AS "__kapok_agg_0", AVG("view_count")::numeric AS "__kapok_agg_1", MIN("id") AS "__kapok_agg_2", MAX("id") AS "__kapok_agg_3" FROM "tenant_test"."posts" WHERE "author_id" = ANY($1) GROUP BY "author_id", "is_published" ORDER BY "author_id", "is_published"`,
+		plan.query(`"tenant_test"."posts"`, []string{`"author_id" = ANY($1)`}, "author_id"))
+	assert.Equal(t,
+		`SELECT "is_published", COUNT(*) AS "__kapok_count", SUM("view_count") AS "__kapok_agg_0", AVG("view_count")::numeric AS "__kapok_agg_1", MIN("id") AS "__kapok_agg_2", MAX("id") AS "__kapok_agg_3" FROM "tenant_test"."posts" GROUP BY "is_published" ORDER BY "is_published"`,
+		plan.query(`"tenant_test"."posts"`, nil, ""))
+
+	results := plan.results([]map[string]interface{}{
+		{
+			strcase.ToLowerCamel(aggregateParentAlias): int64(1),
+			"isPublished": true,
+			strcase.ToLowerCamel(aggregateCountAlias): int64(2),
+			strcase.ToLowerCamel("__kapok_agg_0"):     int64(7),
+			strcase.ToLowerCamel("__kapok_agg_3"):     int64(9),
+		},
+	})
+	require.Len(t, results, 1)
+	assert.Equal(t, map[string]interface{}{"isPublished": true}, results[0]["keys"])
+	assert.Equal(t, int64(2), results[0]["count"])
+	assert.Equal(t, int64(7), results[0]["sum"].(map[string]interface{})["viewCount"])
+	assert.Equal(t, int64(9), results[0]["max"].(map[string]interface{})["id"])
+}
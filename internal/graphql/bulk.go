@@ -0,0 +1,424 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+// maxQueryParams is Postgres' limit on bind parameters per statement; bulk
+// inserts are split into statements below it, inside the same transaction
+const maxQueryParams = 65535
+
+// buildMutationResponse creates the <Type>MutationResponse object returned by bulk mutations
+func (g *SchemaGenerator) buildMutationResponse(table Table, nodeType *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: strcase.ToCamel(table.Name) + "MutationResponse",
+		Fields: graphql.Fields{
+			"affectedRows": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"returning":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(nodeType)))},
+		},
+	})
+}
+
+// buildInsertInput creates the <Type>InsertInput object used by insert<Type>Many.
+// Columns are required on the same terms as the create<Type> arguments.
+func (g *SchemaGenerator) buildInsertInput(table Table, pkName string) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for _, col := range table.Columns {
+		if !table.writable(col.Name) {
+			continue
+		}
+		fieldType := g.getGraphQLType(col.DataType)
+		if !col.IsNullable && !col.HasDefault && col.Name != pkName && col.Name != "created_at" && col.Name != "updated_at" {
+			fieldType = graphql.NewNonNull(fieldType)
+		}
+		fields[strcase.ToLowerCamel(col.Name)] = &graphql.InputObjectFieldConfig{Type: fieldType}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   strcase.ToCamel(table.Name) + "InsertInput",
+		Fields: fields,
+	})
+}
+
+// buildSetInput creates the <Type>SetInput object used by update<Type>Many;
+// every column except the primary key is optional
+func (g *SchemaGenerator) buildSetInput(table Table, pkName string) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for _, col := range table.Columns {
+		if col.Name == pkName || !table.writable(col.Name) {
+			continue
+		}
+		fields[strcase.ToLowerCamel(col.Name)] = &graphql.InputObjectFieldConfig{Type: g.getGraphQLType(col.DataType)}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   strcase.ToCamel(table.Name) + "SetInput",
+		Fields: fields,
+	})
+}
+
+// buildOnConflict creates the <Type>OnConflict input naming an upsert target and
+// the columns to overwrite. It returns nil for tables without unique constraints.
+func (g *SchemaGenerator) buildOnConflict(table Table, selectColumn *graphql.Enum) *graphql.InputObject {
+	typeName := strcase.ToCamel(table.Name)
+
+	values := graphql.EnumValueConfigMap{}
+	for _, c := range table.Constraints {
+		// Constraint names become enum values, so they must be valid GraphQL names
+		if validateIdentifier(c.Name) != nil {
+			continue
+		}
+		values[c.Name] = &graphql.EnumValueConfig{Value: c.Name}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	constraintEnum := graphql.NewEnum(graphql.EnumConfig{
+		Name:   typeName + "Constraint",
+		Values: values,
+	})
+
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: typeName + "OnConflict",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"constraint": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewNonNull(constraintEnum),
+			},
+			// An empty list turns the upsert into DO NOTHING
+			"updateColumns": &graphql.InputObjectFieldConfig{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(selectColumn))),
+			},
+		},
+	})
+}
+
+// columnValues maps the GraphQL field names of an input object to column names
+func columnValues(table Table, input map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(input))
+	for field, val := range input {
+		col, ok := findColumn(table, field)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s", field)
+		}
+		if err := validateIdentifier(col.Name); err != nil {
+			return nil, fmt.Errorf("invalid column name")
+		}
+		values[col.Name] = val
+	}
+	return values, nil
+}
+
+// buildOnConflictClause renders ON CONFLICT for an onConflict argument value
+func buildOnConflictClause(table Table, value interface{}) (string, error) {
+	onConflict, ok := value.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+
+	constraint, _ := onConflict["constraint"].(string)
+	known := false
+	for _, c := range table.Constraints {
+		if c.Name == constraint {
+			known = true
+			break
+		}
+	}
+	if !known || validateIdentifier(constraint) != nil {
+		return "", fmt.Errorf("invalid conflict constraint")
+	}
+
+	updateColumns, _ := onConflict["updateColumns"].([]interface{})
+	if len(updateColumns) == 0 {
+		return fmt.Sprintf(` ON CONFLICT ON CONSTRAINT "%s" DO NOTHING`, constraint), nil
+	}
+
+	sets := make([]string, 0, len(updateColumns))
+	for _, v := range updateColumns {
+		col, _ := v.(string)
+		if err := validateIdentifier(col); err != nil || !table.writable(col) {
+			return "", fmt.Errorf("invalid update column")
+		}
+		sets = append(sets, fmt.Sprintf(`"%s" = EXCLUDED."%s"`, col, col))
+	}
+	return fmt.Sprintf(` ON CONFLICT ON CONSTRAINT "%s" DO UPDATE SET %s`, constraint, strings.Join(sets, ", ")), nil
+}
+
+// buildInsertStatements renders multi-row INSERTs for the given rows, split so no
+// statement exceeds the bind parameter limit once reserved more parameters are
+// added to it. Columns missing from a row use DEFAULT.
+func buildInsertStatements(schemaName string, table Table, rows []map[string]interface{}, conflict string, reserved int) ([]string, [][]interface{}, error) {
+	var cols []string
+	for _, col := range table.Columns {
+		for _, row := range rows {
+			if _, ok := row[col.Name]; ok {
+				cols = append(cols, col.Name)
+				break
+			}
+		}
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("no columns provided")
+	}
+
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = fmt.Sprintf(`"%s"`, col)
+	}
+
+	perStatement := (maxQueryParams - reserved) / len(cols)
+	if perStatement < 1 {
+		return nil, nil, fmt.Errorf("too many columns for a single insert")
+	}
+	var queries []string
+	var params [][]interface{}
+	for start := 0; start < len(rows); start += perStatement {
+		end := start + perStatement
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		args := &queryArgs{}
+		tuples := make([]string, 0, end-start)
+		for _, row := range rows[start:end] {
+			placeholders := make([]string, len(cols))
+			for i, col := range cols {
+				if val, ok := row[col]; ok {
+					placeholders[i] = args.add(val)
+				} else {
+					placeholders[i] = "DEFAULT"
+				}
+			}
+			tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
+		}
+
+		queries = append(queries, fmt.Sprintf(`INSERT INTO "%s"."%s" (%s) VALUES %s%s RETURNING *`,
+			schemaName, table.Name, strings.Join(quoted, ", "), strings.Join(tuples, ", "), conflict))
+		params = append(params, args.values)
+	}
+	return queries, params, nil
+}
+
+// inTx runs fn in a transaction, committing only when it succeeds. Within an
+// operation transaction fn joins it, and the operation commits or rolls back.
+func (r *Resolver) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if tx := operationTx(ctx); tx != nil {
+		return fn(tx)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction")
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction")
+	}
+	return nil
+}
+
+// queryTx runs a RETURNING statement inside tx and reads the returned rows
+func (r *Resolver) queryTx(ctx context.Context, tx *sql.Tx, query string, args []interface{}) ([]map[string]interface{}, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := r.scanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	return results, rows.Err()
+}
+
+// mutationResponse builds the <Type>MutationResponse value for the returned rows
+func mutationResponse(rows []map[string]interface{}) map[string]interface{} {
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"affectedRows": len(rows),
+		"returning":    rows,
+	}
+}
+
+// ResolveInsertMany returns a function that inserts (or upserts) many records in one transaction
+func (r *Resolver) ResolveInsertMany(schemaName string, table Table) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		// Validate identifiers to prevent SQL injection
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := validateIdentifier(table.Name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+
+		objects, _ := p.Args["objects"].([]interface{})
+		if len(objects) == 0 {
+			return mutationResponse(nil), nil
+		}
+
+		rows := make([]map[string]interface{}, 0, len(objects))
+		for _, obj := range objects {
+			input, ok := obj.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("objects must be a list of input objects")
+			}
+			values, err := columnValues(table, input)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, values)
+		}
+
+		conflict, err := buildOnConflictClause(table, p.Args["onConflict"])
+		if err != nil {
+			return nil, err
+		}
+
+		// Each statement gets the parameters of the role's row check too
+		reserved, err := rowCheckParams(p.Context, table)
+		if err != nil {
+			return nil, err
+		}
+		queries, params, err := buildInsertStatements(schemaName, table, rows, conflict, reserved)
+		if err != nil {
+			return nil, err
+		}
+
+		var returning []map[string]interface{}
+		err = r.inTx(p.Context, func(tx *sql.Tx) error {
+			for i, query := range queries {
+				// Inserted rows must match the role's row filter
+				args := &queryArgs{values: params[i]}
+				query, err := withRowCheck(p.Context, table, query, args)
+				if err != nil {
+					return err
+				}
+				results, err := r.queryTx(p.Context, tx, query, args.values)
+				if err != nil {
+					return r.dbError(p.Context, err, "insert failed")
+				}
+				if err := checkRows(table, results); err != nil {
+					return err
+				}
+				returning = append(returning, results...)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mutationResponse(returning), nil
+	}
+}
+
+// ResolveUpdateMany returns a function that updates every record matching a where filter
+func (r *Resolver) ResolveUpdateMany(schemaName string, table Table) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		// Validate identifiers to prevent SQL injection
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := validateIdentifier(table.Name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+
+		set, _ := p.Args["set"].(map[string]interface{})
+		values, err := columnValues(table, set)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no fields to update")
+		}
+
+		args := &queryArgs{}
+		var setClauses []string
+		for _, col := range table.Columns {
+			if val, ok := values[col.Name]; ok {
+				setClauses = append(setClauses, fmt.Sprintf(`"%s" = %s`, col.Name, args.add(val)))
+			}
+		}
+		if bump := versionBump(table, values); bump != "" {
+			setClauses = append(setClauses, bump)
+		}
+
+		query := fmt.Sprintf(`UPDATE "%s"."%s" SET %s`, schemaName, table.Name, strings.Join(setClauses, ", "))
+		where, _ := p.Args["where"].(map[string]interface{})
+		cond, err := filteredWhere(p.Context, table, where, args)
+		if err != nil {
+			return nil, err
+		}
+		if cond != "" {
+			query += " WHERE " + cond
+		}
+		query += " RETURNING *"
+
+		// Updated rows must still match the role's row filter
+		query, err = withRowCheck(p.Context, table, query, args)
+		if err != nil {
+			return nil, err
+		}
+
+		var returning []map[string]interface{}
+		err = r.inTx(p.Context, func(tx *sql.Tx) error {
+			var err error
+			returning, err = r.queryTx(p.Context, tx, query, args.values)
+			if err != nil {
+				return r.dbError(p.Context, err, "update failed")
+			}
+			return checkRows(table, returning)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mutationResponse(returning), nil
+	}
+}
+
+// ResolveDeleteMany returns a function that deletes every record matching a where filter
+func (r *Resolver) ResolveDeleteMany(schemaName string, table Table) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		// Validate identifiers to prevent SQL injection
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := validateIdentifier(table.Name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+
+		args := &queryArgs{}
+		query := fmt.Sprintf(`DELETE FROM "%s"."%s"`, schemaName, table.Name)
+		where, _ := p.Args["where"].(map[string]interface{})
+		cond, err := filteredWhere(p.Context, table, where, args)
+		if err != nil {
+			return nil, err
+		}
+		if cond != "" {
+			query += " WHERE " + cond
+		}
+		query += " RETURNING *"
+
+		var returning []map[string]interface{}
+		err = r.inTx(p.Context, func(tx *sql.Tx) error {
+			var err error
+			returning, err = r.queryTx(p.Context, tx, query, args.values)
+			if err != nil {
+				return r.dbError(p.Context, err, "delete failed")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mutationResponse(returning), nil
+	}
+}
@@ -0,0 +1,110 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bulkTestTable() Table {
+	table := filterTestTable()
+	table.Constraints = []Constraint{
+		{Name: "posts_pkey", Columns: []string{"id"}},
+		{Name: "posts_title_key", Columns: []string{"title"}},
+	}
+	return table
+}
+
+func TestBuildInsertStatements_FillsDefaults(t *testing.T) {
+	queries, params, err := buildInsertStatements("tenant_test", bulkTestTable(), []map[string]interface{}{
+		{"title": "a", "view_count": 1},
+		{"title": "b"},
+	}, "", 0)
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+
+	assert.Equal(t,
+		`INSERT INTO "tenant_test"."posts" ("title", "view_count") VALUES ($1, $2), ($3, DEFAULT) RETURNING *`,
+		queries[0])
+	assert.Equal(t, []interface{}{"a", 1, "b"}, params[0])
+}
+
+func TestBuildInsertStatements_SplitsAtParameterLimit(t *testing.T) {
+	rows := make([]map[string]interface{}, maxQueryParams/2+1)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"title": "t", "view_count": i}
+	}
+
+	queries, params, err := buildInsertStatements("tenant_test", bulkTestTable(), rows, "", 0)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	assert.Len(t, params[0], maxQueryParams-1)
+	assert.Len(t, params[1], 2)
+
+	_, _, err = buildInsertStatements("tenant_test", bulkTestTable(), []map[string]interface{}{{}}, "", 0)
+	assert.Error(t, err)
+}
+
+func TestBuildInsertStatements_ReservesRowCheckParams(t *testing.T) {
+	table := bulkTestTable()
+	table.access = &tableAccess{
+		filter:  map[string]interface{}{"title": map[string]interface{}{"_in": []interface{}{"a", "b", "x-kapok-user-id"}}},
+		columns: table.Columns,
+	}
+	ctx := WithSession(context.Background(), &Session{Role: "user", Variables: map[string]string{"x-kapok-user-id": "u1"}})
+	reserved, err := rowCheckParams(ctx, table)
+	require.NoError(t, err)
+	require.Equal(t, 3, reserved)
+
+	rows := make([]map[string]interface{}, maxQueryParams/2)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"title": "t", "view_count": i}
+	}
+	queries, params, err := buildInsertStatements("tenant_test", table, rows, "", reserved)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	for i, query := range queries {
+		args := &queryArgs{values: params[i]}
+		_, err := withRowCheck(ctx, table, query, args)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(args.values), maxQueryParams)
+	}
+}
+
+func TestBuildOnConflictClause(t *testing.T) {
+	table := bulkTestTable()
+
+	clause, err := buildOnConflictClause(table, map[string]interface{}{
+		"constraint":    "posts_title_key",
+		"updateColumns": []interface{}{"view_count", "is_published"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t,
+		` ON CONFLICT ON CONSTRAINT "posts_title_key" DO UPDATE SET "view_count" = EXCLUDED."view_count", "is_published" = EXCLUDED."is_published"`,
+		clause)
+
+	clause, err = buildOnConflictClause(table, map[string]interface{}{
+		"constraint":    "posts_pkey",
+		"updateColumns": []interface{}{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ` ON CONFLICT ON CONSTRAINT "posts_pkey" DO NOTHING`, clause)
+
+	clause, err = buildOnConflictClause(table, nil)
+	require.NoError(t, err)
+	assert.Empty(t, clause)
+
+	_, err = buildOnConflictClause(table, map[string]interface{}{"constraint": "other_key"})
+	assert.Error(t, err)
+}
+
+func TestColumnValues(t *testing.T) {
+	values, err := columnValues(bulkTestTable(), map[string]interface{}{"viewCount": 3, "isPublished": nil})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"view_count": 3, "is_published": nil}, values)
+
+	_, err = columnValues(bulkTestTable(), map[string]interface{}{"unknown": 1})
+	assert.Error(t, err)
+}
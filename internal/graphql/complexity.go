@@ -0,0 +1,391 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/kapok/kapok/internal/tenant"
+)
+
+// Server-wide query limits, used for tenants that do not configure their own
+const (
+	DefaultMaxQueryDepth = 10
+	DefaultMaxQueryNodes = 500
+	DefaultMaxQueryCost  = 50000
+)
+
+// costCeiling caps estimates so nested lists cannot overflow
+const costCeiling = 1 << 30
+
+// QueryLimitExceededCode is the extensions.code of operations rejected by the limits
+const QueryLimitExceededCode = "QUERY_LIMIT_EXCEEDED"
+
+// DefaultQueryLimits returns the server-wide query limits
+func DefaultQueryLimits() tenant.QueryLimits {
+	return tenant.QueryLimits{
+		MaxDepth: DefaultMaxQueryDepth,
+		MaxNodes: DefaultMaxQueryNodes,
+		MaxCost:  DefaultMaxQueryCost,
+	}
+}
+
+// QueryCost is the static estimate of an operation, computed before it runs.
+//
+// Depth is the deepest field nesting and Nodes the number of fields selected,
+// with fragments expanded. Cost estimates the rows fetched: an object field costs
+// one plus its children, and paginated fields multiply that by their page size
+// (limit, first or last, falling back to DefaultLimit). Scalars are free since
+// they come with their row. Introspection fields are not charged: they count as
+// nodes, and only the outermost adds to the depth.
+type QueryCost struct {
+	Depth int `json:"depth"`
+	Nodes int `json:"nodes"`
+	Cost  int `json:"cost"`
+}
+
+// Check reports one error per limit the operation exceeds
+func (c QueryCost) Check(limits tenant.QueryLimits) []gqlerrors.FormattedError {
+	var errs []gqlerrors.FormattedError
+	exceeded := func(limit string, actual, max int) {
+		errs = append(errs, gqlerrors.FormattedError{
+			Message: fmt.Sprintf("query %s %d exceeds the maximum of %d", limit, actual, max),
+			Extensions: map[string]interface{}{
+				"code":   QueryLimitExceededCode,
+				"limit":  limit,
+				"actual": actual,
+				"max":    max,
+			},
+		})
+	}
+	if limits.MaxDepth > 0 && c.Depth > limits.MaxDepth {
+		exceeded("depth", c.Depth, limits.MaxDepth)
+	}
+	if limits.MaxNodes > 0 && c.Nodes > limits.MaxNodes {
+		exceeded("nodes", c.Nodes, limits.MaxNodes)
+	}
+	if limits.MaxCost > 0 && c.Cost > limits.MaxCost {
+		exceeded("cost", c.Cost, limits.MaxCost)
+	}
+	return errs
+}
+
+// extension returns the cost report added to response extensions
+func (c QueryCost) extension(limits tenant.QueryLimits) map[string]interface{} {
+	return map[string]interface{}{
+		"depth":    c.Depth,
+		"nodes":    c.Nodes,
+		"cost":     c.Cost,
+		"maxDepth": limits.MaxDepth,
+		"maxNodes": limits.MaxNodes,
+		"maxCost":  limits.MaxCost,
+	}
+}
+
+// costAnalyzer walks the selected operation of a document against the schema
+type costAnalyzer struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	maxNodes  int
+
+	// visiting guards against fragment cycles, which validation rejects later
+	visiting map[string]bool
+	// spreads holds the walks of fragments, keyed by fragment, parent type and
+	// whether they are spread inside introspection
+	spreads map[string]fragmentCost
+	// introspection is positive while walking the selections of introspection fields
+	introspection int
+	cost          QueryCost
+}
+
+// fragmentCost is the walk of a fragment on one parent type; depth is relative to
+// the spread
+type fragmentCost struct {
+	cost, nodes, depth int
+}
+
+// analyzeQuery estimates the operation of a request. Documents that cannot be
+// parsed yield a zero cost; execution reports their errors. The walk stops early
+// once maxNodes is exceeded (when positive) so huge documents stay cheap to reject.
+func analyzeQuery(schema *graphql.Schema, query, operationName string, variables map[string]interface{}, maxNodes int) QueryCost {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		return QueryCost{}
+	}
+
+	a := &costAnalyzer{
+		schema:    schema,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: make(map[string]interface{}, len(variables)),
+		maxNodes:  maxNodes,
+		visiting:  make(map[string]bool),
+		spreads:   make(map[string]fragmentCost),
+	}
+	for name, value := range variables {
+		a.variables[name] = value
+	}
+
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				if operation == nil {
+					operation = d
+				}
+			}
+		}
+	}
+	if operation == nil {
+		return QueryCost{}
+	}
+
+	// Variables that were not sent take their declared default
+	for _, v := range operation.VariableDefinitions {
+		if _, ok := a.variables[v.Variable.Name.Value]; !ok && v.DefaultValue != nil {
+			a.variables[v.Variable.Name.Value] = literalValue(v.DefaultValue)
+		}
+	}
+
+	var root *graphql.Object
+	switch operation.Operation {
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	default:
+		root = schema.QueryType()
+	}
+	if root == nil {
+		return QueryCost{}
+	}
+
+	a.cost.Cost = a.selections(root, operation.SelectionSet, 0)
+	return a.cost
+}
+
+// selections returns the cost of a selection set whose fields belong to parent
+func (a *costAnalyzer) selections(parent graphql.Type, set *ast.SelectionSet, depth int) int {
+	if set == nil {
+		return 0
+	}
+
+	total := 0
+	for _, sel := range set.Selections {
+		if a.maxNodes > 0 && a.cost.Nodes > a.maxNodes {
+			break
+		}
+		switch s := sel.(type) {
+		case *ast.Field:
+			total = addCost(total, a.field(parent, s, depth))
+		case *ast.InlineFragment:
+			total = addCost(total, a.selections(a.conditionType(parent, s.TypeCondition), s.SelectionSet, depth))
+		case *ast.FragmentSpread:
+			total = addCost(total, a.spread(parent, s.Name.Value, depth))
+		}
+	}
+	return total
+}
+
+// spread returns the cost of a fragment spread. A fragment is walked once per
+// parent type and its result reused, so spreading fragments repeatedly cannot
+// make the walk exponential.
+func (a *costAnalyzer) spread(parent graphql.Type, name string, depth int) int {
+	frag, ok := a.fragments[name]
+	if !ok || a.visiting[name] {
+		return 0
+	}
+	parentName := ""
+	if parent != nil {
+		parentName = parent.Name()
+	}
+	key := fmt.Sprintf("%s/%s/%t", name, parentName, a.introspection > 0)
+	if c, ok := a.spreads[key]; ok {
+		a.cost.Nodes = addCost(a.cost.Nodes, c.nodes)
+		a.spreadDepth(depth, c.depth)
+		return c.cost
+	}
+
+	// Walk with the depth reset to the spread's to measure the fragment's own
+	nodes, maxDepth := a.cost.Nodes, a.cost.Depth
+	a.cost.Depth = depth
+	a.visiting[name] = true
+	cost := a.selections(a.conditionType(parent, frag.TypeCondition), frag.SelectionSet, depth)
+	delete(a.visiting, name)
+
+	c := fragmentCost{cost: cost, nodes: a.cost.Nodes - nodes, depth: a.cost.Depth - depth}
+	a.spreads[key] = c
+	a.cost.Depth = maxDepth
+	a.spreadDepth(depth, c.depth)
+	return cost
+}
+
+// spreadDepth records the depth reached by a fragment spread at depth; fragments
+// that only select introspection do not reach any
+func (a *costAnalyzer) spreadDepth(depth, fragmentDepth int) {
+	if fragmentDepth > 0 && depth+fragmentDepth > a.cost.Depth {
+		a.cost.Depth = depth + fragmentDepth
+	}
+}
+
+// field returns the cost of one field and records its depth and node
+func (a *costAnalyzer) field(parent graphql.Type, f *ast.Field, depth int) int {
+	a.cost.Nodes = addCost(a.cost.Nodes, 1)
+	if a.introspection == 0 && depth+1 > a.cost.Depth {
+		a.cost.Depth = depth + 1
+	}
+	if f.SelectionSet == nil {
+		return 0
+	}
+
+	// Introspection is free; its selections only count as nodes
+	if a.introspection > 0 || strings.HasPrefix(f.Name.Value, "__") {
+		a.introspection++
+		a.selections(nil, f.SelectionSet, depth+1)
+		a.introspection--
+		return 0
+	}
+
+	def := fieldDefinition(parent, f.Name.Value)
+	if def == nil {
+		return 0
+	}
+
+	children := a.selections(namedType(def.Type), f.SelectionSet, depth+1)
+	return mulCost(a.pageSize(parent, f, def), addCost(1, children))
+}
+
+// pageSize returns the number of rows a field may return: its limit, first or last
+// argument clamped like the resolvers do, MaxLimit for lists only bounded by the
+// table (the rows a bulk mutation returns and grouped aggregates), or 1 for
+// other fields
+func (a *costAnalyzer) pageSize(parent graphql.Type, f *ast.Field, def *graphql.FieldDefinition) int {
+	if def.Name == "returning" && parent != nil && strings.HasSuffix(parent.Name(), "MutationResponse") {
+		return MaxLimit
+	}
+	if a.hasArgument(f, "groupBy") {
+		return MaxLimit
+	}
+
+	paged := false
+	size := 0
+	for _, arg := range def.Args {
+		switch arg.Name() {
+		case "limit", "first", "last":
+			paged = true
+			if v, ok := a.intArgument(f, arg.Name()); ok && v > size {
+				size = v
+			}
+		}
+	}
+	if !paged {
+		return 1
+	}
+	if size <= 0 {
+		size = DefaultLimit
+	}
+	if size > MaxLimit {
+		size = MaxLimit
+	}
+	return size
+}
+
+// hasArgument reports whether a field is given a non-null argument
+func (a *costAnalyzer) hasArgument(f *ast.Field, name string) bool {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != name {
+			continue
+		}
+		if v, ok := arg.Value.(*ast.Variable); ok {
+			return a.variables[v.Name.Value] != nil
+		}
+		return literalValue(arg.Value) != nil
+	}
+	return false
+}
+
+// intArgument reads an integer argument given inline or through a variable
+func (a *costAnalyzer) intArgument(f *ast.Field, name string) (int, bool) {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != name {
+			continue
+		}
+		var value interface{}
+		if v, ok := arg.Value.(*ast.Variable); ok {
+			value = a.variables[v.Name.Value]
+		} else {
+			value = literalValue(arg.Value)
+		}
+		switch v := value.(type) {
+		case int:
+			return v, true
+		case int64:
+			return int(v), true
+		case float64:
+			return int(v), true
+		case json.Number:
+			n, err := strconv.Atoi(v.String())
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// conditionType resolves the type condition of a fragment, defaulting to parent
+func (a *costAnalyzer) conditionType(parent graphql.Type, cond *ast.Named) graphql.Type {
+	if cond == nil {
+		return parent
+	}
+	if t := a.schema.Type(cond.Name.Value); t != nil {
+		return t
+	}
+	return parent
+}
+
+// fieldDefinition looks up a field of an object or interface type
+func fieldDefinition(parent graphql.Type, name string) *graphql.FieldDefinition {
+	switch t := parent.(type) {
+	case *graphql.Object:
+		return t.Fields()[name]
+	case *graphql.Interface:
+		return t.Fields()[name]
+	}
+	return nil
+}
+
+// namedType strips the list and non-null wrappers of a type
+func namedType(t graphql.Type) graphql.Type {
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.List:
+			t = wrapped.OfType
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		default:
+			return t
+		}
+	}
+}
+
+func addCost(a, b int) int {
+	if a+b > costCeiling {
+		return costCeiling
+	}
+	return a + b
+}
+
+func mulCost(a, b int) int {
+	if a != 0 && b > costCeiling/a {
+		return costCeiling
+	}
+	return a * b
+}
@@ -0,0 +1,201 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func complexityTestSchema(t *testing.T) *graphql.Schema {
+	t.Helper()
+	tables := orderTestTables()
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{tables["authors"], tables["posts"]},
+	})
+	require.NoError(t, err)
+	return schema
+}
+
+func TestAnalyzeQuery(t *testing.T) {
+	schema := complexityTestSchema(t)
+
+	cases := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		expected  QueryCost
+	}{
+		{
+			name:     "belongsTo fields cost one row each",
+			query:    `{ posts(limit: 10) { title author { name } } }`,
+			expected: QueryCost{Depth: 3, Nodes: 4, Cost: 20},
+		},
+		{
+			name:     "lists without a limit use the default page size",
+			query:    `{ authors { posts { id } } }`,
+			expected: QueryCost{Depth: 3, Nodes: 3, Cost: DefaultLimit * (1 + DefaultLimit)},
+		},
+		{
+			name:     "limits above the maximum are clamped",
+			query:    `{ posts(limit: 100000) { id } }`,
+			expected: QueryCost{Depth: 2, Nodes: 2, Cost: MaxLimit},
+		},
+		{
+			name:     "variable defaults",
+			query:    `query Posts($n: Int = 5) { posts(limit: $n) { id } }`,
+			expected: QueryCost{Depth: 2, Nodes: 2, Cost: 5},
+		},
+		{
+			name:      "variables",
+			query:     `query Posts($n: Int = 5) { posts(limit: $n) { id } }`,
+			variables: map[string]interface{}{"n": float64(50)},
+			expected:  QueryCost{Depth: 2, Nodes: 2, Cost: 50},
+		},
+		{
+			name:     "connections are paged by first",
+			query:    `{ postsConnection(first: 3) { edges { node { id author { id } } } } }`,
+			expected: QueryCost{Depth: 5, Nodes: 6, Cost: 3 * (1 + 1 + 1 + 1)},
+		},
+		{
+			name:     "fragments are expanded",
+			query:    `fragment F on Posts { author { name } } { posts(limit: 2) { ...F ... on Posts { id } } }`,
+			expected: QueryCost{Depth: 3, Nodes: 4, Cost: 4},
+		},
+		{
+			name:     "introspection is free but counts as nodes",
+			query:    `{ __schema { types { name fields { name type { ofType { ofType { name } } } } } } }`,
+			expected: QueryCost{Depth: 1, Nodes: 9},
+		},
+		{
+			name:     "rows returned by bulk mutations are unbounded",
+			query:    `mutation { deletePostsMany(where: {}) { affectedRows returning { id author { name } } } }`,
+			expected: QueryCost{Depth: 4, Nodes: 6, Cost: 1 + MaxLimit*2},
+		},
+		{
+			name:     "grouped aggregates are unbounded",
+			query:    `{ postsAggregate(groupBy: [author_id]) { count keys { authorId } } }`,
+			expected: QueryCost{Depth: 3, Nodes: 4, Cost: MaxLimit * 2},
+		},
+		{
+			name:     "aggregates without groups return one row",
+			query:    `query Agg($g: [PostsSelectColumn!]) { postsAggregate(groupBy: $g) { count } }`,
+			expected: QueryCost{Depth: 2, Nodes: 2, Cost: 1},
+		},
+		{
+			name:     "unparsable documents are left to execution",
+			query:    `{ posts {`,
+			expected: QueryCost{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, analyzeQuery(schema, tc.query, "", tc.variables, 0))
+		})
+	}
+}
+
+func TestAnalyzeQuery_StopsAfterMaxNodes(t *testing.T) {
+	schema := complexityTestSchema(t)
+	query := `{ a: posts { id } b: posts { id } c: posts { id } d: posts { id } }`
+
+	cost := analyzeQuery(schema, query, "", nil, 3)
+	assert.Greater(t, cost.Nodes, 3)
+	assert.Less(t, cost.Nodes, 8, "the walk stops once the budget is exceeded")
+}
+
+func TestAnalyzeQuery_NestedFragments(t *testing.T) {
+	schema := complexityTestSchema(t)
+
+	// Each fragment spreads the next twice: 2^25 fields once expanded
+	var doc strings.Builder
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&doc, "fragment F%d on Query { ...F%d ...F%d }\n", i, i+1, i+1)
+	}
+	doc.WriteString("fragment F25 on Query { __typename }\n{ ...F0 }")
+
+	start := time.Now()
+	cost := analyzeQuery(schema, doc.String(), "", nil, 0)
+	assert.Less(t, time.Since(start), time.Second, "fragments are walked once")
+	assert.Equal(t, QueryCost{Depth: 1, Nodes: 1 << 25}, cost)
+	assert.NotEmpty(t, cost.Check(DefaultQueryLimits()))
+
+	// Fragments reused at different depths keep their own depth
+	cost = analyzeQuery(schema, `fragment A on Authors { posts { id } }
+		{ authors { ...A posts { author { ...A } } } }`, "", nil, 0)
+	assert.Equal(t, 5, cost.Depth)
+	assert.Equal(t, 7, cost.Nodes)
+
+	// Introspection fragments do not add to the depth
+	cost = analyzeQuery(schema, `fragment T on __Type { name ofType { name } }
+		{ __schema { types { ...T } } }`, "", nil, 0)
+	assert.Equal(t, QueryCost{Depth: 1, Nodes: 5}, cost)
+}
+
+func TestQueryCost_Check(t *testing.T) {
+	limits := tenant.QueryLimits{MaxDepth: 3, MaxNodes: 10, MaxCost: 100}
+
+	assert.Empty(t, QueryCost{Depth: 3, Nodes: 10, Cost: 100}.Check(limits))
+
+	errs := QueryCost{Depth: 4, Nodes: 10, Cost: 101}.Check(limits)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "query depth 4 exceeds the maximum of 3", errs[0].Message)
+	assert.Equal(t, QueryLimitExceededCode, errs[0].Extensions["code"])
+	assert.Equal(t, "cost", errs[1].Extensions["limit"])
+	assert.Equal(t, 101, errs[1].Extensions["actual"])
+	assert.Equal(t, 100, errs[1].Extensions["max"])
+
+	assert.Empty(t, QueryCost{Depth: 100}.Check(tenant.QueryLimits{}), "zero limits are disabled")
+}
+
+func TestQueryLimits_WithDefaults(t *testing.T) {
+	limits := tenant.QueryLimits{MaxCost: 10}.WithDefaults(DefaultQueryLimits())
+	assert.Equal(t, tenant.QueryLimits{MaxDepth: DefaultMaxQueryDepth, MaxNodes: DefaultMaxQueryNodes, MaxCost: 10}, limits)
+}
+
+func TestHandler_RejectsOverBudgetQueries(t *testing.T) {
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits()}
+	h.schemaCache.Store("tenant_test", &cachedSchema{
+		schema:    complexityTestSchema(t),
+		expiresAt: time.Now().Add(time.Minute),
+	})
+
+	ten := &tenant.Tenant{ID: "t1", SchemaName: "tenant_test", QueryLimits: tenant.QueryLimits{MaxCost: 1000}}
+	body := `{"query":"{ authors(limit: 50) { posts(limit: 50) { id } } }"}`
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(tenant.WithTenant(req.Context(), ten))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Data       interface{}              `json:"data"`
+		Errors     []map[string]interface{} `json:"errors"`
+		Extensions map[string]interface{}   `json:"extensions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Nil(t, resp.Data, "the operation never ran")
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "query cost 2550 exceeds the maximum of 1000", resp.Errors[0]["message"])
+	assert.Equal(t, map[string]interface{}{
+		"code": QueryLimitExceededCode, "limit": "cost", "actual": float64(2550), "max": float64(1000),
+	}, resp.Errors[0]["extensions"])
+
+	cost, ok := resp.Extensions["cost"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, float64(2550), cost["cost"])
+	assert.Equal(t, float64(1000), cost["maxCost"])
+	assert.Equal(t, float64(DefaultMaxQueryDepth), cost["maxDepth"], "unset limits use the server defaults")
+}
@@ -0,0 +1,418 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+// pageInfoType is the Relay PageInfo object shared by every connection
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+// buildConnection creates the <Type>Connection object (edges, pageInfo, totalCount) for a table
+func (g *SchemaGenerator) buildConnection(table Table, nodeType *graphql.Object) *graphql.Object {
+	typeName := strcase.ToCamel(table.Name)
+
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: typeName + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: nodeType},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: typeName + "Connection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewList(edgeType)},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+			"totalCount": &graphql.Field{
+				Type: graphql.Int,
+				// Counting is deferred so it only runs when the field is selected
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					source, ok := p.Source.(map[string]interface{})
+					if !ok {
+						return nil, nil
+					}
+					count, ok := source["totalCount"].(func(context.Context) (interface{}, error))
+					if !ok {
+						return nil, nil
+					}
+					return count(p.Context)
+				},
+			},
+		},
+	})
+}
+
+// keysetTerm is one sort key of a keyset cursor
+type keysetTerm struct {
+	column     string
+	field      string
+	desc       bool
+	nullsFirst bool
+}
+
+// sql renders the ORDER BY term, optionally reversed for backward pagination
+func (k keysetTerm) sql(reverse bool) string {
+	desc, nullsFirst := k.desc, k.nullsFirst
+	if reverse {
+		desc, nullsFirst = !desc, !nullsFirst
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	nulls := "NULLS LAST"
+	if nullsFirst {
+		nulls = "NULLS FIRST"
+	}
+	return fmt.Sprintf(`"%s" %s %s`, k.column, dir, nulls)
+}
+
+// connectionPage reads the first and last arguments of a connection: the page
+// size and whether the page is read backward. first: 0 asks for an empty page;
+// only connections without either argument get DefaultLimit rows.
+func connectionPage(args map[string]interface{}) (int, bool, error) {
+	first, hasFirst := args["first"].(int)
+	last, hasLast := args["last"].(int)
+	if hasFirst && hasLast {
+		return 0, false, fmt.Errorf("first and last cannot be combined")
+	}
+	if (hasFirst && first < 0) || (hasLast && last < 0) {
+		return 0, false, fmt.Errorf("first and last cannot be negative")
+	}
+
+	limit := DefaultLimit
+	switch {
+	case hasFirst:
+		limit = first
+	case hasLast:
+		limit = last
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	return limit, hasLast, nil
+}
+
+// connectionOrder builds the keyset sort keys from the requested order_by columns,
+// always ending with the primary key columns so every cursor is unique
+func connectionOrder(table Table, pk []string, value interface{}) ([]keysetTerm, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case nil:
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items = []interface{}{v}
+	default:
+		return nil, fmt.Errorf("order_by expects a list of objects")
+	}
+
+	var terms []keysetTerm
+	seen := make(map[string]bool)
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("order_by expects a list of objects")
+		}
+		for _, key := range sortedKeys(obj) {
+			val := obj[key]
+			if val == nil {
+				continue
+			}
+			col, ok := findColumn(table, key)
+			if !ok {
+				return nil, fmt.Errorf("connections can only be ordered by columns of %s: %s", table.Name, key)
+			}
+			if err := validateIdentifier(col.Name); err != nil {
+				return nil, err
+			}
+			direction, ok := val.(string)
+			if !ok || !validOrderDirections[direction] {
+				return nil, fmt.Errorf("invalid order direction for %s", key)
+			}
+			if seen[col.Name] {
+				continue
+			}
+			seen[col.Name] = true
+
+			desc := strings.HasPrefix(direction, "DESC")
+			// Postgres defaults: ASC sorts NULLs last, DESC sorts them first
+			nullsFirst := desc
+			if strings.HasSuffix(direction, "NULLS FIRST") {
+				nullsFirst = true
+			} else if strings.HasSuffix(direction, "NULLS LAST") {
+				nullsFirst = false
+			}
+			terms = append(terms, keysetTerm{
+				column:     col.Name,
+				field:      strcase.ToLowerCamel(col.Name),
+				desc:       desc,
+				nullsFirst: nullsFirst,
+			})
+		}
+	}
+
+	for _, col := range pk {
+		if !seen[col] {
+			terms = append(terms, keysetTerm{column: col, field: strcase.ToLowerCamel(col)})
+		}
+	}
+	return terms, nil
+}
+
+// keysetCursor is the JSON of a cursor: the fingerprint of the sort keys it was
+// built for and the row's values of them
+type keysetCursor struct {
+	Order  string        `json:"o"`
+	Values []interface{} `json:"v"`
+}
+
+// orderFingerprint identifies the sort keys of a cursor: their columns,
+// directions and NULL placement
+func orderFingerprint(terms []keysetTerm) string {
+	keys := make([]string, len(terms))
+	for i, t := range terms {
+		keys[i] = t.sql(false)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(keys, ",")))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// encodeCursor builds an opaque cursor from the sort key values of a row
+func encodeCursor(terms []keysetTerm, row map[string]interface{}) (string, error) {
+	values := make([]interface{}, len(terms))
+	for i, t := range terms {
+		values[i] = row[t.field]
+	}
+	raw, err := json.Marshal(keysetCursor{Order: orderFingerprint(terms), Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// decodeCursor reverses encodeCursor, checking it matches the current sort keys
+func decodeCursor(terms []keysetTerm, cursor string) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var c keysetCursor
+	if err := dec.Decode(&c); err != nil || len(c.Values) != len(terms) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Order != orderFingerprint(terms) {
+		return nil, fmt.Errorf("cursor does not match the order_by of the request")
+	}
+	values := c.Values
+	for i, v := range values {
+		if n, ok := v.(json.Number); ok {
+			values[i] = n.String()
+		}
+	}
+	return values, nil
+}
+
+// keysetCondition returns the condition selecting rows strictly after the cursor
+// values in the given ordering (or strictly before it when reverse is set)
+func keysetCondition(terms []keysetTerm, values []interface{}, reverse bool, args *queryArgs) string {
+	var ors []string
+	for i := range terms {
+		var ands []string
+		for j := 0; j < i; j++ {
+			col := fmt.Sprintf(`"%s"`, terms[j].column)
+			if values[j] == nil {
+				ands = append(ands, col+" IS NULL")
+			} else {
+				ands = append(ands, fmt.Sprintf("%s = %s", col, args.add(values[j])))
+			}
+		}
+		ands = append(ands, keysetAfter(terms[i], values[i], reverse, args))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+// keysetAfter returns the condition for a single column being past the cursor value
+func keysetAfter(t keysetTerm, value interface{}, reverse bool, args *queryArgs) string {
+	desc, nullsFirst := t.desc, t.nullsFirst
+	if reverse {
+		desc, nullsFirst = !desc, !nullsFirst
+	}
+	col := fmt.Sprintf(`"%s"`, t.column)
+
+	if value == nil {
+		if nullsFirst {
+			return col + " IS NOT NULL"
+		}
+		return "FALSE"
+	}
+
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	cond := fmt.Sprintf("%s %s %s", col, op, args.add(value))
+	if !nullsFirst {
+		cond = fmt.Sprintf("(%s OR %s IS NULL)", cond, col)
+	}
+	return cond
+}
+
+// ResolveConnection returns a function that resolves a Relay connection using keyset pagination
+func (r *Resolver) ResolveConnection(schemaName string, table Table, pk []string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		// Validate identifiers to prevent SQL injection
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := validateIdentifier(table.Name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+		for _, col := range pk {
+			if err := validateIdentifier(col); err != nil {
+				return nil, fmt.Errorf("invalid primary key name")
+			}
+		}
+
+		after, _ := p.Args["after"].(string)
+		before, _ := p.Args["before"].(string)
+
+		// Backward pagination runs the query in reverse order and flips the page afterwards
+		limit, backward, err := connectionPage(p.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		terms, err := connectionOrder(table, pk, p.Args["order_by"])
+		if err != nil {
+			return nil, err
+		}
+
+		// Source and filter shared by the page query and the deferred count
+		filterArgs := &queryArgs{}
+		source, err := tableSource(p.Context, schemaName, table, filterArgs)
+		if err != nil {
+			return nil, err
+		}
+		var filter string
+		if where, ok := p.Args["where"].(map[string]interface{}); ok {
+			filter, err = buildWhere(table, where, filterArgs)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		args := &queryArgs{values: append([]interface{}{}, filterArgs.values...)}
+		var conds []string
+		if filter != "" {
+			conds = append(conds, filter)
+		}
+		if after != "" {
+			values, err := decodeCursor(terms, after)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, keysetCondition(terms, values, false, args))
+		}
+		if before != "" {
+			values, err := decodeCursor(terms, before)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, keysetCondition(terms, values, true, args))
+		}
+
+		query := "SELECT * FROM " + source
+		if len(conds) > 0 {
+			query += " WHERE " + strings.Join(conds, " AND ")
+		}
+		orderTerms := make([]string, len(terms))
+		for i, t := range terms {
+			orderTerms[i] = t.sql(backward)
+		}
+		// Fetch one extra row to know whether another page exists
+		query += fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(orderTerms, ", "), limit+1)
+
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(p.Context, err, "query failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read results")
+		}
+
+		hasMore := len(results) > limit
+		if hasMore {
+			results = results[:limit]
+		}
+		if backward {
+			for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+				results[i], results[j] = results[j], results[i]
+			}
+		}
+
+		edges := make([]map[string]interface{}, 0, len(results))
+		for _, row := range results {
+			cursor, err := encodeCursor(terms, row)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode cursor")
+			}
+			edges = append(edges, map[string]interface{}{
+				"cursor": cursor,
+				"node":   row,
+			})
+		}
+
+		pageInfo := map[string]interface{}{
+			"hasNextPage":     !backward && hasMore,
+			"hasPreviousPage": backward && hasMore,
+			"startCursor":     nil,
+			"endCursor":       nil,
+		}
+		if len(edges) > 0 {
+			pageInfo["startCursor"] = edges[0]["cursor"]
+			pageInfo["endCursor"] = edges[len(edges)-1]["cursor"]
+		}
+
+		countQuery := "SELECT COUNT(*) FROM " + source
+		if filter != "" {
+			countQuery += " WHERE " + filter
+		}
+
+		return map[string]interface{}{
+			"edges":    edges,
+			"pageInfo": pageInfo,
+			"totalCount": func(ctx context.Context) (interface{}, error) {
+				var count int
+				if err := r.conn(ctx).QueryRowContext(ctx, countQuery, filterArgs.values...).Scan(&count); err != nil {
+					return nil, r.dbError(ctx, err, "count query failed")
+				}
+				return count, nil
+			},
+		}, nil
+	}
+}
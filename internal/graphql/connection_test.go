@@ -0,0 +1,110 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionPage(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     map[string]interface{}
+		limit    int
+		backward bool
+		err      string
+	}{
+		{name: "default", args: map[string]interface{}{}, limit: DefaultLimit},
+		{name: "first", args: map[string]interface{}{"first": 5}, limit: 5},
+		{name: "first zero is an empty page", args: map[string]interface{}{"first": 0}, limit: 0},
+		{name: "last", args: map[string]interface{}{"last": 3}, limit: 3, backward: true},
+		{name: "last zero", args: map[string]interface{}{"last": 0}, limit: 0, backward: true},
+		{name: "clamped", args: map[string]interface{}{"first": MaxLimit + 1}, limit: MaxLimit},
+		{name: "negative", args: map[string]interface{}{"first": -1}, err: "first and last cannot be negative"},
+		{name: "both", args: map[string]interface{}{"first": 1, "last": 1}, err: "first and last cannot be combined"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			limit, backward, err := connectionPage(tc.args)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.limit, limit)
+			assert.Equal(t, tc.backward, backward)
+		})
+	}
+}
+
+func TestConnectionOrder_AppendsPrimaryKey(t *testing.T) {
+	terms, err := connectionOrder(filterTestTable(), []string{"id"}, []interface{}{
+		map[string]interface{}{"viewCount": "DESC"},
+	})
+	require.NoError(t, err)
+	require.Len(t, terms, 2)
+
+	assert.Equal(t, keysetTerm{column: "view_count", field: "viewCount", desc: true, nullsFirst: true}, terms[0])
+	assert.Equal(t, keysetTerm{column: "id", field: "id"}, terms[1])
+	assert.Equal(t, `"view_count" DESC NULLS FIRST`, terms[0].sql(false))
+	assert.Equal(t, `"view_count" ASC NULLS LAST`, terms[0].sql(true))
+}
+
+func TestConnectionOrder_RejectsRelations(t *testing.T) {
+	tables := orderTestTables()
+	_, err := connectionOrder(tables["posts"], []string{"id"}, []interface{}{
+		map[string]interface{}{"author": map[string]interface{}{"name": "ASC"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	terms, err := connectionOrder(filterTestTable(), []string{"id"}, []interface{}{
+		map[string]interface{}{"title": "ASC"},
+	})
+	require.NoError(t, err)
+
+	cursor, err := encodeCursor(terms, map[string]interface{}{"id": 42, "title": "hello"})
+	require.NoError(t, err)
+
+	values, err := decodeCursor(terms, cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"hello", "42"}, values)
+
+	_, err = decodeCursor(terms[:1], cursor)
+	assert.Error(t, err, "cursor built for other sort keys must be rejected")
+
+	// Same number of sort keys, other columns or directions
+	for _, orderBy := range []map[string]interface{}{
+		{"title": "DESC"},
+		{"title": "ASC NULLS FIRST"},
+		{"viewCount": "ASC"},
+	} {
+		other, err := connectionOrder(filterTestTable(), []string{"id"}, []interface{}{orderBy})
+		require.NoError(t, err)
+		require.Len(t, other, len(terms))
+		_, err = decodeCursor(other, cursor)
+		assert.EqualError(t, err, "cursor does not match the order_by of the request", orderBy)
+	}
+
+	_, err = decodeCursor(terms, "not-a-cursor!")
+	assert.Error(t, err)
+}
+
+func TestKeysetCondition(t *testing.T) {
+	terms := []keysetTerm{
+		{column: "title", field: "title"},
+		{column: "id", field: "id"},
+	}
+
+	args := &queryArgs{}
+	cond := keysetCondition(terms, []interface{}{"hello", "42"}, false, args)
+	assert.Equal(t, `((("title" > $1 OR "title" IS NULL)) OR ("title" = $2 AND ("id" > $3 OR "id" IS NULL)))`, cond)
+	assert.Equal(t, []interface{}{"hello", "hello", "42"}, args.values)
+
+	args = &queryArgs{}
+	cond = keysetCondition(terms, []interface{}{nil, "42"}, true, args)
+	assert.Equal(t, `(("title" IS NOT NULL) OR ("title" IS NULL AND "id" < $1))`, cond)
+	assert.Equal(t, []interface{}{"42"}, args.values)
+}
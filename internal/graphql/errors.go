@@ -0,0 +1,189 @@
+package graphql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Error codes of failed statements, action calls and remote schema calls,
+// reported in extensions.code
+const (
+	UniqueViolationCode      = "UNIQUE_VIOLATION"
+	ForeignKeyViolationCode  = "FOREIGN_KEY_VIOLATION"
+	NotNullViolationCode     = "NOT_NULL_VIOLATION"
+	CheckViolationCode       = "CHECK_VIOLATION"
+	PermissionDeniedCode     = "PERMISSION_DENIED"
+	InvalidInputCode         = "INVALID_INPUT"
+	SerializationFailureCode = "SERIALIZATION_FAILURE"
+	TimeoutCode              = "TIMEOUT"
+	NotFoundCode             = "NOT_FOUND"
+	InternalErrorCode        = "INTERNAL_SERVER_ERROR"
+	ActionFailedCode         = "ACTION_FAILED"
+	RemoteSchemaFailedCode   = "REMOTE_SCHEMA_FAILED"
+)
+
+// CorrelationHeader carries the ID tying a request's errors to the server logs;
+// clients may send one, otherwise it is generated
+const CorrelationHeader = "X-Request-Id"
+
+// DatabaseError is a failed statement as reported to clients: a code, the
+// constraint, table and columns involved, and a message free of row values.
+// The full Postgres error is only logged, under CorrelationID.
+type DatabaseError struct {
+	Code          string
+	Message       string
+	Table         string
+	Constraint    string
+	Columns       []string
+	CorrelationID string
+}
+
+func (e *DatabaseError) Error() string {
+	return e.Message
+}
+
+// Extensions reports the error details in the GraphQL error's extensions
+func (e *DatabaseError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code}
+	if e.Table != "" {
+		ext["table"] = e.Table
+	}
+	if e.Constraint != "" {
+		ext["constraint"] = e.Constraint
+	}
+	if len(e.Columns) == 1 {
+		ext["column"] = e.Columns[0]
+	}
+	if len(e.Columns) > 0 {
+		ext["columns"] = e.Columns
+	}
+	if e.CorrelationID != "" {
+		ext["correlationId"] = e.CorrelationID
+	}
+	return ext
+}
+
+// keyColumnsDetail reads the column names of a key violation detail such as
+// Key (author_id)=(5) is not present in table "authors". The values are dropped.
+var keyColumnsDetail = regexp.MustCompile(`^Key \(([^)]*)\)=`)
+
+// translatePQError maps a Postgres error to the error clients see. Errors with no
+// client-facing meaning become internal errors with the fallback message.
+func translatePQError(err error, fallback string) *DatabaseError {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return &DatabaseError{Code: InternalErrorCode, Message: fallback}
+	}
+
+	e := &DatabaseError{Table: pqErr.Table, Constraint: pqErr.Constraint}
+	if pqErr.Column != "" {
+		e.Columns = []string{pqErr.Column}
+	}
+	if m := keyColumnsDetail.FindStringSubmatch(pqErr.Detail); m != nil {
+		e.Columns = nil
+		for _, col := range strings.Split(m[1], ",") {
+			e.Columns = append(e.Columns, strings.Trim(strings.TrimSpace(col), `"`))
+		}
+	}
+
+	switch code := string(pqErr.Code); {
+	case code == "23505":
+		e.Code = UniqueViolationCode
+		e.Message = fmt.Sprintf("duplicate value violates unique constraint %s", pqErr.Constraint)
+	case code == "23503":
+		e.Code = ForeignKeyViolationCode
+		if strings.Contains(pqErr.Detail, "still referenced") {
+			e.Message = fmt.Sprintf("row is still referenced through foreign key %s", pqErr.Constraint)
+		} else {
+			e.Message = fmt.Sprintf("referenced row does not exist for foreign key %s", pqErr.Constraint)
+		}
+	case code == "23502":
+		e.Code = NotNullViolationCode
+		e.Message = fmt.Sprintf("column %s cannot be null", pqErr.Column)
+	case code == "23514":
+		e.Code = CheckViolationCode
+		e.Message = fmt.Sprintf("value violates check constraint %s", pqErr.Constraint)
+	case code == "42501":
+		e.Code = PermissionDeniedCode
+		e.Message = "permission denied"
+	case strings.HasPrefix(code, "22"):
+		// Data exceptions quote the offending value, which is not echoed back
+		e.Code = InvalidInputCode
+		e.Message = "invalid input value"
+	case code == "40001", code == "40P01":
+		e.Code = SerializationFailureCode
+		e.Message = "concurrent update, retry the operation"
+	case code == "57014":
+		e.Code = TimeoutCode
+		e.Message = "statement timed out"
+	default:
+		return &DatabaseError{Code: InternalErrorCode, Message: fallback}
+	}
+	return e
+}
+
+// dbError turns the error of a statement into the error returned to clients and
+// logs the original with a correlation ID, which the client error carries
+func (r *Resolver) dbError(ctx context.Context, err error, fallback string) error {
+	e := translatePQError(err, fallback)
+	e.CorrelationID = correlationID(ctx)
+
+	event := r.logger.Warn()
+	if e.Code == InternalErrorCode {
+		event = r.logger.Error()
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		event = event.
+			Str("pg_code", string(pqErr.Code)).
+			Str("pg_detail", pqErr.Detail).
+			Str("pg_table", pqErr.Table).
+			Str("pg_constraint", pqErr.Constraint)
+	}
+	event.Err(err).
+		Str("code", e.Code).
+		Str("correlation_id", e.CorrelationID).
+		Msg(fallback)
+	return e
+}
+
+type correlationIDKey struct{}
+
+// withCorrelationID sets the correlation ID of a request
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// correlationID returns the correlation ID of a request, or a new one
+func correlationID(ctx context.Context) string {
+	if id, ok := ctx.Value(correlationIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return newCorrelationID()
+}
+
+// requestCorrelationID returns the ID a client sent in CorrelationHeader when it
+// is reasonable to log, or a new one
+func requestCorrelationID(r *http.Request) string {
+	id := r.Header.Get(CorrelationHeader)
+	if id != "" && len(id) <= 128 && validCorrelationID.MatchString(id) {
+		return id
+	}
+	return newCorrelationID()
+}
+
+var validCorrelationID = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+func newCorrelationID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
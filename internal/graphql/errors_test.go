@@ -0,0 +1,137 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslatePQError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected DatabaseError
+	}{
+		{
+			name: "unique violation",
+			err: &pq.Error{Code: "23505", Table: "users", Constraint: "users_email_key",
+				Detail: `Key (email)=(jane@example.com) already exists.`},
+			expected: DatabaseError{Code: UniqueViolationCode, Table: "users", Constraint: "users_email_key",
+				Columns: []string{"email"}, Message: "duplicate value violates unique constraint users_email_key"},
+		},
+		{
+			name: "composite unique violation",
+			err: &pq.Error{Code: "23505", Table: "post_tags", Constraint: "post_tags_pkey",
+				Detail: `Key (post_id, tag_id)=(1, 2) already exists.`},
+			expected: DatabaseError{Code: UniqueViolationCode, Table: "post_tags", Constraint: "post_tags_pkey",
+				Columns: []string{"post_id", "tag_id"}, Message: "duplicate value violates unique constraint post_tags_pkey"},
+		},
+		{
+			name: "missing referenced row",
+			err: &pq.Error{Code: "23503", Table: "posts", Constraint: "posts_author_id_fkey",
+				Detail: `Key (author_id)=(5) is not present in table "authors".`},
+			expected: DatabaseError{Code: ForeignKeyViolationCode, Table: "posts", Constraint: "posts_author_id_fkey",
+				Columns: []string{"author_id"}, Message: "referenced row does not exist for foreign key posts_author_id_fkey"},
+		},
+		{
+			name: "referenced row deleted",
+			err: &pq.Error{Code: "23503", Table: "posts", Constraint: "posts_author_id_fkey",
+				Detail: `Key (id)=(5) is still referenced from table "posts".`},
+			expected: DatabaseError{Code: ForeignKeyViolationCode, Table: "posts", Constraint: "posts_author_id_fkey",
+				Columns: []string{"id"}, Message: "row is still referenced through foreign key posts_author_id_fkey"},
+		},
+		{
+			name:     "not null violation",
+			err:      &pq.Error{Code: "23502", Table: "users", Column: "email"},
+			expected: DatabaseError{Code: NotNullViolationCode, Table: "users", Columns: []string{"email"}, Message: "column email cannot be null"},
+		},
+		{
+			name:     "check violation",
+			err:      &pq.Error{Code: "23514", Table: "products", Constraint: "products_price_check"},
+			expected: DatabaseError{Code: CheckViolationCode, Table: "products", Constraint: "products_price_check", Message: "value violates check constraint products_price_check"},
+		},
+		{
+			name:     "insufficient privilege",
+			err:      &pq.Error{Code: "42501", Message: "permission denied for table secrets"},
+			expected: DatabaseError{Code: PermissionDeniedCode, Message: "permission denied"},
+		},
+		{
+			name:     "data exception hides the value",
+			err:      &pq.Error{Code: "22P02", Message: `invalid input syntax for type integer: "secret"`},
+			expected: DatabaseError{Code: InvalidInputCode, Message: "invalid input value"},
+		},
+		{
+			name:     "serialization failure",
+			err:      &pq.Error{Code: "40001"},
+			expected: DatabaseError{Code: SerializationFailureCode, Message: "concurrent update, retry the operation"},
+		},
+		{
+			name:     "other postgres error",
+			err:      &pq.Error{Code: "42P01", Message: `relation "secrets" does not exist`},
+			expected: DatabaseError{Code: InternalErrorCode, Message: "query failed"},
+		},
+		{
+			name:     "not a postgres error",
+			err:      errors.New("connection reset"),
+			expected: DatabaseError{Code: InternalErrorCode, Message: "query failed"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, &tc.expected, translatePQError(tc.err, "query failed"))
+		})
+	}
+}
+
+func TestResolver_DBError(t *testing.T) {
+	r := NewResolver(nil)
+	ctx := withCorrelationID(context.Background(), "req-1")
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"insert": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return nil, r.dbError(p.Context, &pq.Error{
+							Code: "23505", Table: "users", Constraint: "users_email_key",
+							Detail: `Key (email)=(jane@example.com) already exists.`,
+						}, "insert failed")
+					},
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+
+	result := graphql.Do(graphql.Params{Schema: schema, RequestString: `{ insert }`, Context: ctx})
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "duplicate value violates unique constraint users_email_key", result.Errors[0].Message)
+	assert.NotContains(t, result.Errors[0].Message, "jane@example.com")
+	assert.Equal(t, map[string]interface{}{
+		"code":          UniqueViolationCode,
+		"table":         "users",
+		"constraint":    "users_email_key",
+		"column":        "email",
+		"columns":       []string{"email"},
+		"correlationId": "req-1",
+	}, result.Errors[0].Extensions)
+}
+
+func TestRequestCorrelationID(t *testing.T) {
+	req := httptest.NewRequest("POST", "/graphql", nil)
+	req.Header.Set(CorrelationHeader, "abc-123")
+	assert.Equal(t, "abc-123", requestCorrelationID(req))
+
+	req.Header.Set(CorrelationHeader, "bad\nid")
+	generated := requestCorrelationID(req)
+	assert.Len(t, generated, 24)
+	assert.NotEqual(t, generated, requestCorrelationID(req))
+}
@@ -0,0 +1,333 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+// Comparison input types shared by every generated BoolExp.
+// Field names follow the `_eq`, `_neq`, ... convention used by the filter compiler.
+var (
+	intComparisonExp     = newComparisonExp("IntComparisonExp", graphql.Int, false)
+	floatComparisonExp   = newComparisonExp("FloatComparisonExp", graphql.Float, false)
+	booleanComparisonExp = newComparisonExp("BooleanComparisonExp", graphql.Boolean, false)
+	stringComparisonExp  = newComparisonExp("StringComparisonExp", graphql.String, true)
+
+	bigIntComparisonExp   = newComparisonExp("BigIntComparisonExp", BigIntScalar, false)
+	decimalComparisonExp  = newComparisonExp("DecimalComparisonExp", DecimalScalar, false)
+	dateTimeComparisonExp = newComparisonExp("DateTimeComparisonExp", DateTimeScalar, false)
+	dateComparisonExp     = newComparisonExp("DateComparisonExp", DateScalar, false)
+	uuidComparisonExp     = newComparisonExp("UUIDComparisonExp", UUIDScalar, false)
+	bytesComparisonExp    = newComparisonExp("BytesComparisonExp", BytesScalar, false)
+	jsonComparisonExp     = newContainmentExp("JSONComparisonExp", JSONScalar)
+)
+
+// comparisonOperators maps filter operators to their SQL counterparts
+var comparisonOperators = map[string]string{
+	"_eq":    "=",
+	"_neq":   "<>",
+	"_gt":    ">",
+	"_gte":   ">=",
+	"_lt":    "<",
+	"_lte":   "<=",
+	"_like":  "LIKE",
+	"_ilike": "ILIKE",
+
+	// Containment, for arrays and JSON
+	"_contains":     "@>",
+	"_contained_in": "<@",
+}
+
+// newComparisonExp creates the input type holding the operators for a scalar
+func newComparisonExp(name string, scalar graphql.Input, textOps bool) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{
+		"_eq":      &graphql.InputObjectFieldConfig{Type: scalar},
+		"_neq":     &graphql.InputObjectFieldConfig{Type: scalar},
+		"_gt":      &graphql.InputObjectFieldConfig{Type: scalar},
+		"_gte":     &graphql.InputObjectFieldConfig{Type: scalar},
+		"_lt":      &graphql.InputObjectFieldConfig{Type: scalar},
+		"_lte":     &graphql.InputObjectFieldConfig{Type: scalar},
+		"_in":      &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(scalar))},
+		"_is_null": &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	}
+	if textOps {
+		fields["_like"] = &graphql.InputObjectFieldConfig{Type: scalar}
+		fields["_ilike"] = &graphql.InputObjectFieldConfig{Type: scalar}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   name,
+		Fields: fields,
+	})
+}
+
+// newContainmentExp creates the input type holding the operators for values that
+// are compared as a whole or by containment (arrays and JSON)
+func newContainmentExp(name string, valueType graphql.Input) *graphql.InputObject {
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: name,
+		Fields: graphql.InputObjectConfigFieldMap{
+			"_eq":           &graphql.InputObjectFieldConfig{Type: valueType},
+			"_neq":          &graphql.InputObjectFieldConfig{Type: valueType},
+			"_contains":     &graphql.InputObjectFieldConfig{Type: valueType},
+			"_contained_in": &graphql.InputObjectFieldConfig{Type: valueType},
+			"_is_null":      &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		},
+	})
+}
+
+// getComparisonExp returns the comparison input type matching a column's data type
+func (g *SchemaGenerator) getComparisonExp(dataType string) *graphql.InputObject {
+	gqlType := g.getGraphQLType(dataType)
+
+	// Arrays, e.g. tags: StringArrayComparisonExp { _contains: ["go"] }
+	if list, ok := gqlType.(*graphql.List); ok {
+		name := list.OfType.Name() + "ArrayComparisonExp"
+		if exp, ok := g.arrayComparisonExps[name]; ok {
+			return exp
+		}
+		exp := newContainmentExp(name, graphql.NewList(graphql.NewNonNull(list.OfType)))
+		if g.arrayComparisonExps != nil {
+			g.arrayComparisonExps[name] = exp
+		}
+		return exp
+	}
+
+	switch gqlType {
+	case graphql.Int:
+		return intComparisonExp
+	case graphql.Float:
+		return floatComparisonExp
+	case graphql.Boolean:
+		return booleanComparisonExp
+	case BigIntScalar:
+		return bigIntComparisonExp
+	case DecimalScalar:
+		return decimalComparisonExp
+	case DateTimeScalar:
+		return dateTimeComparisonExp
+	case DateScalar:
+		return dateComparisonExp
+	case UUIDScalar:
+		return uuidComparisonExp
+	case BytesScalar:
+		return bytesComparisonExp
+	case JSONScalar:
+		return jsonComparisonExp
+	}
+	if exp, ok := g.enumComparisonExps[dataType]; ok {
+		return exp
+	}
+	return stringComparisonExp
+}
+
+// buildBoolExp creates the <Type>BoolExp input used by the `where` argument of a table
+func (g *SchemaGenerator) buildBoolExp(table Table) *graphql.InputObject {
+	var boolExp *graphql.InputObject
+	boolExp = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: strcase.ToCamel(table.Name) + "BoolExp",
+		Fields: (graphql.InputObjectConfigFieldMapThunk)(func() graphql.InputObjectConfigFieldMap {
+			fields := graphql.InputObjectConfigFieldMap{
+				"_and": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(boolExp))},
+				"_or":  &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(boolExp))},
+				"_not": &graphql.InputObjectFieldConfig{Type: boolExp},
+			}
+			for _, col := range table.Columns {
+				fields[strcase.ToLowerCamel(col.Name)] = &graphql.InputObjectFieldConfig{
+					Type: g.getComparisonExp(col.DataType),
+				}
+			}
+			// Full-text search, e.g. products(where: { _search: "red lamp" })
+			if len(searchSources(table)) > 0 {
+				fields[searchFilterField] = &graphql.InputObjectFieldConfig{
+					Type:        graphql.String,
+					Description: "Matches rows against a full-text search query",
+				}
+			}
+			return fields
+		}),
+	})
+	return boolExp
+}
+
+// queryArgs collects positional parameters while a SQL statement is being built
+type queryArgs struct {
+	values []interface{}
+}
+
+// add appends a value and returns its placeholder ($1, $2, ...)
+func (a *queryArgs) add(v interface{}) string {
+	a.values = append(a.values, sqlValue(v))
+	return fmt.Sprintf("$%d", len(a.values))
+}
+
+// buildWhere compiles a BoolExp argument into a parameterised SQL condition.
+// An empty expression yields an empty string.
+func buildWhere(table Table, exp map[string]interface{}, args *queryArgs) (string, error) {
+	var conds []string
+
+	for _, key := range sortedKeys(exp) {
+		val := exp[key]
+		if val == nil {
+			continue
+		}
+
+		switch key {
+		case "_and", "_or":
+			items, ok := val.([]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s expects a list", key)
+			}
+			var parts []string
+			for _, item := range items {
+				sub, ok := item.(map[string]interface{})
+				if !ok {
+					return "", fmt.Errorf("%s expects a list of objects", key)
+				}
+				cond, err := buildWhere(table, sub, args)
+				if err != nil {
+					return "", err
+				}
+				if cond != "" {
+					parts = append(parts, cond)
+				}
+			}
+			if len(parts) == 0 {
+				continue
+			}
+			op := " AND "
+			if key == "_or" {
+				op = " OR "
+			}
+			conds = append(conds, "("+strings.Join(parts, op)+")")
+
+		case "_not":
+			sub, ok := val.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("_not expects an object")
+			}
+			cond, err := buildWhere(table, sub, args)
+			if err != nil {
+				return "", err
+			}
+			if cond != "" {
+				conds = append(conds, "NOT ("+cond+")")
+			}
+
+		case searchFilterField:
+			cond, err := searchCondition(table, val, args)
+			if err != nil {
+				return "", err
+			}
+			conds = append(conds, cond)
+
+		default:
+			col, ok := findColumn(table, key)
+			if !ok {
+				return "", fmt.Errorf("unknown filter field: %s", key)
+			}
+			ops, ok := val.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("filter on %s expects an object", key)
+			}
+			colConds, err := buildComparison(col.Name, ops, args)
+			if err != nil {
+				return "", err
+			}
+			conds = append(conds, colConds...)
+		}
+	}
+
+	return strings.Join(conds, " AND "), nil
+}
+
+// buildComparison compiles the operators applied to a single column
+func buildComparison(column string, ops map[string]interface{}, args *queryArgs) ([]string, error) {
+	if err := validateIdentifier(column); err != nil {
+		return nil, err
+	}
+	quoted := fmt.Sprintf(`"%s"`, column)
+
+	var conds []string
+	for _, op := range sortedKeys(ops) {
+		val := ops[op]
+		if val == nil {
+			continue
+		}
+		switch op {
+		case "_is_null":
+			isNull, ok := val.(bool)
+			if !ok {
+				continue
+			}
+			if isNull {
+				conds = append(conds, quoted+" IS NULL")
+			} else {
+				conds = append(conds, quoted+" IS NOT NULL")
+			}
+		case "_in":
+			items, ok := val.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("_in expects a list")
+			}
+			if len(items) == 0 {
+				conds = append(conds, "FALSE")
+				continue
+			}
+			placeholders := make([]string, len(items))
+			for i, item := range items {
+				placeholders[i] = args.add(item)
+			}
+			conds = append(conds, fmt.Sprintf("%s IN (%s)", quoted, strings.Join(placeholders, ", ")))
+		default:
+			sqlOp, ok := comparisonOperators[op]
+			if !ok {
+				return nil, fmt.Errorf("unknown filter operator: %s", op)
+			}
+			conds = append(conds, fmt.Sprintf("%s %s %s", quoted, sqlOp, args.add(val)))
+		}
+	}
+	return conds, nil
+}
+
+// keyCondition matches the row identified by the primary key arguments in values
+func keyCondition(pk []string, values map[string]interface{}, args *queryArgs) (string, error) {
+	if len(pk) == 0 {
+		return "", fmt.Errorf("table has no primary key")
+	}
+	conds := make([]string, len(pk))
+	for i, col := range pk {
+		if err := validateIdentifier(col); err != nil {
+			return "", fmt.Errorf("invalid primary key name")
+		}
+		val, ok := values[keyArgName(pk, col)]
+		if !ok {
+			return "", fmt.Errorf("argument %s is required", keyArgName(pk, col))
+		}
+		conds[i] = fmt.Sprintf(`"%s" = %s`, col, args.add(val))
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// findColumn resolves a GraphQL field name (camelCase) to its table column
+func findColumn(table Table, fieldName string) (Column, bool) {
+	for _, col := range table.Columns {
+		if strcase.ToLowerCamel(col.Name) == fieldName {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+// sortedKeys returns map keys in a stable order so generated SQL is deterministic
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,108 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func filterTestTable() Table {
+	return Table{
+		Name: "posts",
+		Columns: []Column{
+			{Name: "id", DataType: "integer", IsPK: true},
+			{Name: "title", DataType: "text"},
+			{Name: "view_count", DataType: "integer", IsNullable: true},
+			{Name: "is_published", DataType: "boolean", IsNullable: true},
+		},
+	}
+}
+
+func TestBuildWhere_Comparisons(t *testing.T) {
+	args := &queryArgs{}
+	cond, err := buildWhere(filterTestTable(), map[string]interface{}{
+		"title":     map[string]interface{}{"_ilike": "%go%"},
+		"viewCount": map[string]interface{}{"_gt": 10, "_lte": 100},
+	}, args)
+
+	require.NoError(t, err)
+	assert.Equal(t, `"title" ILIKE $1 AND "view_count" > $2 AND "view_count" <= $3`, cond)
+	assert.Equal(t, []interface{}{"%go%", 10, 100}, args.values)
+}
+
+func TestBuildWhere_InAndIsNull(t *testing.T) {
+	args := &queryArgs{}
+	cond, err := buildWhere(filterTestTable(), map[string]interface{}{
+		"id":          map[string]interface{}{"_in": []interface{}{1, 2, 3}},
+		"isPublished": map[string]interface{}{"_is_null": false},
+	}, args)
+
+	require.NoError(t, err)
+	assert.Equal(t, `"id" IN ($1, $2, $3) AND "is_published" IS NOT NULL`, cond)
+	assert.Len(t, args.values, 3)
+
+	args = &queryArgs{}
+	cond, err = buildWhere(filterTestTable(), map[string]interface{}{
+		"id": map[string]interface{}{"_in": []interface{}{}},
+	}, args)
+	require.NoError(t, err)
+	assert.Equal(t, "FALSE", cond)
+	assert.Empty(t, args.values)
+}
+
+func TestBuildWhere_BooleanOperators(t *testing.T) {
+	args := &queryArgs{}
+	cond, err := buildWhere(filterTestTable(), map[string]interface{}{
+		"_or": []interface{}{
+			map[string]interface{}{"title": map[string]interface{}{"_eq": "a"}},
+			map[string]interface{}{"title": map[string]interface{}{"_eq": "b"}},
+		},
+		"_not": map[string]interface{}{
+			"isPublished": map[string]interface{}{"_eq": true},
+		},
+	}, args)
+
+	require.NoError(t, err)
+	assert.Equal(t, `NOT ("is_published" = $1) AND ("title" = $2 OR "title" = $3)`, cond)
+	assert.Equal(t, []interface{}{true, "a", "b"}, args.values)
+}
+
+func TestBuildWhere_Errors(t *testing.T) {
+	_, err := buildWhere(filterTestTable(), map[string]interface{}{
+		"unknown": map[string]interface{}{"_eq": 1},
+	}, &queryArgs{})
+	assert.Error(t, err)
+
+	_, err = buildWhere(filterTestTable(), map[string]interface{}{
+		"title": map[string]interface{}{"_regex": ".*"},
+	}, &queryArgs{})
+	assert.Error(t, err)
+}
+
+func TestBuildWhere_Empty(t *testing.T) {
+	cond, err := buildWhere(filterTestTable(), map[string]interface{}{}, &queryArgs{})
+	require.NoError(t, err)
+	assert.Empty(t, cond)
+}
+
+func TestGenerate_WhereArguments(t *testing.T) {
+	gen := NewSchemaGenerator(NewResolver(nil))
+	schema, err := gen.Generate("tenant_test", &SchemaMetadata{Tables: []Table{filterTestTable()}})
+	require.NoError(t, err)
+
+	boolExp := schema.Type("PostsBoolExp")
+	require.NotNil(t, boolExp, "PostsBoolExp should be generated")
+
+	field := schema.QueryType().Fields()["posts"]
+	require.NotNil(t, field)
+
+	var hasWhere bool
+	for _, arg := range field.Args {
+		if arg.Name() == "where" {
+			hasWhere = true
+			assert.Equal(t, "PostsBoolExp", arg.Type.Name())
+		}
+	}
+	assert.True(t, hasWhere, "posts should accept a where argument")
+}
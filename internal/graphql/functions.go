@@ -0,0 +1,193 @@
+package graphql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+// functionArgName returns the GraphQL argument name of a function parameter;
+// unnamed parameters are exposed positionally as arg1, arg2, ...
+func functionArgName(arg FunctionArg, idx int) string {
+	if arg.Name == "" {
+		return fmt.Sprintf("arg%d", idx+1)
+	}
+	return strcase.ToLowerCamel(arg.Name)
+}
+
+// namedFunctionArgs reports whether every parameter is named, which allows calling
+// the function with named notation and leaving defaulted parameters out
+func namedFunctionArgs(fn Function) bool {
+	for _, arg := range fn.Args {
+		if arg.Name == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// buildFunctionField creates the query or mutation field calling a SQL function.
+// Set-returning functions also accept the list arguments of their return table.
+func (g *SchemaGenerator) buildFunctionField(tenantSchema string, fn Function, tables map[string]Table, returnType *graphql.Object, boolExp, orderBy *graphql.InputObject) *graphql.Field {
+	named := namedFunctionArgs(fn)
+
+	args := graphql.FieldConfigArgument{}
+	for idx, arg := range fn.Args {
+		argType := g.getGraphQLType(arg.DataType)
+		// Defaulted parameters can only be skipped with named notation
+		if !arg.HasDefault || !named {
+			argType = graphql.NewNonNull(argType)
+		}
+		args[functionArgName(arg, idx)] = &graphql.ArgumentConfig{Type: argType}
+	}
+
+	var fieldType graphql.Output = returnType
+	if fn.ReturnsSet {
+		fieldType = graphql.NewList(returnType)
+		for name, arg := range listArgs(boolExp, orderBy) {
+			// Function parameters win over list arguments of the same name
+			if _, exists := args[name]; !exists {
+				args[name] = arg
+			}
+		}
+	}
+
+	return &graphql.Field{
+		Type:        fieldType,
+		Args:        args,
+		Description: fn.Comment,
+		Resolve:     g.resolver.ResolveFunction(tenantSchema, tables, fn),
+	}
+}
+
+// functionCall renders the call of fn with the provided GraphQL arguments
+func functionCall(schemaName string, fn Function, values map[string]interface{}, args *queryArgs) (string, error) {
+	named := namedFunctionArgs(fn)
+
+	var params []string
+	for idx, arg := range fn.Args {
+		val, ok := values[functionArgName(arg, idx)]
+		if !ok {
+			if named && arg.HasDefault {
+				continue
+			}
+			return "", fmt.Errorf("argument %s is required", functionArgName(arg, idx))
+		}
+		if named {
+			if err := validateIdentifier(arg.Name); err != nil {
+				return "", fmt.Errorf("invalid argument name")
+			}
+			params = append(params, fmt.Sprintf(`"%s" => %s`, arg.Name, args.add(val)))
+		} else {
+			params = append(params, args.add(val))
+		}
+	}
+	return fmt.Sprintf(`"%s"."%s"(%s)`, schemaName, fn.Name, strings.Join(params, ", ")), nil
+}
+
+// ResolveFunction returns a function that calls a SQL function returning rows of a
+// table. Set-returning functions are filtered, ordered and paged like list queries.
+func (r *Resolver) ResolveFunction(schemaName string, tables map[string]Table, fn Function) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		// Validate identifiers to prevent SQL injection
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := validateIdentifier(fn.Name); err != nil {
+			return nil, fmt.Errorf("invalid function name")
+		}
+		table, ok := tables[fn.ReturnTable]
+		if !ok {
+			return nil, fmt.Errorf("unknown return type")
+		}
+		if err := validateIdentifier(table.Name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+
+		args := &queryArgs{}
+		call, err := functionCall(schemaName, fn, p.Args, args)
+		if err != nil {
+			return nil, err
+		}
+
+		// The alias lets where/order_by reference columns as for the table itself
+		query := fmt.Sprintf(`SELECT * FROM %s AS "%s"`, call, table.Name)
+
+		// Rows hidden by the role's row filter are dropped from the results
+		filter, err := rowFilter(p.Context, table, args)
+		if err != nil {
+			return nil, err
+		}
+		var conds []string
+		if filter != "" {
+			conds = append(conds, filter)
+		}
+		if where, ok := p.Args["where"].(map[string]interface{}); ok && fn.ReturnsSet {
+			cond, err := buildWhere(table, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if cond != "" {
+				conds = append(conds, cond)
+			}
+		}
+		if len(conds) > 0 {
+			query += " WHERE " + strings.Join(conds, " AND ")
+		}
+
+		if fn.ReturnsSet {
+			orderBy, err := buildOrderBy(p.Context, schemaName, tables, table, p.Args["order_by"], args)
+			if err != nil {
+				return nil, err
+			}
+			if orderBy != "" {
+				query += " ORDER BY " + orderBy
+			}
+
+			limit, _ := p.Args["limit"].(int)
+			offset, _ := p.Args["offset"].(int)
+			if limit <= 0 {
+				limit = DefaultLimit
+			}
+			if limit > MaxLimit {
+				limit = MaxLimit
+			}
+			query += fmt.Sprintf(" LIMIT %d", limit)
+			if offset > 0 {
+				query += fmt.Sprintf(" OFFSET %d", offset)
+			}
+		}
+
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(p.Context, err, "function call failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read results")
+		}
+
+		if fn.ReturnsSet {
+			return results, nil
+		}
+		// A function returning NULL yields a single row of NULLs
+		if len(results) == 0 || allNil(results[0]) {
+			return nil, nil
+		}
+		return results[0], nil
+	}
+}
+
+// allNil reports whether every value of a row is NULL
+func allNil(row map[string]interface{}) bool {
+	for _, v := range row {
+		if v != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunctionCall_NamedSkipsDefaults(t *testing.T) {
+	fn := Function{
+		Name: "search_posts",
+		Args: []FunctionArg{
+			{Name: "term", DataType: "text"},
+			{Name: "min_views", DataType: "integer", HasDefault: true},
+		},
+		ReturnTable: "posts",
+		ReturnsSet:  true,
+	}
+
+	args := &queryArgs{}
+	call, err := functionCall("tenant_test", fn, map[string]interface{}{"term": "go"}, args)
+	require.NoError(t, err)
+	assert.Equal(t, `"tenant_test"."search_posts"("term" => $1)`, call)
+	assert.Equal(t, []interface{}{"go"}, args.values)
+
+	_, err = functionCall("tenant_test", fn, map[string]interface{}{"minViews": 3}, &queryArgs{})
+	assert.Error(t, err, "parameters without defaults are required")
+}
+
+func TestFunctionCall_Positional(t *testing.T) {
+	fn := Function{
+		Name:        "post_by_slug",
+		Args:        []FunctionArg{{DataType: "text"}},
+		ReturnTable: "posts",
+	}
+
+	args := &queryArgs{}
+	call, err := functionCall("tenant_test", fn, map[string]interface{}{"arg1": "hello"}, args)
+	require.NoError(t, err)
+	assert.Equal(t, `"tenant_test"."post_by_slug"($1)`, call)
+}
+
+func TestGenerate_ViewsAndFunctions(t *testing.T) {
+	tables := orderTestTables()
+	view := Table{
+		Name:     "popular_posts",
+		Columns:  []Column{{Name: "id", DataType: "integer"}, {Name: "title", DataType: "text"}},
+		ReadOnly: true,
+	}
+
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{tables["authors"], tables["posts"], view},
+		Functions: []Function{
+			{Name: "search_posts", Args: []FunctionArg{{Name: "term", DataType: "text"}}, ReturnTable: "posts", ReturnsSet: true},
+			{Name: "archive_post", Args: []FunctionArg{{Name: "post_id", DataType: "integer"}}, ReturnTable: "posts", Volatile: true},
+		},
+	})
+	require.NoError(t, err)
+
+	queries := schema.QueryType().Fields()
+	mutations := schema.MutationType().Fields()
+
+	assert.Contains(t, queries, "popularPosts")
+	assert.NotContains(t, mutations, "createPopularPosts", "views are read-only")
+	assert.NotContains(t, schema.SubscriptionType().Fields(), "popularPostsChanged")
+
+	require.Contains(t, queries, "searchPosts")
+	assert.Equal(t, "[Posts]", queries["searchPosts"].Type.String())
+	argNames := make([]string, 0)
+	for _, arg := range queries["searchPosts"].Args {
+		argNames = append(argNames, arg.Name())
+	}
+	assert.ElementsMatch(t, []string{"term", "limit", "offset", "where", "order_by"}, argNames)
+
+	require.Contains(t, mutations, "archivePost")
+	assert.Equal(t, "Posts", mutations["archivePost"].Type.String())
+	assert.NotContains(t, queries, "archivePost")
+}
@@ -0,0 +1,223 @@
+package graphql
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// GraphiQLConfig controls the GraphiQL page served for each tenant
+type GraphiQLConfig struct {
+	// Enabled serves the page; it is off by default
+	Enabled bool
+
+	// Roles are the session roles allowed to use the page
+	Roles []string
+
+	// Assets are the scripts and stylesheet the page loads
+	Assets GraphiQLAssets
+}
+
+// Validate checks that an enabled page only loads assets pinned by an
+// integrity hash, since the page holds the admin session's token
+func (c GraphiQLConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	for _, asset := range c.Assets.list() {
+		if asset.URL == "" {
+			return fmt.Errorf("graphiql asset URL is empty")
+		}
+		if !validIntegrity(asset.Integrity) {
+			return fmt.Errorf("graphiql asset %s needs a sha256, sha384 or sha512 integrity hash", asset.URL)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether the page is enabled for a session role
+func (c GraphiQLConfig) Allows(role string) bool {
+	if !c.Enabled {
+		return false
+	}
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphiQL asset versions; the integrity hashes configured for the assets must
+// match these exact builds
+const (
+	graphiQLVersion = "3.8.3"
+	reactVersion    = "18.3.1"
+)
+
+// GraphiQLAsset is a script or stylesheet of the page with its subresource
+// integrity hash
+type GraphiQLAsset struct {
+	URL       string
+	Integrity string
+}
+
+// GraphiQLAssets are the assets the GraphiQL page loads
+type GraphiQLAssets struct {
+	Stylesheet GraphiQLAsset
+	React      GraphiQLAsset
+	ReactDOM   GraphiQLAsset
+	GraphiQL   GraphiQLAsset
+}
+
+// DefaultGraphiQLAssets returns the pinned asset URLs under base, a CDN such as
+// https://unpkg.com or a self-hosted copy with the same layout. The integrity
+// hashes are left to the caller.
+func DefaultGraphiQLAssets(base string) GraphiQLAssets {
+	base = strings.TrimRight(base, "/")
+	return GraphiQLAssets{
+		Stylesheet: GraphiQLAsset{URL: base + "/graphiql@" + graphiQLVersion + "/graphiql.min.css"},
+		React:      GraphiQLAsset{URL: base + "/react@" + reactVersion + "/umd/react.production.min.js"},
+		ReactDOM:   GraphiQLAsset{URL: base + "/react-dom@" + reactVersion + "/umd/react-dom.production.min.js"},
+		GraphiQL:   GraphiQLAsset{URL: base + "/graphiql@" + graphiQLVersion + "/graphiql.min.js"},
+	}
+}
+
+func (a GraphiQLAssets) list() []GraphiQLAsset {
+	return []GraphiQLAsset{a.Stylesheet, a.React, a.ReactDOM, a.GraphiQL}
+}
+
+// validIntegrity reports whether value is a list of SRI hashes of a supported
+// algorithm
+func validIntegrity(value string) bool {
+	hashes := strings.Fields(value)
+	if len(hashes) == 0 {
+		return false
+	}
+	for _, h := range hashes {
+		if !strings.HasPrefix(h, "sha256-") && !strings.HasPrefix(h, "sha384-") && !strings.HasPrefix(h, "sha512-") {
+			return false
+		}
+	}
+	return true
+}
+
+// GraphiQLPage holds the URLs a tenant's GraphiQL page talks to
+type GraphiQLPage struct {
+	Title string
+
+	// Endpoint is the tenant's GraphQL endpoint
+	Endpoint string
+
+	// AccessURL answers 204 when the token's role may use the page
+	AccessURL string
+
+	// Assets are the scripts and stylesheet the page loads
+	Assets GraphiQLAssets
+}
+
+// graphiQLTokenKey is the localStorage key of the admin console's session token
+const graphiQLTokenKey = "kapok_access_token"
+
+// graphiQLTemplate loads GraphiQL from the configured assets, each pinned by
+// its integrity hash. The page cannot send the admin
+// session's token with its own request, so it takes the token from the URL
+// fragment the admin console opens it with, which is never sent to the server
+// (or from the console's storage when both share an origin). It keeps the token
+// in sessionStorage, drops it from the address bar and checks the role before
+// rendering.
+var graphiQLTemplate = template.Must(template.New("graphiql").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <meta name="referrer" content="no-referrer">
+  <title>{{.Title}} · GraphiQL</title>
+  <link rel="stylesheet" href="{{.Assets.Stylesheet.URL}}" integrity="{{.Assets.Stylesheet.Integrity}}" crossorigin="anonymous">
+  <style>
+    body { margin: 0; height: 100vh; font-family: system-ui, sans-serif; }
+    #graphiql { height: 100vh; }
+    .message { padding: 2rem; color: #444; }
+  </style>
+</head>
+<body>
+  <div id="graphiql"><p class="message">Loading…</p></div>
+  <script src="{{.Assets.React.URL}}" integrity="{{.Assets.React.Integrity}}" crossorigin="anonymous"></script>
+  <script src="{{.Assets.ReactDOM.URL}}" integrity="{{.Assets.ReactDOM.Integrity}}" crossorigin="anonymous"></script>
+  <script src="{{.Assets.GraphiQL.URL}}" integrity="{{.Assets.GraphiQL.Integrity}}" crossorigin="anonymous"></script>
+  <script>
+    (function () {
+      var endpoint = {{.Endpoint}};
+      var accessURL = {{.AccessURL}};
+      var storageKey = "kapok_graphiql_token";
+      var root = document.getElementById("graphiql");
+
+      function message(text) {
+        root.innerHTML = "";
+        var p = document.createElement("p");
+        p.className = "message";
+        p.textContent = text;
+        root.appendChild(p);
+      }
+
+      var params = new URLSearchParams(location.hash.slice(1));
+      if (params.get("token")) {
+        sessionStorage.setItem(storageKey, params.get("token"));
+        history.replaceState(null, "", location.pathname + location.search);
+      }
+      var token = sessionStorage.getItem(storageKey) || localStorage.getItem({{.TokenKey}});
+      if (!token) {
+        message("Sign in to the admin console and open GraphiQL from the playground.");
+        return;
+      }
+      var headers = { Authorization: "Bearer " + token };
+
+      fetch(accessURL, { headers: headers }).then(function (res) {
+        if (res.status === 401) {
+          sessionStorage.removeItem(storageKey);
+          message("Your admin session has expired. Sign in again and reopen GraphiQL.");
+          return;
+        }
+        if (!res.ok) {
+          message("GraphiQL is not enabled for your role.");
+          return;
+        }
+        ReactDOM.createRoot(root).render(React.createElement(GraphiQL, {
+          fetcher: GraphiQL.createFetcher({ url: endpoint, headers: headers }),
+          shouldPersistHeaders: false
+        }));
+      }, function () {
+        message("Could not reach the server.");
+      });
+    })();
+  </script>
+</body>
+</html>
+`))
+
+// ServeGraphiQL writes the GraphiQL page of a tenant; it refuses to load assets
+// without an integrity hash
+func ServeGraphiQL(w http.ResponseWriter, page GraphiQLPage) {
+	for _, asset := range page.Assets.list() {
+		if asset.URL == "" || !validIntegrity(asset.Integrity) {
+			http.Error(w, "graphiql assets are not pinned", http.StatusInternalServerError)
+			return
+		}
+	}
+	var buf bytes.Buffer
+	err := graphiQLTemplate.Execute(&buf, struct {
+		GraphiQLPage
+		TokenKey string
+	}{page, graphiQLTokenKey})
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,80 @@
+package graphql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphiQLConfig_Allows(t *testing.T) {
+	cfg := GraphiQLConfig{Enabled: true, Roles: []string{AdminRole, "developer"}}
+	assert.True(t, cfg.Allows(AdminRole))
+	assert.True(t, cfg.Allows("developer"))
+	assert.False(t, cfg.Allows("user"))
+	assert.False(t, cfg.Allows(""))
+
+	cfg.Enabled = false
+	assert.False(t, cfg.Allows(AdminRole))
+}
+
+func testGraphiQLAssets() GraphiQLAssets {
+	assets := DefaultGraphiQLAssets("https://cdn.example.com/")
+	assets.Stylesheet.Integrity = "sha384-css"
+	assets.React.Integrity = "sha384-react"
+	assets.ReactDOM.Integrity = "sha384-reactdom"
+	assets.GraphiQL.Integrity = "sha512-graphiql sha384-graphiql"
+	return assets
+}
+
+func TestGraphiQLConfig_Validate(t *testing.T) {
+	assert.NoError(t, GraphiQLConfig{}.Validate())
+
+	cfg := GraphiQLConfig{Enabled: true, Assets: testGraphiQLAssets()}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Assets.ReactDOM.Integrity = ""
+	assert.ErrorContains(t, cfg.Validate(), "react-dom@18.3.1")
+
+	cfg.Assets.ReactDOM.Integrity = "md5-abc"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Assets = DefaultGraphiQLAssets("https://unpkg.com")
+	assert.Error(t, cfg.Validate())
+}
+
+func TestServeGraphiQL_RequiresPinnedAssets(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ServeGraphiQL(rec, GraphiQLPage{Assets: DefaultGraphiQLAssets("https://unpkg.com")})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "<script")
+}
+
+func TestServeGraphiQL(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ServeGraphiQL(rec, GraphiQLPage{
+		Title:     "Acme <prod>",
+		Endpoint:  "/api/v1/tenants/t1/graphql?x=</script>",
+		AccessURL: "/api/v1/tenants/t1/graphiql/access",
+		Assets:    testGraphiQLAssets(),
+	})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "<title>Acme &lt;prod&gt; · GraphiQL</title>")
+	// URLs are embedded as JavaScript strings
+	assert.Contains(t, body, `var endpoint = "/api/v1/tenants/t1/graphql?x=\u003c/script\u003e";`)
+	assert.Contains(t, body, `var accessURL = "/api/v1/tenants/t1/graphiql/access";`)
+	assert.Contains(t, body, `localStorage.getItem("kapok_access_token")`)
+	// Assets are pinned to exact versions and integrity hashes
+	assert.Contains(t, body, `<link rel="stylesheet" href="https://cdn.example.com/graphiql@3.8.3/graphiql.min.css" integrity="sha384-css" crossorigin="anonymous">`)
+	assert.Contains(t, body, `<script src="https://cdn.example.com/react@18.3.1/umd/react.production.min.js" integrity="sha384-react" crossorigin="anonymous"></script>`)
+	assert.Contains(t, body, `<script src="https://cdn.example.com/react-dom@18.3.1/umd/react-dom.production.min.js" integrity="sha384-reactdom" crossorigin="anonymous"></script>`)
+	assert.Contains(t, body, `<script src="https://cdn.example.com/graphiql@3.8.3/graphiql.min.js" integrity="sha512-graphiql sha384-graphiql" crossorigin="anonymous"></script>`)
+	assert.NotContains(t, body, "unpkg.com")
+}
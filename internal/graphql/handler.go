@@ -2,55 +2,158 @@ package graphql
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
-	gqlhandler "github.com/graphql-go/handler"
+	"github.com/graphql-go/graphql/gqlerrors"
 	"github.com/kapok/kapok/internal/database"
 	"github.com/kapok/kapok/internal/tenant"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog"
 )
 
 const (
 	// SchemaCacheTTL is the time-to-live for cached schemas
 	SchemaCacheTTL = 5 * time.Minute
+
+	// maxRequestBodySize bounds the GraphQL request body (1 MB)
+	maxRequestBodySize = 1 << 20
 )
 
 // validIdentifier matches valid PostgreSQL identifiers
 var validIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 
-// cachedSchema holds a schema with its expiration time
+// cachedSchema holds a schema, the metadata it was generated from and its
+// expiration time
 type cachedSchema struct {
 	schema    *graphql.Schema
+	metadata  *SchemaMetadata
+	expiresAt time.Time
+
+	// openAPI is the OpenAPI document of the schema, generated when first served
+	openAPIOnce sync.Once
+	openAPI     *OpenAPIDocument
+
+	// sdl is the schema in the schema definition language, printed when first served
+	sdlOnce sync.Once
+	sdl     string
+}
+
+// cachedPermissions holds the role permissions of a tenant with their expiration time
+type cachedPermissions struct {
+	roles     map[string]*RolePermissions
+	expiresAt time.Time
+}
+
+// cachedActions holds the actions of a tenant with their expiration time
+type cachedActions struct {
+	actions   []Action
+	expiresAt time.Time
+}
+
+// cachedRemoteSchemas holds the introspected remote schemas of a tenant with
+// their expiration time
+type cachedRemoteSchemas struct {
+	remotes   []RemoteSchema
 	expiresAt time.Time
 }
 
 // Handler serves GraphQL requests with dynamic schema generation
 type Handler struct {
+	resolver     *Resolver
 	introspector *Introspector
 	generator    *SchemaGenerator
 	logger       zerolog.Logger
 
+	// limits are the query limits of tenants without their own
+	limits tenant.QueryLimits
+
+	// operations holds persisted queries and allowlists; nil disables them
+	operations OperationStore
+	// operationCache caches lookups of operations
+	operationCache operationCache
+
+	// permissions restricts the schema per role; nil leaves tenants unrestricted
+	permissions PermissionStore
+
+	// actions extend the schema of tenants with HTTP handlers; nil disables them
+	actions ActionStore
+
+	// remoteSchemas merge GraphQL services into the schema of tenants; nil
+	// disables them
+	remoteSchemas RemoteSchemaStore
+
+	// wsAuth authenticates graphql-ws clients by their connection_init token
+	wsAuth WebSocketAuthenticator
+
+	// origins may open WebSockets besides the server's own
+	origins []string
+
 	// In-memory cache for schemas with TTL
-	// Key: schemaName, Value: *cachedSchema
+	// Key: schemaName, or schemaName/role for restricted roles, Value: *cachedSchema
 	schemaCache sync.Map
+
+	// Generations of the cached schemas, bumped on invalidation so loads that
+	// started before it do not cache what they generated
+	// Key: schemaName, Value: *atomic.Uint64
+	schemaGenerations sync.Map
+	allGeneration     atomic.Uint64
+
+	// In-memory cache for role permissions with TTL
+	// Key: tenantID, Value: *cachedPermissions
+	permissionCache sync.Map
+
+	// In-memory cache for actions with TTL
+	// Key: tenantID, Value: *cachedActions
+	actionCache sync.Map
+
+	// In-memory cache for introspected remote schemas with TTL
+	// Key: tenantID, Value: *cachedRemoteSchemas
+	remoteSchemaCache sync.Map
 }
 
 // NewHandler creates a new GraphQL handler
 func NewHandler(db *database.DB, logger zerolog.Logger) *Handler {
 	resolver := NewResolver(db)
+	resolver.logger = logger
 	return &Handler{
-		introspector: NewIntrospector(db),
-		generator:    NewSchemaGenerator(resolver),
-		logger:       logger,
+		resolver:      resolver,
+		introspector:  NewIntrospector(db),
+		generator:     NewSchemaGenerator(resolver),
+		logger:        logger,
+		limits:        DefaultQueryLimits(),
+		operations:    NewOperationRepository(db),
+		permissions:   NewPermissionRepository(db),
+		actions:       NewActionRepository(db),
+		remoteSchemas: NewRemoteSchemaRepository(db),
 	}
 }
 
+// SetDefaultQueryLimits replaces the server-wide query limits; zero values keep
+// the built-in defaults
+func (h *Handler) SetDefaultQueryLimits(limits tenant.QueryLimits) {
+	h.limits = limits.WithDefaults(DefaultQueryLimits())
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Errors of the request are logged and reported under one correlation ID
+	requestID := requestCorrelationID(r)
+	w.Header().Set(CorrelationHeader, requestID)
+	r = r.WithContext(withCorrelationID(r.Context(), requestID))
+
+	// Remote schemas may be sent some of the client's headers
+	r = r.WithContext(withClientHeader(r.Context(), r.Header))
 	ctx := r.Context()
 
 	// 1. Get Tenant Context using the tenant package
@@ -80,37 +183,250 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Str("schema_name", schemaName).
 		Msg("handling graphql request")
 
-	// 2. Get Schema (Cache or Generate)
-	schema, err := h.getSchema(ctx, schemaName)
+	// Upgrades without a session authenticate in connection_init, which loads
+	// the schema of their role
+	if websocket.IsWebSocketUpgrade(r) && SessionFromContext(ctx) == nil {
+		h.serveWebSocket(w, r, nil, t.QueryLimits.WithDefaults(h.limits))
+		return
+	}
+
+	// 2. Get Schema (Cache or Generate), restricted to the caller's role
+	cached, err := h.getRoleSchema(ctx, t)
+	if errors.Is(err, ErrRoleNotAllowed) {
+		h.logger.Warn().Err(err).Str("tenant_id", t.ID).Msg("graphql request rejected by permissions")
+		http.Error(w, "forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		h.logger.Error().Err(err).Str("schema_name", schemaName).Msg("failed to get schema")
 		http.Error(w, "failed to load schema", http.StatusInternalServerError)
 		return
 	}
+	schema := cached.schema
+
+	limits := t.QueryLimits.WithDefaults(h.limits)
+
+	// 3. Subscriptions (and any other operation) over graphql-ws
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r, schema, limits)
+		return
+	}
+
+	// 4. Resolve persisted queries and enforce the tenant's allowlist
+	req := parseRequest(r)
+	query, opErr := h.resolveOperation(ctx, t, req.Query, req.Extensions)
 
-	// 3. Serve via standard handler
-	gh := gqlhandler.New(&gqlhandler.Config{
-		Schema:   schema,
-		Pretty:   true,
-		GraphiQL: false,
+	// 5. Reject over-budget operations before they reach the database
+	cost := analyzeQuery(schema, query, req.OperationName, req.Variables, limits.MaxNodes)
+
+	var result *graphql.Result
+	if opErr != nil {
+		result = &graphql.Result{Errors: []gqlerrors.FormattedError{*opErr}}
+	} else if errs := cost.Check(limits); len(errs) > 0 {
+		h.logger.Warn().
+			Str("tenant_id", t.ID).
+			Int("depth", cost.Depth).
+			Int("nodes", cost.Nodes).
+			Int("cost", cost.Cost).
+			Msg("graphql query rejected by limits")
+		result = &graphql.Result{Errors: errs}
+	} else {
+		// Relation resolvers batch their lookups through a per-request loader
+		params := graphql.Params{
+			Schema:         *schema,
+			RequestString:  query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        WithLoader(ctx, NewLoader()),
+		}
+		if wantsTransaction(query, req.OperationName, transactionHeader(r)) {
+			result = h.executeInTransaction(ctx, params)
+		} else {
+			result = graphql.Do(params)
+		}
+	}
+	if result.Extensions == nil {
+		result.Extensions = make(map[string]interface{})
+	}
+	result.Extensions["cost"] = cost.extension(limits)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	buff, _ := json.MarshalIndent(result, "", "\t")
+	w.Write(buff)
+}
+
+// graphqlRequest is a GraphQL over HTTP request; extensions carry the APQ hash
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// parseRequest reads a request from the query string (GET) or the body (POST),
+// which may be JSON, application/graphql or a form. Malformed requests yield an
+// empty document, which execution reports.
+func parseRequest(r *http.Request) graphqlRequest {
+	var req graphqlRequest
+	if r.Method != http.MethodPost {
+		values := r.URL.Query()
+		req.Query = values.Get("query")
+		req.OperationName = values.Get("operationName")
+		json.Unmarshal([]byte(values.Get("variables")), &req.Variables)
+		json.Unmarshal([]byte(values.Get("extensions")), &req.Extensions)
+		return req
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+	if err != nil {
+		return req
+	}
+	switch strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]) {
+	case "application/graphql":
+		req.Query = string(body)
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return req
+		}
+		req.Query = values.Get("query")
+		req.OperationName = values.Get("operationName")
+		json.Unmarshal([]byte(values.Get("variables")), &req.Variables)
+	default:
+		json.Unmarshal(body, &req)
+	}
+	return req
+}
+
+// getRoleSchema returns the schema of the caller's role. Tenants without
+// permissions, and the admin role, get the full schema; other roles need
+// permissions of their own.
+func (h *Handler) getRoleSchema(ctx context.Context, t *tenant.Tenant) (*cachedSchema, error) {
+	roles, err := h.getPermissions(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	actions, err := h.getActions(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	remotes, err := h.getRemoteSchemas(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	role := ""
+	if s := SessionFromContext(ctx); s != nil {
+		role = s.Role
+	}
+	if len(roles) == 0 || role == AdminRole {
+		return h.loadSchema(ctx, t.SchemaName, t.SchemaName, nil, actions, remotes)
+	}
+
+	perms, ok := roles[role]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrRoleNotAllowed, role)
+	}
+	return h.loadSchema(ctx, t.SchemaName+"/"+role, t.SchemaName, perms, actions, remotes)
+}
+
+// getPermissions returns the role permissions of a tenant, keyed by role
+func (h *Handler) getPermissions(ctx context.Context, tenantID string) (map[string]*RolePermissions, error) {
+	if h.permissions == nil {
+		return nil, nil
+	}
+	if val, ok := h.permissionCache.Load(tenantID); ok {
+		cached := val.(*cachedPermissions)
+		if time.Now().Before(cached.expiresAt) {
+			return cached.roles, nil
+		}
+		h.permissionCache.Delete(tenantID)
+	}
+
+	perms, err := h.permissions.List(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+	roles := permissionsByRole(perms)
+	h.permissionCache.Store(tenantID, &cachedPermissions{
+		roles:     roles,
+		expiresAt: time.Now().Add(SchemaCacheTTL),
 	})
+	return roles, nil
+}
+
+// getActions returns the actions of a tenant
+func (h *Handler) getActions(ctx context.Context, tenantID string) ([]Action, error) {
+	if h.actions == nil {
+		return nil, nil
+	}
+	if val, ok := h.actionCache.Load(tenantID); ok {
+		cached := val.(*cachedActions)
+		if time.Now().Before(cached.expiresAt) {
+			return cached.actions, nil
+		}
+		h.actionCache.Delete(tenantID)
+	}
 
-	gh.ServeHTTP(w, r)
+	stored, err := h.actions.List(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load actions: %w", err)
+	}
+	actions := make([]Action, len(stored))
+	for i, a := range stored {
+		actions[i] = *a
+	}
+	h.actionCache.Store(tenantID, &cachedActions{
+		actions:   actions,
+		expiresAt: time.Now().Add(SchemaCacheTTL),
+	})
+	return actions, nil
 }
 
-func (h *Handler) getSchema(ctx context.Context, schemaName string) (*graphql.Schema, error) {
+// getRemoteSchemas returns the remote schemas of a tenant that could be
+// introspected
+func (h *Handler) getRemoteSchemas(ctx context.Context, tenantID string) ([]RemoteSchema, error) {
+	if h.remoteSchemas == nil {
+		return nil, nil
+	}
+	if val, ok := h.remoteSchemaCache.Load(tenantID); ok {
+		cached := val.(*cachedRemoteSchemas)
+		if time.Now().Before(cached.expiresAt) {
+			return cached.remotes, nil
+		}
+		h.remoteSchemaCache.Delete(tenantID)
+	}
+
+	stored, err := h.remoteSchemas.List(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load remote schemas: %w", err)
+	}
+	remotes := h.introspectRemoteSchemas(ctx, stored)
+	h.remoteSchemaCache.Store(tenantID, &cachedRemoteSchemas{
+		remotes:   remotes,
+		expiresAt: time.Now().Add(SchemaCacheTTL),
+	})
+	return remotes, nil
+}
+
+// loadSchema returns the schema cached under key, generating it with the
+// tenant's actions and remote schemas for the given role permissions (nil for
+// the full schema) when missing or expired
+func (h *Handler) loadSchema(ctx context.Context, key, schemaName string, perms *RolePermissions, actions []Action, remotes []RemoteSchema) (*cachedSchema, error) {
 	// Check cache with TTL
-	if val, ok := h.schemaCache.Load(schemaName); ok {
+	if val, ok := h.schemaCache.Load(key); ok {
 		cached := val.(*cachedSchema)
 		if time.Now().Before(cached.expiresAt) {
-			return cached.schema, nil
+			return cached, nil
 		}
 		// Cache expired, remove it
-		h.schemaCache.Delete(schemaName)
-		h.logger.Debug().Str("schema_name", schemaName).Msg("schema cache expired")
+		h.schemaCache.Delete(key)
+		h.logger.Debug().Str("schema_name", schemaName).Str("cache_key", key).Msg("schema cache expired")
 	}
 
 	start := time.Now()
+	generation := h.schemaGeneration(schemaName)
 
 	// Introspect
 	metadata, err := h.introspector.Inspect(ctx, schemaName)
@@ -118,29 +434,172 @@ func (h *Handler) getSchema(ctx context.Context, schemaName string) (*graphql.Sc
 		return nil, fmt.Errorf("introspection failed: %w", err)
 	}
 
-	// Generate
+	// Actions and remote schemas are generated with the tables
+	metadata.Actions = actions
+	metadata.RemoteSchemas = remotes
+
+	// Restrict to what the role may see
+	if perms != nil {
+		metadata = perms.apply(metadata)
+	}
+
+	// Generate. Actions and remote schemas were checked when saved, but the
+	// tables, enums and services they refer to may have changed since; the tables
+	// are served without them then.
 	schema, err := h.generator.Generate(schemaName, metadata)
+	if err != nil && (len(metadata.Actions) > 0 || len(metadata.RemoteSchemas) > 0) {
+		h.logger.Error().Err(err).Str("schema_name", schemaName).Msg("actions or remote schemas do not fit the schema, leaving them out")
+		metadata.Actions = nil
+		metadata.RemoteSchemas = nil
+		schema, err = h.generator.Generate(schemaName, metadata)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("schema generation failed: %w", err)
 	}
 
 	// Cache with TTL
-	h.schemaCache.Store(schemaName, &cachedSchema{
+	cached := &cachedSchema{
 		schema:    schema,
+		metadata:  metadata,
 		expiresAt: time.Now().Add(SchemaCacheTTL),
-	})
+	}
+	if !h.cacheSchema(key, schemaName, generation, cached) {
+		h.logger.Debug().Str("schema_name", schemaName).Str("cache_key", key).Msg("schema changed while generating, not caching it")
+		return cached, nil
+	}
 
 	h.logger.Info().
 		Str("schema_name", schemaName).
+		Str("cache_key", key).
 		Int("tables", len(metadata.Tables)).
 		Dur("duration", time.Since(start)).
 		Dur("cache_ttl", SchemaCacheTTL).
 		Msg("schema generated and cached")
 
-	return schema, nil
+	return cached, nil
+}
+
+// schemaGeneration returns the generation of a tenant's cached schemas; it
+// changes whenever they are invalidated
+func (h *Handler) schemaGeneration(schemaName string) uint64 {
+	v, _ := h.schemaGenerations.LoadOrStore(schemaName, new(atomic.Uint64))
+	return v.(*atomic.Uint64).Load() + h.allGeneration.Load()
 }
 
-// InvalidateCache clears the cache for a tenant (e.g. on DDL webhook)
+// bumpSchemaGeneration marks the cached schemas of a tenant stale; it runs
+// before they are deleted so loads in flight do not cache them again
+func (h *Handler) bumpSchemaGeneration(schemaName string) {
+	v, _ := h.schemaGenerations.LoadOrStore(schemaName, new(atomic.Uint64))
+	v.(*atomic.Uint64).Add(1)
+}
+
+// cacheSchema stores a generated schema unless the tenant's schemas were
+// invalidated since its generation was read. Invalidations bump the generation
+// before deleting, so checking again after the store catches one that raced it.
+func (h *Handler) cacheSchema(key, schemaName string, generation uint64, cached *cachedSchema) bool {
+	if h.schemaGeneration(schemaName) != generation {
+		return false
+	}
+	h.schemaCache.Store(key, cached)
+	if h.schemaGeneration(schemaName) != generation {
+		h.schemaCache.CompareAndDelete(key, cached)
+		return false
+	}
+	return true
+}
+
+// InvalidateCache clears the cache for a tenant (e.g. on DDL), including the
+// schemas of its roles
 func (h *Handler) InvalidateCache(schemaName string) {
+	h.bumpSchemaGeneration(schemaName)
 	h.schemaCache.Delete(schemaName)
+	h.invalidateRoleSchemas(schemaName)
+	h.resolver.forgetChangeTriggers(schemaName)
+}
+
+// invalidateAll clears every cached schema
+func (h *Handler) invalidateAll() {
+	h.allGeneration.Add(1)
+	h.schemaCache.Range(func(key, _ interface{}) bool {
+		h.schemaCache.Delete(key)
+		return true
+	})
+	h.resolver.triggerMu.Lock()
+	h.resolver.triggers = make(map[string]map[string]bool)
+	h.resolver.triggerMu.Unlock()
+}
+
+// WatchSchemaChanges invalidates the cached schema of a tenant whenever the
+// schema change triggers report DDL on it, on every replica listening. Should
+// the LISTEN connection drop, every schema is invalidated since notifications
+// may have been missed. The returned function stops watching.
+func (h *Handler) WatchSchemaChanges() (func(), error) {
+	changes, cancel, err := h.resolver.notifier().Subscribe(database.SchemaChangeChannel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for schema changes: %w", err)
+	}
+	go func() {
+		for n := range changes {
+			h.handleSchemaChange(n)
+		}
+	}()
+	return cancel, nil
+}
+
+// handleSchemaChange applies one schema change notification; nil means the
+// listener reconnected
+func (h *Handler) handleSchemaChange(n *pq.Notification) {
+	if n == nil {
+		h.logger.Info().Msg("schema change listener reconnected, invalidating all schemas")
+		h.invalidateAll()
+		return
+	}
+	schemaName := n.Extra
+	if !validIdentifier.MatchString(schemaName) {
+		h.logger.Warn().Str("schema_name", schemaName).Msg("ignoring schema change of invalid schema name")
+		return
+	}
+	h.logger.Info().Str("schema_name", schemaName).Msg("schema changed, invalidating cache")
+	h.InvalidateCache(schemaName)
+}
+
+// InvalidatePermissions clears the cached permissions of a tenant and the schemas
+// generated from them, after its permissions changed
+func (h *Handler) InvalidatePermissions(tenantID, schemaName string) {
+	h.permissionCache.Delete(tenantID)
+	h.bumpSchemaGeneration(schemaName)
+	h.invalidateRoleSchemas(schemaName)
+}
+
+// InvalidateActions clears the cached actions of a tenant and every schema of the
+// tenant, after its actions changed
+func (h *Handler) InvalidateActions(tenantID, schemaName string) {
+	h.actionCache.Delete(tenantID)
+	h.bumpSchemaGeneration(schemaName)
+	h.schemaCache.Delete(schemaName)
+	h.invalidateRoleSchemas(schemaName)
+}
+
+// InvalidateRemoteSchemas clears the cached remote schemas of a tenant and every
+// schema of the tenant, after its remote schemas changed
+func (h *Handler) InvalidateRemoteSchemas(tenantID, schemaName string) {
+	h.remoteSchemaCache.Delete(tenantID)
+	h.bumpSchemaGeneration(schemaName)
+	h.schemaCache.Delete(schemaName)
+	h.invalidateRoleSchemas(schemaName)
+}
+
+func (h *Handler) invalidateRoleSchemas(schemaName string) {
+	prefix := schemaName + "/"
+	h.schemaCache.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			h.schemaCache.Delete(key)
+		}
+		return true
+	})
+}
+
+// Close releases the resources held for subscriptions
+func (h *Handler) Close() error {
+	return h.resolver.Close()
 }
@@ -13,7 +13,10 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
 	"github.com/kapok/kapok/internal/database"
 	"github.com/kapok/kapok/internal/tenant"
 	"github.com/ory/dockertest/v3"
@@ -49,6 +52,8 @@ func setupPostgresContainer(t *testing.T) {
 			"POSTGRES_USER=testuser",
 			"POSTGRES_DB=kapok_graphql_test",
 		},
+		// pg_stat_statements counts the statements resolvers run
+		Cmd: []string{"postgres", "-c", "shared_preload_libraries=pg_stat_statements"},
 	}, func(config *docker.HostConfig) {
 		config.AutoRemove = true
 		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
@@ -202,6 +207,33 @@ func TestDynamicGraphQLAPI(t *testing.T) {
 	assert.Len(t, listResult.Posts, 1)
 	assert.Equal(t, "Hello World", listResult.Posts[0].Title)
 
+	// 5b. Test Query (List Posts with where filter)
+	filteredQuery := `
+		query {
+			matching: posts(where: { title: { _ilike: "hello%" }, isPublished: { _eq: true } }) {
+				id
+			}
+			missing: posts(where: { _or: [{ title: { _eq: "nope" } }, { content: { _is_null: true } }] }) {
+				id
+			}
+		}
+	`
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, filteredQuery)
+	require.Nil(t, resp.Errors, "filtered query errors: %v", resp.Errors)
+
+	var filteredResult struct {
+		Matching []struct {
+			ID int `json:"id"`
+		} `json:"matching"`
+		Missing []struct {
+			ID int `json:"id"`
+		} `json:"missing"`
+	}
+	err = json.Unmarshal(resp.Data, &filteredResult)
+	require.NoError(t, err)
+	assert.Len(t, filteredResult.Matching, 1)
+	assert.Len(t, filteredResult.Missing, 0)
+
 	// 6. Test Query Single (Get Post By ID)
 	getQuery := fmt.Sprintf(`
 		query {
@@ -288,7 +320,8 @@ type GraphQLResponse struct {
 }
 
 type GraphQLError struct {
-	Message string `json:"message"`
+	Message    string                 `json:"message"`
+	Extensions map[string]interface{} `json:"extensions"`
 }
 
 func TestGraphQLRelations(t *testing.T) {
@@ -446,30 +479,1274 @@ func TestGraphQLRelations(t *testing.T) {
 	assert.Equal(t, "John Doe", hasManyResult.AuthorsById.Name)
 	assert.Len(t, hasManyResult.AuthorsById.Posts, 1)
 	assert.Equal(t, "My First Post", hasManyResult.AuthorsById.Posts[0].Title)
+
+	// 8. Test order_by on a belongsTo relation column
+	orderQuery := `
+		query {
+			posts(order_by: [{ author: { name: asc } }, { id: desc }]) {
+				id
+				author {
+					name
+				}
+			}
+		}
+	`
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, orderQuery)
+	require.Nil(t, resp.Errors, "order_by query errors: %v", resp.Errors)
+
+	var orderResult struct {
+		Posts []struct {
+			ID     int `json:"id"`
+			Author struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"posts"`
+	}
+	err = json.Unmarshal(resp.Data, &orderResult)
+	require.NoError(t, err)
+	require.Len(t, orderResult.Posts, 1)
+	assert.Equal(t, "John Doe", orderResult.Posts[0].Author.Name)
+
+	// 9. Test aggregates at the root and through the hasMany relation
+	aggregateQuery := fmt.Sprintf(`
+		query {
+			postsAggregate(groupBy: [authorId]) {
+				keys { authorId }
+				count
+				sum { id }
+				avg { id }
+				max { id }
+			}
+			authorsById(id: "%d") {
+				postsAggregate(where: { title: { _ilike: "%%first%%" } }) {
+					count
+				}
+			}
+		}
+	`, authorID)
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, aggregateQuery)
+	require.Nil(t, resp.Errors, "aggregate query errors: %v", resp.Errors)
+
+	var aggregateResult struct {
+		PostsAggregate []struct {
+			Keys struct {
+				AuthorID int `json:"authorId"`
+			} `json:"keys"`
+			Count int `json:"count"`
+			Sum   struct {
+				ID string `json:"id"`
+			} `json:"sum"`
+			Avg struct {
+				ID string `json:"id"`
+			} `json:"avg"`
+			Max struct {
+				ID int `json:"id"`
+			} `json:"max"`
+		} `json:"postsAggregate"`
+		AuthorsById struct {
+			PostsAggregate []struct {
+				Count int `json:"count"`
+			} `json:"postsAggregate"`
+		} `json:"authorsById"`
+	}
+	err = json.Unmarshal(resp.Data, &aggregateResult)
+	require.NoError(t, err)
+	require.Len(t, aggregateResult.PostsAggregate, 1)
+	assert.Equal(t, authorID, aggregateResult.PostsAggregate[0].Keys.AuthorID)
+	assert.Equal(t, 1, aggregateResult.PostsAggregate[0].Count)
+	assert.Equal(t, postResult.CreatePosts.ID, aggregateResult.PostsAggregate[0].Max.ID)
+	assert.Equal(t, strconv.Itoa(postResult.CreatePosts.ID), aggregateResult.PostsAggregate[0].Sum.ID, "sums are BigInt strings")
+	assert.Contains(t, aggregateResult.PostsAggregate[0].Avg.ID, strconv.Itoa(postResult.CreatePosts.ID), "averages are Decimal strings")
+	require.Len(t, aggregateResult.AuthorsById.PostsAggregate, 1)
+	assert.Equal(t, 1, aggregateResult.AuthorsById.PostsAggregate[0].Count)
 }
 
-func executeGraphQLRequest(t *testing.T, handler *Handler, tenantID, schemaName, query string) GraphQLResponse {
-	reqBody := fmt.Sprintf(`{"query": %q}`, query)
-	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(reqBody))
-	req.Header.Set("Content-Type", "application/json")
+func TestGraphQLConnections(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
 
-	// Inject tenant context using the tenant package
-	ten := &tenant.Tenant{
-		ID:         tenantID,
-		SchemaName: schemaName,
-		Status:     tenant.StatusActive,
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "connection-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %s.posts (
+			id SERIAL PRIMARY KEY,
+			title TEXT NOT NULL
+		);
+		INSERT INTO %s.posts (title) VALUES ('a'), ('b'), ('c');
+	`, ten.SchemaName, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	type connectionResult struct {
+		PostsConnection struct {
+			Edges []struct {
+				Cursor string `json:"cursor"`
+				Node   struct {
+					Title string `json:"title"`
+				} `json:"node"`
+			} `json:"edges"`
+			PageInfo struct {
+				HasNextPage     bool   `json:"hasNextPage"`
+				HasPreviousPage bool   `json:"hasPreviousPage"`
+				EndCursor       string `json:"endCursor"`
+			} `json:"pageInfo"`
+			TotalCount int `json:"totalCount"`
+		} `json:"postsConnection"`
 	}
-	ctx := tenant.WithTenant(req.Context(), ten)
-	req = req.WithContext(ctx)
 
-	w := httptest.NewRecorder()
-	handler.ServeHTTP(w, req)
+	// 1. First page, ordered by title descending
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			postsConnection(first: 2, order_by: [{ title: desc }]) {
+				edges { cursor node { title } }
+				pageInfo { hasNextPage hasPreviousPage endCursor }
+				totalCount
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "connection errors: %v", resp.Errors)
 
-	resp := w.Result()
-	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var page1 connectionResult
+	require.NoError(t, json.Unmarshal(resp.Data, &page1))
+	require.Len(t, page1.PostsConnection.Edges, 2)
+	assert.Equal(t, "c", page1.PostsConnection.Edges[0].Node.Title)
+	assert.Equal(t, "b", page1.PostsConnection.Edges[1].Node.Title)
+	assert.True(t, page1.PostsConnection.PageInfo.HasNextPage)
+	assert.Equal(t, 3, page1.PostsConnection.TotalCount)
 
-	var gqlResp GraphQLResponse
-	err := json.NewDecoder(resp.Body).Decode(&gqlResp)
+	// 2. Second page continues after the end cursor
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, fmt.Sprintf(`
+		query {
+			postsConnection(first: 2, after: %q, order_by: [{ title: desc }]) {
+				edges { node { title } }
+				pageInfo { hasNextPage }
+			}
+		}
+	`, page1.PostsConnection.PageInfo.EndCursor))
+	require.Nil(t, resp.Errors, "connection errors: %v", resp.Errors)
+
+	var page2 connectionResult
+	require.NoError(t, json.Unmarshal(resp.Data, &page2))
+	require.Len(t, page2.PostsConnection.Edges, 1)
+	assert.Equal(t, "a", page2.PostsConnection.Edges[0].Node.Title)
+	assert.False(t, page2.PostsConnection.PageInfo.HasNextPage)
+
+	// 3. Backward pagination returns the last rows in forward order
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			postsConnection(last: 2) {
+				edges { node { title } }
+				pageInfo { hasPreviousPage }
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "connection errors: %v", resp.Errors)
+
+	var backward connectionResult
+	require.NoError(t, json.Unmarshal(resp.Data, &backward))
+	require.Len(t, backward.PostsConnection.Edges, 2)
+	assert.Equal(t, "b", backward.PostsConnection.Edges[0].Node.Title)
+	assert.Equal(t, "c", backward.PostsConnection.Edges[1].Node.Title)
+	assert.True(t, backward.PostsConnection.PageInfo.HasPreviousPage)
+}
+
+func TestGraphQLBatchedRelations(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
 	require.NoError(t, err)
-	return gqlResp
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "loader-test")
+	require.NoError(t, err)
+
+	// 100 authors with one post each: 101 round trips without batching
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.authors (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL
+		);
+		CREATE TABLE %[1]s.posts (
+			id SERIAL PRIMARY KEY,
+			title TEXT NOT NULL,
+			author_id INTEGER REFERENCES %[1]s.authors(id)
+		);
+		INSERT INTO %[1]s.authors (name) SELECT 'author ' || g FROM generate_series(1, 100) g;
+		INSERT INTO %[1]s.posts (title, author_id) SELECT 'post ' || g, g FROM generate_series(1, 100) g;
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+	cached, err := handler.getRoleSchema(ctx, ten)
+	require.NoError(t, err)
+	schema := cached.schema
+
+	query := `
+		query {
+			posts(limit: 100) {
+				title
+				author {
+					name
+					posts { title }
+					postsAggregate { count max { id } }
+				}
+			}
+		}
+	`
+	// Count the statements reading the tenant's tables while the query runs
+	_, err = testDB.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS pg_stat_statements`)
+	require.NoError(t, err)
+	run := func(runCtx context.Context) (*graphql.Result, int) {
+		_, err := testDB.ExecContext(ctx, `SELECT pg_stat_statements_reset()`)
+		require.NoError(t, err)
+		result := graphql.Do(graphql.Params{Schema: *schema, RequestString: query, Context: runCtx})
+		var statements int
+		err = testDB.QueryRowContext(ctx,
+			`SELECT COALESCE(SUM(calls), 0) FROM pg_stat_statements WHERE query LIKE '%' || $1 || '%'`,
+			ten.SchemaName).Scan(&statements)
+		require.NoError(t, err)
+		return result, statements
+	}
+
+	unbatched, unbatchedStatements := run(ctx)
+	require.Empty(t, unbatched.Errors)
+	batched, batchedStatements := run(WithLoader(ctx, NewLoader()))
+	require.Empty(t, batched.Errors)
+
+	unbatchedJSON, err := json.Marshal(unbatched.Data)
+	require.NoError(t, err)
+	batchedJSON, err := json.Marshal(batched.Data)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(unbatchedJSON), string(batchedJSON), "batching must not change results")
+
+	// posts, then one author, one posts and one aggregate query per post
+	assert.Equal(t, 1+100+100+100, unbatchedStatements, "unbatched relations run one query per parent")
+	assert.Equal(t, 4, batchedStatements, "batched relations run one query per relation level")
+}
+
+func TestGraphQLBulkMutations(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "bulk-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %s.posts (
+			id SERIAL PRIMARY KEY,
+			slug TEXT NOT NULL UNIQUE,
+			view_count INT NOT NULL DEFAULT 0 CHECK (view_count >= 0)
+		)
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	type mutationResult struct {
+		AffectedRows int `json:"affectedRows"`
+		Returning    []struct {
+			Slug      string `json:"slug"`
+			ViewCount int    `json:"viewCount"`
+		} `json:"returning"`
+	}
+
+	// 1. Insert many rows in one statement
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			insertPostsMany(objects: [{ slug: "a" }, { slug: "b", viewCount: 5 }, { slug: "c" }]) {
+				affectedRows
+				returning { slug viewCount }
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "insert errors: %v", resp.Errors)
+	var inserted struct {
+		InsertPostsMany mutationResult `json:"insertPostsMany"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &inserted))
+	assert.Equal(t, 3, inserted.InsertPostsMany.AffectedRows)
+	assert.Equal(t, 5, inserted.InsertPostsMany.Returning[1].ViewCount)
+
+	// 2. Upsert on the unique slug updates the existing row
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			insertPostsMany(
+				objects: [{ slug: "a", viewCount: 10 }, { slug: "d" }],
+				onConflict: { constraint: posts_slug_key, updateColumns: [viewCount] }
+			) {
+				affectedRows
+				returning { slug viewCount }
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "upsert errors: %v", resp.Errors)
+	var upserted struct {
+		InsertPostsMany mutationResult `json:"insertPostsMany"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &upserted))
+	assert.Equal(t, 2, upserted.InsertPostsMany.AffectedRows)
+	assert.Equal(t, 10, upserted.InsertPostsMany.Returning[0].ViewCount)
+
+	// 3. A failing row rolls back the whole batch
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			insertPostsMany(objects: [{ slug: "e" }, { slug: "f", viewCount: -1 }]) {
+				affectedRows
+			}
+		}
+	`)
+	require.NotNil(t, resp.Errors, "check violation must fail")
+	assert.Equal(t, CheckViolationCode, resp.Errors[0].Extensions["code"])
+	assert.Equal(t, "posts_view_count_check", resp.Errors[0].Extensions["constraint"])
+	assert.NotEmpty(t, resp.Errors[0].Extensions["correlationId"])
+	var count int
+	require.NoError(t, testDB.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s.posts`, ten.SchemaName)).Scan(&count))
+	assert.Equal(t, 4, count)
+
+	// 4. Update every matching row
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			updatePostsMany(where: { viewCount: { _lt: 10 } }, set: { viewCount: 1 }) {
+				affectedRows
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "update errors: %v", resp.Errors)
+	var updated struct {
+		UpdatePostsMany mutationResult `json:"updatePostsMany"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &updated))
+	assert.Equal(t, 3, updated.UpdatePostsMany.AffectedRows)
+
+	// A duplicate slug reports the constraint and column, not the value
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			insertPostsMany(objects: [{ slug: "b" }]) { affectedRows }
+		}
+	`)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, UniqueViolationCode, resp.Errors[0].Extensions["code"])
+	assert.Equal(t, "posts_slug_key", resp.Errors[0].Extensions["constraint"])
+	assert.Equal(t, "slug", resp.Errors[0].Extensions["column"])
+	assert.NotContains(t, resp.Errors[0].Message, `"b"`)
+
+	// 5. Delete every matching row
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			deletePostsMany(where: { viewCount: { _eq: 1 } }) {
+				affectedRows
+				returning { slug }
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "delete errors: %v", resp.Errors)
+	var deleted struct {
+		DeletePostsMany mutationResult `json:"deletePostsMany"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &deleted))
+	assert.Equal(t, 3, deleted.DeletePostsMany.AffectedRows)
+
+	require.NoError(t, testDB.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s.posts`, ten.SchemaName)).Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestGraphQLNestedInserts(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "nested-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.authors (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL
+		);
+		CREATE TABLE %[1]s.posts (
+			id SERIAL PRIMARY KEY,
+			title TEXT NOT NULL CHECK (title <> ''),
+			author_id INT NOT NULL REFERENCES %[1]s.authors(id)
+		);
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	// 1. hasMany: an author with two posts
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			createAuthors(name: "Ada", posts: [{ title: "first" }, { title: "second" }]) {
+				id
+				posts(order_by: [{ title: asc }]) { title authorId }
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "nested hasMany errors: %v", resp.Errors)
+
+	var author struct {
+		CreateAuthors struct {
+			ID    int `json:"id"`
+			Posts []struct {
+				Title    string `json:"title"`
+				AuthorID int    `json:"authorId"`
+			} `json:"posts"`
+		} `json:"createAuthors"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &author))
+	require.Len(t, author.CreateAuthors.Posts, 2)
+	assert.Equal(t, "first", author.CreateAuthors.Posts[0].Title)
+	assert.Equal(t, author.CreateAuthors.ID, author.CreateAuthors.Posts[1].AuthorID)
+
+	// 2. belongsTo: a post with a new author
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			createPosts(title: "hello", author: { name: "Grace" }) {
+				title
+				author { name }
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "nested belongsTo errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"createPosts":{"title":"hello","author":{"name":"Grace"}}}`, string(resp.Data))
+
+	// 3. A failing child rolls back the parent
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			createAuthors(name: "Linus", posts: [{ title: "ok" }, { title: "" }]) { id }
+		}
+	`)
+	require.NotNil(t, resp.Errors, "check violation must fail")
+
+	var count int
+	require.NoError(t, testDB.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s.authors WHERE name = 'Linus'`, ten.SchemaName)).Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestGraphQLViewsAndFunctions(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "functions-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.posts (
+			id SERIAL PRIMARY KEY,
+			title TEXT NOT NULL,
+			view_count INT NOT NULL DEFAULT 0,
+			archived BOOLEAN NOT NULL DEFAULT false
+		);
+		INSERT INTO %[1]s.posts (title, view_count) VALUES ('go', 10), ('rust', 50), ('gleam', 1);
+
+		CREATE VIEW %[1]s.popular_posts AS SELECT id, title FROM %[1]s.posts WHERE view_count >= 10;
+		CREATE MATERIALIZED VIEW %[1]s.post_stats AS SELECT COUNT(*)::int AS total FROM %[1]s.posts;
+
+		CREATE FUNCTION %[1]s.search_posts(term TEXT, min_views INT DEFAULT 0)
+		RETURNS SETOF %[1]s.posts LANGUAGE sql STABLE AS $$
+			SELECT * FROM %[1]s.posts WHERE title ILIKE '%%' || term || '%%' AND view_count >= min_views
+		$$;
+
+		CREATE FUNCTION %[1]s.archive_post(post_id INT)
+		RETURNS %[1]s.posts LANGUAGE sql VOLATILE AS $$
+			UPDATE %[1]s.posts SET archived = true WHERE id = post_id RETURNING *
+		$$;
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	// 1. Views and materialized views are queryable
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			popularPosts(order_by: [{ title: asc }]) { title }
+			postStats { total }
+		}
+	`)
+	require.Nil(t, resp.Errors, "view errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"popularPosts":[{"title":"go"},{"title":"rust"}],"postStats":[{"total":3}]}`, string(resp.Data))
+
+	// 2. ...but have no mutations
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { createPopularPosts(title: "x") { id } }
+	`)
+	require.NotNil(t, resp.Errors)
+
+	// 3. Stable set-returning function with a defaulted argument and list arguments
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			all: searchPosts(term: "g", order_by: [{ title: asc }]) { title }
+			popular: searchPosts(term: "g", minViews: 5) { title }
+		}
+	`)
+	require.Nil(t, resp.Errors, "function errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"all":[{"title":"gleam"},{"title":"go"}],"popular":[{"title":"go"}]}`, string(resp.Data))
+
+	// 4. Volatile function is a mutation
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { archivePost(postId: 1) { id archived } }
+	`)
+	require.Nil(t, resp.Errors, "function mutation errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"archivePost":{"id":1,"archived":true}}`, string(resp.Data))
+}
+
+func TestGraphQLRichTypes(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "types-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TYPE %[1]s.mood AS ENUM ('happy', 'sad', 'in progress');
+		CREATE TABLE %[1]s.events (
+			id BIGSERIAL PRIMARY KEY,
+			external_id UUID NOT NULL DEFAULT '123e4567-e89b-12d3-a456-426614174000',
+			payload JSONB,
+			tags TEXT[],
+			scores INT[],
+			mood %[1]s.mood,
+			moods %[1]s.mood[],
+			price NUMERIC(12, 2),
+			happened_at TIMESTAMPTZ,
+			day DATE,
+			blob BYTEA,
+			counter BIGINT
+		);
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	// 1. Every type round-trips through a create mutation
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation {
+			createEvents(
+				payload: { kind: "signup", meta: { plan: "pro" }, seats: [1, 2] }
+				tags: ["go", "sql"]
+				scores: [1, 2, 3]
+				mood: in_progress
+				moods: [happy, sad]
+				price: "1234.50"
+				happenedAt: "2024-01-02T15:04:05Z"
+				day: "2024-01-02"
+				blob: "3q0="
+				counter: "9007199254740993"
+			) {
+				id externalId payload tags scores mood moods price happenedAt day blob counter
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "create errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"createEvents":{
+		"id": "1",
+		"externalId": "123e4567-e89b-12d3-a456-426614174000",
+		"payload": {"kind": "signup", "meta": {"plan": "pro"}, "seats": [1, 2]},
+		"tags": ["go", "sql"],
+		"scores": [1, 2, 3],
+		"mood": "in_progress",
+		"moods": ["happy", "sad"],
+		"price": "1234.50",
+		"happenedAt": "2024-01-02T15:04:05Z",
+		"day": "2024-01-02",
+		"blob": "3q0=",
+		"counter": "9007199254740993"
+	}}`, string(resp.Data))
+
+	// 2. Enums, arrays and JSON can be filtered
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			byMood: events(where: { mood: { _eq: in_progress } }) { id }
+			byTag: events(where: { tags: { _contains: ["go"] } }) { id }
+			byPayload: events(where: { payload: { _contains: { kind: "signup" } } }) { id }
+			none: events(where: { tags: { _contains: ["rust"] } }) { id }
+		}
+	`)
+	require.Nil(t, resp.Errors, "filter errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"byMood":[{"id":"1"}],"byTag":[{"id":"1"}],"byPayload":[{"id":"1"}],"none":[]}`, string(resp.Data))
+
+	// 3. Invalid scalar input is rejected before reaching the database
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { createEvents(externalId: "nope") { id } }
+	`)
+	require.NotNil(t, resp.Errors)
+}
+
+func TestGraphQLCompositeKeys(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "composite-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.posts (id SERIAL PRIMARY KEY, title TEXT NOT NULL);
+		CREATE TABLE %[1]s.tags (id SERIAL PRIMARY KEY, name TEXT NOT NULL);
+		CREATE TABLE %[1]s.post_tags (
+			post_id INT NOT NULL REFERENCES %[1]s.posts(id),
+			tag_id INT NOT NULL REFERENCES %[1]s.tags(id),
+			position INT,
+			PRIMARY KEY (post_id, tag_id)
+		);
+		INSERT INTO %[1]s.posts (title) VALUES ('first'), ('second');
+		INSERT INTO %[1]s.tags (name) VALUES ('go'), ('sql');
+		INSERT INTO %[1]s.post_tags (post_id, tag_id, position) VALUES (1, 1, 1), (1, 2, 2), (2, 1, 1);
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	// 1. Lookup by the whole key
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query { postTagsByPostIdAndTagId(postId: 1, tagId: 2) { postId tagId position } }
+	`)
+	require.Nil(t, resp.Errors, "get errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"postTagsByPostIdAndTagId":{"postId":1,"tagId":2,"position":2}}`, string(resp.Data))
+
+	// 2. Update only touches the identified row
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { updatePostTags(postId: 1, tagId: 1, position: 5) { postId tagId position } }
+	`)
+	require.Nil(t, resp.Errors, "update errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"updatePostTags":{"postId":1,"tagId":1,"position":5}}`, string(resp.Data))
+
+	// 3. Delete by key, then the row is gone while its siblings remain
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { deletePostTags(postId: 2, tagId: 1) { postId tagId } }
+	`)
+	require.Nil(t, resp.Errors, "delete errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"deletePostTags":{"postId":2,"tagId":1}}`, string(resp.Data))
+
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query { postTagsConnection(first: 10) { edges { node { postId tagId position } } } }
+	`)
+	require.Nil(t, resp.Errors, "connection errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"postTagsConnection":{"edges":[
+		{"node":{"postId":1,"tagId":1,"position":5}},
+		{"node":{"postId":1,"tagId":2,"position":2}}
+	]}}`, string(resp.Data))
+}
+
+func TestGraphQLManyToMany(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "many-to-many-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.posts (id SERIAL PRIMARY KEY, title TEXT NOT NULL);
+		CREATE TABLE %[1]s.tags (id SERIAL PRIMARY KEY, name TEXT NOT NULL);
+		CREATE TABLE %[1]s.post_tags (
+			post_id INT NOT NULL REFERENCES %[1]s.posts(id),
+			tag_id INT NOT NULL REFERENCES %[1]s.tags(id),
+			created_at TIMESTAMPTZ DEFAULT now(),
+			PRIMARY KEY (post_id, tag_id)
+		);
+		INSERT INTO %[1]s.posts (title) VALUES ('first'), ('second'), ('third');
+		INSERT INTO %[1]s.tags (name) VALUES ('go'), ('sql'), ('graphql');
+		INSERT INTO %[1]s.post_tags (post_id, tag_id) VALUES (1, 1), (1, 2), (1, 3), (2, 1);
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	// 1. Sibling posts share one batched query, paged per post
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query { posts(order_by: [{id: asc}]) { title tags(order_by: [{name: asc}], limit: 2) { name } } }
+	`)
+	require.Nil(t, resp.Errors, "tags errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"posts":[
+		{"title":"first","tags":[{"name":"go"},{"name":"graphql"}]},
+		{"title":"second","tags":[{"name":"go"}]},
+		{"title":"third","tags":[]}
+	]}`, string(resp.Data))
+
+	// 2. Filters and offsets apply to the related rows
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query { postsById(id: 1) { tags(where: {name: {_neq: "go"}}, order_by: [{name: desc}], offset: 1) { name } } }
+	`)
+	require.Nil(t, resp.Errors, "filter errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"postsById":{"tags":[{"name":"graphql"}]}}`, string(resp.Data))
+
+	// 3. The relation is generated on both sides
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query { tagsById(id: 1) { posts(order_by: [{id: asc}]) { title } } }
+	`)
+	require.Nil(t, resp.Errors, "reverse errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"tagsById":{"posts":[{"title":"first"},{"title":"second"}]}}`, string(resp.Data))
+}
+
+func TestGraphQLSubscriptions(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "subscription-test")
+	require.NoError(t, err)
+	other, err := provisioner.CreateTenant(ctx, "subscription-other")
+	require.NoError(t, err)
+
+	for _, schemaName := range []string{ten.SchemaName, other.SchemaName} {
+		_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+			CREATE TABLE %s.posts (
+				id SERIAL PRIMARY KEY,
+				title TEXT NOT NULL
+			)
+		`, schemaName))
+		require.NoError(t, err)
+	}
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE %s.authors (id SERIAL PRIMARY KEY)`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+	defer handler.Close()
+
+	// Serve the handler for the first tenant, as GraphQLProxy would
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), ten)))
+	}))
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	read := func() wsMessage {
+		var msg wsMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		return msg
+	}
+	subscribe := func(id, query string) {
+		payload, _ := json.Marshal(wsSubscribePayload{Query: query})
+		require.NoError(t, conn.WriteJSON(wsMessage{ID: id, Type: wsSubscribe, Payload: payload}))
+	}
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInit}))
+	require.Equal(t, wsConnectionAck, read().Type)
+
+	// 1. Live query sends the current rows immediately
+	subscribe("live", `subscription { posts(order_by: [{ id: asc }]) { title } }`)
+	msg := read()
+	require.Equal(t, wsNext, msg.Type, "payload: %s", msg.Payload)
+	assert.JSONEq(t, `{"data":{"posts":[]}}`, string(msg.Payload))
+
+	subscribe("changes", `subscription { postsChanged { op table row { id title } } }`)
+	// The change stream has no initial message; give it time to start listening
+	time.Sleep(500 * time.Millisecond)
+
+	// 2. Writes in another tenant are not delivered
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s.posts (title) VALUES ('elsewhere')`, other.SchemaName))
+	require.NoError(t, err)
+
+	// 3. An insert produces a change event and a refreshed live query
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s.posts (title) VALUES ('hello')`, ten.SchemaName))
+	require.NoError(t, err)
+
+	received := map[string]string{}
+	for len(received) < 2 {
+		msg := read()
+		require.Equal(t, wsNext, msg.Type, "payload: %s", msg.Payload)
+		received[msg.ID] = string(msg.Payload)
+	}
+	assert.JSONEq(t, `{"data":{"posts":[{"title":"hello"}]}}`, received["live"])
+	assert.JSONEq(t, `{"data":{"postsChanged":{"op":"INSERT","table":"posts","row":{"id":1,"title":"hello"}}}}`, received["changes"])
+
+	// 4. Completing a subscription stops its deliveries
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "live", Type: wsComplete}))
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s.posts`, ten.SchemaName))
+	require.NoError(t, err)
+
+	msg = read()
+	assert.Equal(t, "changes", msg.ID)
+	assert.JSONEq(t, `{"data":{"postsChanged":{"op":"DELETE","table":"posts","row":{"id":1,"title":"hello"}}}}`, string(msg.Payload))
+
+	// 5. Only subscribed tables get a change trigger
+	var triggered string
+	err = testDB.QueryRowContext(ctx, `
+		SELECT COALESCE(string_agg(c.relname, ',' ORDER BY c.relname), '')
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE t.tgname = $1 AND n.nspname = $2
+	`, changeTriggerName, ten.SchemaName).Scan(&triggered)
+	require.NoError(t, err)
+	assert.Equal(t, "posts", triggered)
+}
+
+func TestGraphQLSchemaChangeInvalidation(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, database.NewMigrator(db, logger).InstallSchemaChangeTriggers(ctx))
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "ddl-test")
+	require.NoError(t, err)
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE %s.posts (id SERIAL PRIMARY KEY, title TEXT)`, ten.SchemaName))
+	require.NoError(t, err)
+
+	// Two replicas, each caching the schema
+	var replicas []*Handler
+	for i := 0; i < 2; i++ {
+		h := NewHandler(db, logger)
+		defer h.Close()
+		stop, err := h.WatchSchemaChanges()
+		require.NoError(t, err)
+		defer stop()
+
+		resp := executeGraphQLRequest(t, h, ten.ID, ten.SchemaName, `{ posts { id title } }`)
+		require.Empty(t, resp.Errors)
+		replicas = append(replicas, h)
+	}
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s.posts ADD COLUMN body TEXT`, ten.SchemaName))
+	require.NoError(t, err)
+
+	for i, h := range replicas {
+		assert.Eventually(t, func() bool {
+			resp := executeGraphQLRequest(t, h, ten.ID, ten.SchemaName, `{ posts { id body } }`)
+			return len(resp.Errors) == 0
+		}, 5*time.Second, 50*time.Millisecond, "replica %d regenerates the schema", i)
+	}
+
+	// Dropped tables are reported through sql_drop
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`DROP TABLE %s.posts`, ten.SchemaName))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		resp := executeGraphQLRequest(t, replicas[0], ten.ID, ten.SchemaName, `{ posts { id } }`)
+		return len(resp.Errors) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestIntrospection(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "introspection-test")
+	require.NoError(t, err)
+	s := ten.SchemaName
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.authors (
+			id SERIAL PRIMARY KEY,
+			email TEXT NOT NULL UNIQUE
+		);
+		CREATE TABLE %[1]s.books (
+			id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			author_id INTEGER NOT NULL REFERENCES %[1]s.authors(id),
+			title TEXT NOT NULL,
+			price NUMERIC NOT NULL DEFAULT 0 CONSTRAINT price_positive CHECK (price >= 0),
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX books_title_idx ON %[1]s.books (lower(title)) WHERE price > 0;
+		COMMENT ON TABLE %[1]s.books IS 'Books for sale';
+		COMMENT ON COLUMN %[1]s.books.title IS 'Display title';
+	`, s))
+	require.NoError(t, err)
+
+	meta, err := NewIntrospector(db).Inspect(ctx, s)
+	require.NoError(t, err)
+	require.Len(t, meta.Tables, 2)
+
+	authors, books := meta.Tables[0], meta.Tables[1]
+	assert.Equal(t, "authors", authors.Name)
+	assert.Equal(t, []Constraint{
+		{Name: "authors_email_key", Columns: []string{"email"}},
+		{Name: "authors_pkey", Columns: []string{"id"}},
+	}, authors.Constraints)
+
+	assert.Equal(t, "Books for sale", books.Comment)
+	cols := map[string]Column{}
+	for _, col := range books.Columns {
+		cols[col.Name] = col
+	}
+	assert.True(t, cols["id"].IsPK)
+	assert.True(t, cols["id"].HasDefault, "identity columns are generated")
+	assert.Equal(t, Column{Name: "author_id", DataType: "integer", IsFK: true, FKTable: "authors", FKColumn: "id"}, cols["author_id"])
+	assert.Equal(t, "Display title", cols["title"].Comment)
+	assert.Equal(t, "0", cols["price"].Default)
+	assert.Equal(t, "now()", cols["created_at"].Default)
+
+	assert.Equal(t, []CheckConstraint{
+		{Name: "price_positive", Columns: []string{"price"}, Definition: "CHECK (price >= 0::numeric)"},
+	}, books.Checks)
+
+	require.Len(t, books.Indexes, 2)
+	assert.Equal(t, Index{Name: "books_pkey", Columns: []string{"id"}, OpClasses: []string{"int4_ops"}, Unique: true, Primary: true, Method: "btree"}, books.Indexes[0])
+	assert.Equal(t, Index{Name: "books_title_idx", Columns: []string{"lower(title)"}, OpClasses: []string{"text_ops"}, Method: "btree", Predicate: "price > 0::numeric"}, books.Indexes[1])
+}
+
+func TestGraphQLTransactionsAndOptimisticLocking(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "tx-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %s.accounts (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			version INT NOT NULL DEFAULT 1
+		)
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+	count := func() int {
+		var n int
+		require.NoError(t, testDB.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s.accounts`, ten.SchemaName)).Scan(&n))
+		return n
+	}
+
+	// 1. Without a transaction the first insert is kept when the second fails
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { a: createAccounts(name: "a") { id } b: createAccounts(name: "a") { id } }
+	`)
+	require.NotEmpty(t, resp.Errors)
+	assert.Equal(t, 1, count())
+
+	// 2. With @transaction both are rolled back
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation @transaction { b: createAccounts(name: "b") { id } c: createAccounts(name: "a") { id } }
+	`)
+	require.NotEmpty(t, resp.Errors)
+	assert.Equal(t, "transaction rolled back", resp.Errors[len(resp.Errors)-1].Message)
+	assert.Equal(t, "null", string(resp.Data))
+	assert.Equal(t, 1, count())
+
+	// 3. Successful transactions commit, and reads see their own writes
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation @transaction { b: createAccounts(name: "b") { id } c: createAccounts(name: "c") { id } }
+	`)
+	require.Nil(t, resp.Errors, "errors: %v", resp.Errors)
+	assert.Equal(t, 3, count())
+
+	// 4. Updates bump the version and check the expected one
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { updateAccounts(id: 1, name: "a2", expectedVersion: 1) { version } }
+	`)
+	require.Nil(t, resp.Errors, "errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"updateAccounts":{"version":2}}`, string(resp.Data))
+
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { updateAccounts(id: 1, name: "a3", expectedVersion: 1) { version } }
+	`)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "accounts was modified concurrently: version does not match the expected value", resp.Errors[0].Message)
+
+	// 5. Missing rows are not conflicts
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		mutation { updateAccounts(id: 99, name: "x", expectedVersion: 1) { version } }
+	`)
+	require.Nil(t, resp.Errors, "errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"updateAccounts":null}`, string(resp.Data))
+}
+
+func executeGraphQLRequest(t *testing.T, handler *Handler, tenantID, schemaName, query string) GraphQLResponse {
+	reqBody := fmt.Sprintf(`{"query": %q}`, query)
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Inject tenant context using the tenant package
+	ten := &tenant.Tenant{
+		ID:         tenantID,
+		SchemaName: schemaName,
+		Status:     tenant.StatusActive,
+	}
+	ctx := tenant.WithTenant(req.Context(), ten)
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var gqlResp GraphQLResponse
+	err := json.NewDecoder(resp.Body).Decode(&gqlResp)
+	require.NoError(t, err)
+	return gqlResp
+}
+
+func TestGraphQLFullTextSearch(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "search-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.products (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT,
+			price INT NOT NULL,
+			document TSVECTOR GENERATED ALWAYS AS (
+				to_tsvector('english', name || ' ' || COALESCE(description, ''))
+			) STORED
+		);
+		CREATE INDEX products_document_idx ON %[1]s.products USING gin (document);
+		INSERT INTO %[1]s.products (name, description, price) VALUES
+			('Desk lamp', 'A small lamp for reading', 30),
+			('Floor lamp', 'Lamps and lamps of light', 90),
+			('Office chair', 'Comfortable chair', 150);
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+
+	// 1. Ranked rows with highlighted snippets
+	resp := executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			searchProducts(query: "lamps", limit: 10) {
+				rank
+				snippets { field text }
+				node { name }
+			}
+		}
+	`)
+	require.Nil(t, resp.Errors, "search errors: %v", resp.Errors)
+	var searched struct {
+		SearchProducts []struct {
+			Rank     float64 `json:"rank"`
+			Snippets []struct {
+				Field string `json:"field"`
+				Text  string `json:"text"`
+			} `json:"snippets"`
+			Node struct {
+				Name string `json:"name"`
+			} `json:"node"`
+		} `json:"searchProducts"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &searched))
+	require.Len(t, searched.SearchProducts, 2)
+	assert.Equal(t, "Floor lamp", searched.SearchProducts[0].Node.Name, "more matches rank higher")
+	assert.Greater(t, searched.SearchProducts[0].Rank, searched.SearchProducts[1].Rank)
+	require.NotEmpty(t, searched.SearchProducts[0].Snippets)
+	assert.Contains(t, searched.SearchProducts[0].Snippets[0].Text, "<mark>")
+
+	// 2. The same search as a list filter, combined with other conditions
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			products(where: { _search: "lamp", price: { _lt: 50 } }) { name }
+		}
+	`)
+	require.Nil(t, resp.Errors, "search filter errors: %v", resp.Errors)
+	assert.JSONEq(t, `{"products":[{"name":"Desk lamp"}]}`, string(resp.Data))
+
+	// 3. Snippets escape the column's HTML and keep only their highlights
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s.products (name, description, price) VALUES ('Lantern <img src=x onerror=alert(1)>', 'Tom & Jerry''s "lantern"', 20);
+	`, ten.SchemaName))
+	require.NoError(t, err)
+	resp = executeGraphQLRequest(t, handler, ten.ID, ten.SchemaName, `
+		query {
+			searchProducts(query: "lantern") { snippets { field text } }
+		}
+	`)
+	require.Nil(t, resp.Errors, "search errors: %v", resp.Errors)
+	var escaped struct {
+		SearchProducts []struct {
+			Snippets []struct {
+				Text string `json:"text"`
+			} `json:"snippets"`
+		} `json:"searchProducts"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Data, &escaped))
+	require.Len(t, escaped.SearchProducts, 1)
+	var texts []string
+	for _, snippet := range escaped.SearchProducts[0].Snippets {
+		texts = append(texts, snippet.Text)
+	}
+	all := strings.Join(texts, "\n")
+	assert.Contains(t, all, "<mark>Lantern</mark>")
+	assert.Contains(t, all, "&lt;img")
+	assert.NotContains(t, all, "<img")
+	assert.NotContains(t, all, `"`)
+}
+
+func TestRESTEndpoints(t *testing.T) {
+	setupPostgresContainer(t)
+	defer teardownPostgresContainer(t)
+	setupControlDatabase(t, testDB)
+
+	ctx := context.Background()
+	logger := zerolog.Nop()
+
+	db, err := database.NewDB(ctx, testDBConfig, logger)
+	require.NoError(t, err)
+	defer db.Close()
+
+	provisioner := tenant.NewProvisioner(db, logger)
+	ten, err := provisioner.CreateTenant(ctx, "rest-test")
+	require.NoError(t, err)
+
+	_, err = testDB.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE %[1]s.products (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			price INT NOT NULL
+		);
+		INSERT INTO %[1]s.products (name, price) VALUES ('lamp', 30), ('chair', 150), ('desk', 90);
+	`, ten.SchemaName))
+	require.NoError(t, err)
+
+	handler := NewHandler(db, logger)
+	rest := func(method, target, key, body string) (int, string) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(tenant.WithTenant(req.Context(), ten))
+		w := httptest.NewRecorder()
+		handler.ServeREST(w, req, "products", key)
+		return w.Code, w.Body.String()
+	}
+
+	// 1. List with a filter, an order and pagination
+	status, body := rest("GET", "/rest/products?order=price.desc&limit=2", "", "")
+	require.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, `[{"id":2,"name":"chair","price":150},{"id":3,"name":"desk","price":90}]`, body)
+
+	status, body = rest("GET", `/rest/products?where={"price":{"_lt":100}}&name=lamp`, "", "")
+	require.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, `[{"id":1,"name":"lamp","price":30}]`, body)
+
+	// 2. Create, get, update and delete by id
+	status, body = rest("POST", "/rest/products", "", `{"name":"shelf","price":40}`)
+	require.Equal(t, http.StatusCreated, status, body)
+	assert.JSONEq(t, `{"id":4,"name":"shelf","price":40}`, body)
+
+	status, body = rest("PATCH", "/rest/products/4", "4", `{"price":45}`)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, `{"id":4,"name":"shelf","price":45}`, body)
+
+	status, body = rest("GET", "/rest/products/4", "4", "")
+	require.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, `{"id":4,"name":"shelf","price":45}`, body)
+
+	status, body = rest("DELETE", "/rest/products/4", "4", "")
+	require.Equal(t, http.StatusOK, status, body)
+
+	status, _ = rest("GET", "/rest/products/4", "4", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// 3. Database errors keep their codes
+	status, body = rest("POST", "/rest/products", "", `{"name":"lamp","price":1}`)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Contains(t, body, `"code":"UNIQUE_VIOLATION"`)
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/kapok/kapok/internal/database"
+	"github.com/lib/pq"
 )
 
 // Column represents a database column
@@ -16,17 +17,92 @@ type Column struct {
 	IsFK       bool
 	FKTable    string
 	FKColumn   string
+	// Default is the default expression, e.g. now(); HasDefault is also set for
+	// identity columns, which have none
+	Default    string
+	HasDefault bool
+	Comment    string
 }
 
-// Table represents a database table
-type Table struct {
+// Constraint represents a primary key or unique constraint usable as an upsert target
+type Constraint struct {
 	Name    string
-	Columns []Column
+	Columns []string
+}
+
+// CheckConstraint represents a CHECK constraint of a table
+type CheckConstraint struct {
+	Name    string
+	Columns []string
+	// Definition is the constraint as Postgres prints it, e.g. CHECK ((price > 0))
+	Definition string
+}
+
+// Index represents an index of a table. Columns lists its key columns, with
+// expressions as Postgres prints them, and OpClasses the operator class of each;
+// Predicate is set for partial indexes.
+type Index struct {
+	Name      string
+	Columns   []string
+	OpClasses []string
+	Unique    bool
+	Primary   bool
+	Method    string
+	Predicate string
+}
+
+// Table represents a database table, view or materialized view
+type Table struct {
+	Name        string
+	Columns     []Column
+	Constraints []Constraint
+	Checks      []CheckConstraint
+	Indexes     []Index
+	Comment     string
+	// ReadOnly is set for views and materialized views, which get no mutations
+	ReadOnly bool
+
+	// access restricts the table to the role a schema is generated for
+	access *tableAccess
+}
+
+// FunctionArg represents an input argument of a SQL function
+type FunctionArg struct {
+	Name       string
+	DataType   string
+	HasDefault bool
+}
+
+// Function represents a SQL function returning rows of a table or view
+type Function struct {
+	Name        string
+	Args        []FunctionArg
+	ReturnTable string
+	ReturnsSet  bool
+	// Volatile functions may modify data and are exposed as mutations
+	Volatile bool
+	Comment  string
+}
+
+// Enum represents a Postgres enum type and its labels, in sort order
+type Enum struct {
+	Name   string
+	Values []string
 }
 
 // SchemaMetadata contains the introspected database schema
 type SchemaMetadata struct {
-	Tables []Table
+	Tables    []Table
+	Functions []Function
+	Enums     []Enum
+
+	// Actions are the tenant's custom queries and mutations; introspection
+	// leaves them empty
+	Actions []Action
+
+	// RemoteSchemas are the tenant's introspected remote schemas; introspection
+	// leaves them empty
+	RemoteSchemas []RemoteSchema
 }
 
 // Introspector handles database schema introspection
@@ -39,38 +115,69 @@ func NewIntrospector(db *database.DB) *Introspector {
 	return &Introspector{db: db}
 }
 
-// Inspect discovers the schema structure for a given tenant schema
+// Inspect discovers the schema structure for a given tenant schema. It runs a
+// fixed number of pg_catalog queries, whatever the number of tables.
 func (i *Introspector) Inspect(ctx context.Context, schemaName string) (*SchemaMetadata, error) {
 	tables, err := i.getTables(ctx, schemaName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tables: %w", err)
 	}
 
-	meta := &SchemaMetadata{
-		Tables: make([]Table, 0, len(tables)),
+	byName := make(map[string]*Table, len(tables))
+	for idx := range tables {
+		byName[tables[idx].Name] = &tables[idx]
 	}
 
-	for _, tableName := range tables {
-		columns, err := i.getColumns(ctx, schemaName, tableName)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get columns for table %s: %w", tableName, err)
-		}
-		
-		meta.Tables = append(meta.Tables, Table{
-			Name:    tableName,
-			Columns: columns,
-		})
+	if err := i.getColumns(ctx, schemaName, byName); err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+	if err := i.getConstraints(ctx, schemaName, byName); err != nil {
+		return nil, fmt.Errorf("failed to get constraints: %w", err)
+	}
+	if err := i.getIndexes(ctx, schemaName, byName); err != nil {
+		return nil, fmt.Errorf("failed to get indexes: %w", err)
+	}
+
+	meta := &SchemaMetadata{Tables: tables}
+
+	functions, err := i.getFunctions(ctx, schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get functions: %w", err)
+	}
+	meta.Functions = functions
+
+	enums, err := i.getEnums(ctx, schemaName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enums: %w", err)
 	}
+	meta.Enums = enums
 
 	return meta, nil
 }
 
-func (i *Introspector) getTables(ctx context.Context, schemaName string) ([]string, error) {
+// pg_class.relkind values of the relations exposed as types
+const (
+	relKindTable            = "r"
+	relKindView             = "v"
+	relKindMaterializedView = "m"
+)
+
+// relationFilter restricts pg_class c to the relations exposed as types
+const relationFilter = `
+		c.relkind IN ('r', 'p', 'v', 'm')
+		AND NOT c.relispartition`
+
+func (i *Introspector) getTables(ctx context.Context, schemaName string) ([]Table, error) {
 	query := `
-		SELECT table_name
-		FROM information_schema.tables
-		WHERE table_schema = $1
-		AND table_type = 'BASE TABLE'
+		SELECT c.relname,
+			-- partitioned tables are written to like plain tables
+			CASE WHEN c.relkind = 'p' THEN 'r' ELSE c.relkind::text END,
+			COALESCE(obj_description(c.oid, 'pg_class'), '')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+		AND ` + relationFilter + `
+		ORDER BY c.relname
 	`
 	rows, err := i.db.QueryContext(ctx, query, schemaName)
 	if err != nil {
@@ -78,134 +185,291 @@ func (i *Introspector) getTables(ctx context.Context, schemaName string) ([]stri
 	}
 	defer rows.Close()
 
-	var tables []string
+	tables := make([]Table, 0)
 	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+		var t Table
+		var kind string
+		if err := rows.Scan(&t.Name, &kind, &t.Comment); err != nil {
 			return nil, err
 		}
-		tables = append(tables, name)
+		t.ReadOnly = kind != relKindTable
+		tables = append(tables, t)
 	}
-	return tables, nil
+	return tables, rows.Err()
+}
+
+// dataTypeSQL renders the data type of the type with OID typeOID the way
+// Column.DataType reports it: domains as their base type, enum types by their bare
+// name and arrays as <element type>[]
+func dataTypeSQL(typeOID string) string {
+	return fmt.Sprintf(`(
+		SELECT CASE WHEN e.typtype = 'e' THEN e.typname::text ELSE format_type(e.oid, NULL) END
+			|| CASE WHEN b.typcategory = 'A' THEN '[]' ELSE '' END
+		FROM pg_type t
+		JOIN pg_type b ON b.oid = CASE WHEN t.typtype = 'd' THEN t.typbasetype ELSE t.oid END
+		JOIN pg_type e ON e.oid = CASE WHEN b.typcategory = 'A' THEN b.typelem ELSE b.oid END
+		WHERE t.oid = %s
+	)`, typeOID)
 }
 
-func (i *Introspector) getColumns(ctx context.Context, schemaName, tableName string) ([]Column, error) {
-	// Get basic column info
+func (i *Introspector) getEnums(ctx context.Context, schemaName string) ([]Enum, error) {
 	query := `
-		SELECT column_name, data_type, is_nullable
-		FROM information_schema.columns
-		WHERE table_schema = $1 AND table_name = $2
-		ORDER BY ordinal_position
+		SELECT t.typname, e.enumlabel
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_enum e ON e.enumtypid = t.oid
+		WHERE n.nspname = $1
+		ORDER BY t.typname, e.enumsortorder
 	`
-	rows, err := i.db.QueryContext(ctx, query, schemaName, tableName)
+	rows, err := i.db.QueryContext(ctx, query, schemaName)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var columns []Column
+	var enums []Enum
 	for rows.Next() {
-		var c Column
-		var nullable string
-		if err := rows.Scan(&c.Name, &c.DataType, &nullable); err != nil {
+		var name, label string
+		if err := rows.Scan(&name, &label); err != nil {
 			return nil, err
 		}
-		c.IsNullable = nullable == "YES"
-		columns = append(columns, c)
+		if n := len(enums); n > 0 && enums[n-1].Name == name {
+			enums[n-1].Values = append(enums[n-1].Values, label)
+			continue
+		}
+		enums = append(enums, Enum{Name: name, Values: []string{label}})
 	}
+	return enums, rows.Err()
+}
 
-	// Enrich with PK information
-	pks, err := i.getPrimaryKeys(ctx, schemaName, tableName)
+// getFunctions lists the functions of a schema that return rows of one of its
+// relations. Overloads after the first and functions with OUT/VARIADIC
+// parameters are skipped.
+func (i *Introspector) getFunctions(ctx context.Context, schemaName string) ([]Function, error) {
+	query := `
+		SELECT p.proname, p.provolatile = 'v', p.proretset, rc.relname,
+			COALESCE(p.proargnames, ARRAY[]::text[]),
+			ARRAY(
+				SELECT ` + dataTypeSQL("a.t") + `
+				FROM unnest(p.proargtypes::oid[]) WITH ORDINALITY AS a(t, i)
+				ORDER BY a.i
+			),
+			p.pronargdefaults,
+			COALESCE(obj_description(p.oid, 'pg_proc'), '')
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		JOIN pg_type rt ON rt.oid = p.prorettype
+		JOIN pg_class rc ON rc.oid = rt.typrelid AND rc.relnamespace = n.oid
+		WHERE n.nspname = $1
+		AND p.prokind = 'f'
+		AND p.proallargtypes IS NULL
+		ORDER BY p.proname, p.oid
+	`
+	rows, err := i.db.QueryContext(ctx, query, schemaName)
 	if err != nil {
 		return nil, err
 	}
-	for idx, col := range columns {
-		if _, ok := pks[col.Name]; ok {
-			columns[idx].IsPK = true
+	defer rows.Close()
+
+	var functions []Function
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var fn Function
+		var argNames, argTypes []string
+		var defaults int
+		if err := rows.Scan(&fn.Name, &fn.Volatile, &fn.ReturnsSet, &fn.ReturnTable,
+			pq.Array(&argNames), pq.Array(&argTypes), &defaults, &fn.Comment); err != nil {
+			return nil, err
+		}
+		if seen[fn.Name] {
+			continue
+		}
+		seen[fn.Name] = true
+
+		for idx, dataType := range argTypes {
+			arg := FunctionArg{DataType: dataType}
+			if idx < len(argNames) {
+				arg.Name = argNames[idx]
+			}
+			// Defaults always belong to the trailing arguments
+			arg.HasDefault = idx >= len(argTypes)-defaults
+			fn.Args = append(fn.Args, arg)
 		}
+		functions = append(functions, fn)
 	}
+	return functions, rows.Err()
+}
 
-	// Enrich with FK information
-	fks, err := i.getForeignKeys(ctx, schemaName, tableName)
+// getColumns adds the columns of every relation of a schema; pg_attribute also
+// covers materialized views
+func (i *Introspector) getColumns(ctx context.Context, schemaName string, tables map[string]*Table) error {
+	query := `
+		SELECT c.relname, a.attname, ` + dataTypeSQL("a.atttypid") + `, NOT a.attnotnull,
+			COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+			d.adbin IS NOT NULL OR a.attidentity <> '',
+			COALESCE(col_description(c.oid, a.attnum), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = $1
+		AND ` + relationFilter + `
+		AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum
+	`
+	rows, err := i.db.QueryContext(ctx, query, schemaName)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for idx, col := range columns {
-		if fk, ok := fks[col.Name]; ok {
-			columns[idx].IsFK = true
-			columns[idx].FKTable = fk.Table
-			columns[idx].FKColumn = fk.Column
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		var c Column
+		if err := rows.Scan(&table, &c.Name, &c.DataType, &c.IsNullable, &c.Default, &c.HasDefault, &c.Comment); err != nil {
+			return err
+		}
+		if t, ok := tables[table]; ok {
+			t.Columns = append(t.Columns, c)
 		}
 	}
+	return rows.Err()
+}
+
+// pg_constraint.contype values read by getConstraints
+const (
+	conTypePrimaryKey = "p"
+	conTypeUnique     = "u"
+	conTypeForeignKey = "f"
+	conTypeCheck      = "c"
+)
 
-	return columns, nil
+// constraintColumnsSQL lists the names of the columns numbered by keys of the
+// relation rel, in key order
+func constraintColumnsSQL(rel, keys string) string {
+	return fmt.Sprintf(`ARRAY(
+				SELECT a.attname FROM unnest(%[2]s) WITH ORDINALITY AS k(attnum, i)
+				JOIN pg_attribute a ON a.attrelid = %[1]s AND a.attnum = k.attnum
+				ORDER BY k.i
+			)`, rel, keys)
 }
 
-func (i *Introspector) getPrimaryKeys(ctx context.Context, schemaName, tableName string) (map[string]bool, error) {
+// getConstraints marks primary and foreign key columns and adds the unique and
+// check constraints of every table of a schema. Foreign keys are only followed
+// within the schema.
+func (i *Introspector) getConstraints(ctx context.Context, schemaName string, tables map[string]*Table) error {
 	query := `
-		SELECT kcu.column_name
-		FROM information_schema.table_constraints tc
-		JOIN information_schema.key_column_usage kcu
-		ON tc.constraint_name = kcu.constraint_name
-		AND tc.table_schema = kcu.table_schema
-		WHERE tc.constraint_type = 'PRIMARY KEY'
-		AND tc.table_schema = $1
-		AND tc.table_name = $2
+		SELECT rel.relname, con.conname, con.contype::text,
+			` + constraintColumnsSQL("con.conrelid", "con.conkey") + `,
+			CASE WHEN frel.relnamespace = n.oid THEN frel.relname ELSE '' END,
+			` + constraintColumnsSQL("con.confrelid", "con.confkey") + `,
+			CASE WHEN con.contype = 'c' THEN pg_get_constraintdef(con.oid, true) ELSE '' END
+		FROM pg_constraint con
+		JOIN pg_class rel ON rel.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = rel.relnamespace
+		LEFT JOIN pg_class frel ON frel.oid = con.confrelid
+		WHERE n.nspname = $1
+		AND con.contype IN ('p', 'u', 'f', 'c')
+		ORDER BY rel.relname, con.conname
 	`
-	rows, err := i.db.QueryContext(ctx, query, schemaName, tableName)
+	rows, err := i.db.QueryContext(ctx, query, schemaName)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	pks := make(map[string]bool)
 	for rows.Next() {
-		var col string
-		if err := rows.Scan(&col); err != nil {
-			return nil, err
+		var table, name, kind, foreignTable, definition string
+		var columns, foreignColumns []string
+		if err := rows.Scan(&table, &name, &kind, pq.Array(&columns), &foreignTable,
+			pq.Array(&foreignColumns), &definition); err != nil {
+			return err
+		}
+		t, ok := tables[table]
+		if !ok {
+			continue
 		}
-		pks[col] = true
-	}
-	return pks, nil
-}
 
-type fkInfo struct {
-	Table  string
-	Column string
+		switch kind {
+		case conTypePrimaryKey, conTypeUnique:
+			t.Constraints = append(t.Constraints, Constraint{Name: name, Columns: columns})
+			if kind == conTypePrimaryKey {
+				for _, col := range columns {
+					if c := t.column(col); c != nil {
+						c.IsPK = true
+					}
+				}
+			}
+		case conTypeForeignKey:
+			if foreignTable == "" {
+				continue
+			}
+			for idx, col := range columns {
+				c := t.column(col)
+				if c == nil || idx >= len(foreignColumns) {
+					continue
+				}
+				c.IsFK = true
+				c.FKTable = foreignTable
+				c.FKColumn = foreignColumns[idx]
+			}
+		case conTypeCheck:
+			t.Checks = append(t.Checks, CheckConstraint{Name: name, Columns: columns, Definition: definition})
+		}
+	}
+	return rows.Err()
 }
 
-func (i *Introspector) getForeignKeys(ctx context.Context, schemaName, tableName string) (map[string]fkInfo, error) {
+// getIndexes adds the indexes of every table of a schema
+func (i *Introspector) getIndexes(ctx context.Context, schemaName string, tables map[string]*Table) error {
 	query := `
-		SELECT
-			kcu.column_name,
-			ccu.table_name AS foreign_table_name,
-			ccu.column_name AS foreign_column_name
-		FROM
-			information_schema.table_constraints AS tc
-			JOIN information_schema.key_column_usage AS kcu
-			ON tc.constraint_name = kcu.constraint_name
-			AND tc.table_schema = kcu.table_schema
-			JOIN information_schema.constraint_column_usage AS ccu
-			ON ccu.constraint_name = tc.constraint_name
-			AND ccu.table_schema = tc.table_schema
-		WHERE constraint_type = 'FOREIGN KEY'
-		AND tc.table_schema = $1
-		AND tc.table_name = $2
+		SELECT c.relname, ic.relname, ix.indisunique, ix.indisprimary, am.amname,
+			ARRAY(
+				SELECT pg_get_indexdef(ix.indexrelid, k.i, true)
+				FROM generate_series(1, ix.indnkeyatts) AS k(i)
+				ORDER BY k.i
+			),
+			ARRAY(
+				SELECT opc.opcname
+				FROM generate_series(1, ix.indnkeyatts) AS k(i)
+				JOIN pg_opclass opc ON opc.oid = ix.indclass[k.i - 1]
+				ORDER BY k.i
+			),
+			COALESCE(pg_get_expr(ix.indpred, ix.indrelid, true), '')
+		FROM pg_index ix
+		JOIN pg_class c ON c.oid = ix.indrelid
+		JOIN pg_class ic ON ic.oid = ix.indexrelid
+		JOIN pg_am am ON am.oid = ic.relam
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+		ORDER BY c.relname, ic.relname
 	`
-	rows, err := i.db.QueryContext(ctx, query, schemaName, tableName)
+	rows, err := i.db.QueryContext(ctx, query, schemaName)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	fks := make(map[string]fkInfo)
 	for rows.Next() {
-		var localCol string
-		var info fkInfo
-		if err := rows.Scan(&localCol, &info.Table, &info.Column); err != nil {
-			return nil, err
+		var table string
+		var idx Index
+		if err := rows.Scan(&table, &idx.Name, &idx.Unique, &idx.Primary, &idx.Method,
+			pq.Array(&idx.Columns), pq.Array(&idx.OpClasses), &idx.Predicate); err != nil {
+			return err
+		}
+		if t, ok := tables[table]; ok {
+			t.Indexes = append(t.Indexes, idx)
+		}
+	}
+	return rows.Err()
+}
+
+// column returns the column of a table with the given name, or nil
+func (t *Table) column(name string) *Column {
+	for idx := range t.Columns {
+		if t.Columns[idx].Name == name {
+			return &t.Columns[idx]
 		}
-		fks[localCol] = info
 	}
-	return fks, nil
+	return nil
 }
@@ -0,0 +1,217 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+	"github.com/lib/pq"
+)
+
+// loaderKey is the context key for the per-request Loader
+type loaderKey struct{}
+
+// rowNumberColumn is the window column used to page hasMany batches per parent
+const rowNumberColumn = "__kapok_rn"
+
+// Loader batches relation lookups made while resolving one GraphQL request.
+//
+// Relation resolvers register the key they need and return a thunk. graphql-go
+// resolves thunks breadth-first, so every sibling registers its key before the
+// first thunk of a level runs; that thunk then issues a single
+// `WHERE col = ANY($1)` query for the whole level and the others read from it.
+type Loader struct {
+	mu      sync.Mutex
+	pending map[string]*relationBatch
+}
+
+// relationBatch collects the keys of one relation at one depth level
+type relationBatch struct {
+	keys    []interface{}
+	seen    map[string]bool
+	fetch   func(ctx context.Context, keys []interface{}) (map[string][]map[string]interface{}, error)
+	once    sync.Once
+	results map[string][]map[string]interface{}
+	err     error
+}
+
+// NewLoader creates an empty loader; one should be used per request
+func NewLoader() *Loader {
+	return &Loader{pending: make(map[string]*relationBatch)}
+}
+
+// WithLoader attaches a loader to the context
+func WithLoader(ctx context.Context, l *Loader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+// loaderFromContext returns the request loader, or nil when batching is disabled
+func loaderFromContext(ctx context.Context) *Loader {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(loaderKey{}).(*Loader)
+	return l
+}
+
+// load registers key on the batch identified by batchKey and returns a thunk
+// yielding the rows found for it
+func (l *Loader) load(ctx context.Context, batchKey string, key interface{}, fetch func(context.Context, []interface{}) (map[string][]map[string]interface{}, error)) func() ([]map[string]interface{}, error) {
+	l.mu.Lock()
+	batch, ok := l.pending[batchKey]
+	if !ok {
+		batch = &relationBatch{seen: make(map[string]bool), fetch: fetch}
+		l.pending[batchKey] = batch
+	}
+	id := loaderKeyString(key)
+	if !batch.seen[id] {
+		batch.seen[id] = true
+		batch.keys = append(batch.keys, key)
+	}
+	l.mu.Unlock()
+
+	return func() ([]map[string]interface{}, error) {
+		batch.once.Do(func() {
+			// Later levels reaching the same relation start a fresh batch
+			l.mu.Lock()
+			if l.pending[batchKey] == batch {
+				delete(l.pending, batchKey)
+			}
+			l.mu.Unlock()
+			batch.results, batch.err = batch.fetch(ctx, batch.keys)
+		})
+		if batch.err != nil {
+			return nil, batch.err
+		}
+		return batch.results[id], nil
+	}
+}
+
+// loaderKeyString normalises key values so int64/string parents match child rows
+func loaderKeyString(v interface{}) string {
+	return fmt.Sprint(v)
+}
+
+// groupRows indexes rows by the value of the given field
+func groupRows(rows []map[string]interface{}, field string) map[string][]map[string]interface{} {
+	grouped := make(map[string][]map[string]interface{})
+	for _, row := range rows {
+		key := loaderKeyString(row[field])
+		grouped[key] = append(grouped[key], row)
+	}
+	return grouped
+}
+
+// loadRelation batches a belongsTo lookup (child FK -> parent row)
+func (r *Resolver) loadRelation(p graphql.ResolveParams, l *Loader, schemaName string, foreignTable Table, foreignColumn string, fkValue interface{}) (interface{}, error) {
+	batchKey := fmt.Sprintf("belongsTo:%s.%s.%s", schemaName, foreignTable.Name, foreignColumn)
+
+	thunk := l.load(p.Context, batchKey, fkValue, func(ctx context.Context, keys []interface{}) (map[string][]map[string]interface{}, error) {
+		args := &queryArgs{}
+		source, err := tableSource(ctx, schemaName, foreignTable, args)
+		if err != nil {
+			return nil, err
+		}
+		query := fmt.Sprintf(`SELECT * FROM %s WHERE "%s" = ANY(%s)`,
+			source, foreignColumn, args.add(pq.Array(keys)))
+
+		rows, err := r.conn(ctx).QueryContext(ctx, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(ctx, err, "relation query failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read relation results")
+		}
+		return groupRows(results, strcase.ToLowerCamel(foreignColumn)), nil
+	})
+
+	return func() (interface{}, error) {
+		rows, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		return rows[0], nil
+	}, nil
+}
+
+// loadHasMany batches a hasMany lookup (parent key -> child rows). limit/offset
+// apply per parent, so the batch pages each partition with ROW_NUMBER().
+func (r *Resolver) loadHasMany(p graphql.ResolveParams, l *Loader, schemaName string, tables map[string]Table, childTable Table, childColumn string, pkValue interface{}, limit, offset int) (interface{}, error) {
+	// Fields with different arguments cannot share a batch
+	argsKey, err := json.Marshal(p.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+	batchKey := fmt.Sprintf("hasMany:%s.%s.%s:%s", schemaName, childTable.Name, childColumn, argsKey)
+
+	where, _ := p.Args["where"].(map[string]interface{})
+	orderArg := p.Args["order_by"]
+
+	thunk := l.load(p.Context, batchKey, pkValue, func(ctx context.Context, keys []interface{}) (map[string][]map[string]interface{}, error) {
+		args := &queryArgs{}
+		source, err := tableSource(ctx, schemaName, childTable, args)
+		if err != nil {
+			return nil, err
+		}
+		conds := []string{fmt.Sprintf(`"%s" = ANY(%s)`, childColumn, args.add(pq.Array(keys)))}
+
+		if where != nil {
+			cond, err := buildWhere(childTable, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if cond != "" {
+				conds = append(conds, cond)
+			}
+		}
+
+		orderBy, err := buildOrderBy(ctx, schemaName, tables, childTable, orderArg, args)
+		if err != nil {
+			return nil, err
+		}
+		window := fmt.Sprintf(`PARTITION BY "%s"`, childColumn)
+		if orderBy != "" {
+			window += " ORDER BY " + orderBy
+		}
+
+		query := fmt.Sprintf(
+			`SELECT * FROM (SELECT *, ROW_NUMBER() OVER (%s) AS "%s" FROM %s WHERE %s) AS "batch" WHERE "%s" > %d AND "%s" <= %d ORDER BY "%s"`,
+			window, rowNumberColumn, source, strings.Join(conds, " AND "),
+			rowNumberColumn, offset, rowNumberColumn, offset+limit, rowNumberColumn,
+		)
+
+		rows, err := r.conn(ctx).QueryContext(ctx, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(ctx, err, "has many query failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read has many results")
+		}
+		rnField := strcase.ToLowerCamel(rowNumberColumn)
+		for _, row := range results {
+			delete(row, rnField)
+		}
+		return groupRows(results, strcase.ToLowerCamel(childColumn)), nil
+	})
+
+	return func() (interface{}, error) {
+		rows, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		return rows, nil
+	}, nil
+}
@@ -0,0 +1,73 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader_BatchesSiblingKeys(t *testing.T) {
+	l := NewLoader()
+	ctx := context.Background()
+
+	var calls int
+	var fetched []interface{}
+	fetch := func(_ context.Context, keys []interface{}) (map[string][]map[string]interface{}, error) {
+		calls++
+		fetched = keys
+		return groupRows([]map[string]interface{}{
+			{"id": int64(1), "name": "a"},
+			{"id": int64(2), "name": "b"},
+		}, "id"), nil
+	}
+
+	t1 := l.load(ctx, "authors", int64(1), fetch)
+	t2 := l.load(ctx, "authors", int64(2), fetch)
+	t3 := l.load(ctx, "authors", int64(1), fetch)
+
+	rows, err := t2()
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "b", rows[0]["name"])
+
+	rows, err = t1()
+	require.NoError(t, err)
+	assert.Equal(t, "a", rows[0]["name"])
+
+	_, err = t3()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, calls, "siblings should share one query")
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, fetched, "duplicate keys are only fetched once")
+}
+
+func TestLoader_NewLevelStartsNewBatch(t *testing.T) {
+	l := NewLoader()
+	ctx := context.Background()
+
+	var calls int
+	fetch := func(_ context.Context, keys []interface{}) (map[string][]map[string]interface{}, error) {
+		calls++
+		return map[string][]map[string]interface{}{}, nil
+	}
+
+	first := l.load(ctx, "authors", 1, fetch)
+	_, err := first()
+	require.NoError(t, err)
+
+	second := l.load(ctx, "authors", 2, fetch)
+	rows, err := second()
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestLoaderFromContext(t *testing.T) {
+	assert.Nil(t, loaderFromContext(context.Background()))
+
+	l := NewLoader()
+	assert.Same(t, l, loaderFromContext(WithLoader(context.Background(), l)))
+}
@@ -0,0 +1,286 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+	"github.com/lib/pq"
+)
+
+// maxJunctionExtraColumns is the number of non-key columns a junction table may
+// carry (e.g. created_at, position) and still be treated as a plain link table
+const maxJunctionExtraColumns = 2
+
+// parentKeyColumn carries the source key of each row in batched many-to-many queries
+const parentKeyColumn = "__kapok_parent"
+
+// manyToManyRelation links table to target through a junction table: junction rows
+// reference parentColumn of table via sourceColumn and targetKeyColumn of target
+// via targetColumn. E.g. posts.tags through post_tags(post_id, tag_id).
+type manyToManyRelation struct {
+	field           string
+	junction        Table
+	target          Table
+	sourceColumn    string
+	targetColumn    string
+	parentColumn    string
+	targetKeyColumn string
+}
+
+// junctionColumns returns the two foreign keys forming the primary key of a
+// junction table, or false when the table is not one
+func junctionColumns(table Table) (Column, Column, bool) {
+	if table.ReadOnly {
+		return Column{}, Column{}, false
+	}
+
+	var keys []Column
+	extra := 0
+	for _, col := range table.Columns {
+		switch {
+		case col.IsPK && col.IsFK && col.FKTable != "":
+			keys = append(keys, col)
+		case col.IsPK:
+			return Column{}, Column{}, false
+		default:
+			extra++
+		}
+	}
+	if len(keys) != 2 || extra > maxJunctionExtraColumns {
+		return Column{}, Column{}, false
+	}
+	return keys[0], keys[1], true
+}
+
+// manyToManyRelations lists the tables reachable from table through a junction
+// table, in a stable order. Self-referencing junctions (e.g. follows) are left
+// to the hasMany/belongsTo fields since their direction is ambiguous; when two
+// junctions lead to the same table the first one wins.
+func manyToManyRelations(tables map[string]Table, table Table) []manyToManyRelation {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var relations []manyToManyRelation
+	seen := make(map[string]bool)
+	for _, name := range names {
+		junction := tables[name]
+		a, b, ok := junctionColumns(junction)
+		if !ok || a.FKTable == b.FKTable {
+			continue
+		}
+
+		source, target := a, b
+		if b.FKTable == table.Name {
+			source, target = b, a
+		}
+		if source.FKTable != table.Name {
+			continue
+		}
+		targetTable, ok := tables[target.FKTable]
+		if !ok {
+			continue
+		}
+
+		field := strcase.ToLowerCamel(targetTable.Name)
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		relations = append(relations, manyToManyRelation{
+			field:           field,
+			junction:        junction,
+			target:          targetTable,
+			sourceColumn:    source.Name,
+			targetColumn:    target.Name,
+			parentColumn:    source.FKColumn,
+			targetKeyColumn: target.FKColumn,
+		})
+	}
+	return relations
+}
+
+// validate checks every identifier of the relation before it is used in SQL
+func (rel manyToManyRelation) validate() error {
+	for _, name := range []string{rel.junction.Name, rel.target.Name, rel.sourceColumn, rel.targetColumn, rel.targetKeyColumn} {
+		if err := validateIdentifier(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveManyToMany returns a function that resolves a many-to-many relation
+// through its junction table. Example: post.tags through post_tags.
+func (r *Resolver) ResolveManyToMany(schemaName string, tables map[string]Table, rel manyToManyRelation) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		// Validate identifiers
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := rel.validate(); err != nil {
+			return nil, fmt.Errorf("invalid relation")
+		}
+
+		source, ok := p.Source.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		pkValue, ok := source[strcase.ToLowerCamel(rel.parentColumn)]
+		if !ok || pkValue == nil {
+			return nil, nil
+		}
+
+		limit, _ := p.Args["limit"].(int)
+		offset, _ := p.Args["offset"].(int)
+
+		if limit <= 0 {
+			limit = DefaultLimit
+		}
+		if limit > MaxLimit {
+			limit = MaxLimit
+		}
+
+		// Batch with sibling resolvers when a request loader is available
+		if loader := loaderFromContext(p.Context); loader != nil {
+			return r.loadManyToMany(p, loader, schemaName, tables, rel, pkValue, limit, offset)
+		}
+
+		args := &queryArgs{}
+		target, err := tableSource(p.Context, schemaName, rel.target, args)
+		if err != nil {
+			return nil, err
+		}
+		junction, err := tableSource(p.Context, schemaName, rel.junction, args)
+		if err != nil {
+			return nil, err
+		}
+		query := fmt.Sprintf(`SELECT * FROM %s WHERE "%s" IN (SELECT "%s" FROM %s WHERE "%s" = %s)`,
+			target, rel.targetKeyColumn,
+			rel.targetColumn, junction, rel.sourceColumn, args.add(pkValue))
+
+		if where, ok := p.Args["where"].(map[string]interface{}); ok {
+			cond, err := buildWhere(rel.target, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if cond != "" {
+				query += " AND " + cond
+			}
+		}
+
+		orderBy, err := buildOrderBy(p.Context, schemaName, tables, rel.target, p.Args["order_by"], args)
+		if err != nil {
+			return nil, err
+		}
+		if orderBy != "" {
+			query += " ORDER BY " + orderBy
+		}
+
+		query += fmt.Sprintf(" LIMIT %d", limit)
+		if offset > 0 {
+			query += fmt.Sprintf(" OFFSET %d", offset)
+		}
+
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(p.Context, err, "many to many query failed")
+		}
+		defer rows.Close()
+
+		return r.scanRows(rows)
+	}
+}
+
+// loadManyToMany batches a many-to-many lookup (source key -> target rows). The
+// target rows are joined to their junction rows and tagged with the source key,
+// then paged per source with ROW_NUMBER() as in loadHasMany.
+func (r *Resolver) loadManyToMany(p graphql.ResolveParams, l *Loader, schemaName string, tables map[string]Table, rel manyToManyRelation, pkValue interface{}, limit, offset int) (interface{}, error) {
+	// Fields with different arguments cannot share a batch
+	argsKey, err := json.Marshal(p.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments")
+	}
+	batchKey := fmt.Sprintf("manyToMany:%s.%s.%s:%s", schemaName, rel.junction.Name, rel.sourceColumn, argsKey)
+
+	where, _ := p.Args["where"].(map[string]interface{})
+	orderArg := p.Args["order_by"]
+
+	thunk := l.load(p.Context, batchKey, pkValue, func(ctx context.Context, keys []interface{}) (map[string][]map[string]interface{}, error) {
+		args := &queryArgs{}
+		target, err := aliasedSource(ctx, schemaName, rel.target, "t", args)
+		if err != nil {
+			return nil, err
+		}
+		junction, err := aliasedSource(ctx, schemaName, rel.junction, "j", args)
+		if err != nil {
+			return nil, err
+		}
+		// The joined rows are exposed under the target's name so filters and
+		// order_by terms resolve against it
+		joined := fmt.Sprintf(
+			`(SELECT "j"."%s" AS "%s", "t".* FROM %s JOIN %s ON "j"."%s" = "t"."%s" WHERE "j"."%s" = ANY(%s)) AS "%s"`,
+			rel.sourceColumn, parentKeyColumn, target, junction,
+			rel.targetColumn, rel.targetKeyColumn, rel.sourceColumn, args.add(pq.Array(keys)), rel.target.Name,
+		)
+
+		cond := "TRUE"
+		if where != nil {
+			c, err := buildWhere(rel.target, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if c != "" {
+				cond = c
+			}
+		}
+
+		orderBy, err := buildOrderBy(ctx, schemaName, tables, rel.target, orderArg, args)
+		if err != nil {
+			return nil, err
+		}
+		window := fmt.Sprintf(`PARTITION BY "%s"`, parentKeyColumn)
+		if orderBy != "" {
+			window += " ORDER BY " + orderBy
+		}
+
+		query := fmt.Sprintf(
+			`SELECT * FROM (SELECT *, ROW_NUMBER() OVER (%s) AS "%s" FROM %s WHERE %s) AS "batch" WHERE "%s" > %d AND "%s" <= %d ORDER BY "%s"`,
+			window, rowNumberColumn, joined, cond,
+			rowNumberColumn, offset, rowNumberColumn, offset+limit, rowNumberColumn,
+		)
+
+		rows, err := r.conn(ctx).QueryContext(ctx, query, args.values...)
+		if err != nil {
+			return nil, r.dbError(ctx, err, "many to many query failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read many to many results")
+		}
+		parentField := strcase.ToLowerCamel(parentKeyColumn)
+		grouped := groupRows(results, parentField)
+		rnField := strcase.ToLowerCamel(rowNumberColumn)
+		for _, row := range results {
+			delete(row, rnField)
+			delete(row, parentField)
+		}
+		return grouped, nil
+	})
+
+	return func() (interface{}, error) {
+		rows, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		return rows, nil
+	}, nil
+}
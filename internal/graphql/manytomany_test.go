@@ -0,0 +1,105 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manyToManyTestTables links posts and tags through the post_tags junction table
+func manyToManyTestTables() map[string]Table {
+	tables := orderTestTables()
+	tables["tags"] = Table{
+		Name: "tags",
+		Columns: []Column{
+			{Name: "id", DataType: "integer", IsPK: true},
+			{Name: "name", DataType: "text"},
+		},
+	}
+	tables["post_tags"] = Table{
+		Name: "post_tags",
+		Columns: []Column{
+			{Name: "post_id", DataType: "integer", IsPK: true, IsFK: true, FKTable: "posts", FKColumn: "id"},
+			{Name: "tag_id", DataType: "integer", IsPK: true, IsFK: true, FKTable: "tags", FKColumn: "id"},
+			{Name: "created_at", DataType: "timestamp with time zone", IsNullable: true},
+		},
+	}
+	return tables
+}
+
+func TestManyToManyRelations(t *testing.T) {
+	tables := manyToManyTestTables()
+
+	rels := manyToManyRelations(tables, tables["posts"])
+	require.Len(t, rels, 1)
+	assert.Equal(t, "tags", rels[0].field)
+	assert.Equal(t, "post_tags", rels[0].junction.Name)
+	assert.Equal(t, "post_id", rels[0].sourceColumn)
+	assert.Equal(t, "tag_id", rels[0].targetColumn)
+	assert.Equal(t, "id", rels[0].parentColumn)
+	assert.Equal(t, "id", rels[0].targetKeyColumn)
+
+	rels = manyToManyRelations(tables, tables["tags"])
+	require.Len(t, rels, 1)
+	assert.Equal(t, "posts", rels[0].field)
+	assert.Equal(t, "tag_id", rels[0].sourceColumn)
+
+	assert.Empty(t, manyToManyRelations(tables, tables["authors"]))
+}
+
+func TestJunctionColumns(t *testing.T) {
+	tables := manyToManyTestTables()
+	_, _, ok := junctionColumns(tables["post_tags"])
+	assert.True(t, ok)
+
+	_, _, ok = junctionColumns(postTagsTable())
+	assert.False(t, ok, "both key columns must be foreign keys")
+
+	_, _, ok = junctionColumns(tables["posts"])
+	assert.False(t, ok)
+
+	wide := tables["post_tags"]
+	wide.Columns = append(wide.Columns,
+		Column{Name: "note", DataType: "text"},
+		Column{Name: "weight", DataType: "integer"},
+	)
+	_, _, ok = junctionColumns(wide)
+	assert.False(t, ok, "tables with a payload of their own are not junctions")
+
+	follows := Table{
+		Name: "follows",
+		Columns: []Column{
+			{Name: "follower_id", DataType: "integer", IsPK: true, IsFK: true, FKTable: "authors", FKColumn: "id"},
+			{Name: "followee_id", DataType: "integer", IsPK: true, IsFK: true, FKTable: "authors", FKColumn: "id"},
+		},
+	}
+	tables["follows"] = follows
+	assert.Empty(t, manyToManyRelations(tables, tables["authors"]), "self-referencing junctions are skipped")
+}
+
+func TestGenerate_ManyToMany(t *testing.T) {
+	tables := manyToManyTestTables()
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{tables["authors"], tables["posts"], tables["tags"], tables["post_tags"]},
+	})
+	require.NoError(t, err)
+
+	posts, ok := schema.Type("Posts").(*graphql.Object)
+	require.True(t, ok)
+	require.Contains(t, posts.Fields(), "tags")
+	assert.Equal(t, "[Tags]", posts.Fields()["tags"].Type.String())
+	assert.Contains(t, posts.Fields(), "postTags", "the junction rows stay reachable")
+
+	argNames := make([]string, 0)
+	for _, arg := range posts.Fields()["tags"].Args {
+		argNames = append(argNames, arg.Name())
+	}
+	assert.ElementsMatch(t, []string{"limit", "offset", "where", "order_by"}, argNames)
+
+	tags, ok := schema.Type("Tags").(*graphql.Object)
+	require.True(t, ok)
+	require.Contains(t, tags.Fields(), "posts")
+	assert.Equal(t, "[Posts]", tags.Fields()["posts"].Type.String())
+}
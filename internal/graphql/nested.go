@@ -0,0 +1,251 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+// hasManyRelation is a reverse foreign key: rows of table whose column references
+// parentColumn of the parent table
+type hasManyRelation struct {
+	field        string
+	table        Table
+	column       string
+	parentColumn string
+}
+
+// hasManyRelations lists the tables referencing table, in a stable order. When two
+// foreign keys would produce the same field name the first one wins.
+func hasManyRelations(tables map[string]Table, table Table) []hasManyRelation {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		if name != table.Name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var relations []hasManyRelation
+	seen := make(map[string]bool)
+	for _, name := range names {
+		other := tables[name]
+		for _, col := range other.Columns {
+			if !col.IsFK || col.FKTable != table.Name {
+				continue
+			}
+			field := strcase.ToLowerCamel(name)
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			relations = append(relations, hasManyRelation{
+				field:        field,
+				table:        other,
+				column:       col.Name,
+				parentColumn: col.FKColumn,
+			})
+		}
+	}
+	return relations
+}
+
+// createFields returns the fields accepted when creating a row: its columns plus
+// nested belongsTo objects and hasMany lists. Foreign key columns are optional
+// since they can be filled from a nested parent (or by the enclosing parent).
+func (g *SchemaGenerator) createFields(table Table, tables map[string]Table, createInputs map[string]*graphql.InputObject) graphql.InputObjectConfigFieldMap {
+	pkName := g.getPrimaryKey(table)
+	fields := graphql.InputObjectConfigFieldMap{}
+
+	for _, col := range table.Columns {
+		if !table.writable(col.Name) {
+			continue
+		}
+		fieldType := g.getGraphQLType(col.DataType)
+		if !col.IsNullable && !col.HasDefault && !col.IsFK && col.Name != pkName && col.Name != "created_at" && col.Name != "updated_at" {
+			fieldType = graphql.NewNonNull(fieldType)
+		}
+		fields[strcase.ToLowerCamel(col.Name)] = &graphql.InputObjectFieldConfig{Type: fieldType}
+	}
+
+	// belongsTo: create the referenced row first, e.g. createPosts(author: {...})
+	for _, col := range table.Columns {
+		if !col.IsFK || !table.writable(col.Name) {
+			continue
+		}
+		parentInput, ok := createInputs[col.FKTable]
+		name := relationFieldName(col)
+		if !ok || fields[name] != nil {
+			continue
+		}
+		fields[name] = &graphql.InputObjectFieldConfig{Type: parentInput}
+	}
+
+	// hasMany: create the referencing rows afterwards, e.g. createAuthors(posts: [...])
+	for _, rel := range hasManyRelations(tables, table) {
+		childInput, ok := createInputs[rel.table.Name]
+		if !ok || fields[rel.field] != nil || !rel.table.writable(rel.column) {
+			continue
+		}
+		fields[rel.field] = &graphql.InputObjectFieldConfig{
+			Type: graphql.NewList(graphql.NewNonNull(childInput)),
+		}
+	}
+
+	return fields
+}
+
+// buildCreateInput creates the <Type>CreateInput object used for nested inserts;
+// the fields are a thunk because relations refer to each other's inputs
+func (g *SchemaGenerator) buildCreateInput(table Table, tables map[string]Table, createInputs map[string]*graphql.InputObject) *graphql.InputObject {
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: strcase.ToCamel(table.Name) + "CreateInput",
+		Fields: (graphql.InputObjectConfigFieldMapThunk)(func() graphql.InputObjectConfigFieldMap {
+			return g.createFields(table, tables, createInputs)
+		}),
+	})
+}
+
+// createArgs returns the create<Type> arguments, mirroring <Type>CreateInput
+func (g *SchemaGenerator) createArgs(table Table, tables map[string]Table, createInputs map[string]*graphql.InputObject) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{}
+	for name, field := range g.createFields(table, tables, createInputs) {
+		args[name] = &graphql.ArgumentConfig{Type: field.Type}
+	}
+	return args
+}
+
+// insertNested inserts one row and its nested relations inside tx, in foreign key
+// order: belongsTo parents first, then the row, then its hasMany children. fixed
+// holds column values set by an enclosing parent and takes precedence over input.
+func (r *Resolver) insertNested(ctx context.Context, tx *sql.Tx, schemaName string, tables map[string]Table, table Table, input, fixed map[string]interface{}) (map[string]interface{}, error) {
+	if err := validateIdentifier(table.Name); err != nil {
+		return nil, fmt.Errorf("invalid table name")
+	}
+
+	relations := make(map[string]hasManyRelation)
+	for _, rel := range hasManyRelations(tables, table) {
+		relations[rel.field] = rel
+	}
+
+	values := make(map[string]interface{})
+	type childRows struct {
+		relation hasManyRelation
+		items    []interface{}
+	}
+	var children []childRows
+
+	for _, field := range sortedKeys(input) {
+		val := input[field]
+
+		if col, ok := findColumn(table, field); ok {
+			if err := validateIdentifier(col.Name); err != nil {
+				return nil, fmt.Errorf("invalid column name")
+			}
+			values[col.Name] = val
+			continue
+		}
+
+		if col, ok := findBelongsTo(table, field); ok {
+			if val == nil {
+				continue
+			}
+			obj, ok := val.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s expects an object", field)
+			}
+			parent, ok := tables[col.FKTable]
+			if !ok {
+				return nil, fmt.Errorf("unknown relation %s", field)
+			}
+			parentRow, err := r.insertNested(ctx, tx, schemaName, tables, parent, obj, nil)
+			if err != nil {
+				return nil, err
+			}
+			values[col.Name] = parentRow[strcase.ToLowerCamel(col.FKColumn)]
+			continue
+		}
+
+		if rel, ok := relations[field]; ok {
+			if val == nil {
+				continue
+			}
+			items, ok := val.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s expects a list of objects", field)
+			}
+			children = append(children, childRows{relation: rel, items: items})
+			continue
+		}
+
+		return nil, fmt.Errorf("unknown field %s", field)
+	}
+
+	for col, val := range fixed {
+		values[col] = val
+	}
+
+	query := fmt.Sprintf(`INSERT INTO "%s"."%s" DEFAULT VALUES RETURNING *`, schemaName, table.Name)
+	var params []interface{}
+	if len(values) > 0 {
+		queries, args, err := buildInsertStatements(schemaName, table, []map[string]interface{}{values}, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		query, params = queries[0], args[0]
+	}
+
+	// Inserted rows must match the role's row filter
+	args := &queryArgs{values: params}
+	query, err := withRowCheck(ctx, table, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := r.queryTx(ctx, tx, query, args.values)
+	if err != nil {
+		return nil, r.dbError(ctx, err, "insert failed")
+	}
+	if err := checkRows(table, results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("failed to insert record")
+	}
+	row := results[0]
+
+	// Children receive the generated key of the row just inserted
+	for _, child := range children {
+		if err := validateIdentifier(child.relation.column); err != nil {
+			return nil, fmt.Errorf("invalid column name")
+		}
+		key := row[strcase.ToLowerCamel(child.relation.parentColumn)]
+		for _, item := range child.items {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s expects a list of objects", child.relation.field)
+			}
+			if _, err := r.insertNested(ctx, tx, schemaName, tables, child.relation.table, obj, map[string]interface{}{
+				child.relation.column: key,
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return row, nil
+}
+
+// findBelongsTo returns the foreign key column whose relation field is fieldName
+func findBelongsTo(table Table, fieldName string) (Column, bool) {
+	for _, col := range table.Columns {
+		if col.IsFK && relationFieldName(col) == fieldName {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
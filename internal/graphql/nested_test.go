@@ -0,0 +1,56 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasManyRelations(t *testing.T) {
+	tables := orderTestTables()
+
+	relations := hasManyRelations(tables, tables["authors"])
+	require.Len(t, relations, 1)
+	assert.Equal(t, "posts", relations[0].field)
+	assert.Equal(t, "author_id", relations[0].column)
+	assert.Equal(t, "id", relations[0].parentColumn)
+
+	assert.Empty(t, hasManyRelations(tables, tables["posts"]))
+}
+
+func TestFindBelongsTo(t *testing.T) {
+	tables := orderTestTables()
+
+	col, ok := findBelongsTo(tables["posts"], "author")
+	require.True(t, ok)
+	assert.Equal(t, "author_id", col.Name)
+
+	_, ok = findBelongsTo(tables["posts"], "title")
+	assert.False(t, ok)
+}
+
+func TestGenerate_NestedCreateArgs(t *testing.T) {
+	tables := orderTestTables()
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{tables["authors"], tables["posts"]},
+	})
+	require.NoError(t, err)
+
+	createPosts := schema.MutationType().Fields()["createPosts"]
+	require.NotNil(t, createPosts)
+	args := make(map[string]graphql.Input)
+	for _, arg := range createPosts.Args {
+		args[arg.Name()] = arg.Type
+	}
+
+	assert.Equal(t, "AuthorsCreateInput", args["author"].Name())
+	assert.Equal(t, "Int", args["authorId"].String(), "FK columns are optional when a parent can be nested")
+	assert.Equal(t, "String!", args["title"].String())
+
+	authorsInput, ok := schema.Type("AuthorsCreateInput").(*graphql.InputObject)
+	require.True(t, ok)
+	require.Contains(t, authorsInput.Fields(), "posts")
+	assert.Equal(t, "[PostsCreateInput!]", authorsInput.Fields()["posts"].Type.String())
+}
@@ -0,0 +1,594 @@
+package graphql
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+const (
+	// OpenAPIVersion is the OpenAPI version of generated documents
+	OpenAPIVersion = "3.1.0"
+
+	// openAPIRef prefixes references to component schemas
+	openAPIRef = "#/components/schemas/"
+
+	// openAPIErrorSchema names the schema of error bodies, like the error type of
+	// the TypeScript SDK
+	openAPIErrorSchema = "KapokError"
+)
+
+// OpenAPIOptions describes the API a document is generated for
+type OpenAPIOptions struct {
+	// Title defaults to the schema name
+	Title string
+	// Version is the version of the document, 1.0.0 by default
+	Version string
+	// ServerURL is the base URL of the REST endpoints, e.g.
+	// https://api.example.com/api/v1/tenants/<tenant-id>/rest
+	ServerURL string
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 document describing the REST endpoints of a
+// tenant's tables
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Servers    []OpenAPIServer                         `json:"servers,omitempty"`
+	Security   []map[string][]string                   `json:"security"`
+	Tags       []OpenAPITag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIInfo is the info object of a document
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIServer is a base URL of the API
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPITag groups the operations of a table
+type OpenAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIOperation is an operation on a path
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary"`
+	Tags        []string                    `json:"tags"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter is a path or query parameter. JSON valued parameters set
+// Content instead of Schema.
+type OpenAPIParameter struct {
+	Name        string                       `json:"name"`
+	In          string                       `json:"in"`
+	Description string                       `json:"description,omitempty"`
+	Required    bool                         `json:"required,omitempty"`
+	Schema      *JSONSchema                  `json:"schema,omitempty"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIRequestBody is the JSON body of a request
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is a response, or a reference to one of the components
+type OpenAPIResponse struct {
+	Ref         string                       `json:"$ref,omitempty"`
+	Description string                       `json:"description,omitempty"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType holds the schema of a content type
+type OpenAPIMediaType struct {
+	Schema *JSONSchema `json:"schema"`
+}
+
+// OpenAPIComponents holds the schemas, responses and security schemes that
+// operations refer to
+type OpenAPIComponents struct {
+	Schemas         map[string]*JSONSchema            `json:"schemas"`
+	Responses       map[string]*OpenAPIResponse       `json:"responses"`
+	SecuritySchemes map[string]*OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+// OpenAPISecurityScheme is how requests authenticate
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// JSONSchema is the subset of JSON Schema 2020-12 generated documents use. Type
+// is a string, or a list with "null" for nullable values.
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+}
+
+// errorResponses are the component responses of failed requests, by status
+var errorResponses = map[string]struct{ name, description string }{
+	"400": {"BadRequest", "The request or its values are invalid"},
+	"401": {"Unauthorized", "The bearer token is missing or invalid"},
+	"403": {"Forbidden", "The caller's role may not run the operation"},
+	"404": {"NotFound", "The row does not exist or is not visible to the role"},
+	"409": {"Conflict", "The change conflicts with a constraint or a concurrent change"},
+	"500": {"InternalError", "The server failed to run the operation"},
+	"504": {"Timeout", "The operation ran past its timeout"},
+}
+
+// GenerateOpenAPI generates the OpenAPI document of the REST endpoints of a
+// schema's tables
+func GenerateOpenAPI(schemaName string, metadata *SchemaMetadata, opts OpenAPIOptions) (*OpenAPIDocument, error) {
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate(schemaName, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("schema generation failed: %w", err)
+	}
+	if opts.Title == "" {
+		opts.Title = schemaName
+	}
+	return newOpenAPIDocument(schema, metadata, opts), nil
+}
+
+// openAPIBuilder collects the component schemas operations refer to
+type openAPIBuilder struct {
+	schema  *graphql.Schema
+	schemas map[string]*JSONSchema
+}
+
+// newOpenAPIDocument describes the REST endpoints served for a generated schema.
+// Operations, arguments and types come from the schema's fields, so a role's
+// document only has what the role may do.
+func newOpenAPIDocument(schema *graphql.Schema, metadata *SchemaMetadata, opts OpenAPIOptions) *OpenAPIDocument {
+	if opts.Version == "" {
+		opts.Version = "1.0.0"
+	}
+	b := &openAPIBuilder{schema: schema, schemas: map[string]*JSONSchema{openAPIErrorSchema: errorSchema()}}
+
+	doc := &OpenAPIDocument{
+		OpenAPI:  OpenAPIVersion,
+		Info:     OpenAPIInfo{Title: opts.Title, Version: opts.Version},
+		Security: []map[string][]string{{"bearerAuth": {}}},
+		Paths:    make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas:   b.schemas,
+			Responses: make(map[string]*OpenAPIResponse),
+			SecuritySchemes: map[string]*OpenAPISecurityScheme{
+				"bearerAuth": {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+					Description:  "A token granting the tenant's roles; the role requests run as is chosen with X-Kapok-Role",
+				},
+			},
+		},
+	}
+	if opts.ServerURL != "" {
+		doc.Servers = []OpenAPIServer{{URL: opts.ServerURL}}
+	}
+	for _, resp := range errorResponses {
+		doc.Components.Responses[resp.name] = &OpenAPIResponse{
+			Description: resp.description,
+			Content:     jsonContent(&JSONSchema{Ref: openAPIRef + openAPIErrorSchema}),
+		}
+	}
+
+	for _, table := range metadata.Tables {
+		b.addTable(doc, table)
+	}
+	return doc
+}
+
+// addTable adds the paths of a table and the schema of its rows
+func (b *openAPIBuilder) addTable(doc *OpenAPIDocument, table Table) {
+	typeName := strcase.ToCamel(table.Name)
+	object, ok := b.schema.Type(typeName).(*graphql.Object)
+	if !ok {
+		return
+	}
+	b.schemas[typeName] = b.rowSchema(table, object)
+	doc.Tags = append(doc.Tags, OpenAPITag{Name: table.Name, Description: table.Comment})
+
+	row := &JSONSchema{Ref: openAPIRef + typeName}
+	query, mutation := b.schema.QueryType(), b.schema.MutationType()
+	listField := strcase.ToLowerCamel(table.Name)
+
+	collection := map[string]*OpenAPIOperation{}
+	if field := rootField(query, listField); field != nil {
+		collection["get"] = &OpenAPIOperation{
+			OperationID: listField,
+			Summary:     fmt.Sprintf("List the rows of %s", table.Name),
+			Parameters:  b.listParameters(field),
+			Responses:   responses("200", "The matching rows", &JSONSchema{Type: "array", Items: row}, "400"),
+		}
+	}
+	if field := rootField(mutation, "create"+typeName); field != nil {
+		collection["post"] = &OpenAPIOperation{
+			OperationID: field.Name,
+			Summary:     fmt.Sprintf("Create a row of %s", table.Name),
+			RequestBody: b.argsBody(typeName+"CreateRequest", field, nil),
+			Responses:   responses("201", "The created row", row, "400", "409"),
+		}
+	}
+	b.addPath(doc, "/"+table.Name, table, collection)
+
+	pk := primaryKeyColumns(table)
+	if len(pk) == 0 {
+		return
+	}
+	isKey := make(map[string]bool, len(pk))
+	for _, col := range pk {
+		isKey[keyArgName(pk, col)] = true
+	}
+	keyParam, keyPath := b.keyParameter(object, pk)
+
+	item := map[string]*OpenAPIOperation{}
+	if field := rootField(query, listField+keyFieldSuffix(pk)); field != nil {
+		item["get"] = &OpenAPIOperation{
+			OperationID: field.Name,
+			Summary:     fmt.Sprintf("Get a row of %s by key", table.Name),
+			Responses:   responses("200", "The row", row, "400", "404"),
+		}
+	}
+	if field := rootField(mutation, "update"+typeName); field != nil {
+		body := b.argsBody(typeName+"UpdateRequest", field, isKey)
+		// PUT is the SDK's update; both leave fields that are left out unchanged
+		for method, id := range map[string]string{"patch": field.Name, "put": field.Name + "Put"} {
+			item[method] = &OpenAPIOperation{
+				OperationID: id,
+				Summary:     fmt.Sprintf("Update a row of %s", table.Name),
+				RequestBody: body,
+				Responses:   responses("200", "The updated row", row, "400", "404", "409"),
+			}
+		}
+	}
+	if field := rootField(mutation, "delete"+typeName); field != nil {
+		item["delete"] = &OpenAPIOperation{
+			OperationID: field.Name,
+			Summary:     fmt.Sprintf("Delete a row of %s", table.Name),
+			Responses:   responses("200", "The deleted row", row, "400", "404", "409"),
+		}
+	}
+	for _, op := range item {
+		op.Parameters = []*OpenAPIParameter{keyParam}
+	}
+	b.addPath(doc, "/"+table.Name+"/"+keyPath, table, item)
+}
+
+func (b *openAPIBuilder) addPath(doc *OpenAPIDocument, path string, table Table, ops map[string]*OpenAPIOperation) {
+	if len(ops) == 0 {
+		return
+	}
+	for _, op := range ops {
+		op.Tags = []string{table.Name}
+	}
+	doc.Paths[path] = ops
+}
+
+// rowSchema describes the rows of a table: every column is present, null when
+// the column is nullable
+func (b *openAPIBuilder) rowSchema(table Table, object *graphql.Object) *JSONSchema {
+	fields := object.Fields()
+	s := &JSONSchema{Type: "object", Description: table.Comment, Properties: map[string]*JSONSchema{}}
+	for _, col := range table.Columns {
+		name := strcase.ToLowerCamel(col.Name)
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		prop := b.typeSchema(field.Type)
+		if field.Description != "" {
+			prop = withDescription(prop, field.Description)
+		}
+		s.Properties[name] = prop
+		s.Required = append(s.Required, name)
+	}
+	return s
+}
+
+// argsBody describes a request body carrying the arguments of a mutation field,
+// except skipped ones
+func (b *openAPIBuilder) argsBody(name string, field *graphql.FieldDefinition, skip map[string]bool) *OpenAPIRequestBody {
+	s := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}}
+	for _, arg := range field.Args {
+		if skip[arg.Name()] {
+			continue
+		}
+		prop := b.typeSchema(arg.Type)
+		if arg.Description() != "" {
+			prop = withDescription(prop, arg.Description())
+		}
+		s.Properties[arg.Name()] = prop
+		if _, ok := arg.Type.(*graphql.NonNull); ok {
+			s.Required = append(s.Required, arg.Name())
+		}
+	}
+	sort.Strings(s.Required)
+	b.schemas[name] = s
+	return &OpenAPIRequestBody{Required: true, Content: jsonContent(&JSONSchema{Ref: openAPIRef + name})}
+}
+
+// listParameters describes the query parameters of list requests
+func (b *openAPIBuilder) listParameters(field *graphql.FieldDefinition) []*OpenAPIParameter {
+	zero := 0
+	params := []*OpenAPIParameter{
+		{Name: "limit", In: "query", Description: "Maximum number of rows", Schema: &JSONSchema{Type: "integer", Minimum: &zero}},
+		{Name: "offset", In: "query", Description: "Number of rows to skip", Schema: &JSONSchema{Type: "integer", Minimum: &zero}},
+		{Name: "order", In: "query", Description: "Sort order as comma-separated field.asc or field.desc terms, e.g. createdAt.desc,id",
+			Schema: &JSONSchema{Type: "string"}},
+	}
+	var boolExp *graphql.InputObject
+	for _, arg := range field.Args {
+		switch arg.Name() {
+		case "where":
+			boolExp, _ = arg.Type.(*graphql.InputObject)
+			params = append(params, &OpenAPIParameter{
+				Name: "where", In: "query", Description: "Filter as a JSON object, like the where argument of GraphQL queries",
+				Content: jsonContent(b.nonNullSchema(arg.Type)),
+			})
+		case "order_by":
+			params = append(params, &OpenAPIParameter{
+				Name: "order_by", In: "query", Description: "Sort order as JSON, like the order_by argument of GraphQL queries; takes precedence over order",
+				Content: jsonContent(b.nonNullSchema(arg.Type)),
+			})
+		}
+	}
+	if boolExp == nil {
+		return params
+	}
+
+	names := make([]string, 0, len(boolExp.Fields()))
+	for name := range boolExp.Fields() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == searchFilterField {
+			params = append(params, &OpenAPIParameter{
+				Name: "search", In: "query", Description: "Full-text search query the rows must match",
+				Schema: &JSONSchema{Type: "string"},
+			})
+			continue
+		}
+		valueType, ok := comparisonType(boolExp, name)
+		if !ok || restListParams[name] {
+			continue
+		}
+		// Only values a query string can carry
+		s := b.nonNullSchema(valueType)
+		if _, ok := s.Type.(string); !ok || s.Type == "array" {
+			continue
+		}
+		params = append(params, &OpenAPIParameter{
+			Name: name, In: "query", Description: fmt.Sprintf("Only rows whose %s equals the value", name), Schema: s,
+		})
+	}
+	return params
+}
+
+// keyParameter describes the key path segment of a table's rows and returns it
+// with the segment's template
+func (b *openAPIBuilder) keyParameter(object *graphql.Object, pk []string) (*OpenAPIParameter, string) {
+	if len(pk) == 1 {
+		name := strcase.ToLowerCamel(pk[0])
+		s := &JSONSchema{Type: "string"}
+		if field, ok := object.Fields()[name]; ok {
+			s = b.nonNullSchema(field.Type)
+		}
+		return &OpenAPIParameter{Name: name, In: "path", Required: true, Schema: s}, "{" + name + "}"
+	}
+	fields := make([]string, len(pk))
+	for i, col := range pk {
+		fields[i] = strcase.ToLowerCamel(col)
+	}
+	return &OpenAPIParameter{
+		Name:        "key",
+		In:          "path",
+		Required:    true,
+		Description: fmt.Sprintf("The values of %s, separated by commas and each escaped for the path", strings.Join(fields, ", ")),
+		Schema:      &JSONSchema{Type: "string"},
+	}, "{key}"
+}
+
+// typeSchema returns the JSON schema of values of a GraphQL type. Input objects
+// become component schemas.
+func (b *openAPIBuilder) typeSchema(t graphql.Type) *JSONSchema {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		return b.nonNullSchema(nonNull.OfType)
+	}
+	return nullable(b.nonNullSchema(t))
+}
+
+func (b *openAPIBuilder) nonNullSchema(t graphql.Type) *JSONSchema {
+	switch t := t.(type) {
+	case *graphql.NonNull:
+		return b.nonNullSchema(t.OfType)
+	case *graphql.List:
+		return &JSONSchema{Type: "array", Items: b.typeSchema(t.OfType)}
+	case *graphql.Enum:
+		s := &JSONSchema{Type: "string"}
+		values := t.Values()
+		sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+		for _, v := range values {
+			s.Enum = append(s.Enum, v.Name)
+		}
+		return s
+	case *graphql.InputObject:
+		b.addInputObject(t)
+		return &JSONSchema{Ref: openAPIRef + t.Name()}
+	}
+
+	switch t {
+	case graphql.Int:
+		return &JSONSchema{Type: "integer", Format: "int32"}
+	case graphql.Float:
+		return &JSONSchema{Type: "number", Format: "double"}
+	case graphql.Boolean:
+		return &JSONSchema{Type: "boolean"}
+	case BigIntScalar:
+		return &JSONSchema{Type: "string", Format: "int64", Description: BigIntScalar.Description()}
+	case DecimalScalar:
+		return &JSONSchema{Type: "string", Format: "decimal", Description: DecimalScalar.Description()}
+	case DateTimeScalar:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case DateScalar:
+		return &JSONSchema{Type: "string", Format: "date"}
+	case UUIDScalar:
+		return &JSONSchema{Type: "string", Format: "uuid"}
+	case BytesScalar:
+		return &JSONSchema{Type: "string", ContentEncoding: "base64"}
+	case JSONScalar:
+		// Any JSON value, null included
+		return &JSONSchema{Description: JSONScalar.Description()}
+	}
+	return &JSONSchema{Type: "string"}
+}
+
+// addInputObject adds the component schema of an input object, once
+func (b *openAPIBuilder) addInputObject(obj *graphql.InputObject) {
+	if _, ok := b.schemas[obj.Name()]; ok {
+		return
+	}
+	closed := false
+	s := &JSONSchema{Type: "object", Description: obj.Description(), Properties: map[string]*JSONSchema{}, AdditionalProperties: &closed}
+	// Registered first so recursive inputs refer to it
+	b.schemas[obj.Name()] = s
+	for name, field := range obj.Fields() {
+		prop := b.typeSchema(field.Type)
+		if field.Description() != "" {
+			prop = withDescription(prop, field.Description())
+		}
+		s.Properties[name] = prop
+		if _, ok := field.Type.(*graphql.NonNull); ok {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+}
+
+// nullable allows null besides the values of s
+func nullable(s *JSONSchema) *JSONSchema {
+	switch t := s.Type.(type) {
+	case string:
+		s.Type = []string{t, "null"}
+		if len(s.Enum) > 0 {
+			s.Enum = append(s.Enum, nil)
+		}
+		return s
+	case nil:
+		if s.Ref != "" {
+			return &JSONSchema{AnyOf: []*JSONSchema{s, {Type: "null"}}}
+		}
+	}
+	return s
+}
+
+// withDescription sets the description of a property; references cannot have
+// siblings in every tool, so they are wrapped
+func withDescription(s *JSONSchema, description string) *JSONSchema {
+	if s.Ref != "" {
+		return &JSONSchema{AnyOf: []*JSONSchema{s}, Description: description}
+	}
+	s.Description = description
+	return s
+}
+
+func jsonContent(s *JSONSchema) map[string]*OpenAPIMediaType {
+	return map[string]*OpenAPIMediaType{"application/json": {Schema: s}}
+}
+
+// responses returns the success response of an operation and its error
+// responses; authentication, permission, internal and timeout errors apply to
+// every operation
+func responses(status, description string, body *JSONSchema, errorStatuses ...string) map[string]*OpenAPIResponse {
+	resp := map[string]*OpenAPIResponse{
+		status: {Description: description, Content: jsonContent(body)},
+	}
+	for _, s := range append(errorStatuses, "401", "403", "500", "504") {
+		resp[s] = &OpenAPIResponse{Ref: "#/components/responses/" + errorResponses[s].name}
+	}
+	return resp
+}
+
+// errorSchema describes the body of failed requests
+func errorSchema() *JSONSchema {
+	codes := make([]string, 0, len(restStatuses))
+	for code := range restStatuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	enum := make([]interface{}, len(codes))
+	for i, code := range codes {
+		enum[i] = code
+	}
+
+	str := func(description string) *JSONSchema {
+		return &JSONSchema{Type: "string", Description: description}
+	}
+	return &JSONSchema{
+		Type: "object",
+		Properties: map[string]*JSONSchema{
+			"error":         str("What went wrong"),
+			"code":          {Type: "string", Enum: enum},
+			"correlationId": str("Identifies the request in server logs; also sent as the " + CorrelationHeader + " header"),
+			"table":         str("The table of a violated constraint"),
+			"constraint":    str("The violated constraint"),
+			"column":        str("The column of a violated constraint, when it has one"),
+			"columns":       {Type: "array", Items: &JSONSchema{Type: "string"}, Description: "The columns of a violated constraint"},
+		},
+		Required: []string{"code", "error"},
+	}
+}
+
+// ServeOpenAPI serves the OpenAPI document of the tenant's REST endpoints, as the
+// caller's role sees them. serverURL is the base URL of the endpoints. The
+// document is generated once per cached schema, so it changes with the schema.
+func (h *Handler) ServeOpenAPI(w http.ResponseWriter, r *http.Request, serverURL string) {
+	t, cached, ok := h.requestSchema(r.Context(), w)
+	if !ok {
+		return
+	}
+
+	cached.openAPIOnce.Do(func() {
+		title := t.Name
+		if title == "" {
+			title = t.SchemaName
+		}
+		cached.openAPI = newOpenAPIDocument(cached.schema, cached.metadata, OpenAPIOptions{Title: title + " data API"})
+	})
+
+	// The server is per request, the rest of the document per schema
+	doc := *cached.openAPI
+	if serverURL != "" {
+		doc.Servers = []OpenAPIServer{{URL: serverURL}}
+	}
+	writeRESTJSON(w, http.StatusOK, &doc)
+}
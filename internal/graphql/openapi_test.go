@@ -0,0 +1,202 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openAPITestMetadata() *SchemaMetadata {
+	metadata := restTestMetadata()
+	metadata.Enums = []Enum{{Name: "status", Values: []string{"draft", "published"}}}
+	metadata.Tables = append(metadata.Tables,
+		Table{
+			Name:    "orders",
+			Comment: "Customer orders",
+			Columns: []Column{
+				{Name: "id", DataType: "bigint", IsPK: true, HasDefault: true},
+				{Name: "status", DataType: "status"},
+				{Name: "note", DataType: "text", IsNullable: true, Comment: "Free text"},
+				{Name: "total", DataType: "numeric"},
+				{Name: "tags", DataType: "text[]", IsNullable: true},
+				{Name: "data", DataType: "jsonb", IsNullable: true},
+				{Name: "version", DataType: "integer", HasDefault: true},
+			},
+		},
+		Table{
+			Name:     "order_totals",
+			ReadOnly: true,
+			Columns: []Column{
+				{Name: "total", DataType: "numeric", IsNullable: true},
+			},
+		},
+	)
+	return metadata
+}
+
+func generateTestOpenAPI(t *testing.T) map[string]interface{} {
+	doc, err := GenerateOpenAPI("tenant_test", openAPITestMetadata(), OpenAPIOptions{ServerURL: "https://api.test/rest"})
+	require.NoError(t, err)
+	b, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &out))
+	return out
+}
+
+// jsonPath reads a value of a decoded document by its keys
+func jsonPath(t *testing.T, v interface{}, keys ...string) interface{} {
+	t.Helper()
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		require.True(t, ok, "%s is not an object", key)
+		v, ok = m[key]
+		require.True(t, ok, "missing %s", key)
+	}
+	return v
+}
+
+func TestGenerateOpenAPI_Paths(t *testing.T) {
+	doc := generateTestOpenAPI(t)
+	assert.Equal(t, OpenAPIVersion, doc["openapi"])
+	assert.Equal(t, "tenant_test", jsonPath(t, doc, "info", "title"))
+	assert.Equal(t, []interface{}{map[string]interface{}{"url": "https://api.test/rest"}}, doc["servers"])
+
+	methods := func(path string) []string {
+		var out []string
+		for method := range jsonPath(t, doc, "paths", path).(map[string]interface{}) {
+			out = append(out, method)
+		}
+		return out
+	}
+	assert.ElementsMatch(t, []string{"get", "post"}, methods("/posts"))
+	assert.ElementsMatch(t, []string{"get", "put", "patch", "delete"}, methods("/posts/{id}"))
+	assert.ElementsMatch(t, []string{"get", "put", "patch", "delete"}, methods("/post_tags/{key}"))
+	// Views are read-only and have no key
+	assert.ElementsMatch(t, []string{"get"}, methods("/order_totals"))
+	assert.NotContains(t, jsonPath(t, doc, "paths"), "/order_totals/{id}")
+
+	assert.Equal(t, "createPosts", jsonPath(t, doc, "paths", "/posts", "post", "operationId"))
+	assert.Equal(t, "#/components/schemas/PostsCreateRequest",
+		jsonPath(t, doc, "paths", "/posts", "post", "requestBody", "content", "application/json", "schema", "$ref"))
+	assert.Equal(t, "#/components/responses/Conflict", jsonPath(t, doc, "paths", "/posts", "post", "responses", "409", "$ref"))
+	assert.Equal(t, "#/components/responses/NotFound", jsonPath(t, doc, "paths", "/posts/{id}", "get", "responses", "404", "$ref"))
+
+	// Keys keep the type of their column
+	keyParam := jsonPath(t, doc, "paths", "/orders/{id}", "get", "parameters").([]interface{})[0]
+	assert.Equal(t, map[string]interface{}{
+		"name":     "id",
+		"in":       "path",
+		"required": true,
+		"schema":   map[string]interface{}{"type": "string", "format": "int64", "description": BigIntScalar.Description()},
+	}, keyParam)
+}
+
+func TestGenerateOpenAPI_ListParameters(t *testing.T) {
+	doc := generateTestOpenAPI(t)
+	params := map[string]map[string]interface{}{}
+	for _, p := range jsonPath(t, doc, "paths", "/orders", "get", "parameters").([]interface{}) {
+		param := p.(map[string]interface{})
+		params[param["name"].(string)] = param
+	}
+
+	assert.Equal(t, "#/components/schemas/OrdersBoolExp", jsonPath(t, params["where"], "content", "application/json", "schema", "$ref"))
+	assert.Equal(t, map[string]interface{}{"type": "string", "enum": []interface{}{"draft", "published"}}, params["status"]["schema"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "minimum": float64(0)}, params["limit"]["schema"])
+	// Arrays and JSON cannot be compared from a query string
+	assert.NotContains(t, params, "tags")
+	assert.NotContains(t, params, "data")
+	assert.NotContains(t, params, "search")
+}
+
+func TestGenerateOpenAPI_Schemas(t *testing.T) {
+	doc := generateTestOpenAPI(t)
+	schemas := jsonPath(t, doc, "components", "schemas").(map[string]interface{})
+
+	orders := schemas["Orders"].(map[string]interface{})
+	assert.Equal(t, "Customer orders", orders["description"])
+	assert.Equal(t, []interface{}{"id", "status", "note", "total", "tags", "data", "version"}, orders["required"])
+	assert.Equal(t, map[string]interface{}{"type": []interface{}{"string", "null"}, "description": "Free text"},
+		jsonPath(t, orders, "properties", "note"))
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "decimal", "description": DecimalScalar.Description()},
+		jsonPath(t, orders, "properties", "total"))
+	assert.Equal(t, []interface{}{"array", "null"}, jsonPath(t, orders, "properties", "tags", "type"))
+	assert.Equal(t, map[string]interface{}{"description": JSONScalar.Description()}, jsonPath(t, orders, "properties", "data"))
+
+	// Columns with defaults are optional when creating rows
+	assert.Equal(t, []interface{}{"status", "total"}, jsonPath(t, schemas, "OrdersCreateRequest", "required"))
+	// Updates take the key from the path, and the expected version for optimistic locking
+	update := jsonPath(t, schemas, "OrdersUpdateRequest", "properties").(map[string]interface{})
+	assert.NotContains(t, update, "id")
+	assert.Contains(t, update, "expectedVersion")
+	assert.NotContains(t, schemas["OrdersUpdateRequest"], "required")
+
+	assert.Contains(t, jsonPath(t, schemas, "KapokError", "properties", "code", "enum"), UniqueViolationCode)
+	assert.Equal(t, map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT",
+		"description": jsonPath(t, doc, "components", "securitySchemes", "bearerAuth", "description")},
+		jsonPath(t, doc, "components", "securitySchemes", "bearerAuth"))
+}
+
+func TestGenerateOpenAPI_ReferencesResolve(t *testing.T) {
+	doc := generateTestOpenAPI(t)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+				jsonPath(t, doc, parts...)
+			}
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(doc)
+}
+
+func TestHandler_ServeOpenAPI(t *testing.T) {
+	metadata := restTestMetadata()
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits()}
+	cached := &cachedSchema{
+		schema:    restTestSchema(t, metadata),
+		metadata:  metadata,
+		expiresAt: time.Now().Add(time.Minute),
+	}
+	h.schemaCache.Store("tenant_test", cached)
+	ten := &tenant.Tenant{ID: "t1", Name: "Acme", SchemaName: "tenant_test"}
+
+	serve := func(serverURL string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+		rec := httptest.NewRecorder()
+		h.ServeOpenAPI(rec, req.WithContext(tenant.WithTenant(req.Context(), ten)), serverURL)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+		return doc
+	}
+
+	doc := serve("https://a.test/rest")
+	assert.Equal(t, "Acme data API", jsonPath(t, doc, "info", "title"))
+	assert.Equal(t, []interface{}{map[string]interface{}{"url": "https://a.test/rest"}}, doc["servers"])
+	assert.Contains(t, jsonPath(t, doc, "paths"), "/posts/{id}")
+
+	// The document is generated once per cached schema; servers are per request
+	first := cached.openAPI
+	doc = serve("https://b.test/rest")
+	assert.Same(t, first, cached.openAPI)
+	assert.Equal(t, []interface{}{map[string]interface{}{"url": "https://b.test/rest"}}, doc["servers"])
+	assert.Nil(t, first.Servers)
+}
@@ -0,0 +1,191 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+// orderDirectionEnum lists the sort directions accepted by <Type>OrderBy inputs.
+// Values are the SQL fragments appended to the ORDER BY expression.
+var orderDirectionEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "OrderDirection",
+	Values: graphql.EnumValueConfigMap{
+		"asc":              &graphql.EnumValueConfig{Value: "ASC"},
+		"asc_nulls_first":  &graphql.EnumValueConfig{Value: "ASC NULLS FIRST"},
+		"asc_nulls_last":   &graphql.EnumValueConfig{Value: "ASC NULLS LAST"},
+		"desc":             &graphql.EnumValueConfig{Value: "DESC"},
+		"desc_nulls_first": &graphql.EnumValueConfig{Value: "DESC NULLS FIRST"},
+		"desc_nulls_last":  &graphql.EnumValueConfig{Value: "DESC NULLS LAST"},
+	},
+})
+
+// validOrderDirections guards against directions not produced by orderDirectionEnum
+var validOrderDirections = map[string]bool{
+	"ASC":              true,
+	"ASC NULLS FIRST":  true,
+	"ASC NULLS LAST":   true,
+	"DESC":             true,
+	"DESC NULLS FIRST": true,
+	"DESC NULLS LAST":  true,
+}
+
+// buildOrderBy creates the <Type>OrderBy input used by the `order_by` argument of a table.
+// Columns take an OrderDirection; belongsTo relations nest the related table's OrderBy.
+func (g *SchemaGenerator) buildOrderBy(table Table, orderBys map[string]*graphql.InputObject) *graphql.InputObject {
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: strcase.ToCamel(table.Name) + "OrderBy",
+		Fields: (graphql.InputObjectConfigFieldMapThunk)(func() graphql.InputObjectConfigFieldMap {
+			fields := graphql.InputObjectConfigFieldMap{}
+			for _, col := range table.Columns {
+				fields[strcase.ToLowerCamel(col.Name)] = &graphql.InputObjectFieldConfig{
+					Type: orderDirectionEnum,
+				}
+				if col.IsFK && col.FKTable != "" {
+					if related, ok := orderBys[col.FKTable]; ok {
+						fields[relationFieldName(col)] = &graphql.InputObjectFieldConfig{
+							Type: related,
+						}
+					}
+				}
+			}
+			return fields
+		}),
+	})
+}
+
+// orderTerm is a single ORDER BY expression with its direction
+type orderTerm struct {
+	expr      string
+	direction string
+}
+
+// orderCompiler turns `order_by` arguments into ORDER BY clauses
+type orderCompiler struct {
+	ctx        context.Context
+	schemaName string
+	tables     map[string]Table
+	args       *queryArgs
+	aliases    int
+}
+
+// buildOrderBy compiles an `order_by` argument (a list of <Type>OrderBy objects)
+// into an ORDER BY clause. An empty argument yields an empty string. Related
+// tables are read through their row filters, whose values are added to args.
+func buildOrderBy(ctx context.Context, schemaName string, tables map[string]Table, table Table, value interface{}, args *queryArgs) (string, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items = []interface{}{v}
+	default:
+		return "", fmt.Errorf("order_by expects a list of objects")
+	}
+
+	c := &orderCompiler{ctx: ctx, schemaName: schemaName, tables: tables, args: args}
+	ref := fmt.Sprintf(`"%s"`, table.Name)
+
+	var parts []string
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("order_by expects a list of objects")
+		}
+		terms, err := c.terms(table, ref, obj)
+		if err != nil {
+			return "", err
+		}
+		for _, t := range terms {
+			parts = append(parts, t.expr+" "+t.direction)
+		}
+	}
+
+	return strings.Join(parts, ", "), nil
+}
+
+// terms compiles one <Type>OrderBy object. ref is the SQL name the table is reachable
+// by in the current scope; belongsTo relations become correlated scalar subqueries,
+// so rows hidden from the role sort like missing ones.
+func (c *orderCompiler) terms(table Table, ref string, obj map[string]interface{}) ([]orderTerm, error) {
+	var terms []orderTerm
+
+	for _, key := range sortedKeys(obj) {
+		val := obj[key]
+		if val == nil {
+			continue
+		}
+
+		if col, ok := findColumn(table, key); ok {
+			if err := validateIdentifier(col.Name); err != nil {
+				return nil, err
+			}
+			direction, ok := val.(string)
+			if !ok || !validOrderDirections[direction] {
+				return nil, fmt.Errorf("invalid order direction for %s", key)
+			}
+			terms = append(terms, orderTerm{
+				expr:      fmt.Sprintf(`%s."%s"`, ref, col.Name),
+				direction: direction,
+			})
+			continue
+		}
+
+		col, ok := findRelationColumn(table, key)
+		if !ok {
+			return nil, fmt.Errorf("unknown order_by field: %s", key)
+		}
+		related, ok := c.tables[col.FKTable]
+		if !ok {
+			return nil, fmt.Errorf("unknown related table: %s", col.FKTable)
+		}
+		if err := validateIdentifier(related.Name); err != nil {
+			return nil, err
+		}
+		if err := validateIdentifier(col.FKColumn); err != nil {
+			return nil, err
+		}
+		nested, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("order_by on %s expects an object", key)
+		}
+
+		c.aliases++
+		alias := fmt.Sprintf("o%d", c.aliases)
+		relTerms, err := c.terms(related, `"`+alias+`"`, nested)
+		if err != nil {
+			return nil, err
+		}
+		if len(relTerms) == 0 {
+			continue
+		}
+		source, err := aliasedSource(c.ctx, c.schemaName, related, alias, c.args)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range relTerms {
+			terms = append(terms, orderTerm{
+				expr: fmt.Sprintf(`(SELECT %s FROM %s WHERE "%s"."%s" = %s."%s")`,
+					t.expr, source, alias, col.FKColumn, ref, col.Name),
+				direction: t.direction,
+			})
+		}
+	}
+
+	return terms, nil
+}
+
+// findRelationColumn resolves a belongsTo relation field name to its FK column
+func findRelationColumn(table Table, fieldName string) (Column, bool) {
+	for _, col := range table.Columns {
+		if col.IsFK && col.FKTable != "" && relationFieldName(col) == fieldName {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
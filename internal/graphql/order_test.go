@@ -0,0 +1,74 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func orderTestTables() map[string]Table {
+	return map[string]Table{
+		"authors": {
+			Name: "authors",
+			Columns: []Column{
+				{Name: "id", DataType: "integer", IsPK: true},
+				{Name: "name", DataType: "text"},
+			},
+		},
+		"posts": {
+			Name: "posts",
+			Columns: []Column{
+				{Name: "id", DataType: "integer", IsPK: true},
+				{Name: "title", DataType: "text"},
+				{Name: "created_at", DataType: "timestamp without time zone"},
+				{Name: "author_id", DataType: "integer", IsFK: true, FKTable: "authors", FKColumn: "id"},
+			},
+		},
+	}
+}
+
+func TestBuildOrderBy_Columns(t *testing.T) {
+	tables := orderTestTables()
+	orderBy, err := buildOrderBy(context.Background(), "tenant_test", tables, tables["posts"], []interface{}{
+		map[string]interface{}{"createdAt": "DESC NULLS LAST"},
+		map[string]interface{}{"id": "ASC"},
+	}, &queryArgs{})
+
+	require.NoError(t, err)
+	assert.Equal(t, `"posts"."created_at" DESC NULLS LAST, "posts"."id" ASC`, orderBy)
+}
+
+func TestBuildOrderBy_BelongsToRelation(t *testing.T) {
+	tables := orderTestTables()
+	orderBy, err := buildOrderBy(context.Background(), "tenant_test", tables, tables["posts"], []interface{}{
+		map[string]interface{}{"author": map[string]interface{}{"name": "ASC"}},
+	}, &queryArgs{})
+
+	require.NoError(t, err)
+	assert.Equal(t,
+		`(SELECT "o1"."name" FROM "tenant_test"."authors" AS "o1" WHERE "o1"."id" = "posts"."author_id") ASC`,
+		orderBy)
+}
+
+func TestBuildOrderBy_Errors(t *testing.T) {
+	tables := orderTestTables()
+
+	_, err := buildOrderBy(context.Background(), "tenant_test", tables, tables["posts"], []interface{}{
+		map[string]interface{}{"unknown": "ASC"},
+	}, &queryArgs{})
+	assert.Error(t, err)
+
+	_, err = buildOrderBy(context.Background(), "tenant_test", tables, tables["posts"], []interface{}{
+		map[string]interface{}{"title": "ASC; DROP TABLE posts"},
+	}, &queryArgs{})
+	assert.Error(t, err)
+}
+
+func TestBuildOrderBy_Empty(t *testing.T) {
+	tables := orderTestTables()
+	orderBy, err := buildOrderBy(context.Background(), "tenant_test", tables, tables["posts"], nil, &queryArgs{})
+	require.NoError(t, err)
+	assert.Empty(t, orderBy)
+}
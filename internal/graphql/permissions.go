@@ -0,0 +1,540 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/strcase"
+	"github.com/kapok/kapok/internal/database"
+)
+
+// AdminRole bypasses the permissions of a tenant and sees the full schema
+const AdminRole = "admin"
+
+// sessionVariablePrefix marks row filter values taken from the session
+const sessionVariablePrefix = "x-kapok-"
+
+// rowCheckColumn carries the row filter verdict of inserted and updated rows
+const rowCheckColumn = "__kapok_row_check"
+
+var (
+	// ErrPermissionsNotFound is returned when a tenant has no permissions for a role
+	ErrPermissionsNotFound = errors.New("role permissions not found")
+
+	// ErrRoleNotAllowed is returned when the caller's role has no access to a tenant
+	ErrRoleNotAllowed = errors.New("role has no access to this tenant")
+)
+
+// Session identifies the caller of a GraphQL request. Variables are keyed by
+// lower-case header-style names (x-kapok-user-id) and referenced by row filters.
+type Session struct {
+	Role      string
+	Variables map[string]string
+
+	// ExpiresAt is when the caller's credentials expire; zero if they do not.
+	// Long-lived connections end then.
+	ExpiresAt time.Time
+}
+
+type sessionContextKey struct{}
+
+// WithSession attaches the caller's session to a request context
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, s)
+}
+
+// SessionFromContext returns the session of a request, or nil
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return s
+}
+
+// TablePermission is what a role may do with one table.
+//
+// Columns lists the readable columns (all when empty) and WritableColumns the
+// ones insert and update mutations may set (all readable ones when empty).
+// Filter is a row filter in the shape of the `where` argument, e.g.
+// {"owner_id": {"_eq": "X-Kapok-User-Id"}}; string values naming a session
+// variable are replaced per request. Queries, updates and deletes only reach
+// matching rows, and inserted or updated rows must still match.
+type TablePermission struct {
+	Select          bool                   `json:"select"`
+	Insert          bool                   `json:"insert"`
+	Update          bool                   `json:"update"`
+	Delete          bool                   `json:"delete"`
+	Columns         []string               `json:"columns,omitempty"`
+	WritableColumns []string               `json:"writable_columns,omitempty"`
+	Filter          map[string]interface{} `json:"filter,omitempty"`
+}
+
+// RolePermissions holds the table permissions of one role of a tenant. Tables
+// missing from the map, or without select, are hidden from the role.
+type RolePermissions struct {
+	TenantID  string                     `json:"tenant_id"`
+	Role      string                     `json:"role"`
+	Tables    map[string]TablePermission `json:"tables"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+// Validate checks the role, table and column names of the permissions
+func (p *RolePermissions) Validate() error {
+	if p.Role == "" {
+		return fmt.Errorf("role is required")
+	}
+	if p.Role == AdminRole {
+		return fmt.Errorf("the %s role cannot be restricted", AdminRole)
+	}
+	for name, perm := range p.Tables {
+		if err := validateIdentifier(name); err != nil {
+			return fmt.Errorf("invalid table name: %s", name)
+		}
+		readable := make(map[string]bool, len(perm.Columns))
+		for _, col := range perm.Columns {
+			if err := validateIdentifier(col); err != nil {
+				return fmt.Errorf("invalid column name: %s.%s", name, col)
+			}
+			readable[col] = true
+		}
+		for _, col := range perm.WritableColumns {
+			if err := validateIdentifier(col); err != nil {
+				return fmt.Errorf("invalid column name: %s.%s", name, col)
+			}
+			if len(perm.Columns) > 0 && !readable[col] {
+				return fmt.Errorf("writable column %s.%s is not readable", name, col)
+			}
+		}
+	}
+	return nil
+}
+
+// apply restricts the introspected schema to what the role may see. Tables keep
+// their full column list in their access rules so row filters may use hidden
+// columns. Volatile functions are dropped since they may write anywhere, and
+// actions and remote schemas are kept for the roles they list, with the joins
+// whose tables and columns the role may read.
+func (p *RolePermissions) apply(metadata *SchemaMetadata) *SchemaMetadata {
+	restricted := &SchemaMetadata{Enums: metadata.Enums}
+
+	visible := make(map[string]bool)
+	for _, table := range metadata.Tables {
+		perm, ok := p.Tables[table.Name]
+		if !ok || !perm.Select {
+			continue
+		}
+
+		columns := table.Columns
+		if len(perm.Columns) > 0 {
+			readable := make(map[string]bool, len(perm.Columns))
+			for _, col := range perm.Columns {
+				readable[col] = true
+			}
+			columns = nil
+			for _, col := range table.Columns {
+				if readable[col.Name] {
+					columns = append(columns, col)
+				}
+			}
+		}
+
+		access := &tableAccess{
+			insert:  perm.Insert && !table.ReadOnly,
+			update:  perm.Update && !table.ReadOnly,
+			delete:  perm.Delete && !table.ReadOnly,
+			filter:  perm.Filter,
+			columns: table.Columns,
+		}
+		if len(perm.WritableColumns) > 0 {
+			access.writable = make(map[string]bool, len(perm.WritableColumns))
+			for _, col := range perm.WritableColumns {
+				access.writable[col] = true
+			}
+		}
+
+		restrictedTable := table
+		restrictedTable.Columns = columns
+		restrictedTable.access = access
+
+		// Mutations without a single column to set are not generated
+		pk := make(map[string]bool)
+		for _, col := range primaryKeyColumns(restrictedTable) {
+			pk[col] = true
+		}
+		var writable, writableNonKey int
+		for _, col := range columns {
+			if restrictedTable.writable(col.Name) {
+				writable++
+				if !pk[col.Name] {
+					writableNonKey++
+				}
+			}
+		}
+		access.insert = access.insert && writable > 0
+		access.update = access.update && writableNonKey > 0
+
+		restricted.Tables = append(restricted.Tables, restrictedTable)
+		visible[table.Name] = true
+	}
+
+	for _, fn := range metadata.Functions {
+		if !fn.Volatile && visible[fn.ReturnTable] {
+			restricted.Functions = append(restricted.Functions, fn)
+		}
+	}
+
+	for _, action := range metadata.Actions {
+		if action.allows(p.Role) {
+			restricted.Actions = append(restricted.Actions, action)
+		}
+	}
+
+	readable := make(map[string]bool)
+	for _, table := range restricted.Tables {
+		for _, col := range table.Columns {
+			readable[table.Name+"."+col.Name] = true
+		}
+	}
+	for _, remote := range metadata.RemoteSchemas {
+		if !remote.allows(p.Role) {
+			continue
+		}
+		var joins []RemoteJoin
+		for _, j := range remote.Joins {
+			allowed := true
+			for _, col := range j.Arguments {
+				allowed = allowed && readable[j.Table+"."+col]
+			}
+			if allowed {
+				joins = append(joins, j)
+			}
+		}
+		remote.Joins = joins
+		restricted.RemoteSchemas = append(restricted.RemoteSchemas, remote)
+	}
+	return restricted
+}
+
+// tableAccess is the resolved permission of a role on a table; tables without
+// one are unrestricted
+type tableAccess struct {
+	insert, update, delete bool
+
+	// writable is nil when every readable column may be written
+	writable map[string]bool
+	filter   map[string]interface{}
+
+	// columns is the full column list, which the filter is compiled against
+	columns []Column
+}
+
+// Table operations gated by permissions
+const (
+	opInsert = "insert"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// allows reports whether the role the table was generated for may run op
+func (t Table) allows(op string) bool {
+	if t.access == nil {
+		return true
+	}
+	switch op {
+	case opInsert:
+		return t.access.insert
+	case opUpdate:
+		return t.access.update
+	case opDelete:
+		return t.access.delete
+	}
+	return false
+}
+
+// writable reports whether mutations may set a column
+func (t Table) writable(column string) bool {
+	return t.access == nil || t.access.writable == nil || t.access.writable[column]
+}
+
+// hasRowFilter reports whether the rows of the table are filtered for the role
+func (t Table) hasRowFilter() bool {
+	return t.access != nil && len(t.access.filter) > 0
+}
+
+// rowFilter compiles the row filter of a table with the session variables of
+// the request. It returns an empty condition for unfiltered tables.
+func rowFilter(ctx context.Context, table Table, args *queryArgs) (string, error) {
+	if !table.hasRowFilter() {
+		return "", nil
+	}
+
+	filter, err := bindSession(table.access.filter, SessionFromContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	exp, ok := filter.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("invalid row filter for %s", table.Name)
+	}
+
+	cond, err := buildWhere(Table{Name: table.Name, Columns: table.access.columns}, exp, args)
+	if err != nil {
+		return "", fmt.Errorf("invalid row filter for %s: %w", table.Name, err)
+	}
+	if cond == "" {
+		return "", nil
+	}
+	return "(" + cond + ")", nil
+}
+
+// filteredWhere compiles a where argument and adds the row filter to it, for
+// statements that cannot select from tableSource (UPDATE and DELETE)
+func filteredWhere(ctx context.Context, table Table, where map[string]interface{}, args *queryArgs) (string, error) {
+	cond, err := buildWhere(table, where, args)
+	if err != nil {
+		return "", err
+	}
+	filter, err := rowFilter(ctx, table, args)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case filter == "":
+		return cond, nil
+	case cond == "":
+		return filter, nil
+	}
+	return cond + " AND " + filter, nil
+}
+
+// tableSource returns the FROM item of a table: the table itself, or the rows the
+// role may see under the table's name. Filter parameters are added to args.
+func tableSource(ctx context.Context, schemaName string, table Table, args *queryArgs) (string, error) {
+	return aliasedSource(ctx, schemaName, table, "", args)
+}
+
+// aliasedSource is tableSource under an alias; an empty alias keeps the table name
+func aliasedSource(ctx context.Context, schemaName string, table Table, alias string, args *queryArgs) (string, error) {
+	cond, err := rowFilter(ctx, table, args)
+	if err != nil {
+		return "", err
+	}
+	source := fmt.Sprintf(`"%s"."%s"`, schemaName, table.Name)
+	if cond != "" {
+		source = fmt.Sprintf(`(SELECT * FROM %s WHERE %s)`, source, cond)
+		if alias == "" {
+			alias = table.Name
+		}
+	}
+	if alias != "" {
+		source += fmt.Sprintf(` AS "%s"`, alias)
+	}
+	return source, nil
+}
+
+// withRowCheck wraps a statement ending in RETURNING * so every returned row
+// reports whether it matches the row filter; checkRows reads the verdict. The
+// statement must run in a transaction that is rolled back when the check fails.
+func withRowCheck(ctx context.Context, table Table, query string, args *queryArgs) (string, error) {
+	cond, err := rowFilter(ctx, table, args)
+	if err != nil || cond == "" {
+		return query, err
+	}
+	return fmt.Sprintf(`WITH "%s" AS (%s) SELECT *, COALESCE(%s, false) AS "%s" FROM "%s"`,
+		table.Name, query, cond, rowCheckColumn, table.Name), nil
+}
+
+// rowCheckParams returns how many bind parameters withRowCheck adds to a
+// statement on table
+func rowCheckParams(ctx context.Context, table Table) (int, error) {
+	args := &queryArgs{}
+	if _, err := rowFilter(ctx, table, args); err != nil {
+		return 0, err
+	}
+	return len(args.values), nil
+}
+
+// checkRows fails when a row returned by withRowCheck does not match the row
+// filter, and strips the verdict from the rows
+func checkRows(table Table, rows []map[string]interface{}) error {
+	if !table.hasRowFilter() {
+		return nil
+	}
+	field := strcase.ToLowerCamel(rowCheckColumn)
+	for _, row := range rows {
+		if ok, _ := row[field].(bool); !ok {
+			return &DatabaseError{
+				Code:    PermissionDeniedCode,
+				Message: fmt.Sprintf("row violates the permission filter of %s", table.Name),
+				Table:   table.Name,
+			}
+		}
+		delete(row, field)
+	}
+	return nil
+}
+
+// bindSession replaces the session variables of a row filter with their values
+// and normalizes column keys to field names, so filters may use either
+func bindSession(value interface{}, session *Session) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		bound := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			b, err := bindSession(item, session)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(key, "_") {
+				key = strcase.ToLowerCamel(key)
+			}
+			bound[key] = b
+		}
+		return bound, nil
+	case []interface{}:
+		bound := make([]interface{}, len(v))
+		for i, item := range v {
+			b, err := bindSession(item, session)
+			if err != nil {
+				return nil, err
+			}
+			bound[i] = b
+		}
+		return bound, nil
+	case string:
+		name := strings.ToLower(v)
+		if !strings.HasPrefix(name, sessionVariablePrefix) {
+			return v, nil
+		}
+		var val string
+		ok := false
+		if session != nil {
+			val, ok = session.Variables[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("session variable %s is not set", v)
+		}
+		return val, nil
+	}
+	return value, nil
+}
+
+// PermissionStore loads the role permissions of tenants
+type PermissionStore interface {
+	List(ctx context.Context, tenantID string) ([]*RolePermissions, error)
+}
+
+// PermissionRepository stores role permissions in the control database
+type PermissionRepository struct {
+	db *database.DB
+}
+
+// NewPermissionRepository creates a new permission repository
+func NewPermissionRepository(db *database.DB) *PermissionRepository {
+	return &PermissionRepository{db: db}
+}
+
+// List returns the permissions of every role of a tenant, ordered by role
+func (r *PermissionRepository) List(ctx context.Context, tenantID string) ([]*RolePermissions, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT tenant_id, role, tables, updated_at
+		FROM tenant_permissions WHERE tenant_id = $1
+		ORDER BY role
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var perms []*RolePermissions
+	for rows.Next() {
+		p, err := scanPermissions(rows)
+		if err != nil {
+			return nil, err
+		}
+		perms = append(perms, p)
+	}
+	return perms, rows.Err()
+}
+
+// Get returns the permissions of one role of a tenant
+func (r *PermissionRepository) Get(ctx context.Context, tenantID, role string) (*RolePermissions, error) {
+	p, err := scanPermissions(r.db.QueryRowContext(ctx, `
+		SELECT tenant_id, role, tables, updated_at
+		FROM tenant_permissions WHERE tenant_id = $1 AND role = $2
+	`, tenantID, role))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrPermissionsNotFound, role)
+	}
+	return p, err
+}
+
+// Put creates or replaces the permissions of a role
+func (r *PermissionRepository) Put(ctx context.Context, p *RolePermissions) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.Tables == nil {
+		p.Tables = map[string]TablePermission{}
+	}
+	tables, err := json.Marshal(p.Tables)
+	if err != nil {
+		return fmt.Errorf("failed to encode permissions: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO tenant_permissions (tenant_id, role, tables)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, role) DO UPDATE SET tables = EXCLUDED.tables, updated_at = NOW()
+		RETURNING updated_at
+	`, p.TenantID, p.Role, tables).Scan(&p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save permissions: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the permissions of a role
+func (r *PermissionRepository) Delete(ctx context.Context, tenantID, role string) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM tenant_permissions WHERE tenant_id = $1 AND role = $2
+	`, tenantID, role)
+	if err != nil {
+		return fmt.Errorf("failed to delete permissions: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrPermissionsNotFound, role)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPermissions(row rowScanner) (*RolePermissions, error) {
+	p := &RolePermissions{}
+	var tables []byte
+	if err := row.Scan(&p.TenantID, &p.Role, &tables, &p.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan permissions: %w", err)
+	}
+	if err := json.Unmarshal(tables, &p.Tables); err != nil {
+		return nil, fmt.Errorf("failed to decode permissions: %w", err)
+	}
+	return p, nil
+}
+
+// permissionsByRole indexes the permissions of a tenant by role
+func permissionsByRole(perms []*RolePermissions) map[string]*RolePermissions {
+	roles := make(map[string]*RolePermissions, len(perms))
+	for _, p := range perms {
+		roles[p.Role] = p
+	}
+	return roles
+}
@@ -0,0 +1,201 @@
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryPermissionStore []*RolePermissions
+
+func (s memoryPermissionStore) List(ctx context.Context, tenantID string) ([]*RolePermissions, error) {
+	return s, nil
+}
+
+func authorPermissions() *RolePermissions {
+	return &RolePermissions{
+		Role: "author",
+		Tables: map[string]TablePermission{
+			"posts": {
+				Select:          true,
+				Insert:          true,
+				Update:          true,
+				Columns:         []string{"id", "title", "author_id"},
+				WritableColumns: []string{"title", "author_id"},
+				Filter:          map[string]interface{}{"author_id": map[string]interface{}{"_eq": "X-Kapok-User-Id"}},
+			},
+		},
+	}
+}
+
+func permissionTestSchema(t *testing.T, perms *RolePermissions) *graphql.Schema {
+	t.Helper()
+	tables := orderTestTables()
+	metadata := perms.apply(&SchemaMetadata{Tables: []Table{tables["authors"], tables["posts"]}})
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", metadata)
+	require.NoError(t, err)
+	return schema
+}
+
+func TestRolePermissions_Apply(t *testing.T) {
+	schema := permissionTestSchema(t, authorPermissions())
+	query := schema.QueryType().Fields()
+	mutation := schema.MutationType().Fields()
+
+	assert.Contains(t, query, "posts")
+	assert.NotContains(t, query, "authors", "tables without select are hidden")
+
+	posts := schema.Type("Posts").(*graphql.Object).Fields()
+	assert.Contains(t, posts, "title")
+	assert.NotContains(t, posts, "createdAt", "columns outside the readable list are hidden")
+	assert.NotContains(t, posts, "author", "relations to hidden tables are dropped")
+
+	assert.Contains(t, mutation, "createPosts")
+	assert.Contains(t, mutation, "updatePosts")
+	assert.NotContains(t, mutation, "deletePosts")
+	assert.NotContains(t, mutation, "deletePostsMany")
+
+	var updateArgs []string
+	for _, arg := range mutation["updatePosts"].Args {
+		updateArgs = append(updateArgs, arg.Name())
+	}
+	assert.ElementsMatch(t, []string{"id", "title", "authorId"}, updateArgs)
+
+	for _, arg := range mutation["insertPostsMany"].Args {
+		assert.NotEqual(t, "onConflict", arg.Name(), "upserts could overwrite rows outside the filter")
+	}
+}
+
+func TestRolePermissions_ApplyDisablesMutationsWithoutWritableColumns(t *testing.T) {
+	perms := &RolePermissions{
+		Role: "reader",
+		Tables: map[string]TablePermission{
+			"authors": {Select: true, Insert: true, Update: true, WritableColumns: []string{"id"}},
+		},
+	}
+	tables := orderTestTables()
+	metadata := perms.apply(&SchemaMetadata{Tables: []Table{tables["authors"]}})
+
+	require.Len(t, metadata.Tables, 1)
+	assert.True(t, metadata.Tables[0].allows(opInsert))
+	assert.False(t, metadata.Tables[0].allows(opUpdate), "only the primary key is writable")
+	assert.False(t, metadata.Tables[0].allows(opDelete))
+}
+
+func TestRolePermissions_Validate(t *testing.T) {
+	assert.NoError(t, authorPermissions().Validate())
+	assert.EqualError(t, (&RolePermissions{}).Validate(), "role is required")
+	assert.EqualError(t, (&RolePermissions{Role: AdminRole}).Validate(), "the admin role cannot be restricted")
+	assert.EqualError(t, (&RolePermissions{Role: "r", Tables: map[string]TablePermission{
+		"posts; drop": {Select: true},
+	}}).Validate(), "invalid table name: posts; drop")
+	assert.EqualError(t, (&RolePermissions{Role: "r", Tables: map[string]TablePermission{
+		"posts": {Columns: []string{"id"}, WritableColumns: []string{"title"}},
+	}}).Validate(), "writable column posts.title is not readable")
+}
+
+func TestTableSource_RowFilter(t *testing.T) {
+	tables := orderTestTables()
+	metadata := authorPermissions().apply(&SchemaMetadata{Tables: []Table{tables["posts"]}})
+	posts := metadata.Tables[0]
+
+	ctx := WithSession(context.Background(), &Session{
+		Role:      "author",
+		Variables: map[string]string{"x-kapok-user-id": "42"},
+	})
+	args := &queryArgs{}
+	source, err := tableSource(ctx, "tenant_test", posts, args)
+	require.NoError(t, err)
+	assert.Equal(t, `(SELECT * FROM "tenant_test"."posts" WHERE ("author_id" = $1)) AS "posts"`, source)
+	assert.Equal(t, []interface{}{"42"}, args.values)
+
+	source, err = tableSource(ctx, "tenant_test", tables["authors"], &queryArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, `"tenant_test"."authors"`, source, "unrestricted tables are read directly")
+
+	_, err = tableSource(context.Background(), "tenant_test", posts, &queryArgs{})
+	assert.EqualError(t, err, "session variable X-Kapok-User-Id is not set")
+}
+
+func TestBuildOrderBy_RowFilter(t *testing.T) {
+	tables := orderTestTables()
+	perms := &RolePermissions{
+		Role: "reader",
+		Tables: map[string]TablePermission{
+			"authors": {
+				Select: true,
+				Filter: map[string]interface{}{"id": map[string]interface{}{"_eq": "X-Kapok-User-Id"}},
+			},
+			"posts": {Select: true},
+		},
+	}
+	metadata := perms.apply(&SchemaMetadata{Tables: []Table{tables["authors"], tables["posts"]}})
+	restricted := make(map[string]Table)
+	for _, table := range metadata.Tables {
+		restricted[table.Name] = table
+	}
+
+	ctx := WithSession(context.Background(), &Session{
+		Role:      "reader",
+		Variables: map[string]string{"x-kapok-user-id": "42"},
+	})
+	args := &queryArgs{}
+	orderBy, err := buildOrderBy(ctx, "tenant_test", restricted, restricted["posts"], []interface{}{
+		map[string]interface{}{"author": map[string]interface{}{"name": "ASC"}},
+	}, args)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`(SELECT "o1"."name" FROM (SELECT * FROM "tenant_test"."authors" WHERE ("id" = $1)) AS "o1" WHERE "o1"."id" = "posts"."author_id") ASC`,
+		orderBy, "hidden parents sort like missing ones")
+	assert.Equal(t, []interface{}{"42"}, args.values)
+}
+
+func TestCheckRows(t *testing.T) {
+	tables := orderTestTables()
+	posts := authorPermissions().apply(&SchemaMetadata{Tables: []Table{tables["posts"]}}).Tables[0]
+
+	rows := []map[string]interface{}{{"id": 1, "KapokRowCheck": true}}
+	require.NoError(t, checkRows(posts, rows))
+	assert.Equal(t, []map[string]interface{}{{"id": 1}}, rows)
+
+	err := checkRows(posts, []map[string]interface{}{{"id": 2, "KapokRowCheck": false}})
+	assert.EqualError(t, err, "row violates the permission filter of posts")
+}
+
+func TestHandler_RejectsRolesWithoutPermissions(t *testing.T) {
+	h := &Handler{
+		logger:      zerolog.Nop(),
+		limits:      DefaultQueryLimits(),
+		permissions: memoryPermissionStore{authorPermissions()},
+	}
+	h.schemaCache.Store("tenant_test", &cachedSchema{
+		schema:    complexityTestSchema(t),
+		expiresAt: time.Now().Add(time.Minute),
+	})
+	ten := &tenant.Tenant{ID: "t1", SchemaName: "tenant_test"}
+
+	serve := func(role string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ __typename }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		ctx := tenant.WithTenant(req.Context(), ten)
+		ctx = WithSession(ctx, &Session{Role: role})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	rec := serve("viewer")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), `role has no access to this tenant: "viewer"`)
+
+	assert.Equal(t, http.StatusOK, serve(AdminRole).Code, "admins use the full schema")
+}
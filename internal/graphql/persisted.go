@@ -0,0 +1,339 @@
+package graphql
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/kapok/kapok/internal/database"
+	"github.com/kapok/kapok/internal/tenant"
+)
+
+// ErrOperationNotFound is returned when a tenant has no operation with a hash
+var ErrOperationNotFound = errors.New("persisted operation not found")
+
+// Error codes of persisted query failures, reported in extensions.code. The
+// PersistedQueryNotFound message is what Apollo-style clients retry on.
+const (
+	PersistedQueryNotFoundCode = "PERSISTED_QUERY_NOT_FOUND"
+	PersistedQueryMismatchCode = "PERSISTED_QUERY_HASH_MISMATCH"
+	OperationNotAllowedCode    = "OPERATION_NOT_ALLOWED"
+)
+
+// Bounds of automatic persisted queries, which any client of a tenant can send
+const (
+	// MaxPersistedQueryLength is the longest document registered automatically;
+	// longer ones still run but are not stored
+	MaxPersistedQueryLength = 64 << 10
+
+	// MaxAutomaticOperations is how many automatic persisted queries a tenant
+	// keeps; registering more evicts the oldest. Allowlisted ones do not count.
+	MaxAutomaticOperations = 1000
+)
+
+// Lookups of persisted operations are cached per replica, misses included, so
+// operations registered or deleted on another replica apply within the TTL
+const (
+	operationCacheSize = 4096
+	operationCacheTTL  = time.Minute
+)
+
+// PersistedOperation is a GraphQL document registered for a tenant under the
+// sha256 hash of its text. Allowlisted operations were registered by an admin
+// and may run when the tenant is in strict mode; automatic persisted queries
+// sent by clients are stored without that flag.
+type PersistedOperation struct {
+	TenantID    string    `json:"tenant_id"`
+	Hash        string    `json:"hash"`
+	Name        string    `json:"name"`
+	Query       string    `json:"query"`
+	Allowlisted bool      `json:"allowlisted"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// HashQuery returns the hex sha256 of a document, as sent by APQ clients
+func HashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// OperationStore looks up and registers the persisted operations of tenants
+type OperationStore interface {
+	Get(ctx context.Context, tenantID, hash string) (*PersistedOperation, error)
+	Register(ctx context.Context, op *PersistedOperation) error
+}
+
+// OperationRepository stores persisted operations in the control database
+type OperationRepository struct {
+	db *database.DB
+}
+
+// NewOperationRepository creates a new persisted operation repository
+func NewOperationRepository(db *database.DB) *OperationRepository {
+	return &OperationRepository{db: db}
+}
+
+// Get returns the operation of a tenant with the given hash
+func (r *OperationRepository) Get(ctx context.Context, tenantID, hash string) (*PersistedOperation, error) {
+	op := &PersistedOperation{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT tenant_id, hash, name, query, allowlisted, created_at
+		FROM persisted_operations WHERE tenant_id = $1 AND hash = $2
+	`, tenantID, hash).Scan(&op.TenantID, &op.Hash, &op.Name, &op.Query, &op.Allowlisted, &op.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrOperationNotFound, hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persisted operation: %w", err)
+	}
+	return op, nil
+}
+
+// Register stores an operation, computing its hash. Registering an existing
+// operation never revokes its allowlisting and keeps its name unless a new one
+// is given. Automatic persisted queries beyond MaxAutomaticOperations evict the
+// oldest of the tenant.
+func (r *OperationRepository) Register(ctx context.Context, op *PersistedOperation) error {
+	if op.Query == "" {
+		return fmt.Errorf("operation query is required")
+	}
+	op.Hash = HashQuery(op.Query)
+
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO persisted_operations (tenant_id, hash, name, query, allowlisted)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, hash) DO UPDATE SET
+			name = COALESCE(NULLIF(EXCLUDED.name, ''), persisted_operations.name),
+			allowlisted = persisted_operations.allowlisted OR EXCLUDED.allowlisted
+		RETURNING name, allowlisted, created_at
+	`, op.TenantID, op.Hash, op.Name, op.Query, op.Allowlisted).Scan(&op.Name, &op.Allowlisted, &op.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to register persisted operation: %w", err)
+	}
+	if op.Allowlisted {
+		return nil
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		DELETE FROM persisted_operations
+		WHERE tenant_id = $1 AND NOT allowlisted AND hash NOT IN (
+			SELECT hash FROM persisted_operations
+			WHERE tenant_id = $1 AND NOT allowlisted
+			ORDER BY created_at DESC
+			LIMIT $2
+		)
+	`, op.TenantID, MaxAutomaticOperations)
+	if err != nil {
+		return fmt.Errorf("failed to evict persisted operations: %w", err)
+	}
+	return nil
+}
+
+// List returns the operations of a tenant; allowlistedOnly skips automatic
+// persisted queries
+func (r *OperationRepository) List(ctx context.Context, tenantID string, allowlistedOnly bool) ([]*PersistedOperation, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT tenant_id, hash, name, query, allowlisted, created_at
+		FROM persisted_operations
+		WHERE tenant_id = $1 AND (allowlisted OR NOT $2)
+		ORDER BY created_at DESC
+	`, tenantID, allowlistedOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persisted operations: %w", err)
+	}
+	defer rows.Close()
+
+	var ops []*PersistedOperation
+	for rows.Next() {
+		op := &PersistedOperation{}
+		if err := rows.Scan(&op.TenantID, &op.Hash, &op.Name, &op.Query, &op.Allowlisted, &op.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan persisted operation: %w", err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, rows.Err()
+}
+
+// Delete removes an operation of a tenant
+func (r *OperationRepository) Delete(ctx context.Context, tenantID, hash string) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM persisted_operations WHERE tenant_id = $1 AND hash = $2
+	`, tenantID, hash)
+	if err != nil {
+		return fmt.Errorf("failed to delete persisted operation: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrOperationNotFound, hash)
+	}
+	return nil
+}
+
+// operationCache is an LRU of persisted operation lookups; a nil operation
+// records a miss. The zero value is ready to use.
+type operationCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   list.List
+}
+
+type operationCacheEntry struct {
+	key       string
+	op        *PersistedOperation
+	expiresAt time.Time
+}
+
+// get returns the cached lookup of a tenant's hash
+func (c *operationCache) get(tenantID, hash string) (op *PersistedOperation, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[tenantID+"/"+hash]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*operationCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, entry.key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.op, true
+}
+
+// put caches the lookup of a tenant's hash, evicting the least recently used
+func (c *operationCache) put(tenantID, hash string, op *PersistedOperation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	key := tenantID + "/" + hash
+	entry := &operationCacheEntry{key: key, op: op, expiresAt: time.Now().Add(operationCacheTTL)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > operationCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*operationCacheEntry).key)
+	}
+}
+
+// remove drops the cached lookup of a tenant's hash
+func (c *operationCache) remove(tenantID, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[tenantID+"/"+hash]; ok {
+		c.order.Remove(el)
+		delete(c.entries, tenantID+"/"+hash)
+	}
+}
+
+// InvalidateOperation forgets the cached lookup of a tenant's operation, after
+// it was registered or deleted
+func (h *Handler) InvalidateOperation(tenantID, hash string) {
+	h.operationCache.remove(tenantID, hash)
+}
+
+// getOperation looks up a tenant's operation through the cache; it returns nil
+// when the tenant has none with the hash
+func (h *Handler) getOperation(ctx context.Context, tenantID, hash string) (*PersistedOperation, error) {
+	if op, ok := h.operationCache.get(tenantID, hash); ok {
+		return op, nil
+	}
+	op, err := h.operations.Get(ctx, tenantID, hash)
+	if errors.Is(err, ErrOperationNotFound) {
+		op, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.operationCache.put(tenantID, hash, op)
+	return op, nil
+}
+
+// persistedQueryHash returns the sha256Hash of the APQ extension of a request,
+// or an empty string when the request does not use persisted queries
+func persistedQueryHash(extensions map[string]interface{}) string {
+	ext, ok := extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	hash, _ := ext["sha256Hash"].(string)
+	return hash
+}
+
+// operationError builds a request error carrying an extensions.code
+func operationError(code, message string) *gqlerrors.FormattedError {
+	return &gqlerrors.FormattedError{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
+
+// resolveOperation returns the document to execute for a request. Requests with
+// an APQ hash and no query run the stored document; requests sending both
+// register it, up to MaxPersistedQueryLength. Tenants in strict mode may only
+// run allowlisted operations, whichever way they are sent, and cannot register
+// new ones.
+func (h *Handler) resolveOperation(ctx context.Context, t *tenant.Tenant, query string, extensions map[string]interface{}) (string, *gqlerrors.FormattedError) {
+	hash := persistedQueryHash(extensions)
+	if h.operations == nil {
+		if hash != "" && query == "" {
+			return "", operationError(PersistedQueryNotFoundCode, "PersistedQueryNotFound")
+		}
+		return query, nil
+	}
+
+	if hash != "" && query != "" && HashQuery(query) != hash {
+		return "", operationError(PersistedQueryMismatchCode, "provided sha256Hash does not match query")
+	}
+	if hash == "" {
+		if !t.StrictOperations {
+			return query, nil
+		}
+		hash = HashQuery(query)
+	}
+
+	op, err := h.getOperation(ctx, t.ID, hash)
+	if err != nil {
+		h.logger.Error().Err(err).Str("tenant_id", t.ID).Msg("failed to load persisted operation")
+		return "", operationError(InternalErrorCode, "failed to load persisted operation")
+	}
+
+	if t.StrictOperations {
+		if op == nil || !op.Allowlisted {
+			return "", operationError(OperationNotAllowedCode, "operation is not allowlisted for this tenant")
+		}
+		return op.Query, nil
+	}
+
+	if op != nil {
+		return op.Query, nil
+	}
+	if query == "" {
+		return "", operationError(PersistedQueryNotFoundCode, "PersistedQueryNotFound")
+	}
+
+	// Automatic registration; the request still runs if it cannot be stored
+	if len(query) > MaxPersistedQueryLength {
+		return query, nil
+	}
+	op = &PersistedOperation{TenantID: t.ID, Query: query}
+	if err := h.operations.Register(ctx, op); err != nil {
+		h.logger.Warn().Err(err).Str("tenant_id", t.ID).Msg("failed to register persisted query")
+		return query, nil
+	}
+	h.operationCache.put(t.ID, hash, op)
+	return query, nil
+}
@@ -0,0 +1,232 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryOperationStore keeps persisted operations in memory
+type memoryOperationStore struct {
+	ops  map[string]*PersistedOperation
+	gets int
+}
+
+func newMemoryOperationStore() *memoryOperationStore {
+	return &memoryOperationStore{ops: make(map[string]*PersistedOperation)}
+}
+
+func (s *memoryOperationStore) Get(ctx context.Context, tenantID, hash string) (*PersistedOperation, error) {
+	s.gets++
+	op, ok := s.ops[tenantID+"/"+hash]
+	if !ok {
+		return nil, ErrOperationNotFound
+	}
+	return op, nil
+}
+
+func (s *memoryOperationStore) Register(ctx context.Context, op *PersistedOperation) error {
+	op.Hash = HashQuery(op.Query)
+	if existing, ok := s.ops[op.TenantID+"/"+op.Hash]; ok {
+		existing.Allowlisted = existing.Allowlisted || op.Allowlisted
+		return nil
+	}
+	s.ops[op.TenantID+"/"+op.Hash] = op
+	return nil
+}
+
+func apqExtensions(hash string) map[string]interface{} {
+	return map[string]interface{}{
+		"persistedQuery": map[string]interface{}{"version": float64(1), "sha256Hash": hash},
+	}
+}
+
+func TestResolveOperation_AutomaticPersistedQueries(t *testing.T) {
+	store := newMemoryOperationStore()
+	h := &Handler{logger: zerolog.Nop(), operations: store}
+	ten := &tenant.Tenant{ID: "t1"}
+	ctx := context.Background()
+
+	query := `{ posts { id } }`
+	hash := HashQuery(query)
+
+	_, opErr := h.resolveOperation(ctx, ten, "", apqExtensions(hash))
+	require.NotNil(t, opErr)
+	assert.Equal(t, "PersistedQueryNotFound", opErr.Message)
+	assert.Equal(t, PersistedQueryNotFoundCode, opErr.Extensions["code"])
+
+	got, opErr := h.resolveOperation(ctx, ten, query, apqExtensions(hash))
+	require.Nil(t, opErr)
+	assert.Equal(t, query, got)
+	require.Contains(t, store.ops, "t1/"+hash)
+	assert.False(t, store.ops["t1/"+hash].Allowlisted)
+
+	got, opErr = h.resolveOperation(ctx, ten, "", apqExtensions(hash))
+	require.Nil(t, opErr)
+	assert.Equal(t, query, got)
+
+	_, opErr = h.resolveOperation(ctx, &tenant.Tenant{ID: "t2"}, "", apqExtensions(hash))
+	require.NotNil(t, opErr, "operations are stored per tenant")
+
+	_, opErr = h.resolveOperation(ctx, ten, `{ authors { id } }`, apqExtensions(hash))
+	require.NotNil(t, opErr)
+	assert.Equal(t, PersistedQueryMismatchCode, opErr.Extensions["code"])
+
+	got, opErr = h.resolveOperation(ctx, ten, `{ authors { id } }`, nil)
+	require.Nil(t, opErr)
+	assert.Equal(t, `{ authors { id } }`, got, "plain queries run without being stored")
+	assert.Len(t, store.ops, 1)
+}
+
+func TestResolveOperation_StrictMode(t *testing.T) {
+	store := newMemoryOperationStore()
+	h := &Handler{logger: zerolog.Nop(), operations: store}
+	ten := &tenant.Tenant{ID: "t1", StrictOperations: true}
+	ctx := context.Background()
+
+	allowed := `query Posts { posts { id } }`
+	require.NoError(t, store.Register(ctx, &PersistedOperation{TenantID: "t1", Query: allowed, Allowlisted: true}))
+	automatic := `{ authors { id } }`
+	require.NoError(t, store.Register(ctx, &PersistedOperation{TenantID: "t1", Query: automatic}))
+
+	got, opErr := h.resolveOperation(ctx, ten, "", apqExtensions(HashQuery(allowed)))
+	require.Nil(t, opErr)
+	assert.Equal(t, allowed, got)
+
+	got, opErr = h.resolveOperation(ctx, ten, allowed, nil)
+	require.Nil(t, opErr, "the full text of allowlisted operations is accepted")
+	assert.Equal(t, allowed, got)
+
+	for name, query := range map[string]string{"unknown": `{ posts { title } }`, "automatic": automatic} {
+		_, opErr = h.resolveOperation(ctx, ten, query, nil)
+		require.NotNil(t, opErr, name)
+		assert.Equal(t, OperationNotAllowedCode, opErr.Extensions["code"], name)
+
+		_, opErr = h.resolveOperation(ctx, ten, query, apqExtensions(HashQuery(query)))
+		require.NotNil(t, opErr, name)
+		assert.Equal(t, OperationNotAllowedCode, opErr.Extensions["code"], name)
+	}
+	assert.Len(t, store.ops, 2, "strict tenants cannot register operations")
+}
+
+func TestResolveOperation_BoundsAutomaticRegistration(t *testing.T) {
+	store := newMemoryOperationStore()
+	h := &Handler{logger: zerolog.Nop(), operations: store}
+	ten := &tenant.Tenant{ID: "t1"}
+	ctx := context.Background()
+
+	long := "{ posts { id } }" + strings.Repeat(" ", MaxPersistedQueryLength)
+	got, opErr := h.resolveOperation(ctx, ten, long, apqExtensions(HashQuery(long)))
+	require.Nil(t, opErr, "long documents still run")
+	assert.Equal(t, long, got)
+	assert.Empty(t, store.ops, "long documents are not registered")
+}
+
+func TestResolveOperation_CachesLookups(t *testing.T) {
+	store := newMemoryOperationStore()
+	h := &Handler{logger: zerolog.Nop(), operations: store}
+	ten := &tenant.Tenant{ID: "t1", StrictOperations: true}
+	ctx := context.Background()
+
+	allowed := `query Posts { posts { id } }`
+	require.NoError(t, store.Register(ctx, &PersistedOperation{TenantID: "t1", Query: allowed, Allowlisted: true}))
+	for i := 0; i < 3; i++ {
+		_, opErr := h.resolveOperation(ctx, ten, allowed, nil)
+		require.Nil(t, opErr)
+	}
+	assert.Equal(t, 1, store.gets, "allowlisted operations are looked up once")
+
+	unknown := `{ posts { title } }`
+	for i := 0; i < 3; i++ {
+		_, opErr := h.resolveOperation(ctx, ten, unknown, nil)
+		require.NotNil(t, opErr)
+	}
+	assert.Equal(t, 2, store.gets, "misses are cached too")
+
+	// Registering through the admin API invalidates the cached miss
+	require.NoError(t, store.Register(ctx, &PersistedOperation{TenantID: "t1", Query: unknown, Allowlisted: true}))
+	h.InvalidateOperation("t1", HashQuery(unknown))
+	_, opErr := h.resolveOperation(ctx, ten, unknown, nil)
+	require.Nil(t, opErr)
+	assert.Equal(t, 3, store.gets)
+}
+
+func TestOperationCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	var c operationCache
+	for i := 0; i < operationCacheSize; i++ {
+		c.put("t1", fmt.Sprint(i), &PersistedOperation{})
+	}
+	_, ok := c.get("t1", "0")
+	require.True(t, ok)
+	c.put("t1", "new", nil)
+
+	_, ok = c.get("t1", "0")
+	assert.True(t, ok, "recently used entries are kept")
+	_, ok = c.get("t1", "1")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	op, ok := c.get("t1", "new")
+	assert.True(t, ok)
+	assert.Nil(t, op, "misses are cached as nil")
+	assert.Equal(t, operationCacheSize, c.order.Len())
+}
+
+func TestParseRequest(t *testing.T) {
+	hash := HashQuery(`{ posts { id } }`)
+
+	values := url.Values{}
+	values.Set("operationName", "Posts")
+	values.Set("variables", `{"n":5}`)
+	values.Set("extensions", `{"persistedQuery":{"version":1,"sha256Hash":"`+hash+`"}}`)
+	req := parseRequest(httptest.NewRequest(http.MethodGet, "/graphql?"+values.Encode(), nil))
+	assert.Empty(t, req.Query)
+	assert.Equal(t, "Posts", req.OperationName)
+	assert.Equal(t, map[string]interface{}{"n": float64(5)}, req.Variables)
+	assert.Equal(t, hash, persistedQueryHash(req.Extensions))
+
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ posts { id } }","extensions":{"persistedQuery":{"sha256Hash":"`+hash+`"}}}`))
+	r.Header.Set("Content-Type", "application/json")
+	req = parseRequest(r)
+	assert.Equal(t, `{ posts { id } }`, req.Query)
+	assert.Equal(t, hash, persistedQueryHash(req.Extensions))
+
+	r = httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{ authors { id } }`))
+	r.Header.Set("Content-Type", "application/graphql")
+	assert.Equal(t, `{ authors { id } }`, parseRequest(r).Query)
+}
+
+func TestHandler_RejectsOperationsOutsideAllowlist(t *testing.T) {
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits(), operations: newMemoryOperationStore()}
+	h.schemaCache.Store("tenant_test", &cachedSchema{
+		schema:    complexityTestSchema(t),
+		expiresAt: time.Now().Add(time.Minute),
+	})
+
+	ten := &tenant.Tenant{ID: "t1", SchemaName: "tenant_test", StrictOperations: true}
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ posts { id } }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(tenant.WithTenant(req.Context(), ten))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Data   interface{}              `json:"data"`
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Nil(t, resp.Data)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, map[string]interface{}{"code": OperationNotAllowedCode}, resp.Errors[0]["extensions"])
+}
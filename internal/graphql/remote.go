@@ -0,0 +1,1262 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/printer"
+	"github.com/iancoleman/strcase"
+	"github.com/kapok/kapok/internal/database"
+	"github.com/kapok/kapok/internal/tenant"
+)
+
+const (
+	// DefaultRemoteSchemaTimeout bounds calls to remote schemas without a timeout
+	// of their own
+	DefaultRemoteSchemaTimeout = 30 * time.Second
+
+	// maxRemoteSchemaTimeout bounds the timeout a remote schema may declare
+	maxRemoteSchemaTimeout = 5 * time.Minute
+
+	// maxRemoteResponseSize bounds the response body of a remote schema (10 MB)
+	maxRemoteResponseSize = 10 << 20
+)
+
+// ErrRemoteSchemaNotFound is returned when a tenant has no remote schema of a name
+var ErrRemoteSchemaNotFound = errors.New("remote schema not found")
+
+// headerName matches HTTP header names
+var headerName = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// RedactedHeader replaces the values of stored headers in API responses, since
+// they usually carry credentials. Put back as a value, it keeps the stored one.
+const RedactedHeader = "[redacted]"
+
+// RedactHeaders returns a copy of headers with every value replaced by RedactedHeader
+func RedactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for name := range headers {
+		redacted[name] = RedactedHeader
+	}
+	return redacted
+}
+
+// RestoreHeaders replaces the RedactedHeader values of headers by the values
+// stored for them, so a redacted response can be edited and put back.
+func RestoreHeaders(headers, stored map[string]string) error {
+	for name, value := range headers {
+		if value != RedactedHeader {
+			continue
+		}
+		original, ok := stored[name]
+		if !ok {
+			return fmt.Errorf("header %s has no stored value", name)
+		}
+		headers[name] = original
+	}
+	return nil
+}
+
+// hasRedactedHeaders reports whether a header is sent as RedactedHeader
+func hasRedactedHeaders(headers map[string]string) bool {
+	for _, value := range headers {
+		if value == RedactedHeader {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteClient calls remote schemas; timeouts are set per call
+var remoteClient = &http.Client{}
+
+// RemoteSchema is a GraphQL service of a tenant whose root fields are merged into
+// the tenant's schema. FieldPrefix is put before the names of its root fields and
+// TypePrefix before the names of its types, so services with overlapping names
+// can be merged; built-in scalars keep their names.
+//
+// Calls are sent with Headers, the ForwardHeaders of the client's request and
+// the session variables as X-Kapok-* headers. Joins add fields to table types
+// that call a root query field of the service with arguments taken from the
+// row. On tenants with permissions, Roles lists the roles besides admin that
+// may use the service.
+type RemoteSchema struct {
+	TenantID       string            `json:"tenant_id"`
+	Name           string            `json:"name"`
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	ForwardHeaders []string          `json:"forward_headers,omitempty"`
+	FieldPrefix    string            `json:"field_prefix,omitempty"`
+	TypePrefix     string            `json:"type_prefix,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	Joins          []RemoteJoin      `json:"joins,omitempty"`
+	Roles          []string          `json:"roles,omitempty"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+
+	// introspection is the schema of the service, loaded before the tenant's
+	// schema is generated; services without one are left out
+	introspection *remoteIntrospection
+}
+
+// Redacted returns a copy of the remote schema for API responses, with its
+// header values replaced by RedactedHeader
+func (s *RemoteSchema) Redacted() *RemoteSchema {
+	redacted := *s
+	redacted.Headers = RedactHeaders(s.Headers)
+	return &redacted
+}
+
+// HasRedactedHeaders reports whether the values of some headers are to be
+// restored from the stored remote schema
+func (s *RemoteSchema) HasRedactedHeaders() bool {
+	return hasRedactedHeaders(s.Headers)
+}
+
+// RemoteJoin adds Field to the type of Table, resolved by the root query field
+// RemoteField of the remote schema. Arguments maps arguments of the remote field
+// to the columns of the row they are taken from, e.g. customerId: customer_id;
+// its other arguments are left to the client.
+type RemoteJoin struct {
+	Table       string            `json:"table"`
+	Field       string            `json:"field"`
+	RemoteField string            `json:"remote_field"`
+	Arguments   map[string]string `json:"arguments"`
+}
+
+// Validate checks the name, URL, prefixes, headers, timeout and joins of the
+// remote schema. Whether the joined tables and fields exist is checked when the
+// schema is generated.
+func (s *RemoteSchema) Validate() error {
+	if !validIdentifier.MatchString(s.Name) {
+		return fmt.Errorf("invalid remote schema name: %s", s.Name)
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, prefix := range []string{s.FieldPrefix, s.TypePrefix} {
+		if prefix != "" && (!graphQLName.MatchString(prefix) || strings.HasPrefix(prefix, "__")) {
+			return fmt.Errorf("invalid prefix: %s", prefix)
+		}
+	}
+	for name := range s.Headers {
+		if !headerName.MatchString(name) {
+			return fmt.Errorf("invalid header name: %s", name)
+		}
+	}
+	for _, name := range s.ForwardHeaders {
+		if !headerName.MatchString(name) {
+			return fmt.Errorf("invalid forwarded header name: %s", name)
+		}
+	}
+	if s.TimeoutSeconds < 0 || time.Duration(s.TimeoutSeconds)*time.Second > maxRemoteSchemaTimeout {
+		return fmt.Errorf("timeout_seconds must be between 0 and %d", int(maxRemoteSchemaTimeout/time.Second))
+	}
+	for _, role := range s.Roles {
+		if role == "" {
+			return fmt.Errorf("roles must not be empty")
+		}
+	}
+
+	seen := make(map[string]bool, len(s.Joins))
+	for _, j := range s.Joins {
+		if err := validateIdentifier(j.Table); err != nil {
+			return fmt.Errorf("invalid join table name: %s", j.Table)
+		}
+		if !graphQLName.MatchString(j.Field) || strings.HasPrefix(j.Field, "__") {
+			return fmt.Errorf("invalid join field name: %s", j.Field)
+		}
+		if seen[j.Table+"."+j.Field] {
+			return fmt.Errorf("duplicate join: %s.%s", j.Table, j.Field)
+		}
+		seen[j.Table+"."+j.Field] = true
+		if !graphQLName.MatchString(j.RemoteField) {
+			return fmt.Errorf("invalid remote field name: %s", j.RemoteField)
+		}
+		if len(j.Arguments) == 0 {
+			return fmt.Errorf("join %s.%s maps no arguments", j.Table, j.Field)
+		}
+		for arg, col := range j.Arguments {
+			if !graphQLName.MatchString(arg) {
+				return fmt.Errorf("invalid argument name: %s", arg)
+			}
+			if err := validateIdentifier(col); err != nil {
+				return fmt.Errorf("invalid column name: %s.%s", j.Table, col)
+			}
+		}
+	}
+	return nil
+}
+
+// timeout returns how long a call of the remote schema may take
+func (s *RemoteSchema) timeout() time.Duration {
+	if s.TimeoutSeconds <= 0 {
+		return DefaultRemoteSchemaTimeout
+	}
+	return time.Duration(s.TimeoutSeconds) * time.Second
+}
+
+// allows reports whether a role of a tenant with permissions may use the
+// remote schema
+func (s *RemoteSchema) allows(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the name of a remote type in the tenant's schema
+func (s *RemoteSchema) typeName(name string) string {
+	if builtinScalars[name] {
+		return name
+	}
+	return s.TypePrefix + name
+}
+
+// remoteTypeName returns the name of a type of the tenant's schema in the
+// remote schema
+func (s *RemoteSchema) remoteTypeName(name string) string {
+	if builtinScalars[name] {
+		return name
+	}
+	return strings.TrimPrefix(name, s.TypePrefix)
+}
+
+// remoteIntrospectionQuery loads the types of a remote schema
+const remoteIntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    types { ...FullType }
+  }
+}
+fragment FullType on __Type {
+  kind name description
+  fields(includeDeprecated: true) { name description args { ...InputValue } type { ...TypeRef } deprecationReason }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) { name description deprecationReason }
+  possibleTypes { ...TypeRef }
+}
+fragment InputValue on __InputValue { name description type { ...TypeRef } }
+fragment TypeRef on __Type {
+  kind name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } }
+}`
+
+// remoteIntrospection is the introspected schema of a remote service
+type remoteIntrospection struct {
+	QueryType    *remoteTypeRef `json:"queryType"`
+	MutationType *remoteTypeRef `json:"mutationType"`
+	Types        []remoteType   `json:"types"`
+}
+
+type remoteType struct {
+	Kind          string            `json:"kind"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Fields        []remoteField     `json:"fields"`
+	InputFields   []remoteArgument  `json:"inputFields"`
+	Interfaces    []remoteTypeRef   `json:"interfaces"`
+	EnumValues    []remoteEnumValue `json:"enumValues"`
+	PossibleTypes []remoteTypeRef   `json:"possibleTypes"`
+}
+
+type remoteField struct {
+	Name              string           `json:"name"`
+	Description       string           `json:"description"`
+	Args              []remoteArgument `json:"args"`
+	Type              remoteTypeRef    `json:"type"`
+	DeprecationReason string           `json:"deprecationReason"`
+}
+
+type remoteArgument struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Type        remoteTypeRef `json:"type"`
+}
+
+type remoteEnumValue struct {
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	DeprecationReason string `json:"deprecationReason"`
+}
+
+type remoteTypeRef struct {
+	Kind   string         `json:"kind"`
+	Name   string         `json:"name"`
+	OfType *remoteTypeRef `json:"ofType"`
+}
+
+// remoteResponse is a GraphQL response of a remote schema
+type remoteResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []remoteError          `json:"errors"`
+}
+
+type remoteError struct {
+	Message    string                 `json:"message"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// introspect loads the schema of the remote service
+func (s *RemoteSchema) introspect(ctx context.Context) error {
+	var resp struct {
+		Data struct {
+			Schema *remoteIntrospection `json:"__schema"`
+		} `json:"data"`
+		Errors []remoteError `json:"errors"`
+	}
+	if err := s.post(ctx, remoteIntrospectionQuery, nil, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("introspection failed: %s", resp.Errors[0].Message)
+	}
+	if resp.Data.Schema == nil || resp.Data.Schema.QueryType == nil {
+		return fmt.Errorf("introspection returned no schema")
+	}
+	s.introspection = resp.Data.Schema
+	return nil
+}
+
+// post sends a GraphQL document to the remote service with its headers and the
+// given ones, and decodes the response into out
+func (s *RemoteSchema) post(ctx context.Context, query string, header http.Header, out interface{}) error {
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := remoteClient.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		var data []byte
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxRemoteResponseSize+1))
+		if err == nil && len(data) > maxRemoteResponseSize {
+			err = fmt.Errorf("response exceeds %d bytes", maxRemoteResponseSize)
+		}
+		// GraphQL servers may answer errors with a 4xx status and a GraphQL body
+		if err == nil && json.Unmarshal(data, out) != nil {
+			err = fmt.Errorf("remote schema responded with status %d and no GraphQL response", resp.StatusCode)
+		}
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// requestHeader returns the headers a call on behalf of a client is sent with:
+// the client's headers listed in ForwardHeaders, the session variables and the
+// correlation ID. Clients cannot forward X-Kapok-* headers of their own.
+func (s *RemoteSchema) requestHeader(ctx context.Context) http.Header {
+	header := make(http.Header)
+	client := clientHeader(ctx)
+	for _, name := range s.ForwardHeaders {
+		if values := client.Values(name); len(values) > 0 && !strings.HasPrefix(strings.ToLower(name), "x-kapok-") {
+			header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	for name, value := range actionSessionVariables(ctx) {
+		header.Set(name, value)
+	}
+	header.Set(CorrelationHeader, correlationID(ctx))
+	return header
+}
+
+type clientHeaderKey struct{}
+
+// withClientHeader keeps the headers of a client's request for remote schemas
+func withClientHeader(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, clientHeaderKey{}, header)
+}
+
+// clientHeader returns the headers of the client's request, if any
+func clientHeader(ctx context.Context) http.Header {
+	header, _ := ctx.Value(clientHeaderKey{}).(http.Header)
+	return header
+}
+
+// remoteTypes builds the types of a remote schema under their names in the
+// tenant's schema. Every type is built before the schema is, so resolvers only
+// read the map.
+type remoteTypes struct {
+	remote *RemoteSchema
+	defs   map[string]*remoteType
+	types  map[string]graphql.Type
+}
+
+// newRemoteTypes checks the type references of an introspected schema and builds
+// its types, except the root types which are only built when referenced
+func newRemoteTypes(remote *RemoteSchema) (*remoteTypes, error) {
+	b := &remoteTypes{
+		remote: remote,
+		defs:   make(map[string]*remoteType),
+		types:  make(map[string]graphql.Type),
+	}
+	for i := range remote.introspection.Types {
+		def := &remote.introspection.Types[i]
+		if !strings.HasPrefix(def.Name, "__") {
+			b.defs[def.Name] = def
+		}
+	}
+
+	check := func(ref remoteTypeRef) error {
+		for ref.OfType != nil {
+			ref = *ref.OfType
+		}
+		if b.defs[ref.Name] == nil && !builtinScalars[ref.Name] {
+			return fmt.Errorf("remote schema %s: unknown type %s", remote.Name, ref.Name)
+		}
+		return nil
+	}
+	for _, def := range b.defs {
+		for _, f := range def.Fields {
+			if err := check(f.Type); err != nil {
+				return nil, err
+			}
+			for _, arg := range f.Args {
+				if err := check(arg.Type); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, f := range def.InputFields {
+			if err := check(f.Type); err != nil {
+				return nil, err
+			}
+		}
+		for _, ref := range append(append([]remoteTypeRef{}, def.Interfaces...), def.PossibleTypes...) {
+			if err := check(ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, root := range []*remoteTypeRef{remote.introspection.QueryType, remote.introspection.MutationType} {
+		if root != nil && b.defs[root.Name] == nil {
+			return nil, fmt.Errorf("remote schema %s: unknown root type %s", remote.Name, root.Name)
+		}
+	}
+
+	roots := map[string]bool{remote.introspection.QueryType.Name: true}
+	if remote.introspection.MutationType != nil {
+		roots[remote.introspection.MutationType.Name] = true
+	}
+	for name := range b.defs {
+		if !roots[name] {
+			b.named(name)
+		}
+	}
+	return b, nil
+}
+
+// all returns the built types, sorted by name
+func (b *remoteTypes) all() []graphql.Type {
+	types := make([]graphql.Type, 0, len(b.types))
+	for _, t := range b.types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name() < types[j].Name() })
+	return types
+}
+
+// ref returns the type a checked type reference refers to
+func (b *remoteTypes) ref(ref remoteTypeRef) graphql.Type {
+	switch ref.Kind {
+	case "NON_NULL":
+		return graphql.NewNonNull(b.ref(*ref.OfType))
+	case "LIST":
+		return graphql.NewList(b.ref(*ref.OfType))
+	}
+	return b.named(ref.Name)
+}
+
+// named returns the type of a name, building it when first asked for
+func (b *remoteTypes) named(name string) graphql.Type {
+	if t, ok := b.types[name]; ok {
+		return t
+	}
+	switch name {
+	case "String":
+		return graphql.String
+	case "Int":
+		return graphql.Int
+	case "Float":
+		return graphql.Float
+	case "Boolean":
+		return graphql.Boolean
+	case "ID":
+		return graphql.ID
+	}
+
+	def := b.defs[name]
+	typeName := b.remote.typeName(name)
+	var t graphql.Type
+	switch def.Kind {
+	case "SCALAR":
+		// Scalars named like Kapok's, e.g. DateTime, are Kapok's
+		t = remoteScalar(typeName, def.Description)
+		if s := kapokScalar(typeName); s != nil {
+			t = s
+		}
+	case "ENUM":
+		values := graphql.EnumValueConfigMap{}
+		for _, v := range def.EnumValues {
+			values[v.Name] = &graphql.EnumValueConfig{Value: v.Name, Description: v.Description, DeprecationReason: v.DeprecationReason}
+		}
+		t = graphql.NewEnum(graphql.EnumConfig{Name: typeName, Description: def.Description, Values: values})
+	case "INPUT_OBJECT":
+		t = graphql.NewInputObject(graphql.InputObjectConfig{
+			Name:        typeName,
+			Description: def.Description,
+			Fields: (graphql.InputObjectConfigFieldMapThunk)(func() graphql.InputObjectConfigFieldMap {
+				fields := graphql.InputObjectConfigFieldMap{}
+				for _, f := range def.InputFields {
+					fields[f.Name] = &graphql.InputObjectFieldConfig{Type: b.ref(f.Type).(graphql.Input), Description: f.Description}
+				}
+				return fields
+			}),
+		})
+	case "OBJECT":
+		t = graphql.NewObject(graphql.ObjectConfig{
+			Name:        typeName,
+			Description: def.Description,
+			Fields:      b.fields(def),
+			Interfaces: (graphql.InterfacesThunk)(func() []*graphql.Interface {
+				interfaces := make([]*graphql.Interface, 0, len(def.Interfaces))
+				for _, ref := range def.Interfaces {
+					if iface, ok := b.named(ref.Name).(*graphql.Interface); ok {
+						interfaces = append(interfaces, iface)
+					}
+				}
+				return interfaces
+			}),
+		})
+	case "INTERFACE":
+		t = graphql.NewInterface(graphql.InterfaceConfig{
+			Name:        typeName,
+			Description: def.Description,
+			Fields:      b.fields(def),
+			ResolveType: b.resolveType,
+		})
+	case "UNION":
+		t = graphql.NewUnion(graphql.UnionConfig{
+			Name:        typeName,
+			Description: def.Description,
+			Types: (graphql.UnionTypesThunk)(func() []*graphql.Object {
+				members := make([]*graphql.Object, 0, len(def.PossibleTypes))
+				for _, ref := range def.PossibleTypes {
+					if obj, ok := b.named(ref.Name).(*graphql.Object); ok {
+						members = append(members, obj)
+					}
+				}
+				return members
+			}),
+			ResolveType: b.resolveType,
+		})
+	default:
+		t = remoteScalar(typeName, def.Description)
+	}
+	b.types[name] = t
+	return t
+}
+
+// fields returns the fields of an object or interface, read from the response
+// under their response keys since forwarded selections keep their aliases
+func (b *remoteTypes) fields(def *remoteType) graphql.FieldsThunk {
+	return func() graphql.Fields {
+		fields := graphql.Fields{}
+		for _, f := range def.Fields {
+			fields[f.Name] = &graphql.Field{
+				Type:              b.ref(f.Type).(graphql.Output),
+				Args:              b.args(f.Args),
+				Description:       f.Description,
+				DeprecationReason: f.DeprecationReason,
+				Resolve:           resolveRemoteField,
+			}
+		}
+		return fields
+	}
+}
+
+func (b *remoteTypes) args(args []remoteArgument) graphql.FieldConfigArgument {
+	config := graphql.FieldConfigArgument{}
+	for _, arg := range args {
+		config[arg.Name] = &graphql.ArgumentConfig{Type: b.ref(arg.Type).(graphql.Input), Description: arg.Description}
+	}
+	return config
+}
+
+// resolveType picks the object type of an abstract value by the __typename the
+// forwarded selection asks for
+func (b *remoteTypes) resolveType(p graphql.ResolveTypeParams) *graphql.Object {
+	source, _ := p.Value.(map[string]interface{})
+	name, _ := source["__typename"].(string)
+	obj, _ := b.types[name].(*graphql.Object)
+	return obj
+}
+
+func resolveRemoteField(p graphql.ResolveParams) (interface{}, error) {
+	source, _ := p.Source.(map[string]interface{})
+	key, _ := p.Info.Path.Key.(string)
+	return source[key], nil
+}
+
+// kapokScalar returns the custom scalar Kapok defines under a name, if any
+func kapokScalar(name string) *graphql.Scalar {
+	for _, s := range []*graphql.Scalar{JSONScalar, DateTimeScalar, DateScalar, BigIntScalar, DecimalScalar, UUIDScalar, BytesScalar} {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// remoteScalar is a custom scalar of a remote schema, passed through as is
+func remoteScalar(name, description string) *graphql.Scalar {
+	identity := func(value interface{}) interface{} { return value }
+	return graphql.NewScalar(graphql.ScalarConfig{
+		Name:         name,
+		Description:  description,
+		Serialize:    identity,
+		ParseValue:   identity,
+		ParseLiteral: remoteLiteral,
+	})
+}
+
+// remoteLiteral parses a literal of a remote scalar; it is printed back from the
+// document when the field is forwarded
+func remoteLiteral(value ast.Value) interface{} {
+	switch v := value.(type) {
+	case *ast.ObjectValue:
+		obj := make(map[string]interface{}, len(v.Fields))
+		for _, f := range v.Fields {
+			obj[f.Name.Value] = remoteLiteral(f.Value)
+		}
+		return obj
+	case *ast.ListValue:
+		items := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			items[i] = remoteLiteral(item)
+		}
+		return items
+	}
+	return value.GetValue()
+}
+
+// addRemoteSchemas adds the root fields of the remote schemas to the Query and
+// Mutation roots and their joins to joins, keyed by table. It returns the remote
+// types, which the schema must include so abstract types can be resolved.
+func (g *SchemaGenerator) addRemoteSchemas(remotes []RemoteSchema, tableMap map[string]Table, queryFields, mutationFields graphql.Fields, joins map[string]graphql.Fields) ([]graphql.Type, error) {
+	definedBy := make(map[string]string)
+	for name := range tableMap {
+		definedBy[strcase.ToCamel(name)] = "table " + name
+	}
+
+	var types []graphql.Type
+	for i := range remotes {
+		remote := &remotes[i]
+		if remote.introspection == nil {
+			continue
+		}
+		b, err := newRemoteTypes(remote)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range b.all() {
+			if kapokScalar(t.Name()) != nil {
+				continue
+			}
+			if other, ok := definedBy[t.Name()]; ok {
+				return nil, fmt.Errorf("remote schema %s: type %s is already defined by %s", remote.Name, t.Name(), other)
+			}
+			definedBy[t.Name()] = "remote schema " + remote.Name
+		}
+
+		roots := []struct {
+			name      string
+			operation string
+			ref       *remoteTypeRef
+			fields    graphql.Fields
+		}{
+			{"Query", "query", remote.introspection.QueryType, queryFields},
+			{"Mutation", "mutation", remote.introspection.MutationType, mutationFields},
+		}
+		for _, root := range roots {
+			if root.ref == nil {
+				continue
+			}
+			for _, f := range b.defs[root.ref.Name].Fields {
+				name := remote.FieldPrefix + f.Name
+				if root.fields[name] != nil {
+					return nil, fmt.Errorf("remote schema %s: field %s conflicts with an existing %s field", remote.Name, name, root.name)
+				}
+				root.fields[name] = &graphql.Field{
+					Type:              b.ref(f.Type).(graphql.Output),
+					Args:              b.args(f.Args),
+					Description:       f.Description,
+					DeprecationReason: f.DeprecationReason,
+					Resolve:           g.resolver.ResolveRemote(remote, root.operation, f.Name),
+				}
+			}
+		}
+
+		for _, j := range remote.Joins {
+			field, err := g.remoteJoinField(remote, b, tableMap, j)
+			if err != nil {
+				return nil, err
+			}
+			if joins[j.Table] == nil {
+				joins[j.Table] = graphql.Fields{}
+			}
+			if joins[j.Table][j.Field] != nil {
+				return nil, fmt.Errorf("remote schema %s: join %s.%s is already defined", remote.Name, j.Table, j.Field)
+			}
+			joins[j.Table][j.Field] = field
+		}
+		types = append(types, b.all()...)
+	}
+	return types, nil
+}
+
+// remoteJoinField builds the field of a join, taking the remote field's
+// arguments the join does not map. The field is nullable since rows missing a
+// mapped value join nothing.
+func (g *SchemaGenerator) remoteJoinField(remote *RemoteSchema, b *remoteTypes, tableMap map[string]Table, j RemoteJoin) (*graphql.Field, error) {
+	table, ok := tableMap[j.Table]
+	if !ok {
+		return nil, fmt.Errorf("remote schema %s: join table %s not found", remote.Name, j.Table)
+	}
+	var target *remoteField
+	for i, f := range b.defs[remote.introspection.QueryType.Name].Fields {
+		if f.Name == j.RemoteField {
+			target = &b.defs[remote.introspection.QueryType.Name].Fields[i]
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("remote schema %s: query field %s not found", remote.Name, j.RemoteField)
+	}
+
+	columns := make(map[string]bool, len(table.Columns))
+	for _, col := range table.Columns {
+		columns[col.Name] = true
+	}
+	remoteArgs := b.args(target.Args)
+	mapped := make(map[string]graphql.Input, len(j.Arguments))
+	for arg, col := range j.Arguments {
+		config, ok := remoteArgs[arg]
+		if !ok {
+			return nil, fmt.Errorf("remote schema %s: field %s has no argument %s", remote.Name, j.RemoteField, arg)
+		}
+		if !columns[col] {
+			return nil, fmt.Errorf("remote schema %s: column %s.%s not found", remote.Name, j.Table, col)
+		}
+		mapped[arg] = config.Type
+		delete(remoteArgs, arg)
+	}
+
+	output := b.ref(target.Type)
+	if nonNull, ok := output.(*graphql.NonNull); ok {
+		output = nonNull.OfType
+	}
+	return &graphql.Field{
+		Type:        output.(graphql.Output),
+		Args:        remoteArgs,
+		Description: target.Description,
+		Resolve:     g.resolver.ResolveRemoteJoin(remote, j, mapped),
+	}, nil
+}
+
+// RemoteSchemaError is a failed remote schema call as reported to clients.
+// Errors the service reports keep their message, and their code when it is
+// well-formed; calls that fail otherwise are reported with REMOTE_SCHEMA_FAILED
+// or TIMEOUT and logged under CorrelationID.
+type RemoteSchemaError struct {
+	RemoteSchema  string
+	Code          string
+	Message       string
+	CorrelationID string
+}
+
+func (e *RemoteSchemaError) Error() string {
+	return e.Message
+}
+
+// Extensions reports the error details in the GraphQL error's extensions
+func (e *RemoteSchemaError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code, "remoteSchema": e.RemoteSchema}
+	if e.CorrelationID != "" {
+		ext["correlationId"] = e.CorrelationID
+	}
+	return ext
+}
+
+// ResolveRemote returns a function that forwards a root field to its remote
+// schema. The field is printed back with its selection under its response key,
+// with variables inlined and type conditions named as the service names them.
+func (r *Resolver) ResolveRemote(remote *RemoteSchema, operation, fieldName string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return r.callRemote(p, remote, operation, fieldName, nil)
+	}
+}
+
+// ResolveRemoteJoin returns a function that calls the remote field of a join
+// with the mapped arguments taken from the row; rows missing a value join
+// nothing. Each row is one call.
+func (r *Resolver) ResolveRemoteJoin(remote *RemoteSchema, join RemoteJoin, mapped map[string]graphql.Input) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		row, _ := p.Source.(map[string]interface{})
+		fixed := make(map[string]string, len(join.Arguments))
+		for arg, col := range join.Arguments {
+			value := row[strcase.ToLowerCamel(col)]
+			if value == nil {
+				return nil, nil
+			}
+			fixed[arg] = printValue(mapped[arg], value)
+		}
+		return r.callRemote(p, remote, "query", join.RemoteField, fixed)
+	}
+}
+
+func (r *Resolver) callRemote(p graphql.ResolveParams, remote *RemoteSchema, operation, fieldName string, fixed map[string]string) (interface{}, error) {
+	key, _ := p.Info.Path.Key.(string)
+	def := compositeFields(p.Info.ParentType)[p.Info.FieldName]
+	if def == nil {
+		return nil, fmt.Errorf("field not found")
+	}
+	w := &remotePrinter{
+		remote:    remote,
+		schema:    p.Info.Schema,
+		fragments: p.Info.Fragments,
+		variables: p.Info.VariableValues,
+	}
+	query := operation + " { " + w.field(key, fieldName, def, p.Info.FieldASTs, fixed) + " }"
+
+	var resp remoteResponse
+	if err := remote.post(p.Context, query, remote.requestHeader(p.Context), &resp); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, r.remoteError(p.Context, remote, TimeoutCode, fmt.Sprintf("remote schema %s timed out", remote.Name), err)
+		}
+		return nil, r.remoteError(p.Context, remote, RemoteSchemaFailedCode, fmt.Sprintf("remote schema %s failed", remote.Name), err)
+	}
+	if len(resp.Errors) > 0 {
+		reported := resp.Errors[0]
+		code := RemoteSchemaFailedCode
+		if c, _ := reported.Extensions["code"].(string); actionErrorCode.MatchString(c) {
+			code = c
+		}
+		message := reported.Message
+		if message == "" {
+			message = fmt.Sprintf("remote schema %s failed", remote.Name)
+		}
+		return nil, r.remoteError(p.Context, remote, code, message, fmt.Errorf("remote schema reported %d errors", len(resp.Errors)))
+	}
+	return resp.Data[key], nil
+}
+
+// remoteError logs a failed call under the request's correlation ID and returns
+// the error clients see
+func (r *Resolver) remoteError(ctx context.Context, remote *RemoteSchema, code, message string, cause error) error {
+	e := &RemoteSchemaError{RemoteSchema: remote.Name, Code: code, Message: message, CorrelationID: correlationID(ctx)}
+	r.logger.Warn().
+		Err(cause).
+		Str("remote_schema", remote.Name).
+		Str("code", code).
+		Str("correlation_id", e.CorrelationID).
+		Msg("remote schema call failed")
+	return e
+}
+
+// compositeFields returns the fields of an object or interface type
+func compositeFields(t graphql.Type) graphql.FieldDefinitionMap {
+	switch t := t.(type) {
+	case *graphql.Object:
+		return t.Fields()
+	case *graphql.Interface:
+		return t.Fields()
+	}
+	return nil
+}
+
+// remotePrinter prints the selection of a forwarded field as the remote service
+// reads it
+type remotePrinter struct {
+	remote    *RemoteSchema
+	schema    graphql.Schema
+	fragments map[string]ast.Definition
+	variables map[string]interface{}
+}
+
+// field prints a field under its response key, with the fixed arguments, those
+// of the document and the merged selection of its ASTs
+func (w *remotePrinter) field(key, name string, def *graphql.FieldDefinition, fields []*ast.Field, fixed map[string]string) string {
+	var b strings.Builder
+	if key != name {
+		b.WriteString(key + ": ")
+	}
+	b.WriteString(name)
+
+	argTypes := make(map[string]graphql.Input, len(def.Args))
+	for _, arg := range def.Args {
+		argTypes[arg.Name()] = arg.Type
+	}
+	var args []string
+	for _, name := range sortedStringKeys(fixed) {
+		args = append(args, name+": "+fixed[name])
+	}
+	if len(fields) > 0 {
+		for _, arg := range fields[0].Arguments {
+			// Unset variables leave the argument to the service's default
+			if v, ok := arg.Value.(*ast.Variable); ok {
+				if _, set := w.variables[v.Name.Value]; !set {
+					continue
+				}
+			}
+			args = append(args, arg.Name.Value+": "+w.value(argTypes[arg.Name.Value], arg.Value))
+		}
+	}
+	if len(args) > 0 {
+		b.WriteString("(" + strings.Join(args, ", ") + ")")
+	}
+
+	var sets []*ast.SelectionSet
+	for _, f := range fields {
+		if f.SelectionSet != nil {
+			sets = append(sets, f.SelectionSet)
+		}
+	}
+	if len(sets) > 0 {
+		b.WriteString(" " + w.selectionSet(def.Type, sets))
+	}
+	return b.String()
+}
+
+// selectionSet prints selections on a type; abstract types also select
+// __typename so the object type can be resolved
+func (w *remotePrinter) selectionSet(t graphql.Type, sets []*ast.SelectionSet) string {
+	named, _ := graphql.GetNamed(t).(graphql.Type)
+	fields := compositeFields(named)
+
+	var parts []string
+	for _, set := range sets {
+		for _, sel := range set.Selections {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				if !w.included(sel.Directives) {
+					continue
+				}
+				name, key := sel.Name.Value, sel.Name.Value
+				if sel.Alias != nil {
+					key = sel.Alias.Value
+				}
+				if name == "__typename" {
+					if key != name {
+						name = key + ": " + name
+					}
+					parts = append(parts, name)
+					continue
+				}
+				if def := fields[name]; def != nil {
+					parts = append(parts, w.field(key, name, def, []*ast.Field{sel}, nil))
+				}
+			case *ast.InlineFragment:
+				if !w.included(sel.Directives) {
+					continue
+				}
+				cond, prefix := named, "..."
+				if sel.TypeCondition != nil {
+					cond = w.schema.Type(sel.TypeCondition.Name.Value)
+					prefix = "... on " + w.remote.remoteTypeName(sel.TypeCondition.Name.Value)
+				}
+				parts = append(parts, prefix+" "+w.selectionSet(cond, []*ast.SelectionSet{sel.SelectionSet}))
+			case *ast.FragmentSpread:
+				if !w.included(sel.Directives) {
+					continue
+				}
+				def, ok := w.fragments[sel.Name.Value].(*ast.FragmentDefinition)
+				if !ok {
+					continue
+				}
+				name := def.TypeCondition.Name.Value
+				parts = append(parts, "... on "+w.remote.remoteTypeName(name)+" "+
+					w.selectionSet(w.schema.Type(name), []*ast.SelectionSet{def.SelectionSet}))
+			}
+		}
+	}
+	switch named.(type) {
+	case *graphql.Interface, *graphql.Union:
+		parts = append(parts, "__typename")
+	}
+	return "{ " + strings.Join(parts, " ") + " }"
+}
+
+// value prints an argument value, inlining variables
+func (w *remotePrinter) value(t graphql.Input, v ast.Value) string {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	switch v := v.(type) {
+	case *ast.Variable:
+		return printValue(t, w.variables[v.Name.Value])
+	case *ast.ListValue:
+		var item graphql.Input
+		if list, ok := t.(*graphql.List); ok {
+			item = list.OfType
+		}
+		items := make([]string, len(v.Values))
+		for i, value := range v.Values {
+			items[i] = w.value(item, value)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *ast.ObjectValue:
+		fields := make([]string, len(v.Fields))
+		for i, f := range v.Fields {
+			var field graphql.Input
+			if object, ok := t.(*graphql.InputObject); ok && object.Fields()[f.Name.Value] != nil {
+				field = object.Fields()[f.Name.Value].Type
+			}
+			fields[i] = f.Name.Value + ": " + w.value(field, f.Value)
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return fmt.Sprint(printer.Print(v))
+}
+
+// included evaluates the @skip and @include directives of a selection
+func (w *remotePrinter) included(directives []*ast.Directive) bool {
+	for _, d := range directives {
+		if d.Name.Value != "skip" && d.Name.Value != "include" {
+			continue
+		}
+		cond := false
+		for _, arg := range d.Arguments {
+			if arg.Name.Value != "if" {
+				continue
+			}
+			switch v := arg.Value.(type) {
+			case *ast.BooleanValue:
+				cond = v.Value
+			case *ast.Variable:
+				cond, _ = w.variables[v.Name.Value].(bool)
+			}
+		}
+		if (d.Name.Value == "skip") == cond {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// introspectRemoteSchemas introspects remote schemas concurrently and returns
+// those that answered; the others are logged and left out
+func (h *Handler) introspectRemoteSchemas(ctx context.Context, stored []*RemoteSchema) []RemoteSchema {
+	// A client's cancelled request must not leave its tenant without them
+	ctx = context.WithoutCancel(ctx)
+
+	errs := make([]error, len(stored))
+	var wg sync.WaitGroup
+	for i, remote := range stored {
+		wg.Add(1)
+		go func(i int, remote *RemoteSchema) {
+			defer wg.Done()
+			errs[i] = remote.introspect(ctx)
+		}(i, remote)
+	}
+	wg.Wait()
+
+	var remotes []RemoteSchema
+	for i, remote := range stored {
+		if errs[i] != nil {
+			h.logger.Warn().Err(errs[i]).
+				Str("tenant_id", remote.TenantID).
+				Str("remote_schema", remote.Name).
+				Msg("remote schema introspection failed, leaving it out")
+			continue
+		}
+		remotes = append(remotes, *remote)
+	}
+	return remotes
+}
+
+// CheckRemoteSchema introspects the remote schema and generates the tenant's
+// schema with it added to its remote schemas, or replacing the one of its name,
+// and reports why it cannot be merged
+func (h *Handler) CheckRemoteSchema(ctx context.Context, t *tenant.Tenant, remote *RemoteSchema) error {
+	if err := remote.introspect(ctx); err != nil {
+		return fmt.Errorf("remote schema %s: %w", remote.Name, err)
+	}
+	existing, err := h.getRemoteSchemas(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	var remotes []RemoteSchema
+	for _, s := range existing {
+		if s.Name != remote.Name {
+			remotes = append(remotes, s)
+		}
+	}
+	remotes = append(remotes, *remote)
+
+	actions, err := h.getActions(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	metadata, err := h.introspector.Inspect(ctx, t.SchemaName)
+	if err != nil {
+		return fmt.Errorf("introspection failed: %w", err)
+	}
+	metadata.Actions = actions
+	metadata.RemoteSchemas = remotes
+	_, err = h.generator.Generate(t.SchemaName, metadata)
+	return err
+}
+
+// RemoteSchemaStore loads the remote schemas of tenants
+type RemoteSchemaStore interface {
+	List(ctx context.Context, tenantID string) ([]*RemoteSchema, error)
+}
+
+// RemoteSchemaRepository stores remote schemas in the control database
+type RemoteSchemaRepository struct {
+	db *database.DB
+}
+
+// NewRemoteSchemaRepository creates a new remote schema repository
+func NewRemoteSchemaRepository(db *database.DB) *RemoteSchemaRepository {
+	return &RemoteSchemaRepository{db: db}
+}
+
+// List returns the remote schemas of a tenant, ordered by name
+func (r *RemoteSchemaRepository) List(ctx context.Context, tenantID string) ([]*RemoteSchema, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT tenant_id, name, definition, updated_at
+		FROM tenant_remote_schemas WHERE tenant_id = $1
+		ORDER BY name
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote schemas: %w", err)
+	}
+	defer rows.Close()
+
+	var remotes []*RemoteSchema
+	for rows.Next() {
+		s, err := scanRemoteSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		remotes = append(remotes, s)
+	}
+	return remotes, rows.Err()
+}
+
+// Get returns one remote schema of a tenant
+func (r *RemoteSchemaRepository) Get(ctx context.Context, tenantID, name string) (*RemoteSchema, error) {
+	s, err := scanRemoteSchema(r.db.QueryRowContext(ctx, `
+		SELECT tenant_id, name, definition, updated_at
+		FROM tenant_remote_schemas WHERE tenant_id = $1 AND name = $2
+	`, tenantID, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteSchemaNotFound, name)
+	}
+	return s, err
+}
+
+// Put creates or replaces a remote schema
+func (r *RemoteSchemaRepository) Put(ctx context.Context, s *RemoteSchema) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	definition, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode remote schema: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO tenant_remote_schemas (tenant_id, name, definition)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, name) DO UPDATE SET definition = EXCLUDED.definition, updated_at = NOW()
+		RETURNING updated_at
+	`, s.TenantID, s.Name, definition).Scan(&s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save remote schema: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a remote schema
+func (r *RemoteSchemaRepository) Delete(ctx context.Context, tenantID, name string) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM tenant_remote_schemas WHERE tenant_id = $1 AND name = $2
+	`, tenantID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete remote schema: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrRemoteSchemaNotFound, name)
+	}
+	return nil
+}
+
+// scanRemoteSchema reads a remote schema; the key columns win over the stored
+// definition
+func scanRemoteSchema(row rowScanner) (*RemoteSchema, error) {
+	s := &RemoteSchema{}
+	var tenantID, name string
+	var definition []byte
+	var updatedAt time.Time
+	if err := row.Scan(&tenantID, &name, &definition, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan remote schema: %w", err)
+	}
+	if err := json.Unmarshal(definition, s); err != nil {
+		return nil, fmt.Errorf("failed to decode remote schema: %w", err)
+	}
+	s.TenantID, s.Name, s.UpdatedAt = tenantID, name, updatedAt
+	return s, nil
+}
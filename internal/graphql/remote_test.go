@@ -0,0 +1,528 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// billingError is an error of the billing service with a code
+type billingError struct{ code string }
+
+func (e billingError) Error() string { return "invoice is already paid" }
+
+func (e billingError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// billingSchema is the schema of a GraphQL service merged in the tests
+func billingSchema(t *testing.T) graphql.Schema {
+	t.Helper()
+	invoices := []map[string]interface{}{
+		{"id": "inv-1", "customerId": 3, "amount": 12.5, "status": "OPEN", "issuedAt": "2026-01-02T03:04:05Z", "meta": map[string]interface{}{"currency": "EUR"}},
+		{"id": "inv-2", "customerId": 3, "amount": 7.0, "status": "PAID"},
+		{"id": "inv-3", "customerId": 4, "amount": 1.0, "status": "OPEN"},
+	}
+	status := graphql.NewEnum(graphql.EnumConfig{
+		Name: "InvoiceStatus",
+		Values: graphql.EnumValueConfigMap{
+			"OPEN": &graphql.EnumValueConfig{Value: "OPEN"},
+			"PAID": &graphql.EnumValueConfig{Value: "PAID"},
+		},
+	})
+	identity := func(v interface{}) interface{} { return v }
+	literal := func(v ast.Value) interface{} { return v.GetValue() }
+	dateTime := graphql.NewScalar(graphql.ScalarConfig{Name: "DateTime", Serialize: identity, ParseValue: identity, ParseLiteral: literal})
+	money := graphql.NewScalar(graphql.ScalarConfig{Name: "Money", Description: "An amount with its currency", Serialize: identity, ParseValue: identity, ParseLiteral: literal})
+
+	var invoice *graphql.Object
+	node := graphql.NewInterface(graphql.InterfaceConfig{
+		Name:   "Node",
+		Fields: graphql.Fields{"id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)}},
+		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+			return invoice
+		},
+	})
+	invoice = graphql.NewObject(graphql.ObjectConfig{
+		Name:       "Invoice",
+		Interfaces: []*graphql.Interface{node},
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"customerId": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"amount":     &graphql.Field{Type: graphql.NewNonNull(graphql.Float), Description: "Amount due"},
+			"status":     &graphql.Field{Type: graphql.NewNonNull(status)},
+			"issuedAt":   &graphql.Field{Type: dateTime},
+			"meta":       &graphql.Field{Type: money},
+		},
+	})
+
+	find := func(id interface{}) interface{} {
+		for _, inv := range invoices {
+			if inv["id"] == id {
+				return inv
+			}
+		}
+		return nil
+	}
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"invoices": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(invoice))),
+					Description: "Invoices of a customer",
+					Args: graphql.FieldConfigArgument{
+						"customerId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+						"status":     &graphql.ArgumentConfig{Type: status},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						var out []interface{}
+						for _, inv := range invoices {
+							if inv["customerId"] == p.Args["customerId"] && (p.Args["status"] == nil || inv["status"] == p.Args["status"]) {
+								out = append(out, inv)
+							}
+						}
+						return out, nil
+					},
+				},
+				"node": &graphql.Field{
+					Type: node,
+					Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return find(p.Args["id"]), nil
+					},
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"payInvoice": &graphql.Field{
+					Type: invoice,
+					Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						inv, _ := find(p.Args["id"]).(map[string]interface{})
+						if inv["status"] == "PAID" {
+							return nil, billingError{code: "ALREADY_PAID"}
+						}
+						return map[string]interface{}{"id": inv["id"], "customerId": inv["customerId"], "amount": inv["amount"], "status": "PAID"}, nil
+					},
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	return schema
+}
+
+// billingService serves the billing schema and records the documents and
+// headers it was sent, introspection aside
+type billingService struct {
+	mu      sync.Mutex
+	queries []string
+	headers []http.Header
+}
+
+func (s *billingService) calls() ([]string, []http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.queries...), append([]http.Header{}, s.headers...)
+}
+
+func newBillingService(t *testing.T) (*httptest.Server, *billingService) {
+	t.Helper()
+	schema := billingSchema(t)
+	service := &billingService{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Query != remoteIntrospectionQuery {
+			service.mu.Lock()
+			service.queries = append(service.queries, req.Query)
+			service.headers = append(service.headers, r.Header.Clone())
+			service.mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(graphql.Do(graphql.Params{Schema: schema, RequestString: req.Query, Context: r.Context()}))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, service
+}
+
+func billingRemote(t *testing.T, url string) RemoteSchema {
+	t.Helper()
+	remote := RemoteSchema{
+		Name:           "billing",
+		URL:            url,
+		Headers:        map[string]string{"X-Billing-Key": "k3y"},
+		ForwardHeaders: []string{"Authorization", "X-Kapok-User-Id"},
+		FieldPrefix:    "billing_",
+		TypePrefix:     "Billing",
+		Joins: []RemoteJoin{{
+			Table:       "authors",
+			Field:       "invoices",
+			RemoteField: "invoices",
+			Arguments:   map[string]string{"customerId": "id"},
+		}},
+	}
+	require.NoError(t, remote.Validate())
+	require.NoError(t, remote.introspect(context.Background()))
+	return remote
+}
+
+func remoteTestSchema(t *testing.T, remotes ...RemoteSchema) *graphql.Schema {
+	t.Helper()
+	tables := orderTestTables()
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables:        []Table{tables["authors"], tables["posts"]},
+		RemoteSchemas: remotes,
+	})
+	require.NoError(t, err)
+	return schema
+}
+
+// remoteContext is a client's request context: the tenant, the session and the
+// request's headers
+func remoteContext() context.Context {
+	ctx := tenant.WithTenant(context.Background(), &tenant.Tenant{ID: "t1", SchemaName: "tenant_test"})
+	ctx = withCorrelationID(ctx, "req-1")
+	ctx = withClientHeader(ctx, http.Header{
+		"Authorization":   {"Bearer client"},
+		"Cookie":          {"session=1"},
+		"X-Kapok-User-Id": {"1"},
+	})
+	return WithSession(ctx, &Session{Role: "author"})
+}
+
+func TestRemoteSchema_Validate(t *testing.T) {
+	valid := func() RemoteSchema {
+		return RemoteSchema{
+			Name:  "billing",
+			URL:   "https://billing.internal/graphql",
+			Joins: []RemoteJoin{{Table: "authors", Field: "invoices", RemoteField: "invoices", Arguments: map[string]string{"customerId": "id"}}},
+		}
+	}
+	s := valid()
+	require.NoError(t, s.Validate())
+	assert.Equal(t, DefaultRemoteSchemaTimeout, s.timeout())
+
+	tests := []struct {
+		name   string
+		modify func(s *RemoteSchema)
+		want   string
+	}{
+		{"name", func(s *RemoteSchema) { s.Name = "bill-ing" }, "invalid remote schema name"},
+		{"url", func(s *RemoteSchema) { s.URL = "billing.internal" }, "url must be"},
+		{"field prefix", func(s *RemoteSchema) { s.FieldPrefix = "billing-" }, "invalid prefix"},
+		{"type prefix", func(s *RemoteSchema) { s.TypePrefix = "__B" }, "invalid prefix"},
+		{"header", func(s *RemoteSchema) { s.Headers = map[string]string{"X Key": "v"} }, "invalid header name"},
+		{"forwarded header", func(s *RemoteSchema) { s.ForwardHeaders = []string{"Author:ization"} }, "invalid forwarded header name"},
+		{"timeout", func(s *RemoteSchema) { s.TimeoutSeconds = -1 }, "timeout_seconds"},
+		{"role", func(s *RemoteSchema) { s.Roles = []string{""} }, "roles must not be empty"},
+		{"join table", func(s *RemoteSchema) { s.Joins[0].Table = "authors;" }, "invalid join table name"},
+		{"join field", func(s *RemoteSchema) { s.Joins[0].Field = "in voices" }, "invalid join field name"},
+		{"duplicate join", func(s *RemoteSchema) { s.Joins = append(s.Joins, s.Joins[0]) }, "duplicate join"},
+		{"remote field", func(s *RemoteSchema) { s.Joins[0].RemoteField = "" }, "invalid remote field name"},
+		{"no arguments", func(s *RemoteSchema) { s.Joins[0].Arguments = nil }, "maps no arguments"},
+		{"column", func(s *RemoteSchema) { s.Joins[0].Arguments = map[string]string{"customerId": "id;"} }, "invalid column name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.modify(&s)
+			err := s.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestRemoteSchema_Redacted(t *testing.T) {
+	s := &RemoteSchema{Name: "billing", URL: "https://billing.internal/graphql", Headers: map[string]string{"Authorization": "Bearer secret"}}
+
+	redacted := s.Redacted()
+	assert.Equal(t, map[string]string{"Authorization": RedactedHeader}, redacted.Headers)
+	assert.Equal(t, "Bearer secret", s.Headers["Authorization"], "the stored remote schema is left as is")
+	assert.Nil(t, (&RemoteSchema{}).Redacted().Headers)
+
+	// A redacted response put back keeps the stored values
+	redacted.Headers["X-Api-Version"] = "2"
+	require.True(t, redacted.HasRedactedHeaders())
+	require.NoError(t, RestoreHeaders(redacted.Headers, s.Headers))
+	assert.Equal(t, map[string]string{"Authorization": "Bearer secret", "X-Api-Version": "2"}, redacted.Headers)
+	assert.False(t, redacted.HasRedactedHeaders())
+
+	err := RestoreHeaders(map[string]string{"X-Key": RedactedHeader}, s.Headers)
+	assert.EqualError(t, err, "header X-Key has no stored value")
+}
+
+func TestSchemaGenerator_RemoteSchemas(t *testing.T) {
+	srv, _ := newBillingService(t)
+	schema := remoteTestSchema(t, billingRemote(t, srv.URL))
+
+	// Root fields and types are prefixed
+	invoices := schema.QueryType().Fields()["billing_invoices"]
+	require.NotNil(t, invoices)
+	assert.Equal(t, "[BillingInvoice!]!", invoices.Type.String())
+	assert.Equal(t, "Invoices of a customer", invoices.Description)
+	assert.Equal(t, "BillingNode", schema.QueryType().Fields()["billing_node"].Type.String())
+	assert.Equal(t, "BillingInvoice", schema.MutationType().Fields()["billing_payInvoice"].Type.String())
+	assert.NotNil(t, schema.QueryType().Fields()["posts"])
+
+	invoice, ok := schema.Type("BillingInvoice").(*graphql.Object)
+	require.True(t, ok)
+	assert.Equal(t, "BillingInvoiceStatus!", invoice.Fields()["status"].Type.String())
+	assert.Equal(t, "Amount due", invoice.Fields()["amount"].Description)
+	require.Len(t, invoice.Interfaces(), 1)
+	assert.Equal(t, "BillingNode", invoice.Interfaces()[0].Name())
+	assert.Equal(t, "BillingDateTime", invoice.Fields()["issuedAt"].Type.String())
+	assert.Equal(t, "An amount with its currency", schema.Type("BillingMoney").Description())
+
+	// Joins take the remote field's arguments the row does not provide
+	join := schema.Type("Authors").(*graphql.Object).Fields()["invoices"]
+	require.NotNil(t, join)
+	assert.Equal(t, "[BillingInvoice!]", join.Type.String())
+	require.Len(t, join.Args, 1)
+	assert.Equal(t, "status", join.Args[0].Name())
+
+	assert.Contains(t, PrintSchema(schema), "billing_invoices(customerId: Int!, status: BillingInvoiceStatus): [BillingInvoice!]!")
+}
+
+func TestSchemaGenerator_RemoteSchemaScalars(t *testing.T) {
+	srv, _ := newBillingService(t)
+	remote := billingRemote(t, srv.URL)
+	remote.TypePrefix = ""
+
+	// Unprefixed scalars named like Kapok's are Kapok's
+	schema := remoteTestSchema(t, remote)
+	assert.Same(t, DateTimeScalar, schema.Type("DateTime"))
+	assert.Equal(t, "Node", schema.QueryType().Fields()["billing_node"].Type.String())
+	assert.Equal(t, "DateTime", schema.Type("Invoice").(*graphql.Object).Fields()["issuedAt"].Type.String())
+}
+
+func TestSchemaGenerator_RemoteSchemaErrors(t *testing.T) {
+	srv, _ := newBillingService(t)
+	tables := orderTestTables()
+	generate := func(remotes ...RemoteSchema) error {
+		_, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+			Tables:        []Table{tables["authors"], tables["posts"]},
+			RemoteSchemas: remotes,
+		})
+		return err
+	}
+
+	tests := []struct {
+		name    string
+		remotes func() []RemoteSchema
+		want    string
+	}{
+		{"root field", func() []RemoteSchema {
+			a, b := billingRemote(t, srv.URL), billingRemote(t, srv.URL)
+			b.Name, b.TypePrefix, b.Joins = "billing2", "Billing2", nil
+			return []RemoteSchema{a, b}
+		}, "field billing_invoices conflicts with an existing Query field"},
+		{"type", func() []RemoteSchema {
+			a, b := billingRemote(t, srv.URL), billingRemote(t, srv.URL)
+			b.Name, b.FieldPrefix, b.Joins = "billing2", "billing2_", nil
+			return []RemoteSchema{a, b}
+		}, "remote schema billing2: type BillingDateTime is already defined by remote schema billing"},
+		{"join table", func() []RemoteSchema {
+			a := billingRemote(t, srv.URL)
+			a.Joins[0].Table = "customers"
+			return []RemoteSchema{a}
+		}, "join table customers not found"},
+		{"join remote field", func() []RemoteSchema {
+			a := billingRemote(t, srv.URL)
+			a.Joins[0].RemoteField = "customers"
+			return []RemoteSchema{a}
+		}, "query field customers not found"},
+		{"join argument", func() []RemoteSchema {
+			a := billingRemote(t, srv.URL)
+			a.Joins[0].Arguments = map[string]string{"accountId": "id"}
+			return []RemoteSchema{a}
+		}, "field invoices has no argument accountId"},
+		{"join column", func() []RemoteSchema {
+			a := billingRemote(t, srv.URL)
+			a.Joins[0].Arguments = map[string]string{"customerId": "customer_id"}
+			return []RemoteSchema{a}
+		}, "column authors.customer_id not found"},
+		{"join field", func() []RemoteSchema {
+			a := billingRemote(t, srv.URL)
+			a.Joins[0].Field = "name"
+			return []RemoteSchema{a}
+		}, "remote joins conflict with existing fields: Authors.name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := generate(tt.remotes()...)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	// Remote schemas that could not be introspected are left out
+	assert.NoError(t, generate(RemoteSchema{Name: "down", URL: "http://127.0.0.1:1"}))
+}
+
+func TestResolveRemote(t *testing.T) {
+	srv, service := newBillingService(t)
+	schema := remoteTestSchema(t, billingRemote(t, srv.URL))
+
+	result := graphql.Do(graphql.Params{
+		Schema: *schema,
+		RequestString: `query($status: BillingInvoiceStatus, $skip: Boolean!) {
+			open: billing_invoices(customerId: 3, status: $status) { id amount status ...Dates meta @skip(if: $skip) }
+			billing_node(id: "inv-1") { id ... on BillingInvoice { total: amount } }
+		}
+		fragment Dates on BillingInvoice { issuedAt }`,
+		VariableValues: map[string]interface{}{"status": "OPEN", "skip": true},
+		Context:        remoteContext(),
+	})
+	require.Empty(t, result.Errors)
+	assert.Equal(t, map[string]interface{}{
+		"open": []interface{}{
+			map[string]interface{}{"id": "inv-1", "amount": 12.5, "status": "OPEN", "issuedAt": "2026-01-02T03:04:05Z"},
+		},
+		"billing_node": map[string]interface{}{"id": "inv-1", "total": 12.5},
+	}, result.Data)
+
+	// Fields are forwarded unprefixed with their selection, variables inlined;
+	// root fields resolve in no particular order
+	queries, headers := service.calls()
+	assert.ElementsMatch(t, []string{
+		`query { open: invoices(customerId: 3, status: OPEN) { id amount status ... on Invoice { issuedAt } } }`,
+		`query { billing_node: node(id: "inv-1") { id ... on Invoice { total: amount } __typename } }`,
+	}, queries)
+
+	// Calls carry the service's headers, the forwarded ones and the session
+	h := headers[0]
+	assert.Equal(t, "k3y", h.Get("X-Billing-Key"))
+	assert.Equal(t, "Bearer client", h.Get("Authorization"))
+	assert.Empty(t, h.Get("Cookie"), "only listed headers are forwarded")
+	assert.Empty(t, h.Get("X-Kapok-User-Id"), "clients cannot forward session headers")
+	assert.Equal(t, "author", h.Get("X-Kapok-Role"))
+	assert.Equal(t, "t1", h.Get("X-Kapok-Tenant-Id"))
+	assert.Equal(t, "req-1", h.Get(CorrelationHeader))
+
+	// Mutations are forwarded as mutations
+	result = graphql.Do(graphql.Params{
+		Schema:        *schema,
+		RequestString: `mutation { billing_payInvoice(id: "inv-1") { id status } }`,
+		Context:       remoteContext(),
+	})
+	require.Empty(t, result.Errors)
+	assert.Equal(t, map[string]interface{}{"billing_payInvoice": map[string]interface{}{"id": "inv-1", "status": "PAID"}}, result.Data)
+	queries, _ = service.calls()
+	assert.Equal(t, `mutation { billing_payInvoice: payInvoice(id: "inv-1") { id status } }`, queries[len(queries)-1])
+}
+
+func TestResolveRemoteJoin(t *testing.T) {
+	srv, service := newBillingService(t)
+	schema := remoteTestSchema(t, billingRemote(t, srv.URL))
+
+	// Serve author rows without a database
+	authors := schema.Type("Authors").(*graphql.Object)
+	rows, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"authors": &graphql.Field{
+					Type: graphql.NewList(authors),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return []interface{}{
+							map[string]interface{}{"id": int64(3), "name": "Ada"},
+							map[string]interface{}{"id": nil, "name": "Nobody"},
+						}, nil
+					},
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+
+	result := graphql.Do(graphql.Params{
+		Schema:        rows,
+		RequestString: `{ authors { name invoices(status: PAID) { id amount } } }`,
+		Context:       remoteContext(),
+	})
+	require.Empty(t, result.Errors)
+	assert.Equal(t, map[string]interface{}{"authors": []interface{}{
+		map[string]interface{}{"name": "Ada", "invoices": []interface{}{map[string]interface{}{"id": "inv-2", "amount": 7.0}}},
+		map[string]interface{}{"name": "Nobody", "invoices": nil},
+	}}, result.Data)
+
+	// The row's column fills the mapped argument; rows without one join nothing
+	queries, _ := service.calls()
+	assert.Equal(t, []string{`query { invoices(customerId: 3, status: PAID) { id amount } }`}, queries)
+}
+
+func TestResolveRemote_Errors(t *testing.T) {
+	srv, _ := newBillingService(t)
+	remote := billingRemote(t, srv.URL)
+	schema := remoteTestSchema(t, remote)
+
+	extensions := func(result *graphql.Result) map[string]interface{} {
+		require.Len(t, result.Errors, 1)
+		return gqlerrors.FormatError(result.Errors[0]).Extensions
+	}
+
+	// Errors the service reports keep their message and code
+	result := graphql.Do(graphql.Params{
+		Schema:        *schema,
+		RequestString: `mutation { billing_payInvoice(id: "inv-2") { id } }`,
+		Context:       remoteContext(),
+	})
+	ext := extensions(result)
+	assert.Equal(t, "invoice is already paid", result.Errors[0].Message)
+	assert.Equal(t, "ALREADY_PAID", ext["code"])
+	assert.Equal(t, "billing", ext["remoteSchema"])
+	assert.Equal(t, "req-1", ext["correlationId"])
+
+	// Services that cannot be reached fail with REMOTE_SCHEMA_FAILED
+	srv.Close()
+	result = graphql.Do(graphql.Params{
+		Schema:        *schema,
+		RequestString: `{ billing_invoices(customerId: 3) { id } }`,
+		Context:       remoteContext(),
+	})
+	ext = extensions(result)
+	assert.Equal(t, "remote schema billing failed", result.Errors[0].Message)
+	assert.Equal(t, RemoteSchemaFailedCode, ext["code"])
+}
+
+func TestRolePermissions_ApplyRemoteSchemas(t *testing.T) {
+	allowed := RemoteSchema{
+		Name:  "billing",
+		Roles: []string{"author"},
+		Joins: []RemoteJoin{
+			{Table: "posts", Field: "invoices", Arguments: map[string]string{"customerId": "author_id"}},
+			{Table: "posts", Field: "drafts", Arguments: map[string]string{"createdAt": "created_at"}},
+			{Table: "authors", Field: "invoices", Arguments: map[string]string{"customerId": "id"}},
+		},
+	}
+	hidden := RemoteSchema{Name: "payroll"}
+
+	tables := orderTestTables()
+	metadata := authorPermissions().apply(&SchemaMetadata{
+		Tables:        []Table{tables["authors"], tables["posts"]},
+		RemoteSchemas: []RemoteSchema{allowed, hidden},
+	})
+	require.Len(t, metadata.RemoteSchemas, 1)
+	assert.Equal(t, "billing", metadata.RemoteSchemas[0].Name)
+	// Joins need the table and the columns they read to be visible
+	require.Len(t, metadata.RemoteSchemas[0].Joins, 1)
+	assert.Equal(t, "posts", metadata.RemoteSchemas[0].Joins[0].Table)
+	assert.Equal(t, "invoices", metadata.RemoteSchemas[0].Joins[0].Field)
+}
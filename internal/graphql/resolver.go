@@ -1,14 +1,17 @@
 package graphql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/graphql-go/graphql"
 	"github.com/iancoleman/strcase"
 	"github.com/kapok/kapok/internal/database"
+	"github.com/rs/zerolog"
 )
 
 const (
@@ -31,26 +34,69 @@ func validateIdentifier(name string) error {
 
 // Resolver handles GraphQL query execution against the database
 type Resolver struct {
-	db *database.DB
+	db     *database.DB
+	logger zerolog.Logger
+
+	// Subscriptions share one LISTEN connection, opened on first use
+	notifierOnce sync.Once
+	changes      *database.Notifier
+
+	// Tables with a change trigger installed, per schema
+	triggerMu sync.Mutex
+	triggers  map[string]map[string]bool
 }
 
 // NewResolver creates a new resolver
 func NewResolver(db *database.DB) *Resolver {
-	return &Resolver{db: db}
+	return &Resolver{db: db, triggers: make(map[string]map[string]bool)}
+}
+
+// Close releases the LISTEN connection used by subscriptions, if one was opened
+func (r *Resolver) Close() error {
+	if r.changes == nil {
+		return nil
+	}
+	return r.changes.Close()
 }
 
 // ResolveList returns a function that resolves a list of records from a table
-func (r *Resolver) ResolveList(schemaName, tableName string) graphql.FieldResolveFn {
+func (r *Resolver) ResolveList(schemaName string, tables map[string]Table, table Table) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		// Validate identifiers to prevent SQL injection
 		if err := validateIdentifier(schemaName); err != nil {
 			return nil, fmt.Errorf("invalid schema name")
 		}
-		if err := validateIdentifier(tableName); err != nil {
+		if err := validateIdentifier(table.Name); err != nil {
 			return nil, fmt.Errorf("invalid table name")
 		}
 
-		query := fmt.Sprintf(`SELECT * FROM "%s"."%s"`, schemaName, tableName)
+		// Rows hidden by the role's row filter are never selected
+		args := &queryArgs{}
+		source, err := tableSource(p.Context, schemaName, table, args)
+		if err != nil {
+			return nil, err
+		}
+		query := "SELECT * FROM " + source
+
+		// Apply where filter as parameterised conditions
+		if where, ok := p.Args["where"].(map[string]interface{}); ok {
+			cond, err := buildWhere(table, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if cond != "" {
+				query += " WHERE " + cond
+			}
+		}
+
+		// Apply order_by, validated against the introspected columns
+		orderBy, err := buildOrderBy(p.Context, schemaName, tables, table, p.Args["order_by"], args)
+		if err != nil {
+			return nil, err
+		}
+		if orderBy != "" {
+			query += " ORDER BY " + orderBy
+		}
 
 		// Apply limit with defaults and maximum cap
 		limit, _ := p.Args["limit"].(int)
@@ -68,9 +114,9 @@ func (r *Resolver) ResolveList(schemaName, tableName string) graphql.FieldResolv
 			query += fmt.Sprintf(" OFFSET %d", offset)
 		}
 
-		rows, err := r.db.QueryContext(p.Context, query)
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
 		if err != nil {
-			return nil, fmt.Errorf("query failed")
+			return nil, r.dbError(p.Context, err, "query failed")
 		}
 		defer rows.Close()
 
@@ -79,29 +125,31 @@ func (r *Resolver) ResolveList(schemaName, tableName string) graphql.FieldResolv
 }
 
 // ResolveGet returns a function that resolves a single record by primary key
-func (r *Resolver) ResolveGet(schemaName, tableName string, pkName string) graphql.FieldResolveFn {
+func (r *Resolver) ResolveGet(schemaName string, table Table, pk []string) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		// Validate identifiers to prevent SQL injection
 		if err := validateIdentifier(schemaName); err != nil {
 			return nil, fmt.Errorf("invalid schema name")
 		}
-		if err := validateIdentifier(tableName); err != nil {
+		if err := validateIdentifier(table.Name); err != nil {
 			return nil, fmt.Errorf("invalid table name")
 		}
-		if err := validateIdentifier(pkName); err != nil {
-			return nil, fmt.Errorf("invalid primary key name")
-		}
 
-		id, ok := p.Args[pkName]
-		if !ok {
-			return nil, fmt.Errorf("argument %s is required", pkName)
+		args := &queryArgs{}
+		source, err := tableSource(p.Context, schemaName, table, args)
+		if err != nil {
+			return nil, err
+		}
+		cond, err := keyCondition(pk, p.Args, args)
+		if err != nil {
+			return nil, err
 		}
 
-		query := fmt.Sprintf(`SELECT * FROM "%s"."%s" WHERE "%s" = $1`, schemaName, tableName, pkName)
+		query := fmt.Sprintf(`SELECT * FROM %s WHERE %s`, source, cond)
 
-		rows, err := r.db.QueryContext(p.Context, query, id)
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
 		if err != nil {
-			return nil, fmt.Errorf("query failed")
+			return nil, r.dbError(p.Context, err, "query failed")
 		}
 		defer rows.Close()
 
@@ -117,93 +165,58 @@ func (r *Resolver) ResolveGet(schemaName, tableName string, pkName string) graph
 	}
 }
 
-// ResolveCreate returns a function that inserts a new record
-func (r *Resolver) ResolveCreate(schemaName, tableName string, columns []string) graphql.FieldResolveFn {
+// ResolveCreate returns a function that inserts a new record, together with any
+// nested belongsTo/hasMany records, in a single transaction
+func (r *Resolver) ResolveCreate(schemaName string, tables map[string]Table, table Table) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		// Validate identifiers to prevent SQL injection
 		if err := validateIdentifier(schemaName); err != nil {
 			return nil, fmt.Errorf("invalid schema name")
 		}
-		if err := validateIdentifier(tableName); err != nil {
+		if err := validateIdentifier(table.Name); err != nil {
 			return nil, fmt.Errorf("invalid table name")
 		}
 
-		var cols []string
-		var vals []interface{}
-		var placeholders []string
-
-		argIdx := 1
-		for _, col := range columns {
-			// Validate column name
-			if err := validateIdentifier(col); err != nil {
-				continue // Skip invalid column names
-			}
-			// Convert column name (snake_case) to argument name (camelCase)
-			argName := strcase.ToLowerCamel(col)
-			if val, ok := p.Args[argName]; ok {
-				cols = append(cols, fmt.Sprintf(`"%s"`, col))
-				vals = append(vals, val)
-				placeholders = append(placeholders, fmt.Sprintf("$%d", argIdx))
-				argIdx++
-			}
-		}
-
-		if len(cols) == 0 {
+		if len(p.Args) == 0 {
 			return nil, fmt.Errorf("no arguments provided")
 		}
 
-		query := fmt.Sprintf(
-			`INSERT INTO "%s"."%s" (%s) VALUES (%s) RETURNING *`,
-			schemaName, tableName,
-			strings.Join(cols, ", "),
-			strings.Join(placeholders, ", "),
-		)
-
-		rows, err := r.db.QueryContext(p.Context, query, vals...)
+		var row map[string]interface{}
+		err := r.inTx(p.Context, func(tx *sql.Tx) error {
+			var err error
+			row, err = r.insertNested(p.Context, tx, schemaName, tables, table, p.Args, nil)
+			return err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("insert failed")
-		}
-		defer rows.Close()
-
-		results, err := r.scanRows(rows)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read results")
-		}
-
-		if len(results) == 0 {
-			return nil, fmt.Errorf("failed to insert record")
+			return nil, err
 		}
-		return results[0], nil
+		return row, nil
 	}
 }
 
 // ResolveUpdate returns a function that updates an existing record by primary key
-func (r *Resolver) ResolveUpdate(schemaName, tableName, pkName string, columns []string) graphql.FieldResolveFn {
+func (r *Resolver) ResolveUpdate(schemaName string, table Table, pk []string, columns []string) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		// Validate identifiers to prevent SQL injection
 		if err := validateIdentifier(schemaName); err != nil {
 			return nil, fmt.Errorf("invalid schema name")
 		}
-		if err := validateIdentifier(tableName); err != nil {
+		if err := validateIdentifier(table.Name); err != nil {
 			return nil, fmt.Errorf("invalid table name")
 		}
-		if err := validateIdentifier(pkName); err != nil {
-			return nil, fmt.Errorf("invalid primary key name")
-		}
 
-		// Get primary key value
-		id, ok := p.Args[pkName]
-		if !ok {
-			return nil, fmt.Errorf("argument %s is required", pkName)
+		isKey := make(map[string]bool, len(pk))
+		for _, col := range pk {
+			isKey[col] = true
 		}
 
+		args := &queryArgs{}
 		var setClauses []string
-		var vals []interface{}
-		argIdx := 1
+		set := make(map[string]interface{})
 
 		for _, col := range columns {
-			// Skip primary key in SET clause
-			if col == pkName {
+			// Skip primary key columns in SET clause
+			if isKey[col] {
 				continue
 			}
 			// Validate column name
@@ -213,35 +226,68 @@ func (r *Resolver) ResolveUpdate(schemaName, tableName, pkName string, columns [
 			// Convert column name (snake_case) to argument name (camelCase)
 			argName := strcase.ToLowerCamel(col)
 			if val, ok := p.Args[argName]; ok {
-				setClauses = append(setClauses, fmt.Sprintf(`"%s" = $%d`, col, argIdx))
-				vals = append(vals, val)
-				argIdx++
+				setClauses = append(setClauses, fmt.Sprintf(`"%s" = %s`, col, args.add(val)))
+				set[col] = val
 			}
 		}
 
 		if len(setClauses) == 0 {
 			return nil, fmt.Errorf("no fields to update")
 		}
+		if bump := versionBump(table, set); bump != "" {
+			setClauses = append(setClauses, bump)
+		}
 
-		// Add ID as the last parameter
-		vals = append(vals, id)
+		// The key parameters follow the SET values
+		cond, err := keyCondition(pk, p.Args, args)
+		if err != nil {
+			return nil, err
+		}
+
+		// Optimistic locking: only update the row if its version is the expected one
+		version := versionColumn(table)
+		var expected interface{}
+		if version != nil {
+			expected = p.Args[expectedVersionArg(version)]
+		}
+		if expected != nil {
+			cond += fmt.Sprintf(` AND "%s" = %s`, version.Name, args.add(expected))
+		}
+
+		// Only rows the role can see may be updated, and they must stay visible
+		filter, err := rowFilter(p.Context, table, args)
+		if err != nil {
+			return nil, err
+		}
+		if filter != "" {
+			cond += " AND " + filter
+		}
 
 		query := fmt.Sprintf(
-			`UPDATE "%s"."%s" SET %s WHERE "%s" = $%d RETURNING *`,
-			schemaName, tableName,
+			`UPDATE "%s"."%s" SET %s WHERE %s RETURNING *`,
+			schemaName, table.Name,
 			strings.Join(setClauses, ", "),
-			pkName, argIdx,
+			cond,
 		)
-
-		rows, err := r.db.QueryContext(p.Context, query, vals...)
+		query, err = withRowCheck(p.Context, table, query, args)
 		if err != nil {
-			return nil, fmt.Errorf("update failed")
+			return nil, err
 		}
-		defer rows.Close()
 
-		results, err := r.scanRows(rows)
+		var results []map[string]interface{}
+		err = r.inTx(p.Context, func(tx *sql.Tx) error {
+			var err error
+			results, err = r.queryTx(p.Context, tx, query, args.values)
+			if err != nil {
+				return r.dbError(p.Context, err, "update failed")
+			}
+			if len(results) == 0 && expected != nil {
+				return r.checkConflict(p.Context, tx, schemaName, table, pk, p.Args, version)
+			}
+			return checkRows(table, results)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to read results")
+			return nil, err
 		}
 
 		if len(results) == 0 {
@@ -251,30 +297,58 @@ func (r *Resolver) ResolveUpdate(schemaName, tableName, pkName string, columns [
 	}
 }
 
+// checkConflict tells a row that no longer has its expected version apart from
+// a missing one, after an update with an expected version changed nothing
+func (r *Resolver) checkConflict(ctx context.Context, tx *sql.Tx, schemaName string, table Table, pk []string, key map[string]interface{}, version *Column) error {
+	args := &queryArgs{}
+	from, err := tableSource(ctx, schemaName, table, args)
+	if err != nil {
+		return err
+	}
+	cond, err := keyCondition(pk, key, args)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE %s)`, from, cond)
+	if err := tx.QueryRowContext(ctx, query, args.values...).Scan(&exists); err != nil {
+		return r.dbError(ctx, err, "update failed")
+	}
+	if exists {
+		return &ConflictError{Table: table.Name, Column: version.Name}
+	}
+	return nil
+}
+
 // ResolveDelete returns a function that deletes a record by primary key
-func (r *Resolver) ResolveDelete(schemaName, tableName, pkName string) graphql.FieldResolveFn {
+func (r *Resolver) ResolveDelete(schemaName string, table Table, pk []string) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		// Validate identifiers to prevent SQL injection
 		if err := validateIdentifier(schemaName); err != nil {
 			return nil, fmt.Errorf("invalid schema name")
 		}
-		if err := validateIdentifier(tableName); err != nil {
+		if err := validateIdentifier(table.Name); err != nil {
 			return nil, fmt.Errorf("invalid table name")
 		}
-		if err := validateIdentifier(pkName); err != nil {
-			return nil, fmt.Errorf("invalid primary key name")
-		}
 
-		id, ok := p.Args[pkName]
-		if !ok {
-			return nil, fmt.Errorf("argument %s is required", pkName)
+		args := &queryArgs{}
+		cond, err := keyCondition(pk, p.Args, args)
+		if err != nil {
+			return nil, err
+		}
+		filter, err := rowFilter(p.Context, table, args)
+		if err != nil {
+			return nil, err
+		}
+		if filter != "" {
+			cond += " AND " + filter
 		}
 
-		query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "%s" = $1 RETURNING *`, schemaName, tableName, pkName)
+		query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE %s RETURNING *`, schemaName, table.Name, cond)
 
-		rows, err := r.db.QueryContext(p.Context, query, id)
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
 		if err != nil {
-			return nil, fmt.Errorf("delete failed")
+			return nil, r.dbError(p.Context, err, "delete failed")
 		}
 		defer rows.Close()
 
@@ -292,13 +366,13 @@ func (r *Resolver) ResolveDelete(schemaName, tableName, pkName string) graphql.F
 
 // ResolveRelation returns a function that resolves a belongsTo relation (FK -> parent)
 // Example: post.author where post has author_id FK pointing to users.id
-func (r *Resolver) ResolveRelation(schemaName, foreignTable, foreignColumn, localColumn string) graphql.FieldResolveFn {
+func (r *Resolver) ResolveRelation(schemaName string, foreignTable Table, foreignColumn, localColumn string) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		// Validate identifiers
 		if err := validateIdentifier(schemaName); err != nil {
 			return nil, fmt.Errorf("invalid schema name")
 		}
-		if err := validateIdentifier(foreignTable); err != nil {
+		if err := validateIdentifier(foreignTable.Name); err != nil {
 			return nil, fmt.Errorf("invalid table name")
 		}
 		if err := validateIdentifier(foreignColumn); err != nil {
@@ -318,12 +392,22 @@ func (r *Resolver) ResolveRelation(schemaName, foreignTable, foreignColumn, loca
 			return nil, nil
 		}
 
-		query := fmt.Sprintf(`SELECT * FROM "%s"."%s" WHERE "%s" = $1 LIMIT 1`,
-			schemaName, foreignTable, foreignColumn)
+		// Batch with sibling resolvers when a request loader is available
+		if loader := loaderFromContext(p.Context); loader != nil {
+			return r.loadRelation(p, loader, schemaName, foreignTable, foreignColumn, fkValue)
+		}
+
+		args := &queryArgs{}
+		from, err := tableSource(p.Context, schemaName, foreignTable, args)
+		if err != nil {
+			return nil, err
+		}
+		query := fmt.Sprintf(`SELECT * FROM %s WHERE "%s" = %s LIMIT 1`,
+			from, foreignColumn, args.add(fkValue))
 
-		rows, err := r.db.QueryContext(p.Context, query, fkValue)
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
 		if err != nil {
-			return nil, fmt.Errorf("relation query failed")
+			return nil, r.dbError(p.Context, err, "relation query failed")
 		}
 		defer rows.Close()
 
@@ -341,13 +425,13 @@ func (r *Resolver) ResolveRelation(schemaName, foreignTable, foreignColumn, loca
 
 // ResolveHasMany returns a function that resolves a hasMany relation (parent -> children)
 // Example: user.posts where posts have user_id FK pointing to users.id
-func (r *Resolver) ResolveHasMany(schemaName, childTable, childColumn, parentColumn string) graphql.FieldResolveFn {
+func (r *Resolver) ResolveHasMany(schemaName string, tables map[string]Table, childTable Table, childColumn, parentColumn string) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		// Validate identifiers
 		if err := validateIdentifier(schemaName); err != nil {
 			return nil, fmt.Errorf("invalid schema name")
 		}
-		if err := validateIdentifier(childTable); err != nil {
+		if err := validateIdentifier(childTable.Name); err != nil {
 			return nil, fmt.Errorf("invalid table name")
 		}
 		if err := validateIdentifier(childColumn); err != nil {
@@ -378,16 +462,46 @@ func (r *Resolver) ResolveHasMany(schemaName, childTable, childColumn, parentCol
 			limit = MaxLimit
 		}
 
-		query := fmt.Sprintf(`SELECT * FROM "%s"."%s" WHERE "%s" = $1 LIMIT %d`,
-			schemaName, childTable, childColumn, limit)
+		// Batch with sibling resolvers when a request loader is available
+		if loader := loaderFromContext(p.Context); loader != nil {
+			return r.loadHasMany(p, loader, schemaName, tables, childTable, childColumn, pkValue, limit, offset)
+		}
 
+		args := &queryArgs{}
+		from, err := tableSource(p.Context, schemaName, childTable, args)
+		if err != nil {
+			return nil, err
+		}
+		query := fmt.Sprintf(`SELECT * FROM %s WHERE "%s" = %s`,
+			from, childColumn, args.add(pkValue))
+
+		// Narrow the children with the optional where filter
+		if where, ok := p.Args["where"].(map[string]interface{}); ok {
+			cond, err := buildWhere(childTable, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if cond != "" {
+				query += " AND " + cond
+			}
+		}
+
+		orderBy, err := buildOrderBy(p.Context, schemaName, tables, childTable, p.Args["order_by"], args)
+		if err != nil {
+			return nil, err
+		}
+		if orderBy != "" {
+			query += " ORDER BY " + orderBy
+		}
+
+		query += fmt.Sprintf(" LIMIT %d", limit)
 		if offset > 0 {
 			query += fmt.Sprintf(" OFFSET %d", offset)
 		}
 
-		rows, err := r.db.QueryContext(p.Context, query, pkValue)
+		rows, err := r.conn(p.Context).QueryContext(p.Context, query, args.values...)
 		if err != nil {
-			return nil, fmt.Errorf("has many query failed")
+			return nil, r.dbError(p.Context, err, "has many query failed")
 		}
 		defer rows.Close()
 
@@ -423,22 +537,10 @@ func (r *Resolver) scanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
 
 		entry := make(map[string]interface{})
 		for i, col := range colNames {
-			val := values[i]
 			// Convert column name to camelCase to match GraphQL fields
 			key := strcase.ToLowerCamel(col)
-			
-			if b, ok := val.([]byte); ok {
-				typeName := colTypes[i].DatabaseTypeName()
-				switch typeName {
-				case "BOOL", "bool":
-					s := string(b)
-					entry[key] = (s == "t" || s == "true" || s == "1" || s == "YES")
-				default:
-					entry[key] = string(b)
-				}
-			} else {
-				entry[key] = val
-			}
+			// Decode driver values (jsonb, arrays, ...) for the column's GraphQL type
+			entry[key] = decodeValue(colTypes[i].DatabaseTypeName(), values[i])
 		}
 		results = append(results, entry)
 	}
@@ -0,0 +1,518 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/iancoleman/strcase"
+	"github.com/kapok/kapok/internal/tenant"
+)
+
+// restListParams are the query parameters of REST list requests that are not
+// column filters
+var restListParams = map[string]bool{
+	"limit": true, "offset": true, "where": true, "order_by": true, "order": true, "search": true,
+}
+
+// restError is a failed REST request; the body carries the code and details
+// like GraphQL error extensions do
+type restError struct {
+	status     int
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *restError) Error() string {
+	return e.message
+}
+
+func newRESTError(status int, code, message string) *restError {
+	return &restError{status: status, message: message, extensions: map[string]interface{}{"code": code}}
+}
+
+// ServeREST serves the REST endpoints of a tenant's tables, the ones the
+// TypeScript SDK calls: GET and POST on /{table}, GET, PUT, PATCH and DELETE on
+// /{table}/{key}. key is the row's primary key, its columns separated by commas
+// and each escaped for the path; it is empty for the table itself.
+//
+// Requests run as operations on the caller's role schema, so they are resolved,
+// restricted, limited and reported like the equivalent GraphQL requests. Tenants
+// with strict operations only run the documents they allowlisted.
+func (h *Handler) ServeREST(w http.ResponseWriter, r *http.Request, tableName, key string) {
+	requestID := requestCorrelationID(r)
+	w.Header().Set(CorrelationHeader, requestID)
+	ctx := withCorrelationID(r.Context(), requestID)
+
+	t, cached, ok := h.requestSchema(ctx, w)
+	if !ok {
+		return
+	}
+
+	table, ok := restTable(cached.metadata, tableName)
+	if !ok {
+		writeRESTError(w, newRESTError(http.StatusNotFound, NotFoundCode, fmt.Sprintf("table %s not found", tableName)))
+		return
+	}
+
+	req, err := buildRESTRequest(cached.schema, table, r, key)
+	if err != nil {
+		writeRESTError(w, asRESTError(err))
+		return
+	}
+
+	// The generated document is checked like a client's; it is not registered
+	// as a persisted query
+	if t.StrictOperations {
+		if _, opErr := h.resolveOperation(ctx, t, req.query, nil); opErr != nil {
+			writeRESTError(w, restResultError(*opErr))
+			return
+		}
+	}
+	limits := t.QueryLimits.WithDefaults(h.limits)
+	cost := analyzeQuery(cached.schema, req.query, "", req.variables, limits.MaxNodes)
+	if errs := cost.Check(limits); len(errs) > 0 {
+		h.logger.Warn().
+			Str("tenant_id", t.ID).
+			Int("depth", cost.Depth).
+			Int("nodes", cost.Nodes).
+			Int("cost", cost.Cost).
+			Msg("rest request rejected by limits")
+		writeRESTError(w, restResultError(errs[0]))
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         *cached.schema,
+		RequestString:  req.query,
+		VariableValues: req.variables,
+		Context:        WithLoader(ctx, NewLoader()),
+	})
+	if len(result.Errors) > 0 {
+		writeRESTError(w, restResultError(result.Errors[0]))
+		return
+	}
+
+	data, _ := result.Data.(map[string]interface{})
+	value := data[req.field]
+	if value == nil && key != "" {
+		writeRESTError(w, newRESTError(http.StatusNotFound, NotFoundCode, "row not found"))
+		return
+	}
+	if value == nil {
+		value = []interface{}{}
+	}
+	writeRESTJSON(w, req.status, value)
+}
+
+// requestSchema returns the tenant of the request and the schema of the caller's
+// role, writing a REST error when either is unavailable
+func (h *Handler) requestSchema(ctx context.Context, w http.ResponseWriter) (*tenant.Tenant, *cachedSchema, bool) {
+	t, err := tenant.GetTenant(ctx)
+	if err != nil {
+		writeRESTError(w, newRESTError(http.StatusUnauthorized, PermissionDeniedCode, "tenant context required"))
+		return nil, nil, false
+	}
+	if !validIdentifier.MatchString(t.SchemaName) {
+		h.logger.Error().Str("schema_name", t.SchemaName).Msg("invalid schema name format")
+		writeRESTError(w, newRESTError(http.StatusInternalServerError, InternalErrorCode, "internal server error"))
+		return nil, nil, false
+	}
+
+	cached, err := h.getRoleSchema(ctx, t)
+	if errors.Is(err, ErrRoleNotAllowed) {
+		writeRESTError(w, newRESTError(http.StatusForbidden, PermissionDeniedCode, err.Error()))
+		return nil, nil, false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Str("schema_name", t.SchemaName).Msg("failed to get schema")
+		writeRESTError(w, newRESTError(http.StatusInternalServerError, InternalErrorCode, "failed to load schema"))
+		return nil, nil, false
+	}
+	return t, cached, true
+}
+
+// restTable returns the table a REST path names, if the role can see it
+func restTable(metadata *SchemaMetadata, name string) (Table, bool) {
+	if metadata == nil || !validIdentifier.MatchString(name) {
+		return Table{}, false
+	}
+	for _, table := range metadata.Tables {
+		if table.Name == name {
+			return table, true
+		}
+	}
+	return Table{}, false
+}
+
+// restRequest is the GraphQL operation a REST request runs
+type restRequest struct {
+	query     string
+	variables map[string]interface{}
+	// field is the root field whose value is the response body
+	field string
+	// status is the status of successful responses
+	status int
+}
+
+// buildRESTRequest maps a REST request to the operation on the table's
+// generated fields: list, ById, create, update or delete
+func buildRESTRequest(schema *graphql.Schema, table Table, r *http.Request, key string) (*restRequest, error) {
+	typeName := strcase.ToCamel(table.Name)
+	listField := strcase.ToLowerCamel(table.Name)
+	pk := primaryKeyColumns(table)
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodGet:
+			vars, err := restListVariables(schema.QueryType().Fields()[listField], r.URL.Query())
+			if err != nil {
+				return nil, err
+			}
+			return newRESTRequest(schema.QueryType(), "query", listField, vars, table, http.StatusOK)
+		case http.MethodPost:
+			vars, err := restBody(r)
+			if err != nil {
+				return nil, err
+			}
+			return newRESTRequest(schema.MutationType(), "mutation", "create"+typeName, vars, table, http.StatusCreated)
+		}
+		return nil, newRESTError(http.StatusMethodNotAllowed, InvalidInputCode, "method not allowed")
+	}
+
+	if len(pk) == 0 {
+		return nil, newRESTError(http.StatusNotFound, NotFoundCode, fmt.Sprintf("table %s has no primary key", table.Name))
+	}
+	var opType, field string
+	var root *graphql.Object
+	vars := map[string]interface{}{}
+	switch r.Method {
+	case http.MethodGet:
+		root, opType, field = schema.QueryType(), "query", listField+keyFieldSuffix(pk)
+	case http.MethodPut, http.MethodPatch:
+		body, err := restBody(r)
+		if err != nil {
+			return nil, err
+		}
+		vars = body
+		root, opType, field = schema.MutationType(), "mutation", "update"+typeName
+	case http.MethodDelete:
+		root, opType, field = schema.MutationType(), "mutation", "delete"+typeName
+	default:
+		return nil, newRESTError(http.StatusMethodNotAllowed, InvalidInputCode, "method not allowed")
+	}
+
+	def := rootField(root, field)
+	if def == nil {
+		return nil, restFieldMissing(field)
+	}
+	// The router matches the escaped path only when it differs from the decoded
+	// one; otherwise key is already decoded
+	keyVars, err := restKeyVariables(def, pk, key, r.URL.RawPath != "")
+	if err != nil {
+		return nil, err
+	}
+	// The path identifies the row; keys in the body do not move it
+	for name, val := range keyVars {
+		vars[name] = val
+	}
+	return newRESTRequest(root, opType, field, vars, table, http.StatusOK)
+}
+
+// newRESTRequest builds the operation calling field with vars as its arguments
+// and selecting every column of table
+func newRESTRequest(root *graphql.Object, operation, field string, vars map[string]interface{}, table Table, status int) (*restRequest, error) {
+	def := rootField(root, field)
+	if def == nil {
+		return nil, restFieldMissing(field)
+	}
+	argTypes := make(map[string]string, len(def.Args))
+	for _, arg := range def.Args {
+		argTypes[arg.Name()] = arg.Type.String()
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var defs, args []string
+	for _, name := range names {
+		argType, ok := argTypes[name]
+		if !ok {
+			return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, fmt.Sprintf("unknown field: %s", name))
+		}
+		defs = append(defs, fmt.Sprintf("$%s: %s", name, argType))
+		args = append(args, fmt.Sprintf("%s: $%s", name, name))
+	}
+
+	selection := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		selection[i] = strcase.ToLowerCamel(col.Name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(operation)
+	if len(defs) > 0 {
+		sb.WriteString("(" + strings.Join(defs, ", ") + ")")
+	}
+	sb.WriteString(" { " + field)
+	if len(args) > 0 {
+		sb.WriteString("(" + strings.Join(args, ", ") + ")")
+	}
+	sb.WriteString(" { " + strings.Join(selection, " ") + " } }")
+
+	return &restRequest{query: sb.String(), variables: vars, field: field, status: status}, nil
+}
+
+// rootField returns a field of the query or mutation type, nil when the type or
+// field is not generated for the role
+func rootField(root *graphql.Object, name string) *graphql.FieldDefinition {
+	if root == nil {
+		return nil
+	}
+	return root.Fields()[name]
+}
+
+// restFieldMissing reports an operation the role's schema does not generate
+func restFieldMissing(field string) *restError {
+	return newRESTError(http.StatusForbidden, PermissionDeniedCode, fmt.Sprintf("%s is not permitted", field))
+}
+
+// restListVariables reads the list arguments from query parameters: limit,
+// offset, where and order_by as JSON, order as field.asc,field.desc, search, and
+// any other parameter as an equality filter on the field it names
+func restListVariables(field *graphql.FieldDefinition, params url.Values) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	if field == nil {
+		return vars, nil
+	}
+	var boolExp *graphql.InputObject
+	for _, arg := range field.Args {
+		if arg.Name() == "where" {
+			boolExp, _ = arg.Type.(*graphql.InputObject)
+		}
+	}
+
+	for _, name := range []string{"limit", "offset"} {
+		if raw := params.Get(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, fmt.Sprintf("%s must be a non-negative integer", name))
+			}
+			vars[name] = n
+		}
+	}
+
+	var conds []interface{}
+	if raw := params.Get("where"); raw != "" {
+		var where map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &where); err != nil {
+			return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, "where must be a JSON object")
+		}
+		conds = append(conds, where)
+	}
+	if search := params.Get("search"); search != "" {
+		conds = append(conds, map[string]interface{}{searchFilterField: search})
+	}
+	filters := make([]string, 0, len(params))
+	for name := range params {
+		if !restListParams[name] {
+			filters = append(filters, name)
+		}
+	}
+	sort.Strings(filters)
+	for _, name := range filters {
+		valueType, ok := comparisonType(boolExp, name)
+		if !ok {
+			return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, fmt.Sprintf("unknown filter field: %s", name))
+		}
+		val, err := parseRESTValue(valueType, params.Get(name))
+		if err != nil {
+			return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, fmt.Sprintf("invalid value for %s", name))
+		}
+		conds = append(conds, map[string]interface{}{name: map[string]interface{}{"_eq": val}})
+	}
+	switch len(conds) {
+	case 0:
+	case 1:
+		vars["where"] = conds[0]
+	default:
+		vars["where"] = map[string]interface{}{"_and": conds}
+	}
+
+	if raw := params.Get("order_by"); raw != "" {
+		var orderBy interface{}
+		if err := json.Unmarshal([]byte(raw), &orderBy); err != nil {
+			return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, "order_by must be JSON")
+		}
+		vars["order_by"] = orderBy
+	} else if raw := params.Get("order"); raw != "" {
+		var orderBy []interface{}
+		for _, term := range strings.Split(raw, ",") {
+			name, direction := term, "asc"
+			if i := strings.LastIndex(term, "."); i >= 0 {
+				name, direction = term[:i], term[i+1:]
+			}
+			orderBy = append(orderBy, map[string]interface{}{name: direction})
+		}
+		vars["order_by"] = orderBy
+	}
+	return vars, nil
+}
+
+// comparisonType returns the type compared by the _eq operator of a BoolExp field
+func comparisonType(boolExp *graphql.InputObject, name string) (graphql.Input, bool) {
+	if boolExp == nil {
+		return nil, false
+	}
+	field, ok := boolExp.Fields()[name]
+	if !ok {
+		return nil, false
+	}
+	exp, ok := field.Type.(*graphql.InputObject)
+	if !ok {
+		return nil, false
+	}
+	eq, ok := exp.Fields()["_eq"]
+	if !ok {
+		return nil, false
+	}
+	return eq.Type, true
+}
+
+// restKeyVariables reads the key arguments of a single-row field from the key
+// path segment, whose comma-separated parts follow the primary key columns. The
+// parts are unescaped when the segment is escaped.
+func restKeyVariables(field *graphql.FieldDefinition, pk []string, key string, escaped bool) (map[string]interface{}, error) {
+	// Single-column keys are not split, commas included
+	parts := []string{key}
+	if len(pk) > 1 {
+		parts = strings.Split(key, ",")
+	}
+	if len(parts) != len(pk) {
+		return nil, newRESTError(http.StatusBadRequest, InvalidInputCode,
+			fmt.Sprintf("key must have %d comma-separated parts", len(pk)))
+	}
+	argTypes := make(map[string]graphql.Input, len(field.Args))
+	for _, arg := range field.Args {
+		argTypes[arg.Name()] = arg.Type
+	}
+
+	vars := make(map[string]interface{}, len(pk))
+	for i, col := range pk {
+		name := keyArgName(pk, col)
+		raw := parts[i]
+		if escaped {
+			var err error
+			if raw, err = url.PathUnescape(raw); err != nil {
+				return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, "invalid key")
+			}
+		}
+		val, err := parseRESTValue(argTypes[name], raw)
+		if err != nil {
+			return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, fmt.Sprintf("invalid value for %s", name))
+		}
+		vars[name] = val
+	}
+	return vars, nil
+}
+
+// parseRESTValue converts a path or query string value to the variable value
+// of a GraphQL input type
+func parseRESTValue(t graphql.Input, raw string) (interface{}, error) {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	switch t {
+	case graphql.Int:
+		return strconv.Atoi(raw)
+	case graphql.Float:
+		return strconv.ParseFloat(raw, 64)
+	case graphql.Boolean:
+		return strconv.ParseBool(raw)
+	}
+	return raw, nil
+}
+
+// restBody reads the JSON object of a create or update request
+func restBody(r *http.Request) (map[string]interface{}, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+	if err != nil {
+		return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, "failed to read body")
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(body, &vars); err != nil || vars == nil {
+		return nil, newRESTError(http.StatusBadRequest, InvalidInputCode, "body must be a JSON object")
+	}
+	return vars, nil
+}
+
+// restStatuses maps error codes to HTTP statuses
+var restStatuses = map[string]int{
+	UniqueViolationCode:      http.StatusConflict,
+	ForeignKeyViolationCode:  http.StatusConflict,
+	ConflictCode:             http.StatusConflict,
+	SerializationFailureCode: http.StatusConflict,
+	NotNullViolationCode:     http.StatusBadRequest,
+	CheckViolationCode:       http.StatusBadRequest,
+	InvalidInputCode:         http.StatusBadRequest,
+	QueryLimitExceededCode:   http.StatusBadRequest,
+	PermissionDeniedCode:     http.StatusForbidden,
+	OperationNotAllowedCode:  http.StatusForbidden,
+	NotFoundCode:             http.StatusNotFound,
+	TimeoutCode:              http.StatusGatewayTimeout,
+	InternalErrorCode:        http.StatusInternalServerError,
+}
+
+// restResultError converts the error of an operation. Errors without a code are
+// validation errors of the request's values.
+func restResultError(err gqlerrors.FormattedError) *restError {
+	ext := map[string]interface{}{}
+	for k, v := range err.Extensions {
+		ext[k] = v
+	}
+	code, _ := ext["code"].(string)
+	if code == "" {
+		code = InvalidInputCode
+		ext["code"] = code
+	}
+	status, ok := restStatuses[code]
+	if !ok {
+		status = http.StatusBadRequest
+	}
+	return &restError{status: status, message: err.Message, extensions: ext}
+}
+
+func asRESTError(err error) *restError {
+	var re *restError
+	if errors.As(err, &re) {
+		return re
+	}
+	return newRESTError(http.StatusInternalServerError, InternalErrorCode, err.Error())
+}
+
+// writeRESTError writes {"error": message, "code": ..., <details>}
+func writeRESTError(w http.ResponseWriter, err *restError) {
+	body := map[string]interface{}{"error": err.message}
+	for k, v := range err.extensions {
+		body[k] = v
+	}
+	writeRESTJSON(w, err.status, body)
+}
+
+func writeRESTJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
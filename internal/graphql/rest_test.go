@@ -0,0 +1,208 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func restTestMetadata() *SchemaMetadata {
+	tables := orderTestTables()
+	postTags := Table{
+		Name: "post_tags",
+		Columns: []Column{
+			{Name: "post_id", DataType: "integer", IsPK: true},
+			{Name: "tag", DataType: "text", IsPK: true},
+			{Name: "weight", DataType: "integer"},
+		},
+	}
+	return &SchemaMetadata{Tables: []Table{tables["authors"], tables["posts"], postTags}}
+}
+
+func restTestSchema(t *testing.T, metadata *SchemaMetadata) *graphql.Schema {
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", metadata)
+	require.NoError(t, err)
+	return schema
+}
+
+func TestBuildRESTRequest(t *testing.T) {
+	metadata := restTestMetadata()
+	schema := restTestSchema(t, metadata)
+	posts, postTags := metadata.Tables[1], metadata.Tables[2]
+
+	build := func(table Table, method, target, body, key string) (*restRequest, error) {
+		return buildRESTRequest(schema, table, httptest.NewRequest(method, target, strings.NewReader(body)), key)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		req, err := build(posts, http.MethodGet, "/posts?limit=10&offset=5&authorId=3&order=createdAt.desc,id", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, "query($limit: Int, $offset: Int, $order_by: [PostsOrderBy!], $where: PostsBoolExp) "+
+			"{ posts(limit: $limit, offset: $offset, order_by: $order_by, where: $where) { id title createdAt authorId } }", req.query)
+		assert.Equal(t, map[string]interface{}{
+			"limit":  10,
+			"offset": 5,
+			"where":  map[string]interface{}{"authorId": map[string]interface{}{"_eq": 3}},
+			"order_by": []interface{}{
+				map[string]interface{}{"createdAt": "desc"},
+				map[string]interface{}{"id": "asc"},
+			},
+		}, req.variables)
+		assert.Equal(t, http.StatusOK, req.status)
+	})
+
+	t.Run("filters combine with where", func(t *testing.T) {
+		req, err := build(posts, http.MethodGet, `/posts?title=hi&where={"id":{"_gt":1}}`, "", "")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"_and": []interface{}{
+			map[string]interface{}{"id": map[string]interface{}{"_gt": float64(1)}},
+			map[string]interface{}{"title": map[string]interface{}{"_eq": "hi"}},
+		}}, req.variables["where"])
+	})
+
+	t.Run("create", func(t *testing.T) {
+		req, err := build(posts, http.MethodPost, "/posts", `{"title":"hello","authorId":1}`, "")
+		require.NoError(t, err)
+		assert.Equal(t, "mutation($authorId: Int, $title: String!) "+
+			"{ createPosts(authorId: $authorId, title: $title) { id title createdAt authorId } }", req.query)
+		assert.Equal(t, http.StatusCreated, req.status)
+	})
+
+	t.Run("update keeps the key of the path", func(t *testing.T) {
+		req, err := build(posts, http.MethodPatch, "/posts/7", `{"id":8,"title":"new"}`, "7")
+		require.NoError(t, err)
+		assert.Equal(t, "mutation($id: ID!, $title: String) "+
+			"{ updatePosts(id: $id, title: $title) { id title createdAt authorId } }", req.query)
+		assert.Equal(t, map[string]interface{}{"id": "7", "title": "new"}, req.variables)
+	})
+
+	t.Run("composite key", func(t *testing.T) {
+		req, err := build(postTags, http.MethodGet, "/post_tags/1,a%2Cb", "", "1,a%2Cb")
+		require.NoError(t, err)
+		assert.Equal(t, "query($postId: Int!, $tag: String!) "+
+			"{ postTagsByPostIdAndTag(postId: $postId, tag: $tag) { postId tag weight } }", req.query)
+		assert.Equal(t, map[string]interface{}{"postId": 1, "tag": "a,b"}, req.variables)
+
+		_, err = build(postTags, http.MethodDelete, "/post_tags/1", "", "1")
+		assert.EqualError(t, err, "key must have 2 comma-separated parts")
+	})
+
+	t.Run("keys are decoded once", func(t *testing.T) {
+		// Without a raw path the router hands over the decoded key
+		req, err := build(postTags, http.MethodGet, "/post_tags/1,100%25", "", "1,100%")
+		require.NoError(t, err)
+		assert.Equal(t, "100%", req.variables["tag"])
+
+		req, err = build(postTags, http.MethodGet, "/post_tags/1,a%2541", "", "1,a%41")
+		require.NoError(t, err)
+		assert.Equal(t, "a%41", req.variables["tag"])
+
+		// With one it hands over the escaped key
+		req, err = build(postTags, http.MethodGet, "/post_tags/1,a%2C100%25", "", "1,a%2C100%25")
+		require.NoError(t, err)
+		assert.Equal(t, "a,100%", req.variables["tag"])
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		_, err := build(posts, http.MethodPost, "/posts", `{"nope":1}`, "")
+		assert.EqualError(t, err, "unknown field: nope")
+
+		_, err = build(posts, http.MethodGet, "/posts?nope=1", "", "")
+		assert.EqualError(t, err, "unknown filter field: nope")
+
+		_, err = build(posts, http.MethodGet, "/posts?authorId=x", "", "")
+		assert.EqualError(t, err, "invalid value for authorId")
+
+		_, err = build(posts, http.MethodPut, "/posts", `{}`, "")
+		assert.Equal(t, http.StatusMethodNotAllowed, asRESTError(err).status)
+	})
+}
+
+func TestRESTResultError(t *testing.T) {
+	err := restResultError(gqlerrors.FormattedError{
+		Message:    "duplicate value violates unique constraint posts_slug_key",
+		Extensions: map[string]interface{}{"code": UniqueViolationCode, "constraint": "posts_slug_key"},
+	})
+	assert.Equal(t, http.StatusConflict, err.status)
+
+	err = restResultError(gqlerrors.FormattedError{Message: `Variable "$id" got invalid value`})
+	assert.Equal(t, http.StatusBadRequest, err.status)
+	assert.Equal(t, InvalidInputCode, err.extensions["code"])
+}
+
+func TestHandler_ServeREST(t *testing.T) {
+	metadata := restTestMetadata()
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits()}
+	h.schemaCache.Store("tenant_test", &cachedSchema{
+		schema:    restTestSchema(t, metadata),
+		metadata:  metadata,
+		expiresAt: time.Now().Add(time.Minute),
+	})
+	ten := &tenant.Tenant{ID: "t1", SchemaName: "tenant_test"}
+
+	serve := func(method, table, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/rest/"+table, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeREST(rec, req.WithContext(tenant.WithTenant(req.Context(), ten)), table, key)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "comments", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, map[string]interface{}{"error": "table comments not found", "code": NotFoundCode}, body)
+	assert.NotEmpty(t, rec.Header().Get(CorrelationHeader))
+
+	rec = serve(http.MethodPost, "posts", "", `not json`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "body must be a JSON object")
+}
+
+func TestHandler_ServeRESTChecksOperations(t *testing.T) {
+	metadata := restTestMetadata()
+	store := newMemoryOperationStore()
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits(), operations: store}
+	h.schemaCache.Store("tenant_test", &cachedSchema{
+		schema:    restTestSchema(t, metadata),
+		metadata:  metadata,
+		expiresAt: time.Now().Add(time.Minute),
+	})
+
+	serve := func(ten *tenant.Tenant, method, table, key string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(method, "/rest/"+table, nil)
+		rec := httptest.NewRecorder()
+		h.ServeREST(rec, req.WithContext(tenant.WithTenant(req.Context(), ten)), table, key)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec, body
+	}
+
+	strict := &tenant.Tenant{ID: "t1", SchemaName: "tenant_test", StrictOperations: true}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		key := ""
+		if method == http.MethodDelete {
+			key = "1"
+		}
+		rec, body := serve(strict, method, "posts", key)
+		assert.Equal(t, http.StatusForbidden, rec.Code, method)
+		assert.Equal(t, OperationNotAllowedCode, body["code"], method)
+	}
+	assert.Empty(t, store.ops, "REST documents are not registered as persisted queries")
+
+	limited := &tenant.Tenant{ID: "t2", SchemaName: "tenant_test", QueryLimits: tenant.QueryLimits{MaxNodes: 1}}
+	rec, body := serve(limited, http.MethodGet, "posts", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, QueryLimitExceededCode, body["code"])
+	assert.Equal(t, "nodes", body["limit"])
+}
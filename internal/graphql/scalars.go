@@ -0,0 +1,581 @@
+package graphql
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/iancoleman/strcase"
+	"github.com/lib/pq"
+)
+
+// dateLayout is the format of Date values
+const dateLayout = "2006-01-02"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+// Custom scalars for Postgres types that do not fit the built-in GraphQL scalars
+var (
+	// JSONScalar carries json/jsonb values as plain JSON
+	JSONScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:         "JSON",
+		Description:  "An arbitrary JSON value.",
+		Serialize:    serializeJSON,
+		ParseValue:   func(value interface{}) interface{} { return jsonValue{value: value} },
+		ParseLiteral: func(value ast.Value) interface{} { return jsonValue{value: literalValue(value)} },
+	})
+
+	// DateTimeScalar carries timestamps as RFC 3339 strings
+	DateTimeScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "DateTime",
+		Description: "A timestamp in RFC 3339 format, e.g. 2024-01-02T15:04:05Z.",
+		Serialize:   serializeDateTime,
+		ParseValue:  parseDateTime,
+		ParseLiteral: func(value ast.Value) interface{} {
+			if v, ok := value.(*ast.StringValue); ok {
+				return parseDateTime(v.Value)
+			}
+			return nil
+		},
+	})
+
+	// DateScalar carries calendar dates as YYYY-MM-DD strings
+	DateScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "Date",
+		Description: "A calendar date in YYYY-MM-DD format.",
+		Serialize:   serializeDate,
+		ParseValue:  parseDate,
+		ParseLiteral: func(value ast.Value) interface{} {
+			if v, ok := value.(*ast.StringValue); ok {
+				return parseDate(v.Value)
+			}
+			return nil
+		},
+	})
+
+	// BigIntScalar carries 64-bit integers as strings so clients do not lose precision
+	BigIntScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "BigInt",
+		Description: "A 64-bit integer, serialized as a string. Integer literals are accepted as input.",
+		Serialize:   serializeBigInt,
+		ParseValue:  parseBigInt,
+		ParseLiteral: func(value ast.Value) interface{} {
+			switch v := value.(type) {
+			case *ast.IntValue:
+				return parseBigInt(v.Value)
+			case *ast.StringValue:
+				return parseBigInt(v.Value)
+			}
+			return nil
+		},
+	})
+
+	// DecimalScalar carries arbitrary precision numbers as strings
+	DecimalScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "Decimal",
+		Description: "An arbitrary precision number, serialized as a string. Numeric literals are accepted as input.",
+		Serialize:   serializeDecimal,
+		ParseValue:  parseDecimal,
+		ParseLiteral: func(value ast.Value) interface{} {
+			switch v := value.(type) {
+			case *ast.IntValue:
+				return parseDecimal(v.Value)
+			case *ast.FloatValue:
+				return parseDecimal(v.Value)
+			case *ast.StringValue:
+				return parseDecimal(v.Value)
+			}
+			return nil
+		},
+	})
+
+	// UUIDScalar carries uuid values
+	UUIDScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "UUID",
+		Description: "A UUID, e.g. 123e4567-e89b-12d3-a456-426614174000.",
+		Serialize:   serializeString,
+		ParseValue:  parseUUID,
+		ParseLiteral: func(value ast.Value) interface{} {
+			if v, ok := value.(*ast.StringValue); ok {
+				return parseUUID(v.Value)
+			}
+			return nil
+		},
+	})
+
+	// BytesScalar carries bytea values as base64 strings
+	BytesScalar = graphql.NewScalar(graphql.ScalarConfig{
+		Name:        "Bytes",
+		Description: "Binary data, encoded as standard base64.",
+		Serialize:   serializeBytes,
+		ParseValue:  parseBytes,
+		ParseLiteral: func(value ast.Value) interface{} {
+			if v, ok := value.(*ast.StringValue); ok {
+				return parseBytes(v.Value)
+			}
+			return nil
+		},
+	})
+)
+
+// jsonValue is a parsed JSON input; it is sent to Postgres as its JSON encoding
+type jsonValue struct {
+	value interface{}
+}
+
+// Value implements driver.Valuer
+func (v jsonValue) Value() (driver.Value, error) {
+	b, err := json.Marshal(v.value)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// MarshalJSON keeps parsed inputs readable when they are echoed, e.g. in cursors
+func (v jsonValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.value)
+}
+
+// literalValue converts an inline GraphQL literal into its Go value
+func literalValue(value ast.Value) interface{} {
+	switch v := value.(type) {
+	case *ast.ObjectValue:
+		obj := make(map[string]interface{}, len(v.Fields))
+		for _, field := range v.Fields {
+			obj[field.Name.Value] = literalValue(field.Value)
+		}
+		return obj
+	case *ast.ListValue:
+		list := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			list[i] = literalValue(item)
+		}
+		return list
+	case *ast.IntValue:
+		if n, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+			return n
+		}
+		return json.Number(v.Value)
+	case *ast.FloatValue:
+		return json.Number(v.Value)
+	case *ast.StringValue:
+		return v.Value
+	case *ast.BooleanValue:
+		return v.Value
+	case *ast.EnumValue:
+		return v.Value
+	}
+	return nil
+}
+
+func serializeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return decodeJSON(v)
+	case json.RawMessage:
+		return decodeJSON(v)
+	case jsonValue:
+		return v.value
+	}
+	return value
+}
+
+// decodeJSON parses a json/jsonb column, keeping numbers exact
+func decodeJSON(b []byte) interface{} {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return string(b)
+	}
+	return v
+}
+
+func serializeDateTime(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.Format(time.RFC3339Nano)
+	case string:
+		// Change events carry timestamps as JSON strings
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+		return v
+	case []byte:
+		return string(v)
+	}
+	return nil
+}
+
+func parseDateTime(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+func serializeDate(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(dateLayout)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.Format(dateLayout)
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return nil
+}
+
+func parseDate(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	if _, err := time.Parse(dateLayout, s); err != nil {
+		return nil
+	}
+	return s
+}
+
+func serializeBigInt(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	case json.Number:
+		return v.String()
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return nil
+}
+
+func parseBigInt(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return n
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		// JSON variables decode to float64; only exact integers are accepted
+		if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+			return nil
+		}
+		return int64(v)
+	}
+	return nil
+}
+
+func serializeDecimal(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case json.Number:
+		return v.String()
+	}
+	return nil
+}
+
+func parseDecimal(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if _, ok := new(big.Float).SetString(v); !ok {
+			return nil
+		}
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return nil
+}
+
+func serializeString(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return nil
+}
+
+func parseUUID(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok || !uuidPattern.MatchString(s) {
+		return nil
+	}
+	return s
+}
+
+func serializeBytes(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case string:
+		// Change events carry bytea in the \x hex format
+		if b, err := hex.DecodeString(strings.TrimPrefix(v, `\x`)); err == nil && strings.HasPrefix(v, `\x`) {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+		return v
+	}
+	return nil
+}
+
+func parseBytes(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// sqlValue converts a GraphQL input value into a query parameter; lists are sent
+// as Postgres arrays
+func sqlValue(value interface{}) interface{} {
+	if list, ok := value.([]interface{}); ok {
+		return pq.GenericArray{A: list}
+	}
+	return value
+}
+
+// decodeValue converts a raw column value to the Go value expected by the GraphQL
+// type of the column. typeName is the driver's database type name.
+func decodeValue(typeName string, value interface{}) interface{} {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+
+	switch typeName {
+	case "BOOL", "bool":
+		s := string(b)
+		return s == "t" || s == "true" || s == "1" || s == "YES"
+	case "JSON", "JSONB":
+		return decodeJSON(b)
+	case "BYTEA":
+		return b
+	case "":
+		// Enum types are unknown to the driver; arrays of them arrive as {a,b}
+		if len(b) > 1 && b[0] == '{' && b[len(b)-1] == '}' {
+			if list, err := decodeArray("TEXT", b); err == nil {
+				return list
+			}
+		}
+		return string(b)
+	}
+
+	if strings.HasPrefix(typeName, "_") {
+		if list, err := decodeArray(strings.TrimPrefix(typeName, "_"), b); err == nil {
+			return list
+		}
+	}
+	return string(b)
+}
+
+// decodeArray parses a one-dimensional Postgres array of elemType elements
+func decodeArray(elemType string, b []byte) ([]interface{}, error) {
+	switch elemType {
+	case "INT2", "INT4", "INT8", "OID":
+		var items []sql.NullInt64
+		if err := (pq.GenericArray{A: &items}).Scan(b); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			if item.Valid {
+				list[i] = item.Int64
+			}
+		}
+		return list, nil
+	case "FLOAT4", "FLOAT8":
+		var items []sql.NullFloat64
+		if err := (pq.GenericArray{A: &items}).Scan(b); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			if item.Valid {
+				list[i] = item.Float64
+			}
+		}
+		return list, nil
+	case "BOOL":
+		var items []sql.NullBool
+		if err := (pq.GenericArray{A: &items}).Scan(b); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			if item.Valid {
+				list[i] = item.Bool
+			}
+		}
+		return list, nil
+	case "BYTEA":
+		var items pq.ByteaArray
+		if err := items.Scan(b); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			if item != nil {
+				list[i] = item
+			}
+		}
+		return list, nil
+	}
+
+	var items []sql.NullString
+	if err := (pq.GenericArray{A: &items}).Scan(b); err != nil {
+		return nil, err
+	}
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		if !item.Valid {
+			continue
+		}
+		switch elemType {
+		case "JSON", "JSONB":
+			list[i] = decodeJSON([]byte(item.String))
+		case "TIMESTAMP", "TIMESTAMPTZ", "DATE":
+			t, err := pq.ParseTimestamp(time.UTC, item.String)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = t
+		default:
+			list[i] = item.String
+		}
+	}
+	return list, nil
+}
+
+// enumValueName turns an enum label into a valid GraphQL enum value name
+func enumValueName(label string) string {
+	var b strings.Builder
+	for i, r := range label {
+		switch {
+		case r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	name := b.String()
+	switch name {
+	case "", "true", "false", "null":
+		name = "_" + name
+	}
+	return name
+}
+
+// buildEnum creates the GraphQL enum of a Postgres enum type; its values are the
+// labels, named after them where possible. Labels that are valid names keep
+// them; others whose names collide (in-progress and in_progress) get a numeric
+// suffix in label order.
+func buildEnum(enum Enum, typeName string) *graphql.Enum {
+	values := graphql.EnumValueConfigMap{}
+	for _, label := range enum.Values {
+		if enumValueName(label) == label {
+			values[label] = &graphql.EnumValueConfig{Value: label}
+		}
+	}
+	for _, label := range enum.Values {
+		name := enumValueName(label)
+		if name == label {
+			continue
+		}
+		for n := 2; values[name] != nil; n++ {
+			name = enumValueName(label) + "_" + strconv.Itoa(n)
+		}
+		values[name] = &graphql.EnumValueConfig{Value: label}
+	}
+	return graphql.NewEnum(graphql.EnumConfig{
+		Name:   typeName,
+		Values: values,
+	})
+}
+
+// withEnums returns a copy of the generator resolving the enum types of one
+// tenant; the shared generator is used concurrently for different tenants
+func (g *SchemaGenerator) withEnums(enums []Enum, tables []Table) *SchemaGenerator {
+	gen := *g
+	gen.enums = make(map[string]*graphql.Enum, len(enums))
+	gen.enumComparisonExps = make(map[string]*graphql.InputObject, len(enums))
+	gen.arrayComparisonExps = make(map[string]*graphql.InputObject)
+
+	tableTypes := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		tableTypes[strcase.ToCamel(table.Name)] = true
+	}
+	for _, enum := range enums {
+		typeName := strcase.ToCamel(enum.Name)
+		if tableTypes[typeName] {
+			typeName += "Enum"
+		}
+		gen.enums[enum.Name] = buildEnum(enum, typeName)
+		gen.enumComparisonExps[enum.Name] = newComparisonExp(typeName+"ComparisonExp", gen.enums[enum.Name], false)
+	}
+	return &gen
+}
@@ -0,0 +1,171 @@
+package graphql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetGraphQLType_RichScalars(t *testing.T) {
+	g := NewSchemaGenerator(nil).withEnums([]Enum{{Name: "mood", Values: []string{"happy", "sad"}}}, nil)
+
+	cases := map[string]string{
+		"integer":                     "Int",
+		"smallint":                    "Int",
+		"bigint":                      "BigInt",
+		"numeric":                     "Decimal",
+		"double precision":            "Float",
+		"text":                        "String",
+		"uuid":                        "UUID",
+		"jsonb":                       "JSON",
+		"bytea":                       "Bytes",
+		"timestamp with time zone":    "DateTime",
+		"timestamp without time zone": "DateTime",
+		"date":                        "Date",
+		"interval":                    "String",
+		"int4range":                   "String",
+		"text[]":                      "[String]",
+		"bigint[]":                    "[BigInt]",
+		"mood":                        "Mood",
+		"mood[]":                      "[Mood]",
+	}
+	for dataType, expected := range cases {
+		assert.Equal(t, expected, g.getGraphQLType(dataType).String(), dataType)
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	assert.Equal(t, true, decodeValue("BOOL", []byte("t")))
+	assert.Equal(t, "12.50", decodeValue("NUMERIC", []byte("12.50")))
+	assert.Equal(t, []byte{0xde, 0xad}, decodeValue("BYTEA", []byte{0xde, 0xad}))
+	assert.Equal(t, int64(7), decodeValue("INT8", int64(7)))
+
+	doc, ok := decodeValue("JSONB", []byte(`{"a":[1,"x"],"big":9007199254740993}`)).(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, json.Number("9007199254740993"), doc["big"], "numbers are kept exact")
+
+	assert.Equal(t, []interface{}{int64(1), nil, int64(3)}, decodeValue("_INT4", []byte("{1,NULL,3}")))
+	assert.Equal(t, []interface{}{"a b", `c"d`}, decodeValue("_TEXT", []byte(`{"a b","c\"d"}`)))
+	assert.Equal(t, []interface{}{true, false}, decodeValue("_BOOL", []byte("{t,f}")))
+
+	dates, ok := decodeValue("_DATE", []byte("{2024-01-02}")).([]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "2024-01-02", serializeDate(dates[0]))
+
+	// Enum arrays have no driver type name
+	assert.Equal(t, []interface{}{"happy", "sad"}, decodeValue("", []byte("{happy,sad}")))
+	assert.Equal(t, "happy", decodeValue("", []byte("happy")))
+}
+
+func TestScalars_SerializeAndParse(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	assert.Equal(t, "2024-01-02T15:04:05Z", serializeDateTime(ts))
+	assert.Equal(t, ts, parseDateTime("2024-01-02T15:04:05Z"))
+	assert.Nil(t, parseDateTime("yesterday"))
+
+	assert.Equal(t, "2024-01-02", serializeDate(ts))
+	assert.Nil(t, parseDate("2024-13-02"))
+
+	assert.Equal(t, "9223372036854775807", serializeBigInt(int64(9223372036854775807)))
+	assert.Equal(t, int64(9223372036854775807), parseBigInt("9223372036854775807"))
+	assert.Equal(t, int64(42), parseBigInt(float64(42)))
+	assert.Nil(t, parseBigInt(1.5))
+
+	assert.Equal(t, "12.50", serializeDecimal([]byte("12.50")))
+	assert.Nil(t, parseDecimal("twelve"))
+
+	assert.Nil(t, parseUUID("not-a-uuid"))
+	assert.Equal(t, "123e4567-e89b-12d3-a456-426614174000", parseUUID("123e4567-e89b-12d3-a456-426614174000"))
+
+	assert.Equal(t, "3q0=", serializeBytes([]byte{0xde, 0xad}))
+	assert.Equal(t, "3q0=", serializeBytes(`\xdead`), "change events carry hex bytea")
+	assert.Equal(t, []byte{0xde, 0xad}, parseBytes("3q0="))
+
+	value, err := jsonValue{value: map[string]interface{}{"a": 1}}.Value()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, value)
+}
+
+func TestEnumValueName(t *testing.T) {
+	assert.Equal(t, "happy", enumValueName("happy"))
+	assert.Equal(t, "in_progress", enumValueName("in progress"))
+	assert.Equal(t, "_1st", enumValueName("1st"))
+	assert.Equal(t, "_true", enumValueName("true"))
+}
+
+func TestBuildEnum_CollidingLabels(t *testing.T) {
+	enum := buildEnum(Enum{Name: "status", Values: []string{"in-progress", "in_progress", "in progress", "in_progress_2"}}, "Status")
+
+	names := map[string]interface{}{}
+	for _, value := range enum.Values() {
+		names[value.Name] = value.Value
+	}
+	assert.Equal(t, map[string]interface{}{
+		"in_progress":   "in_progress",
+		"in_progress_2": "in_progress_2",
+		"in_progress_3": "in-progress",
+		"in_progress_4": "in progress",
+	}, names)
+	assert.Equal(t, "in_progress_3", enum.Serialize("in-progress"), "every label serializes")
+}
+
+func TestGenerate_EnumsAndArrays(t *testing.T) {
+	table := Table{
+		Name: "posts",
+		Columns: []Column{
+			{Name: "id", DataType: "bigint", IsPK: true},
+			{Name: "mood", DataType: "mood", IsNullable: true},
+			{Name: "tags", DataType: "text[]", IsNullable: true},
+			{Name: "metadata", DataType: "jsonb", IsNullable: true},
+			{Name: "published_at", DataType: "timestamp with time zone", IsNullable: true},
+		},
+	}
+
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{table},
+		Enums:  []Enum{{Name: "mood", Values: []string{"happy", "in progress"}}},
+	})
+	require.NoError(t, err)
+
+	posts, ok := schema.Type("Posts").(*graphql.Object)
+	require.True(t, ok)
+	fields := posts.Fields()
+	assert.Equal(t, "BigInt!", fields["id"].Type.String())
+	assert.Equal(t, "Mood", fields["mood"].Type.String())
+	assert.Equal(t, "[String]", fields["tags"].Type.String())
+	assert.Equal(t, "JSON", fields["metadata"].Type.String())
+	assert.Equal(t, "DateTime", fields["publishedAt"].Type.String())
+
+	mood, ok := schema.Type("Mood").(*graphql.Enum)
+	require.True(t, ok)
+	assert.Equal(t, "in progress", mood.ParseValue("in_progress"))
+
+	boolExp, ok := schema.Type("PostsBoolExp").(*graphql.InputObject)
+	require.True(t, ok)
+	assert.Equal(t, "MoodComparisonExp", boolExp.Fields()["mood"].Type.String())
+	assert.Equal(t, "StringArrayComparisonExp", boolExp.Fields()["tags"].Type.String())
+	assert.Equal(t, "JSONComparisonExp", boolExp.Fields()["metadata"].Type.String())
+
+	// Bigint keys still sum and average
+	numeric, _ := NewSchemaGenerator(nil).aggregateColumns(table)
+	require.Len(t, numeric, 1)
+	assert.Equal(t, "id", numeric[0].Name)
+}
+
+func TestBuildComparison_ArrayContains(t *testing.T) {
+	args := &queryArgs{}
+	conds, err := buildComparison("tags", map[string]interface{}{"_contains": []interface{}{"go"}}, args)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`"tags" @> $1`}, conds)
+
+	valuer, ok := args.values[0].(driver.Valuer)
+	require.True(t, ok, "lists are sent as Postgres arrays")
+	value, err := valuer.Value()
+	require.NoError(t, err)
+	assert.Equal(t, `{"go"}`, value)
+}
@@ -1,6 +1,8 @@
 package graphql
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/graphql-go/graphql"
@@ -10,6 +12,11 @@ import (
 // SchemaGenerator generates a GraphQL schema from database metadata
 type SchemaGenerator struct {
 	resolver *Resolver
+
+	// Per-tenant types, set on the copy made by withEnums
+	enums               map[string]*graphql.Enum
+	enumComparisonExps  map[string]*graphql.InputObject
+	arrayComparisonExps map[string]*graphql.InputObject
 }
 
 // NewSchemaGenerator creates a new schema generator
@@ -19,6 +26,9 @@ func NewSchemaGenerator(resolver *Resolver) *SchemaGenerator {
 
 // Generate creates a GraphQL schema for a specific tenant schema
 func (g *SchemaGenerator) Generate(tenantSchema string, metadata *SchemaMetadata) (*graphql.Schema, error) {
+	// GraphQL enums for the tenant's enum types (e.g., Mood)
+	g = g.withEnums(metadata.Enums, metadata.Tables)
+
 	// 1. Create GraphQL Objects for each table
 	types := make(map[string]*graphql.Object)
 
@@ -28,12 +38,38 @@ func (g *SchemaGenerator) Generate(tenantSchema string, metadata *SchemaMetadata
 		tableMap[table.Name] = table
 	}
 
+	// Filter inputs used by `where` arguments (e.g., PostsBoolExp)
+	boolExps := make(map[string]*graphql.InputObject)
+	for _, table := range metadata.Tables {
+		boolExps[table.Name] = g.buildBoolExp(table)
+	}
+
+	// Sort inputs used by `order_by` arguments (e.g., PostsOrderBy)
+	orderBys := make(map[string]*graphql.InputObject)
+	for _, table := range metadata.Tables {
+		orderBys[table.Name] = g.buildOrderBy(table, orderBys)
+	}
+
+	// Aggregate result objects and groupBy column enums (e.g., PostsAggregate)
+	aggregates := make(map[string]*graphql.Object)
+	selectColumns := make(map[string]*graphql.Enum)
+	for _, table := range metadata.Tables {
+		aggregates[table.Name] = g.buildAggregate(table)
+		selectColumns[table.Name] = g.buildSelectColumn(table)
+	}
+
+	// Fields joining remote schemas, added once the remote types are built; join
+	// names taken by the table's own fields are collected as conflicts
+	joins := make(map[string]graphql.Fields)
+	var joinConflicts []string
+
 	for _, table := range metadata.Tables {
 		table := table // capture loop variable
 		typeName := strcase.ToCamel(table.Name)
 
 		types[table.Name] = graphql.NewObject(graphql.ObjectConfig{
-			Name: typeName,
+			Name:        typeName,
+			Description: table.Comment,
 			Fields: (graphql.FieldsThunk)(func() graphql.Fields {
 				fields := graphql.Fields{}
 
@@ -46,23 +82,17 @@ func (g *SchemaGenerator) Generate(tenantSchema string, metadata *SchemaMetadata
 					}
 
 					fields[fieldName] = &graphql.Field{
-						Type: gqlType,
+						Type:        gqlType,
+						Description: columnDescription(table, col),
 					}
 
 					// Add FK relation field (e.g., author for author_id)
 					if col.IsFK && col.FKTable != "" {
 						relatedType, exists := types[col.FKTable]
 						if exists {
-							// Remove _id suffix for relation field name
-							relationFieldName := strings.TrimSuffix(fieldName, "Id")
-							if relationFieldName == fieldName {
-								// No Id suffix, use table name
-								relationFieldName = strcase.ToLowerCamel(col.FKTable)
-							}
-
-							fields[relationFieldName] = &graphql.Field{
+							fields[relationFieldName(col)] = &graphql.Field{
 								Type:    relatedType,
-								Resolve: g.resolver.ResolveRelation(tenantSchema, col.FKTable, col.FKColumn, col.Name),
+								Resolve: g.resolver.ResolveRelation(tenantSchema, tableMap[col.FKTable], col.FKColumn, col.Name),
 							}
 						}
 					}
@@ -83,22 +113,49 @@ func (g *SchemaGenerator) Generate(tenantSchema string, metadata *SchemaMetadata
 								hasManyFieldName := strcase.ToLowerCamel(otherTableName)
 
 								fields[hasManyFieldName] = &graphql.Field{
-									Type: graphql.NewList(relatedType),
-									Args: graphql.FieldConfigArgument{
-										"limit": &graphql.ArgumentConfig{
-											Type: graphql.Int,
-										},
-										"offset": &graphql.ArgumentConfig{
-											Type: graphql.Int,
-										},
-									},
-									Resolve: g.resolver.ResolveHasMany(tenantSchema, otherTableName, otherCol.Name, otherCol.FKColumn),
+									Type:    graphql.NewList(relatedType),
+									Args:    listArgs(boolExps[otherTableName], orderBys[otherTableName]),
+									Resolve: g.resolver.ResolveHasMany(tenantSchema, tableMap, otherTable, otherCol.Name, otherCol.FKColumn),
+								}
+
+								// Aggregate over the related rows, e.g. postsAggregate
+								numeric, comparable := g.aggregateColumns(otherTable)
+								fields[hasManyFieldName+"Aggregate"] = &graphql.Field{
+									Type:    graphql.NewList(graphql.NewNonNull(aggregates[otherTableName])),
+									Args:    aggregateArgs(boolExps[otherTableName], selectColumns[otherTableName]),
+									Resolve: g.resolver.ResolveAggregate(tenantSchema, otherTable, numeric, comparable, otherCol.Name, otherCol.FKColumn),
 								}
 							}
 						}
 					}
 				}
 
+				// Add many-to-many relations through junction tables - e.g., tags for a post
+				for _, rel := range manyToManyRelations(tableMap, table) {
+					relatedType, exists := types[rel.target.Name]
+					if !exists {
+						continue
+					}
+					// Columns and direct relations keep their names
+					if _, taken := fields[rel.field]; taken {
+						continue
+					}
+					fields[rel.field] = &graphql.Field{
+						Type:    graphql.NewList(relatedType),
+						Args:    listArgs(boolExps[rel.target.Name], orderBys[rel.target.Name]),
+						Resolve: g.resolver.ResolveManyToMany(tenantSchema, tableMap, rel),
+					}
+				}
+
+				// Add joins to remote schemas - e.g., invoices of a customer from a billing service
+				for name, field := range joins[table.Name] {
+					if _, taken := fields[name]; taken {
+						joinConflicts = append(joinConflicts, typeName+"."+name)
+						continue
+					}
+					fields[name] = field
+				}
+
 				return fields
 			}),
 		})
@@ -113,90 +170,185 @@ func (g *SchemaGenerator) Generate(tenantSchema string, metadata *SchemaMetadata
 		if !ok {
 			continue
 		}
-		pkName := g.getPrimaryKey(table)
+		pk := primaryKeyColumns(table)
 
-		// List Query: users(limit: Int, offset: Int)
+		// List Query: users(limit: Int, offset: Int, where: UsersBoolExp, order_by: [UsersOrderBy!])
 		queryFields[fieldName] = &graphql.Field{
-			Type: graphql.NewList(gqlType),
-			Args: graphql.FieldConfigArgument{
-				"limit": &graphql.ArgumentConfig{
-					Type: graphql.Int,
-				},
-				"offset": &graphql.ArgumentConfig{
-					Type: graphql.Int,
-				},
-			},
-			Resolve: g.resolver.ResolveList(tenantSchema, tableName),
+			Type:    graphql.NewList(gqlType),
+			Args:    listArgs(boolExps[tableName], orderBys[tableName]),
+			Resolve: g.resolver.ResolveList(tenantSchema, tableMap, table),
+		}
+
+		// Aggregate Query: usersAggregate(where: UsersBoolExp, groupBy: [UsersSelectColumn!])
+		numeric, comparable := g.aggregateColumns(table)
+		queryFields[fieldName+"Aggregate"] = &graphql.Field{
+			Type:    graphql.NewList(graphql.NewNonNull(aggregates[tableName])),
+			Args:    aggregateArgs(boolExps[tableName], selectColumns[tableName]),
+			Resolve: g.resolver.ResolveAggregate(tenantSchema, table, numeric, comparable, "", ""),
 		}
 
-		// Get Query: userById(id: ID!)
-		if pkName != "" {
-			singleFieldName := fieldName + "ById"
-			queryFields[singleFieldName] = &graphql.Field{
-				Type: gqlType,
+		// Connection Query: usersConnection(first: Int, after: String, last: Int, before: String, ...)
+		if len(pk) > 0 {
+			queryFields[fieldName+"Connection"] = &graphql.Field{
+				Type: g.buildConnection(table, gqlType),
 				Args: graphql.FieldConfigArgument{
-					pkName: &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.ID),
+					"first": &graphql.ArgumentConfig{
+						Type: graphql.Int,
+					},
+					"after": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"last": &graphql.ArgumentConfig{
+						Type: graphql.Int,
+					},
+					"before": &graphql.ArgumentConfig{
+						Type: graphql.String,
+					},
+					"where": &graphql.ArgumentConfig{
+						Type: boolExps[tableName],
+					},
+					"order_by": &graphql.ArgumentConfig{
+						Type: graphql.NewList(graphql.NewNonNull(orderBys[tableName])),
 					},
 				},
-				Resolve: g.resolver.ResolveGet(tenantSchema, tableName, pkName),
+				Resolve: g.resolver.ResolveConnection(tenantSchema, table, pk),
+			}
+		}
+
+		// Get Query: userById(id: ID!), or postTagsByPostIdAndTagId(postId: Int!, tagId: Int!)
+		if len(pk) > 0 {
+			queryFields[fieldName+keyFieldSuffix(pk)] = &graphql.Field{
+				Type:    gqlType,
+				Args:    g.keyArgs(table, pk),
+				Resolve: g.resolver.ResolveGet(tenantSchema, table, pk),
 			}
 		}
 	}
 
-	rootQuery := graphql.NewObject(graphql.ObjectConfig{
-		Name:   "Query",
-		Fields: queryFields,
-	})
+	// Function Queries: STABLE/IMMUTABLE functions returning rows, e.g. searchPosts(term: String!)
+	for _, fn := range metadata.Functions {
+		fieldName := strcase.ToLowerCamel(fn.Name)
+		returnType, ok := types[fn.ReturnTable]
+		if fn.Volatile || !ok || queryFields[fieldName] != nil {
+			continue
+		}
+		queryFields[fieldName] = g.buildFunctionField(tenantSchema, fn, tableMap, returnType, boolExps[fn.ReturnTable], orderBys[fn.ReturnTable])
+	}
+
+	// Search Queries: searchProducts(query: String!, limit: Int, offset: Int, where: ProductsBoolExp),
+	// for tables with tsvector columns or GIN indexed text. Functions keep their names.
+	for _, table := range metadata.Tables {
+		fieldName := "search" + strcase.ToCamel(table.Name)
+		gqlType, ok := types[table.Name]
+		if !ok || queryFields[fieldName] != nil || len(searchSources(table)) == 0 {
+			continue
+		}
+		queryFields[fieldName] = &graphql.Field{
+			Type:    graphql.NewList(graphql.NewNonNull(buildSearchResult(table, gqlType))),
+			Args:    searchArgs(boolExps[table.Name]),
+			Resolve: g.resolver.ResolveSearch(tenantSchema, table),
+		}
+	}
 
 	// 3. Create Mutation Root
+	// Nested insert inputs (e.g., PostsCreateInput) reference each other through relations
+	createInputs := make(map[string]*graphql.InputObject)
+	for _, table := range metadata.Tables {
+		if !table.ReadOnly && table.allows(opInsert) {
+			createInputs[table.Name] = g.buildCreateInput(table, tableMap, createInputs)
+		}
+	}
+
 	mutationFields := graphql.Fields{}
 	for _, table := range metadata.Tables {
+		// Views and materialized views are query-only
+		if table.ReadOnly {
+			continue
+		}
 		tableName := table.Name
 		typeName := strcase.ToCamel(tableName)
 		gqlType := types[tableName]
 		pkName := g.getPrimaryKey(table)
 
-		// Create Mutation: createBroad(name: String!, ...)
-		createArgs := graphql.FieldConfigArgument{}
-		var createCols []string
+		mutationResponse := g.buildMutationResponse(table, gqlType)
 
-		for _, col := range table.Columns {
-			argName := strcase.ToLowerCamel(col.Name)
-			argType := g.getGraphQLType(col.DataType)
-			
-			if !col.IsNullable && col.Name != pkName && col.Name != "created_at" && col.Name != "updated_at" {
-				argType = graphql.NewNonNull(argType)
+		if table.allows(opInsert) {
+			// Create Mutation: createPosts(title: String!, ..., author: AuthorsCreateInput, tags: [TagsCreateInput!])
+			mutationFields["create"+typeName] = &graphql.Field{
+				Type:    gqlType,
+				Args:    g.createArgs(table, tableMap, createInputs),
+				Resolve: g.resolver.ResolveCreate(tenantSchema, tableMap, table),
+			}
+
+			// Bulk Mutations: insertPostsMany(objects: [PostsInsertInput!]!, onConflict: PostsOnConflict),
+			// updatePostsMany(where: PostsBoolExp!, set: PostsSetInput!), deletePostsMany(where: PostsBoolExp!)
+			insertManyArgs := graphql.FieldConfigArgument{
+				"objects": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(g.buildInsertInput(table, pkName)))),
+				},
+			}
+			// Upserts overwrite existing rows, so they need the update permission,
+			// and the conflicting row may be one the row filter hides
+			if table.allows(opUpdate) && !table.hasRowFilter() {
+				if onConflict := g.buildOnConflict(table, selectColumns[tableName]); onConflict != nil {
+					insertManyArgs["onConflict"] = &graphql.ArgumentConfig{
+						Type: onConflict,
+					}
+				}
+			}
+			mutationFields["insert"+typeName+"Many"] = &graphql.Field{
+				Type:    mutationResponse,
+				Args:    insertManyArgs,
+				Resolve: g.resolver.ResolveInsertMany(tenantSchema, table),
 			}
-			
-			createArgs[argName] = &graphql.ArgumentConfig{
-				Type: argType,
+		}
+
+		if table.allows(opUpdate) {
+			mutationFields["update"+typeName+"Many"] = &graphql.Field{
+				Type: mutationResponse,
+				Args: graphql.FieldConfigArgument{
+					"where": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(boolExps[tableName]),
+					},
+					"set": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(g.buildSetInput(table, pkName)),
+					},
+				},
+				Resolve: g.resolver.ResolveUpdateMany(tenantSchema, table),
 			}
-			createCols = append(createCols, col.Name)
 		}
 
-		mutationFields["create"+typeName] = &graphql.Field{
-			Type:    gqlType,
-			Args:    createArgs,
-			Resolve: g.resolver.ResolveCreate(tenantSchema, tableName, createCols),
+		if table.allows(opDelete) {
+			mutationFields["delete"+typeName+"Many"] = &graphql.Field{
+				Type: mutationResponse,
+				Args: graphql.FieldConfigArgument{
+					"where": &graphql.ArgumentConfig{
+						Type: graphql.NewNonNull(boolExps[tableName]),
+					},
+				},
+				Resolve: g.resolver.ResolveDeleteMany(tenantSchema, table),
+			}
 		}
 
 		// Update Mutation: updatePosts(id: ID!, title: String, ...)
-		if pkName != "" {
-			updateArgs := graphql.FieldConfigArgument{
-				pkName: &graphql.ArgumentConfig{
-					Type: graphql.NewNonNull(graphql.ID),
-				},
+		if pk := primaryKeyColumns(table); len(pk) > 0 && table.allows(opUpdate) {
+			updateArgs := g.keyArgs(table, pk)
+			isKey := make(map[string]bool, len(pk))
+			for _, col := range pk {
+				isKey[col] = true
 			}
 			var updateCols []string
 
 			for _, col := range table.Columns {
 				argName := strcase.ToLowerCamel(col.Name)
 				// Skip PK in update args (already added as required)
-				if col.Name == pkName {
+				if isKey[col.Name] {
 					updateCols = append(updateCols, col.Name)
 					continue
 				}
+				if !table.writable(col.Name) {
+					continue
+				}
 				argType := g.getGraphQLType(col.DataType)
 				// All fields are optional for updates
 				updateArgs[argName] = &graphql.ArgumentConfig{
@@ -205,71 +357,279 @@ func (g *SchemaGenerator) Generate(tenantSchema string, metadata *SchemaMetadata
 				updateCols = append(updateCols, col.Name)
 			}
 
+			// Optimistic locking: update only if the row still has the expected version
+			if version := versionColumn(table); version != nil {
+				updateArgs[expectedVersionArg(version)] = &graphql.ArgumentConfig{
+					Type:        g.getGraphQLType(version.DataType),
+					Description: fmt.Sprintf("Fails with a %s error unless %s still has this value", ConflictCode, version.Name),
+				}
+			}
+
 			mutationFields["update"+typeName] = &graphql.Field{
 				Type:    gqlType,
 				Args:    updateArgs,
-				Resolve: g.resolver.ResolveUpdate(tenantSchema, tableName, pkName, updateCols),
+				Resolve: g.resolver.ResolveUpdate(tenantSchema, table, pk, updateCols),
 			}
+		}
 
-			// Delete Mutation: deletePosts(id: ID!)
+		// Delete Mutation: deletePosts(id: ID!)
+		if pk := primaryKeyColumns(table); len(pk) > 0 && table.allows(opDelete) {
 			mutationFields["delete"+typeName] = &graphql.Field{
-				Type: gqlType,
-				Args: graphql.FieldConfigArgument{
-					pkName: &graphql.ArgumentConfig{
-						Type: graphql.NewNonNull(graphql.ID),
-					},
-				},
-				Resolve: g.resolver.ResolveDelete(tenantSchema, tableName, pkName),
+				Type:    gqlType,
+				Args:    g.keyArgs(table, pk),
+				Resolve: g.resolver.ResolveDelete(tenantSchema, table, pk),
 			}
 		}
 	}
 
+	// Function Mutations: VOLATILE functions returning rows, e.g. archivePosts(before: String!)
+	for _, fn := range metadata.Functions {
+		fieldName := strcase.ToLowerCamel(fn.Name)
+		returnType, ok := types[fn.ReturnTable]
+		if !fn.Volatile || !ok || mutationFields[fieldName] != nil {
+			continue
+		}
+		mutationFields[fieldName] = g.buildFunctionField(tenantSchema, fn, tableMap, returnType, boolExps[fn.ReturnTable], orderBys[fn.ReturnTable])
+	}
+
+	// Actions: custom queries and mutations served by HTTP handlers, e.g. sendInvite(email: String!)
+	if err := g.addActionFields(metadata.Actions, types, queryFields, mutationFields); err != nil {
+		return nil, err
+	}
+
+	// Remote schemas: root fields of the tenant's GraphQL services, e.g. billing_invoices
+	remoteTypes, err := g.addRemoteSchemas(metadata.RemoteSchemas, tableMap, queryFields, mutationFields, joins)
+	if err != nil {
+		return nil, err
+	}
+
+	rootQuery := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Query",
+		Fields: queryFields,
+	})
+
 	rootMutation := graphql.NewObject(graphql.ObjectConfig{
 		Name:   "Mutation",
 		Fields: mutationFields,
 	})
 
+	// 4. Create Subscription Root
+	subscriptionFields := graphql.Fields{}
+	for _, table := range metadata.Tables {
+		// Change triggers cannot be installed on views
+		if table.ReadOnly {
+			continue
+		}
+		tableName := table.Name
+		fieldName := strcase.ToLowerCamel(tableName)
+		gqlType, ok := types[tableName]
+		if !ok {
+			continue
+		}
+
+		// Live Query: users(limit: Int, ...) re-sent whenever the users table changes
+		subscriptionFields[fieldName] = &graphql.Field{
+			Type:      graphql.NewList(gqlType),
+			Args:      listArgs(boolExps[tableName], orderBys[tableName]),
+			Subscribe: g.resolver.SubscribeLive(tenantSchema, table),
+			Resolve:   g.resolver.ResolveList(tenantSchema, tableMap, table),
+		}
+
+		// Change Stream: usersChanged emits one UsersChangeEvent per row change
+		subscriptionFields[fieldName+"Changed"] = &graphql.Field{
+			Type:      graphql.NewNonNull(g.buildChangeEvent(table, gqlType)),
+			Subscribe: g.resolver.SubscribeChanges(tenantSchema, table),
+			Resolve:   resolveSource,
+		}
+	}
+
 	schemaConfig := graphql.SchemaConfig{
-		Query:    rootQuery,
-		Mutation: rootMutation,
+		Query: rootQuery,
+		Types: remoteTypes,
+	}
+	if len(mutationFields) > 0 {
+		schemaConfig.Mutation = rootMutation
+		schemaConfig.Directives = append(append([]*graphql.Directive{}, graphql.SpecifiedDirectives...), transactionDirectiveDef)
+	}
+	if len(subscriptionFields) > 0 {
+		schemaConfig.Subscription = graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Subscription",
+			Fields: subscriptionFields,
+		})
 	}
 
 	schema, err := graphql.NewSchema(schemaConfig)
 	if err != nil {
 		return nil, err
 	}
+	if len(joinConflicts) > 0 {
+		sort.Strings(joinConflicts)
+		return nil, fmt.Errorf("remote joins conflict with existing fields: %s", strings.Join(joinConflicts, ", "))
+	}
 	return &schema, nil
 }
 
 func (g *SchemaGenerator) getGraphQLType(dataType string) graphql.Type {
+	// Arrays are reported as <element type>[]
+	if elemType := strings.TrimSuffix(dataType, "[]"); elemType != dataType {
+		return graphql.NewList(g.getGraphQLType(elemType))
+	}
+	// Enum types are reported by name
+	if enum, ok := g.enums[dataType]; ok {
+		return enum
+	}
+
 	dataType = strings.ToLower(dataType)
 	switch {
-	case strings.Contains(dataType, "int"):
+	case dataType == "bigint" || dataType == "int8" || dataType == "bigserial":
+		return BigIntScalar
+	case dataType == "interval" || strings.HasSuffix(dataType, "range"):
+		return graphql.String
+	case strings.Contains(dataType, "int") || strings.Contains(dataType, "serial"):
 		return graphql.Int
-	case strings.Contains(dataType, "char") || strings.Contains(dataType, "text") || strings.Contains(dataType, "uuid"):
+	case strings.Contains(dataType, "char") || strings.Contains(dataType, "text"):
 		return graphql.String
+	case dataType == "uuid":
+		return UUIDScalar
 	case strings.Contains(dataType, "bool"):
 		return graphql.Boolean
-	case strings.Contains(dataType, "float") || strings.Contains(dataType, "double") || strings.Contains(dataType, "numeric") || strings.Contains(dataType, "decimal"):
+	case strings.Contains(dataType, "numeric") || strings.Contains(dataType, "decimal"):
+		return DecimalScalar
+	case strings.Contains(dataType, "float") || strings.Contains(dataType, "double") || dataType == "real":
 		return graphql.Float
-	case strings.Contains(dataType, "time") || strings.Contains(dataType, "date"):
-		return graphql.String
+	case dataType == "json" || dataType == "jsonb":
+		return JSONScalar
+	case dataType == "bytea":
+		return BytesScalar
+	case strings.HasPrefix(dataType, "timestamp"):
+		return DateTimeScalar
+	case dataType == "date":
+		return DateScalar
 	default:
+		// time, interval, inet, ... keep their Postgres text representation
 		return graphql.String
 	}
 }
 
+// listArgs returns the arguments accepted by list fields (root, hasMany and live queries)
+func listArgs(boolExp, orderBy *graphql.InputObject) graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"limit": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"offset": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"where": &graphql.ArgumentConfig{
+			Type: boolExp,
+		},
+		"order_by": &graphql.ArgumentConfig{
+			Type: graphql.NewList(graphql.NewNonNull(orderBy)),
+		},
+	}
+}
+
+// relationFieldName returns the belongsTo field name for a FK column
+// (e.g., author for author_id, or the related table name when there is no Id suffix)
+func relationFieldName(col Column) string {
+	fieldName := strcase.ToLowerCamel(col.Name)
+	relationName := strings.TrimSuffix(fieldName, "Id")
+	if relationName == fieldName {
+		relationName = strcase.ToLowerCamel(col.FKTable)
+	}
+	return relationName
+}
+
+// columnDescription returns the comment of a column followed by the CHECK
+// constraints on it, which clients would otherwise only learn from failed writes.
+// Constraints reading columns hidden from the role are left out.
+func columnDescription(table Table, col Column) string {
+	var lines []string
+	if col.Comment != "" {
+		lines = append(lines, col.Comment)
+	}
+	for _, check := range table.Checks {
+		covers, visible := false, true
+		for _, name := range check.Columns {
+			covers = covers || name == col.Name
+			visible = visible && table.column(name) != nil
+		}
+		if covers && visible {
+			lines = append(lines, check.Definition)
+		}
+	}
+	return strings.Join(lines, "\n\n")
+}
+
 func (g *SchemaGenerator) getPrimaryKey(table Table) string {
+	return primaryKeyColumn(table)
+}
+
+// primaryKeyColumns returns the primary key columns of a table, falling back to "id"
+func primaryKeyColumns(table Table) []string {
+	var pk []string
 	for _, col := range table.Columns {
 		if col.IsPK {
-			return col.Name
+			pk = append(pk, col.Name)
 		}
 	}
+	if len(pk) > 0 {
+		return pk
+	}
 	// Fallback to "id" if found
 	for _, col := range table.Columns {
 		if col.Name == "id" {
-			return col.Name
+			return []string{col.Name}
+		}
+	}
+	return nil
+}
+
+// primaryKeyColumn returns the primary key column of a table with a single-column
+// key, or an empty string for composite and missing keys
+func primaryKeyColumn(table Table) string {
+	pk := primaryKeyColumns(table)
+	if len(pk) != 1 {
+		return ""
+	}
+	return pk[0]
+}
+
+// keyFieldSuffix names the single-row query of a key: ById for single-column keys,
+// By<Col>And<Col> for composite ones (e.g., ByPostIdAndTagId)
+func keyFieldSuffix(pk []string) string {
+	if len(pk) == 1 {
+		return "ById"
+	}
+	parts := make([]string, len(pk))
+	for i, col := range pk {
+		parts[i] = strcase.ToCamel(col)
+	}
+	return "By" + strings.Join(parts, "And")
+}
+
+// keyArgName returns the argument carrying a key column. Single-column keys keep
+// the column name; composite keys use the camelCase field names.
+func keyArgName(pk []string, column string) string {
+	if len(pk) == 1 {
+		return column
+	}
+	return strcase.ToLowerCamel(column)
+}
+
+// keyArgs returns the required arguments identifying a row by primary key
+func (g *SchemaGenerator) keyArgs(table Table, pk []string) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{}
+	for _, name := range pk {
+		var argType graphql.Input = graphql.ID
+		if len(pk) > 1 {
+			if col, ok := findColumn(table, strcase.ToLowerCamel(name)); ok {
+				argType = g.getGraphQLType(col.DataType)
+			}
+		}
+		args[keyArgName(pk, name)] = &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(argType),
 		}
 	}
-	return ""
+	return args
 }
@@ -0,0 +1,122 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postTagsTable is a junction table keyed by both of its foreign keys
+func postTagsTable() Table {
+	return Table{
+		Name: "post_tags",
+		Columns: []Column{
+			{Name: "post_id", DataType: "integer", IsPK: true, IsFK: true, FKTable: "posts", FKColumn: "id"},
+			{Name: "tag_id", DataType: "integer", IsPK: true},
+			{Name: "position", DataType: "integer", IsNullable: true},
+		},
+	}
+}
+
+func TestPrimaryKeyColumns(t *testing.T) {
+	assert.Equal(t, []string{"post_id", "tag_id"}, primaryKeyColumns(postTagsTable()))
+	assert.Equal(t, "", primaryKeyColumn(postTagsTable()), "composite keys have no single column")
+	assert.Equal(t, []string{"id"}, primaryKeyColumns(filterTestTable()))
+	assert.Equal(t, "id", primaryKeyColumn(filterTestTable()))
+}
+
+func TestKeyCondition(t *testing.T) {
+	pk := []string{"post_id", "tag_id"}
+	args := &queryArgs{values: []interface{}{"set value"}}
+	cond, err := keyCondition(pk, map[string]interface{}{"postId": 1, "tagId": 2}, args)
+	require.NoError(t, err)
+	assert.Equal(t, `"post_id" = $2 AND "tag_id" = $3`, cond)
+	assert.Equal(t, []interface{}{"set value", 1, 2}, args.values)
+
+	_, err = keyCondition(pk, map[string]interface{}{"postId": 1}, &queryArgs{})
+	assert.Error(t, err, "the whole key is required")
+
+	// Single-column keys keep the column name as argument
+	cond, err = keyCondition([]string{"id"}, map[string]interface{}{"id": "7"}, &queryArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, `"id" = $1`, cond)
+}
+
+func TestGenerate_CompositePrimaryKey(t *testing.T) {
+	tables := orderTestTables()
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{tables["authors"], tables["posts"], postTagsTable()},
+	})
+	require.NoError(t, err)
+
+	queries := schema.QueryType().Fields()
+	assert.Contains(t, queries, "postsById")
+	require.Contains(t, queries, "postTagsByPostIdAndTagId")
+	assert.NotContains(t, queries, "postTagsById")
+	assert.Contains(t, queries, "postTagsConnection")
+
+	argTypes := func(name string, fields map[string]string) {
+		t.Helper()
+		require.Contains(t, schema.MutationType().Fields(), name)
+		for _, arg := range schema.MutationType().Fields()[name].Args {
+			if expected, ok := fields[arg.Name()]; ok {
+				assert.Equal(t, expected, arg.Type.String(), "%s(%s)", name, arg.Name())
+				delete(fields, arg.Name())
+			}
+		}
+		assert.Empty(t, fields, "missing arguments of %s", name)
+	}
+	argTypes("updatePostTags", map[string]string{"postId": "Int!", "tagId": "Int!", "position": "Int"})
+	argTypes("deletePostTags", map[string]string{"postId": "Int!", "tagId": "Int!"})
+
+	byKey := map[string]string{}
+	for _, arg := range queries["postTagsByPostIdAndTagId"].Args {
+		byKey[arg.Name()] = arg.Type.String()
+	}
+	assert.Equal(t, map[string]string{"postId": "Int!", "tagId": "Int!"}, byKey)
+}
+
+func TestChangeTriggerSQL_CompositeKey(t *testing.T) {
+	stmts := changeTriggerSQL("tenant_test", map[string]Table{"post_tags": postTagsTable()}, primaryKeyColumns)
+	require.Len(t, stmts, 3)
+	assert.Contains(t, stmts[2], `EXECUTE FUNCTION "tenant_test"."kapok_notify_change"('post_id', 'tag_id')`)
+}
+
+func TestGenerate_CommentsAndDefaults(t *testing.T) {
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{{
+			Name:    "orders",
+			Comment: "Customer orders",
+			Columns: []Column{
+				{Name: "id", DataType: "integer", IsPK: true, HasDefault: true},
+				{Name: "status", DataType: "text", Default: "'new'::text", HasDefault: true, Comment: "Fulfilment state"},
+				{Name: "total", DataType: "integer"},
+			},
+			Checks: []CheckConstraint{
+				{Name: "orders_status_check", Columns: []string{"status"}, Definition: "CHECK (status = ANY (ARRAY['new'::text, 'paid'::text]))"},
+				{Name: "orders_total_check", Columns: []string{"total"}, Definition: "CHECK (total >= 0)"},
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	orders := schema.Type("Orders").(*graphql.Object)
+	assert.Equal(t, "Customer orders", orders.Description())
+	assert.Equal(t, "Fulfilment state\n\nCHECK (status = ANY (ARRAY['new'::text, 'paid'::text]))", orders.Fields()["status"].Description)
+	assert.Equal(t, "CHECK (total >= 0)", orders.Fields()["total"].Description)
+	assert.Empty(t, orders.Fields()["id"].Description)
+
+	// Constraints comparing to a hidden column are not described
+	table := Table{
+		Name:    "products",
+		Columns: []Column{{Name: "price", DataType: "numeric"}},
+		Checks:  []CheckConstraint{{Name: "price_above_cost", Columns: []string{"price", "cost"}, Definition: "CHECK (price > cost)"}},
+	}
+	assert.Empty(t, columnDescription(table, table.Columns[0]))
+
+	input := schema.Type("OrdersInsertInput").(*graphql.InputObject).Fields()
+	assert.Equal(t, "String", input["status"].Type.String(), "columns with a default may be omitted")
+	assert.Equal(t, "Int!", input["total"].Type.String())
+}
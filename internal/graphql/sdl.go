@@ -0,0 +1,295 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+)
+
+// builtinScalars are the scalars every schema has, which SDL leaves out
+var builtinScalars = map[string]bool{
+	"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true,
+}
+
+// GenerateSDL generates the schema of a tenant schema's tables and prints it in
+// the GraphQL schema definition language
+func GenerateSDL(schemaName string, metadata *SchemaMetadata) (string, error) {
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate(schemaName, metadata)
+	if err != nil {
+		return "", fmt.Errorf("schema generation failed: %w", err)
+	}
+	return PrintSchema(schema), nil
+}
+
+// PrintSchema prints a schema in the GraphQL schema definition language. Types,
+// fields and arguments are sorted by name so the output is stable.
+func PrintSchema(schema *graphql.Schema) string {
+	var defs []string
+
+	if def := printSchemaDefinition(schema); def != "" {
+		defs = append(defs, def)
+	}
+
+	specified := make(map[string]bool, len(graphql.SpecifiedDirectives))
+	for _, d := range graphql.SpecifiedDirectives {
+		specified[d.Name] = true
+	}
+	directives := schema.Directives()
+	sort.Slice(directives, func(i, j int) bool { return directives[i].Name < directives[j].Name })
+	for _, d := range directives {
+		if !specified[d.Name] {
+			defs = append(defs, printDirective(d))
+		}
+	}
+
+	typeMap := schema.TypeMap()
+	names := make([]string, 0, len(typeMap))
+	for name := range typeMap {
+		if !strings.HasPrefix(name, "__") && !builtinScalars[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if def := printType(typeMap[name]); def != "" {
+			defs = append(defs, def)
+		}
+	}
+
+	return strings.Join(defs, "\n\n") + "\n"
+}
+
+// printSchemaDefinition prints the schema block, left out when the root types
+// have their conventional names
+func printSchemaDefinition(schema *graphql.Schema) string {
+	roots := []struct {
+		operation string
+		object    *graphql.Object
+	}{
+		{"query", schema.QueryType()},
+		{"mutation", schema.MutationType()},
+		{"subscription", schema.SubscriptionType()},
+	}
+	conventional := true
+	var lines []string
+	for _, root := range roots {
+		if root.object == nil {
+			continue
+		}
+		if root.object.Name() != strings.Title(root.operation) {
+			conventional = false
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", root.operation, root.object.Name()))
+	}
+	if conventional {
+		return ""
+	}
+	return "schema {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+func printDirective(d *graphql.Directive) string {
+	return printDescription(d.Description, "") +
+		"directive @" + d.Name + printArgs(d.Args, "") + " on " + strings.Join(d.Locations, " | ")
+}
+
+func printType(t graphql.Type) string {
+	switch t := t.(type) {
+	case *graphql.Scalar:
+		return printDescription(t.Description(), "") + "scalar " + t.Name()
+	case *graphql.Enum:
+		values := t.Values()
+		sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+		lines := make([]string, len(values))
+		for i, v := range values {
+			lines[i] = printDescription(v.Description, "  ") + "  " + v.Name + printDeprecated(v.DeprecationReason)
+		}
+		return printDescription(t.Description(), "") + "enum " + t.Name() + printBlock(lines)
+	case *graphql.InputObject:
+		fields := t.Fields()
+		lines := make([]string, 0, len(fields))
+		for _, name := range sortedFieldNames(fields) {
+			f := fields[name]
+			lines = append(lines, printDescription(f.Description(), "  ")+
+				"  "+name+": "+f.Type.String()+printDefault(f.Type, f.DefaultValue))
+		}
+		return printDescription(t.Description(), "") + "input " + t.Name() + printBlock(lines)
+	case *graphql.Object:
+		return printDescription(t.Description(), "") + "type " + t.Name() +
+			printInterfaces(t.Interfaces()) + printFields(t.Fields())
+	case *graphql.Interface:
+		return printDescription(t.Description(), "") + "interface " + t.Name() + printFields(t.Fields())
+	case *graphql.Union:
+		members := make([]string, len(t.Types()))
+		for i, member := range t.Types() {
+			members[i] = member.Name()
+		}
+		return printDescription(t.Description(), "") + "union " + t.Name() + " = " + strings.Join(members, " | ")
+	}
+	return ""
+}
+
+func printInterfaces(interfaces []*graphql.Interface) string {
+	if len(interfaces) == 0 {
+		return ""
+	}
+	names := make([]string, len(interfaces))
+	for i, iface := range interfaces {
+		names[i] = iface.Name()
+	}
+	return " implements " + strings.Join(names, " & ")
+}
+
+func printFields(fields graphql.FieldDefinitionMap) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		f := fields[name]
+		lines[i] = printDescription(f.Description, "  ") + "  " + name + printArgs(f.Args, "  ") + ": " +
+			f.Type.String() + printDeprecated(f.DeprecationReason)
+	}
+	return printBlock(lines)
+}
+
+// printArgs prints an argument list, one argument per line when any of them has
+// a description
+func printArgs(args []*graphql.Argument, indent string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	args = append([]*graphql.Argument{}, args...)
+	sort.Slice(args, func(i, j int) bool { return args[i].Name() < args[j].Name() })
+
+	multiline := false
+	for _, arg := range args {
+		if arg.Description() != "" {
+			multiline = true
+		}
+	}
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Name() + ": " + arg.Type.String() + printDefault(arg.Type, arg.DefaultValue)
+		if multiline {
+			parts[i] = printDescription(arg.Description(), indent+"  ") + indent + "  " + parts[i]
+		}
+	}
+	if !multiline {
+		return "(" + strings.Join(parts, ", ") + ")"
+	}
+	return "(\n" + strings.Join(parts, "\n") + "\n" + indent + ")"
+}
+
+func printBlock(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return " {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+// printDescription prints a description as a block string on the lines above a
+// definition
+func printDescription(description, indent string) string {
+	if description == "" {
+		return ""
+	}
+	text := strings.ReplaceAll(description, `"""`, `\"""`)
+	if !strings.Contains(text, "\n") {
+		return indent + `"""` + text + `"""` + "\n"
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return indent + `"""` + "\n" + strings.Join(lines, "\n") + "\n" + indent + `"""` + "\n"
+}
+
+func printDeprecated(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return " @deprecated(reason: " + printValue(graphql.String, reason) + ")"
+}
+
+func printDefault(t graphql.Input, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return " = " + printValue(t, value)
+}
+
+// printValue prints a Go value of an input type as a GraphQL literal
+func printValue(t graphql.Input, value interface{}) string {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		var item graphql.Input
+		if list, ok := t.(*graphql.List); ok {
+			item = list.OfType
+		}
+		items := make([]string, len(v))
+		for i, value := range v {
+			items[i] = printValue(item, value)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		fields := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			var field graphql.Input
+			if object, ok := t.(*graphql.InputObject); ok && object.Fields()[key] != nil {
+				field = object.Fields()[key].Type
+			}
+			fields = append(fields, key+": "+printValue(field, v[key]))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	if enum, ok := t.(*graphql.Enum); ok {
+		for _, ev := range enum.Values() {
+			if ev.Value == value {
+				return ev.Name
+			}
+		}
+	}
+	// Strings, numbers and booleans print like JSON
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", fmt.Sprint(value))
+	}
+	return string(b)
+}
+
+func sortedFieldNames(fields graphql.InputObjectFieldMap) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServeSDL serves the schema of the tenant, as the caller's role sees it, in the
+// GraphQL schema definition language. The SDL is printed once per cached schema.
+func (h *Handler) ServeSDL(w http.ResponseWriter, r *http.Request) {
+	_, cached, ok := h.requestSchema(r.Context(), w)
+	if !ok {
+		return
+	}
+	cached.sdlOnce.Do(func() {
+		cached.sdl = PrintSchema(cached.schema)
+	})
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(cached.sdl))
+}
@@ -0,0 +1,161 @@
+package graphql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintSchema_GeneratedSchema(t *testing.T) {
+	sdl := PrintSchema(restTestSchema(t, openAPITestMetadata()))
+
+	// The printed schema is a valid document with a definition per type
+	doc, err := parser.Parse(parser.ParseParams{Source: sdl})
+	require.NoError(t, err)
+	defined := map[string]bool{}
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.ObjectDefinition:
+			defined[def.Name.Value] = true
+		case *ast.InputObjectDefinition:
+			defined[def.Name.Value] = true
+		case *ast.EnumDefinition:
+			defined[def.Name.Value] = true
+		case *ast.ScalarDefinition:
+			defined[def.Name.Value] = true
+		case *ast.DirectiveDefinition:
+			defined["@"+def.Name.Value] = true
+		}
+	}
+	for _, name := range []string{"Query", "Mutation", "Subscription", "Orders", "OrdersBoolExp", "Status", "BigInt", "@transaction"} {
+		assert.True(t, defined[name], "missing %s", name)
+	}
+	// Built-in scalars, introspection types and specified directives are left out
+	for _, name := range []string{"String", "Boolean", "__Schema", "__Type", "@skip", "@deprecated"} {
+		assert.False(t, defined[name], "unexpected %s", name)
+	}
+
+	assert.NotContains(t, sdl, "schema {")
+	assert.Contains(t, sdl, "enum Status {\n  draft\n  published\n}")
+	assert.Contains(t, sdl, "type Orders {\n")
+	assert.Contains(t, sdl, `  """Free text"""`+"\n  note: String\n")
+	assert.Contains(t, sdl, "  ordersById(id: ID!): Orders\n")
+
+	// Output is stable across prints
+	assert.Equal(t, sdl, PrintSchema(restTestSchema(t, openAPITestMetadata())))
+}
+
+func TestPrintSchema_Definitions(t *testing.T) {
+	status := graphql.NewEnum(graphql.EnumConfig{
+		Name: "Status",
+		Values: graphql.EnumValueConfigMap{
+			"open":   &graphql.EnumValueConfig{Value: "open"},
+			"closed": &graphql.EnumValueConfig{Value: "closed", DeprecationReason: "Use open"},
+		},
+	})
+	filter := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "Filter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"tags":  &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.String), DefaultValue: []interface{}{"a", "b"}},
+			"limit": &graphql.InputObjectFieldConfig{Type: graphql.Int, DefaultValue: 10},
+		},
+	})
+	item := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Item",
+		Description: "An item\nwith two lines",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"old":  &graphql.Field{Type: graphql.String, DeprecationReason: "Use name"},
+		},
+	})
+	root := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Root",
+		Fields: graphql.Fields{
+			"items": &graphql.Field{
+				Type: graphql.NewList(item),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: filter, Description: "Rows to return"},
+					"status": &graphql.ArgumentConfig{Type: status, DefaultValue: "open"},
+				},
+			},
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: root})
+	require.NoError(t, err)
+
+	assert.Equal(t, `schema {
+  query: Root
+}
+
+input Filter {
+  limit: Int = 10
+  tags: [String] = ["a", "b"]
+}
+
+"""
+An item
+with two lines
+"""
+type Item {
+  name: String!
+  old: String @deprecated(reason: "Use name")
+}
+
+type Root {
+  items(
+    """Rows to return"""
+    filter: Filter
+    status: Status = open
+  ): [Item]
+}
+
+enum Status {
+  closed @deprecated(reason: "Use open")
+  open
+}
+`, PrintSchema(&schema))
+}
+
+func TestPrintValue(t *testing.T) {
+	assert.Equal(t, "null", printValue(graphql.String, nil))
+	assert.Equal(t, `"a \"b\""`, printValue(graphql.String, `a "b"`))
+	assert.Equal(t, "1.5", printValue(graphql.Float, 1.5))
+	assert.Equal(t, "true", printValue(graphql.Boolean, true))
+	assert.Equal(t, `{a: 1, b: [true, null]}`, printValue(nil, map[string]interface{}{"b": []interface{}{true, nil}, "a": 1}))
+	// Enum values print by name
+	assert.Equal(t, "[asc, desc_nulls_last]", printValue(graphql.NewList(graphql.NewNonNull(orderDirectionEnum)), []interface{}{"ASC", "DESC NULLS LAST"}))
+}
+
+func TestHandler_ServeSDL(t *testing.T) {
+	metadata := restTestMetadata()
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits()}
+	cached := &cachedSchema{
+		schema:    restTestSchema(t, metadata),
+		metadata:  metadata,
+		expiresAt: time.Now().Add(time.Minute),
+	}
+	h.schemaCache.Store("tenant_test", cached)
+	ten := &tenant.Tenant{ID: "t1", SchemaName: "tenant_test"}
+
+	req := httptest.NewRequest(http.MethodGet, "/graphql/schema.graphql", nil)
+	rec := httptest.NewRecorder()
+	h.ServeSDL(rec, req.WithContext(tenant.WithTenant(req.Context(), ten)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, PrintSchema(cached.schema), rec.Body.String())
+	assert.Equal(t, cached.sdl, rec.Body.String())
+
+	// Requests without a tenant are rejected
+	rec = httptest.NewRecorder()
+	h.ServeSDL(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,379 @@
+package graphql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+)
+
+const (
+	// searchFilterField is the BoolExp field matching rows against a search query
+	searchFilterField = "_search"
+
+	// Columns added to search queries for the rank and the snippets
+	searchRankColumn    = "__kapok_rank"
+	searchSnippetPrefix = "__kapok_snippet_"
+
+	// searchHeadlineOptions highlights matches with <mark> in snippets
+	searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+// searchSnippetType is a highlighted excerpt of a matching column. Its text is
+// HTML: the column's text escaped, with matches in <mark> tags.
+var searchSnippetType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "SearchSnippet",
+	Fields: graphql.Fields{
+		"field": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"text": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "HTML excerpt of the column, its text escaped and matches wrapped in <mark>",
+		},
+	},
+})
+
+// searchSource is something a search query is matched against: a text search
+// vector (a tsvector column or an indexed to_tsvector expression), or a text
+// column with a trigram index
+type searchSource struct {
+	// Vector is the tsvector expression, empty for trigram columns
+	Vector string
+	// Config is the text search configuration, empty for the server default
+	Config string
+	// Column is the trigram indexed column, whose rank and snippets use the
+	// simple configuration
+	Column string
+	// Snippets are the text columns highlighted in results
+	Snippets []string
+}
+
+var (
+	// regconfigArg reads the configuration of to_tsvector('english'::regconfig, ...)
+	regconfigArg = regexp.MustCompile(`to_tsvector\('([^']+)'::regconfig`)
+	// identifierToken finds the identifiers an expression may reference
+	identifierToken = regexp.MustCompile(`"([^"]+)"|\b([a-z_][a-z0-9_]*)\b`)
+)
+
+// trigramOpClasses are pg_trgm's operator classes, which make text columns
+// searchable by similarity
+var trigramOpClasses = map[string]bool{"gin_trgm_ops": true, "gist_trgm_ops": true}
+
+// searchSources returns what a table is searched by: its tsvector columns,
+// to_tsvector expressions of its GIN indexes and trigram indexed text columns.
+// Tables without any are not searchable.
+func searchSources(table Table) []searchSource {
+	var sources []searchSource
+	seen := make(map[string]bool)
+
+	for _, col := range table.Columns {
+		if col.DataType != "tsvector" || readsHiddenColumns(table, col.Default) {
+			continue
+		}
+		// Generated tsvector columns name their configuration and source columns
+		sources = append(sources, searchSource{
+			Vector:   fmt.Sprintf(`"%s"`, col.Name),
+			Config:   searchConfig(col.Default),
+			Snippets: textColumns(table, col.Default),
+		})
+		seen[col.Name] = true
+	}
+
+	for _, idx := range table.Indexes {
+		if idx.Method != "gin" && idx.Method != "gist" {
+			continue
+		}
+		for i, key := range idx.Columns {
+			if strings.HasPrefix(key, "to_tsvector(") {
+				if seen[key] || readsHiddenColumns(table, key) {
+					continue
+				}
+				seen[key] = true
+				sources = append(sources, searchSource{
+					Vector:   key,
+					Config:   searchConfig(key),
+					Snippets: textColumns(table, key),
+				})
+				continue
+			}
+			// Only pg_trgm's operator classes serve similarity searches
+			if i >= len(idx.OpClasses) || !trigramOpClasses[idx.OpClasses[i]] {
+				continue
+			}
+			col := table.column(strings.Trim(key, `"`))
+			if col == nil || !isTextType(col.DataType) || seen[col.Name] {
+				continue
+			}
+			seen[col.Name] = true
+			sources = append(sources, searchSource{Column: col.Name, Config: "simple", Snippets: []string{col.Name}})
+		}
+	}
+	return sources
+}
+
+// searchConfig returns the text search configuration named in an expression, or
+// an empty string for the server default
+func searchConfig(expr string) string {
+	m := regconfigArg.FindStringSubmatch(expr)
+	if m == nil || !validSQLIdentifier.MatchString(m[1]) {
+		return ""
+	}
+	return m[1]
+}
+
+// textColumns returns the text columns of a table referenced by an expression
+func textColumns(table Table, expr string) []string {
+	var cols []string
+	added := make(map[string]bool)
+	for _, m := range identifierToken.FindAllStringSubmatch(expr, -1) {
+		name := m[1] + m[2]
+		col := table.column(name)
+		if col == nil || !isTextType(col.DataType) || added[name] {
+			continue
+		}
+		added[name] = true
+		cols = append(cols, name)
+	}
+	return cols
+}
+
+// readsHiddenColumns reports whether an expression references columns the role
+// a table is restricted to cannot read, which searches must not match against
+func readsHiddenColumns(table Table, expr string) bool {
+	if table.access == nil {
+		return false
+	}
+	full := Table{Columns: table.access.columns}
+	for _, m := range identifierToken.FindAllStringSubmatch(expr, -1) {
+		name := m[1] + m[2]
+		if full.column(name) != nil && table.column(name) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isTextType(dataType string) bool {
+	return dataType == "text" || strings.Contains(dataType, "char")
+}
+
+// tsQuery returns the tsquery of a search in a configuration
+func tsQuery(config, placeholder string) string {
+	if config == "" {
+		return fmt.Sprintf("websearch_to_tsquery(%s)", placeholder)
+	}
+	return fmt.Sprintf("websearch_to_tsquery('%s', %s)", config, placeholder)
+}
+
+// compiledSearch holds the SQL of a search query: the condition matching rows,
+// their rank and one snippet expression per snippet field
+type compiledSearch struct {
+	match    string
+	rank     string
+	snippets []string
+	fields   []string
+}
+
+// compileSearch builds the SQL matching a table's rows against query
+func compileSearch(table Table, query string, args *queryArgs) (*compiledSearch, error) {
+	sources := searchSources(table)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%s is not searchable", table.Name)
+	}
+	q := args.add(query)
+	var pattern string
+
+	search := &compiledSearch{}
+	var matches, ranks []string
+	for _, src := range sources {
+		tsq := tsQuery(src.Config, q)
+		if src.Vector != "" {
+			matches = append(matches, fmt.Sprintf("(%s) @@ %s", src.Vector, tsq))
+			ranks = append(ranks, fmt.Sprintf("ts_rank(%s, %s)", src.Vector, tsq))
+		} else {
+			// Substring matches use the trigram index; whole words rank higher
+			if pattern == "" {
+				pattern = args.add("%" + escapeLike(query) + "%")
+			}
+			matches = append(matches, fmt.Sprintf(`"%s" ILIKE %s`, src.Column, pattern))
+			ranks = append(ranks, fmt.Sprintf(`ts_rank(to_tsvector('simple', COALESCE("%s", '')), %s)`, src.Column, tsq))
+		}
+		for _, col := range src.Snippets {
+			search.snippets = append(search.snippets,
+				fmt.Sprintf(`ts_headline(%s%s, %s, '%s')`, configArg(src.Config), htmlEscapeColumn(col), tsq, searchHeadlineOptions))
+			search.fields = append(search.fields, strcase.ToLowerCamel(col))
+		}
+	}
+	search.match = "(" + strings.Join(matches, " OR ") + ")"
+	search.rank = "(" + strings.Join(ranks, " + ") + ")::float8"
+	return search, nil
+}
+
+func configArg(config string) string {
+	if config == "" {
+		return ""
+	}
+	return fmt.Sprintf("'%s', ", config)
+}
+
+// htmlEscapes are the HTML special characters and their entities, & first
+var htmlEscapes = [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"'", "&#39;"}}
+
+// htmlEscapeColumn escapes the HTML special characters of a column, so the
+// <mark> tags of a snippet are its only markup
+func htmlEscapeColumn(col string) string {
+	expr := fmt.Sprintf(`"%s"`, col)
+	for _, e := range htmlEscapes {
+		expr = fmt.Sprintf("replace(%s, '%s', '%s')", expr, strings.ReplaceAll(e[0], "'", "''"), e[1])
+	}
+	return expr
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// searchCondition compiles the _search filter of a BoolExp
+func searchCondition(table Table, val interface{}, args *queryArgs) (string, error) {
+	query, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("%s expects a string", searchFilterField)
+	}
+	search, err := compileSearch(table, query, args)
+	if err != nil {
+		return "", err
+	}
+	return search.match, nil
+}
+
+// buildSearchResult creates the <Type>SearchResult object of search fields
+func buildSearchResult(table Table, nodeType *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: strcase.ToCamel(table.Name) + "SearchResult",
+		Fields: graphql.Fields{
+			"rank":     &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"snippets": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(searchSnippetType)))},
+			"node":     &graphql.Field{Type: graphql.NewNonNull(nodeType)},
+		},
+	})
+}
+
+// searchArgs returns the arguments of search fields
+func searchArgs(boolExp *graphql.InputObject) graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"query": &graphql.ArgumentConfig{
+			Type: graphql.NewNonNull(graphql.String),
+		},
+		"limit": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"offset": &graphql.ArgumentConfig{
+			Type: graphql.Int,
+		},
+		"where": &graphql.ArgumentConfig{
+			Type: boolExp,
+		},
+	}
+}
+
+// ResolveSearch returns a function that resolves the rows of a table matching a
+// full-text search, best ranked first, with highlighted snippets
+func (r *Resolver) ResolveSearch(schemaName string, table Table) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if err := validateIdentifier(schemaName); err != nil {
+			return nil, fmt.Errorf("invalid schema name")
+		}
+		if err := validateIdentifier(table.Name); err != nil {
+			return nil, fmt.Errorf("invalid table name")
+		}
+
+		args := &queryArgs{}
+		source, err := tableSource(p.Context, schemaName, table, args)
+		if err != nil {
+			return nil, err
+		}
+		query, _ := p.Args["query"].(string)
+		search, err := compileSearch(table, query, args)
+		if err != nil {
+			return nil, err
+		}
+
+		selects := []string{"*", fmt.Sprintf(`%s AS "%s"`, search.rank, searchRankColumn)}
+		for i, snippet := range search.snippets {
+			selects = append(selects, fmt.Sprintf(`%s AS "%s%d"`, snippet, searchSnippetPrefix, i))
+		}
+		sqlQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(selects, ", "), source, search.match)
+
+		if where, ok := p.Args["where"].(map[string]interface{}); ok {
+			cond, err := buildWhere(table, where, args)
+			if err != nil {
+				return nil, err
+			}
+			if cond != "" {
+				sqlQuery += " AND " + cond
+			}
+		}
+
+		// Ties keep a stable order across pages
+		order := []string{fmt.Sprintf(`"%s" DESC`, searchRankColumn)}
+		for _, col := range primaryKeyColumns(table) {
+			order = append(order, fmt.Sprintf(`"%s"`, col))
+		}
+		sqlQuery += " ORDER BY " + strings.Join(order, ", ")
+
+		limit, _ := p.Args["limit"].(int)
+		offset, _ := p.Args["offset"].(int)
+		if limit <= 0 {
+			limit = DefaultLimit
+		}
+		if limit > MaxLimit {
+			limit = MaxLimit
+		}
+		sqlQuery += fmt.Sprintf(" LIMIT %d", limit)
+		if offset > 0 {
+			sqlQuery += fmt.Sprintf(" OFFSET %d", offset)
+		}
+
+		rows, err := r.conn(p.Context).QueryContext(p.Context, sqlQuery, args.values...)
+		if err != nil {
+			return nil, r.dbError(p.Context, err, "search failed")
+		}
+		defer rows.Close()
+
+		results, err := r.scanRows(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read results")
+		}
+		return searchResults(results, search.fields), nil
+	}
+}
+
+// searchResults splits the rank and snippet columns of scanned rows from the
+// rows themselves. Snippets without a highlighted match are dropped.
+func searchResults(rows []map[string]interface{}, fields []string) []map[string]interface{} {
+	rankKey := strcase.ToLowerCamel(searchRankColumn)
+	results := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		rank, _ := row[rankKey].(float64)
+		delete(row, rankKey)
+
+		snippets := []map[string]interface{}{}
+		for i, field := range fields {
+			key := strcase.ToLowerCamel(fmt.Sprintf("%s%d", searchSnippetPrefix, i))
+			text, _ := row[key].(string)
+			delete(row, key)
+			if strings.Contains(text, "<mark>") {
+				snippets = append(snippets, map[string]interface{}{"field": field, "text": text})
+			}
+		}
+
+		results = append(results, map[string]interface{}{
+			"rank":     rank,
+			"snippets": snippets,
+			"node":     row,
+		})
+	}
+	return results
+}
@@ -0,0 +1,130 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func searchTestTable() Table {
+	return Table{
+		Name: "products",
+		Columns: []Column{
+			{Name: "id", DataType: "integer", IsPK: true},
+			{Name: "name", DataType: "text"},
+			{Name: "description", DataType: "text", IsNullable: true},
+			{Name: "sku", DataType: "character varying"},
+			{Name: "document", DataType: "tsvector", HasDefault: true,
+				Default: `to_tsvector('english'::regconfig, (name || ' '::text) || COALESCE(description, ''::text))`},
+		},
+		Indexes: []Index{
+			{Name: "products_pkey", Columns: []string{"id"}, Unique: true, Primary: true, Method: "btree"},
+			{Name: "products_document_idx", Columns: []string{"document"}, Method: "gin"},
+			{Name: "products_sku_trgm_idx", Columns: []string{"sku"}, OpClasses: []string{"gin_trgm_ops"}, Method: "gin"},
+		},
+	}
+}
+
+func TestSearchSources(t *testing.T) {
+	assert.Equal(t, []searchSource{
+		{Vector: `"document"`, Config: "english", Snippets: []string{"name", "description"}},
+		{Column: "sku", Config: "simple", Snippets: []string{"sku"}},
+	}, searchSources(searchTestTable()))
+
+	indexed := Table{
+		Name:    "articles",
+		Columns: []Column{{Name: "id", DataType: "integer", IsPK: true}, {Name: "body", DataType: "text"}},
+		Indexes: []Index{{Name: "articles_body_fts", Columns: []string{"to_tsvector('simple'::regconfig, body)"}, Method: "gin"}},
+	}
+	assert.Equal(t, []searchSource{
+		{Vector: "to_tsvector('simple'::regconfig, body)", Config: "simple", Snippets: []string{"body"}},
+	}, searchSources(indexed))
+
+	plain := Table{
+		Name:    "notes",
+		Columns: []Column{{Name: "id", DataType: "integer"}, {Name: "body", DataType: "text"}},
+		Indexes: []Index{{Name: "notes_body_idx", Columns: []string{"body"}, Method: "btree"}},
+	}
+	assert.Empty(t, searchSources(plain), "btree indexes do not make a table searchable")
+
+	// A GIN index on a text column needs pg_trgm's operator class, e.g. not btree_gin's
+	plain.Indexes = []Index{{Name: "notes_body_gin", Columns: []string{"body"}, OpClasses: []string{"text_ops"}, Method: "gin"}}
+	assert.Empty(t, searchSources(plain), "only trigram indexes make text columns searchable")
+	plain.Indexes[0].OpClasses = []string{"gist_trgm_ops"}
+	plain.Indexes[0].Method = "gist"
+	assert.Equal(t, []searchSource{{Column: "body", Config: "simple", Snippets: []string{"body"}}}, searchSources(plain))
+
+	restricted := searchTestTable()
+	restricted.access = &tableAccess{columns: restricted.Columns}
+	restricted.Columns = []Column{restricted.Columns[0], restricted.Columns[1], restricted.Columns[3], restricted.Columns[4]}
+	assert.Equal(t, []searchSource{{Column: "sku", Config: "simple", Snippets: []string{"sku"}}}, searchSources(restricted),
+		"vectors built from hidden columns are not searched")
+}
+
+func TestCompileSearch(t *testing.T) {
+	args := &queryArgs{}
+	search, err := compileSearch(searchTestTable(), "50%_off", args)
+	require.NoError(t, err)
+
+	assert.Equal(t, `(("document") @@ websearch_to_tsquery('english', $1) OR "sku" ILIKE $2)`, search.match)
+	assert.Equal(t, `(ts_rank("document", websearch_to_tsquery('english', $1)) + `+
+		`ts_rank(to_tsvector('simple', COALESCE("sku", '')), websearch_to_tsquery('simple', $1)))::float8`, search.rank)
+	assert.Equal(t, []string{"name", "description", "sku"}, search.fields)
+	assert.Equal(t, `ts_headline('english', `+htmlEscapeColumn("name")+`, websearch_to_tsquery('english', $1), '`+searchHeadlineOptions+`')`, search.snippets[0])
+	assert.Equal(t, []interface{}{"50%_off", `%50\%\_off%`}, args.values)
+
+	_, err = compileSearch(Table{Name: "notes"}, "x", &queryArgs{})
+	assert.Error(t, err)
+}
+
+func TestHTMLEscapeColumn(t *testing.T) {
+	assert.Equal(t, `replace(replace(replace(replace(replace("name", '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`,
+		htmlEscapeColumn("name"))
+}
+
+func TestBuildWhere_Search(t *testing.T) {
+	args := &queryArgs{}
+	cond, err := buildWhere(searchTestTable(), map[string]interface{}{
+		"_search": "lamp",
+		"id":      map[string]interface{}{"_gt": 3},
+	}, args)
+	require.NoError(t, err)
+	assert.Equal(t, `(("document") @@ websearch_to_tsquery('english', $1) OR "sku" ILIKE $2) AND "id" > $3`, cond)
+}
+
+func TestSearchResults(t *testing.T) {
+	rows := []map[string]interface{}{{
+		"id":              1,
+		"KapokRank":       0.5,
+		"KapokSnippet0":   "red <mark>lamp</mark>",
+		"KapokSnippet1":   "no match here",
+		"unrelatedColumn": "kept",
+	}}
+	results := searchResults(rows, []string{"name", "description"})
+	require.Len(t, results, 1)
+	assert.Equal(t, 0.5, results[0]["rank"])
+	assert.Equal(t, []map[string]interface{}{{"field": "name", "text": "red <mark>lamp</mark>"}}, results[0]["snippets"])
+	assert.Equal(t, map[string]interface{}{"id": 1, "unrelatedColumn": "kept"}, results[0]["node"])
+}
+
+func TestGenerate_SearchFields(t *testing.T) {
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{searchTestTable(), {Name: "notes", Columns: []Column{{Name: "id", DataType: "integer", IsPK: true}, {Name: "body", DataType: "text"}}}},
+	})
+	require.NoError(t, err)
+
+	fields := schema.QueryType().Fields()
+	require.Contains(t, fields, "searchProducts")
+	assert.NotContains(t, fields, "searchNotes")
+	assert.Equal(t, "[ProductsSearchResult!]", fields["searchProducts"].Type.String())
+	var argNames []string
+	for _, arg := range fields["searchProducts"].Args {
+		argNames = append(argNames, arg.Name())
+	}
+	assert.ElementsMatch(t, []string{"query", "limit", "offset", "where"}, argNames)
+
+	assert.Contains(t, schema.Type("ProductsBoolExp").(*graphql.InputObject).Fields(), "_search")
+	assert.NotContains(t, schema.Type("NotesBoolExp").(*graphql.InputObject).Fields(), "_search")
+}
@@ -0,0 +1,400 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/iancoleman/strcase"
+	"github.com/kapok/kapok/internal/database"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/lib/pq"
+)
+
+const (
+	// changeChannelPrefix prefixes the NOTIFY channel of each tenant schema
+	changeChannelPrefix = "kapok_changes_"
+	// changeTriggerName names both the trigger function and the per-table triggers
+	changeTriggerName = "kapok_notify_change"
+	// maxChangePayload keeps NOTIFY payloads under Postgres' 8000 byte limit;
+	// larger rows are sent with only their primary key and re-read on delivery
+	maxChangePayload = 7900
+)
+
+// changeOpEnum is the kind of row change carried by <Type>ChangeEvent
+var changeOpEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ChangeOp",
+	Values: graphql.EnumValueConfigMap{
+		"INSERT": &graphql.EnumValueConfig{Value: "INSERT"},
+		"UPDATE": &graphql.EnumValueConfig{Value: "UPDATE"},
+		"DELETE": &graphql.EnumValueConfig{Value: "DELETE"},
+	},
+})
+
+// changeEvent is the NOTIFY payload sent by the change trigger
+type changeEvent struct {
+	Table   string                 `json:"table"`
+	Op      string                 `json:"op"`
+	Row     map[string]interface{} `json:"row"`
+	Partial bool                   `json:"partial"`
+}
+
+// changeChannel returns the NOTIFY channel carrying row changes of a tenant schema
+func changeChannel(schemaName string) string {
+	return changeChannelPrefix + schemaName
+}
+
+// decodeChangeEvent parses a trigger payload, converting the row to GraphQL field names
+func decodeChangeEvent(payload string) (*changeEvent, error) {
+	dec := json.NewDecoder(strings.NewReader(payload))
+	dec.UseNumber()
+	var ev changeEvent
+	if err := dec.Decode(&ev); err != nil {
+		return nil, fmt.Errorf("invalid change payload: %w", err)
+	}
+	if ev.Table == "" || ev.Op == "" {
+		return nil, fmt.Errorf("invalid change payload: missing table or op")
+	}
+
+	row := make(map[string]interface{}, len(ev.Row))
+	for col, val := range ev.Row {
+		if n, ok := val.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				val = i
+			} else if f, err := n.Float64(); err == nil {
+				val = f
+			}
+		}
+		row[strcase.ToLowerCamel(col)] = val
+	}
+	ev.Row = row
+	return &ev, nil
+}
+
+// changeTriggerSQL returns the statements installing the change trigger on the
+// tables of a schema. The trigger arguments are the table's primary key columns,
+// which are all that is sent when a row is too large for a NOTIFY payload.
+func changeTriggerSQL(schemaName string, tables map[string]Table, pkColumns func(Table) []string) []string {
+	stmts := []string{fmt.Sprintf(`CREATE OR REPLACE FUNCTION "%[1]s"."%[2]s"() RETURNS trigger AS $$
+DECLARE
+	rec jsonb;
+	payload text;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		rec := to_jsonb(OLD);
+	ELSE
+		rec := to_jsonb(NEW);
+	END IF;
+	payload := jsonb_build_object('table', TG_TABLE_NAME, 'op', TG_OP, 'row', rec)::text;
+	IF octet_length(payload) > %[3]d THEN
+		payload := jsonb_build_object('table', TG_TABLE_NAME, 'op', TG_OP, 'partial', true,
+			'row', (SELECT COALESCE(jsonb_object_agg(k, rec -> k), '{}'::jsonb) FROM unnest(TG_ARGV) AS k))::text;
+	END IF;
+	PERFORM pg_notify('%[4]s', payload);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`, schemaName, changeTriggerName, maxChangePayload, changeChannel(schemaName))}
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pk := pkColumns(tables[name])
+		quoted := make([]string, len(pk))
+		for i, col := range pk {
+			quoted[i] = "'" + col + "'"
+		}
+		arg := strings.Join(quoted, ", ")
+		stmts = append(stmts,
+			fmt.Sprintf(`DROP TRIGGER IF EXISTS "%s" ON "%s"."%s"`, changeTriggerName, schemaName, name),
+			fmt.Sprintf(`CREATE TRIGGER "%s" AFTER INSERT OR UPDATE OR DELETE ON "%s"."%s" FOR EACH ROW EXECUTE FUNCTION "%s"."%s"(%s)`,
+				changeTriggerName, schemaName, name, schemaName, changeTriggerName, arg),
+		)
+	}
+	return stmts
+}
+
+// ensureChangeTrigger installs the change trigger of a table on its first
+// subscription. The trigger stays once the subscriptions end, so only writes to
+// tables that have had subscribers pay for a NOTIFY.
+func (r *Resolver) ensureChangeTrigger(ctx context.Context, schemaName string, table Table) error {
+	if err := validateIdentifier(table.Name); err != nil {
+		return fmt.Errorf("invalid table name")
+	}
+	// The trigger arguments must not depend on the columns the role may read
+	if table.access != nil {
+		table.Columns = table.access.columns
+	}
+
+	r.triggerMu.Lock()
+	defer r.triggerMu.Unlock()
+
+	if r.triggers[schemaName][table.Name] {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to install change triggers")
+	}
+	defer tx.Rollback()
+
+	// Change triggers leave the GraphQL schema as it is
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`SET LOCAL %s = 'on'`, database.SkipSchemaChangeSetting)); err != nil {
+		return fmt.Errorf("failed to install change triggers")
+	}
+	for _, stmt := range changeTriggerSQL(schemaName, map[string]Table{table.Name: table}, primaryKeyColumns) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to install change triggers")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to install change triggers")
+	}
+
+	if r.triggers[schemaName] == nil {
+		r.triggers[schemaName] = make(map[string]bool)
+	}
+	r.triggers[schemaName][table.Name] = true
+	return nil
+}
+
+// forgetChangeTriggers makes the next subscription to a schema reinstall its
+// change triggers, which DDL may have dropped with their tables
+func (r *Resolver) forgetChangeTriggers(schemaName string) {
+	r.triggerMu.Lock()
+	defer r.triggerMu.Unlock()
+	delete(r.triggers, schemaName)
+}
+
+// notifier returns the shared LISTEN connection, opening it on first use
+func (r *Resolver) notifier() *database.Notifier {
+	r.notifierOnce.Do(func() {
+		r.changes = database.NewNotifier(r.db.Config(), r.logger)
+	})
+	return r.changes
+}
+
+// listenChanges checks the subscriber belongs to the tenant owning schemaName,
+// installs the table's change trigger and starts listening on the schema's channel
+func (r *Resolver) listenChanges(ctx context.Context, schemaName string, table Table) (<-chan *pq.Notification, func(), error) {
+	if err := validateIdentifier(schemaName); err != nil {
+		return nil, nil, fmt.Errorf("invalid schema name")
+	}
+
+	// Events are only ever read from the channel of the caller's own tenant
+	t, err := tenant.GetTenant(ctx)
+	if err != nil || t.SchemaName != schemaName {
+		return nil, nil, fmt.Errorf("subscription not allowed for this tenant")
+	}
+
+	if err := r.ensureChangeTrigger(ctx, schemaName, table); err != nil {
+		return nil, nil, err
+	}
+
+	events, cancel, err := r.notifier().Subscribe(changeChannel(schemaName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to subscribe to changes")
+	}
+	return events, cancel, nil
+}
+
+// SubscribeChanges returns a subscribe function streaming the row changes of a table.
+// Rows too large for a notification are re-read by primary key before delivery.
+func (r *Resolver) SubscribeChanges(schemaName string, table Table) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		events, cancel, err := r.listenChanges(p.Context, schemaName, table)
+		if err != nil {
+			return nil, err
+		}
+		pk := primaryKeyColumns(table)
+
+		out := make(chan interface{})
+		go func() {
+			defer close(out)
+			defer cancel()
+			for {
+				select {
+				case <-p.Context.Done():
+					return
+				case n, ok := <-events:
+					if !ok {
+						return
+					}
+					if n == nil {
+						continue
+					}
+					ev, err := decodeChangeEvent(n.Extra)
+					if err != nil || ev.Table != table.Name {
+						continue
+					}
+					if table.hasRowFilter() {
+						// Rows are only streamed once re-read through the row filter;
+						// deleted rows cannot be checked and are not streamed
+						row, ok := r.visibleRow(p.Context, schemaName, table, pk, ev)
+						if !ok {
+							continue
+						}
+						ev.Row = row
+					} else if ev.Partial && ev.Op != "DELETE" && len(pk) > 0 {
+						ev.Row = r.reloadRow(p.Context, schemaName, table.Name, pk, ev.Row)
+					}
+					select {
+					case out <- map[string]interface{}{"op": ev.Op, "table": ev.Table, "row": ev.Row}:
+					case <-p.Context.Done():
+						return
+					}
+				}
+			}
+		}()
+		return out, nil
+	}
+}
+
+// SubscribeLive returns a subscribe function that emits once immediately and again
+// whenever the table changes, so the field's resolver re-runs the list query.
+func (r *Resolver) SubscribeLive(schemaName string, table Table) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		events, cancel, err := r.listenChanges(p.Context, schemaName, table)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make(chan interface{})
+		go func() {
+			defer close(out)
+			defer cancel()
+			for {
+				select {
+				case out <- struct{}{}:
+				case <-p.Context.Done():
+					return
+				}
+				if !r.waitForChange(p.Context, events, table.Name) {
+					return
+				}
+			}
+		}()
+		return out, nil
+	}
+}
+
+// waitForChange blocks until the table changes (or the listener reconnects), then
+// drains already queued notifications so a burst of writes triggers a single refresh
+func (r *Resolver) waitForChange(ctx context.Context, events <-chan *pq.Notification, tableName string) bool {
+	changed := false
+	for !changed {
+		select {
+		case <-ctx.Done():
+			return false
+		case n, ok := <-events:
+			if !ok {
+				return false
+			}
+			changed = affectsTable(n, tableName)
+		}
+	}
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// affectsTable reports whether a notification may change the rows of tableName
+func affectsTable(n *pq.Notification, tableName string) bool {
+	if n == nil {
+		return true
+	}
+	ev, err := decodeChangeEvent(n.Extra)
+	return err == nil && ev.Table == tableName
+}
+
+// reloadRow reads a row by the primary key of a partial row, falling back to the
+// partial row when it is gone
+func (r *Resolver) reloadRow(ctx context.Context, schemaName, tableName string, pk []string, partial map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{}, len(pk))
+	for _, col := range pk {
+		values[keyArgName(pk, col)] = partial[strcase.ToLowerCamel(col)]
+	}
+	args := &queryArgs{}
+	cond, err := keyCondition(pk, values, args)
+	if err != nil {
+		return partial
+	}
+
+	query := fmt.Sprintf(`SELECT * FROM "%s"."%s" WHERE %s`, schemaName, tableName, cond)
+	rows, err := r.db.QueryContext(ctx, query, args.values...)
+	if err != nil {
+		return partial
+	}
+	defer rows.Close()
+
+	results, err := r.scanRows(rows)
+	if err != nil || len(results) == 0 {
+		return partial
+	}
+	return results[0]
+}
+
+// visibleRow re-reads the row of a change event through the table's row filter,
+// reporting false when the role may not see it
+func (r *Resolver) visibleRow(ctx context.Context, schemaName string, table Table, pk []string, ev *changeEvent) (map[string]interface{}, bool) {
+	if ev.Op == "DELETE" || len(pk) == 0 {
+		return nil, false
+	}
+	values := make(map[string]interface{}, len(pk))
+	for _, col := range pk {
+		values[keyArgName(pk, col)] = ev.Row[strcase.ToLowerCamel(col)]
+	}
+
+	args := &queryArgs{}
+	source, err := tableSource(ctx, schemaName, table, args)
+	if err != nil {
+		return nil, false
+	}
+	cond, err := keyCondition(pk, values, args)
+	if err != nil {
+		return nil, false
+	}
+
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s WHERE %s`, source, cond), args.values...)
+	if err != nil {
+		return nil, false
+	}
+	defer rows.Close()
+
+	results, err := r.scanRows(rows)
+	if err != nil || len(results) == 0 {
+		return nil, false
+	}
+	return results[0], true
+}
+
+// buildChangeEvent creates the <Type>ChangeEvent object streamed by <table>Changed
+func (g *SchemaGenerator) buildChangeEvent(table Table, nodeType *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: strcase.ToCamel(table.Name) + "ChangeEvent",
+		Fields: graphql.Fields{
+			"op":    &graphql.Field{Type: graphql.NewNonNull(changeOpEnum)},
+			"table": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"row":   &graphql.Field{Type: nodeType},
+		},
+	})
+}
+
+// resolveSource returns the subscription payload as the field value
+func resolveSource(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source, nil
+}
@@ -0,0 +1,107 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kapok/kapok/internal/database"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeChangeEvent(t *testing.T) {
+	ev, err := decodeChangeEvent(`{"table":"posts","op":"UPDATE","row":{"id":42,"view_count":1.5,"author_id":null,"title":"hi"}}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "posts", ev.Table)
+	assert.Equal(t, "UPDATE", ev.Op)
+	assert.False(t, ev.Partial)
+	assert.Equal(t, map[string]interface{}{
+		"id":        int64(42),
+		"viewCount": 1.5,
+		"authorId":  nil,
+		"title":     "hi",
+	}, ev.Row)
+
+	_, err = decodeChangeEvent(`{"row":{}}`)
+	assert.Error(t, err)
+
+	_, err = decodeChangeEvent(`not json`)
+	assert.Error(t, err)
+}
+
+func TestChangeTriggerSQL(t *testing.T) {
+	stmts := changeTriggerSQL("tenant_test", orderTestTables(), primaryKeyColumns)
+	require.Len(t, stmts, 5)
+
+	assert.Contains(t, stmts[0], `CREATE OR REPLACE FUNCTION "tenant_test"."kapok_notify_change"()`)
+	assert.Contains(t, stmts[0], `pg_notify('kapok_changes_tenant_test', payload)`)
+	assert.Equal(t, `DROP TRIGGER IF EXISTS "kapok_notify_change" ON "tenant_test"."authors"`, stmts[1])
+	assert.Equal(t,
+		`CREATE TRIGGER "kapok_notify_change" AFTER INSERT OR UPDATE OR DELETE ON "tenant_test"."authors" FOR EACH ROW EXECUTE FUNCTION "tenant_test"."kapok_notify_change"('id')`,
+		stmts[2])
+	assert.True(t, strings.HasSuffix(stmts[4], `ON "tenant_test"."posts" FOR EACH ROW EXECUTE FUNCTION "tenant_test"."kapok_notify_change"('id')`))
+}
+
+func TestAffectsTable(t *testing.T) {
+	assert.True(t, affectsTable(nil, "posts"), "a reconnect may have hidden changes")
+	assert.True(t, affectsTable(&pq.Notification{Extra: `{"table":"posts","op":"INSERT","row":{}}`}, "posts"))
+	assert.False(t, affectsTable(&pq.Notification{Extra: `{"table":"authors","op":"INSERT","row":{}}`}, "posts"))
+}
+
+func TestHandler_HandleSchemaChange(t *testing.T) {
+	h := &Handler{resolver: NewResolver(nil), logger: zerolog.Nop()}
+	for _, key := range []string{"tenant_a", "tenant_a/author", "tenant_b"} {
+		h.schemaCache.Store(key, &cachedSchema{expiresAt: time.Now().Add(time.Minute)})
+	}
+	h.resolver.triggers["tenant_a"] = map[string]bool{"posts": true}
+
+	cached := func() []string {
+		var keys []string
+		h.schemaCache.Range(func(key, _ interface{}) bool {
+			keys = append(keys, key.(string))
+			return true
+		})
+		return keys
+	}
+
+	h.handleSchemaChange(&pq.Notification{Channel: database.SchemaChangeChannel, Extra: "tenant_a"})
+	assert.Equal(t, []string{"tenant_b"}, cached(), "only the changed schema and its roles are dropped")
+	assert.Empty(t, h.resolver.triggers, "change triggers are reinstalled on the next subscription")
+
+	h.handleSchemaChange(&pq.Notification{Channel: database.SchemaChangeChannel, Extra: `tenant_b"; --`})
+	assert.Equal(t, []string{"tenant_b"}, cached(), "invalid schema names are ignored")
+
+	h.handleSchemaChange(nil)
+	assert.Empty(t, cached(), "a reconnect may have hidden changes")
+}
+
+func TestHandler_CacheSchemaSkipsStaleLoads(t *testing.T) {
+	h := &Handler{resolver: NewResolver(nil), logger: zerolog.Nop()}
+	fresh := func() *cachedSchema { return &cachedSchema{expiresAt: time.Now().Add(time.Minute)} }
+
+	generation := h.schemaGeneration("tenant_a")
+	assert.True(t, h.cacheSchema("tenant_a", "tenant_a", generation, fresh()))
+	_, ok := h.schemaCache.Load("tenant_a")
+	assert.True(t, ok)
+
+	// A load that introspected before the DDL finishes after its notification
+	generation = h.schemaGeneration("tenant_a")
+	h.handleSchemaChange(&pq.Notification{Channel: database.SchemaChangeChannel, Extra: "tenant_a"})
+	assert.False(t, h.cacheSchema("tenant_a/author", "tenant_a", generation, fresh()))
+	_, ok = h.schemaCache.Load("tenant_a/author")
+	assert.False(t, ok, "the stale schema is not cached")
+
+	// Other tenants are not affected; reconnects invalidate every tenant
+	other := h.schemaGeneration("tenant_b")
+	assert.True(t, h.cacheSchema("tenant_b", "tenant_b", other, fresh()))
+	h.handleSchemaChange(nil)
+	assert.False(t, h.cacheSchema("tenant_b", "tenant_b", other, fresh()))
+
+	generation = h.schemaGeneration("tenant_a")
+	h.InvalidatePermissions("t1", "tenant_a")
+	assert.False(t, h.cacheSchema("tenant_a/author", "tenant_a", generation, fresh()))
+}
@@ -0,0 +1,187 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/iancoleman/strcase"
+)
+
+const (
+	// TransactionHeader makes the mutations of a request run in one transaction
+	// when set to true
+	TransactionHeader = "X-Kapok-Transaction"
+
+	// transactionDirective does the same from the document: mutation @transaction { ... }
+	transactionDirective = "transaction"
+
+	// Error codes reported in extensions.code
+	ConflictCode              = "CONFLICT"
+	TransactionRolledBackCode = "TRANSACTION_ROLLED_BACK"
+)
+
+// transactionDirectiveDef declares @transaction so documents using it validate
+var transactionDirectiveDef = graphql.NewDirective(graphql.DirectiveConfig{
+	Name:        transactionDirective,
+	Description: "Runs every mutation field of the operation in one transaction, rolled back if any fails.",
+	Locations:   []string{graphql.DirectiveLocationMutation},
+})
+
+// querier runs statements on the database, or on the transaction of the operation
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type operationTxKey struct{}
+
+// withOperationTx makes the statements of an operation run in tx
+func withOperationTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, operationTxKey{}, tx)
+}
+
+// operationTx returns the transaction of the operation, or nil
+func operationTx(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(operationTxKey{}).(*sql.Tx)
+	return tx
+}
+
+// conn returns what the statements of a request run on. Reads also go through
+// the operation's transaction so they see its uncommitted writes.
+func (r *Resolver) conn(ctx context.Context) querier {
+	if tx := operationTx(ctx); tx != nil {
+		return tx
+	}
+	return r.db
+}
+
+// wantsTransaction reports whether the mutations of a request run in one
+// transaction: when header (TransactionHeader) is set or the operation carries
+// the @transaction directive. Queries and documents that cannot be parsed never do.
+func wantsTransaction(query, operationName string, header bool) bool {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		return false
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || (operationName != "" && (op.Name == nil || op.Name.Value != operationName)) {
+			continue
+		}
+		if op.Operation != ast.OperationTypeMutation {
+			return false
+		}
+		if header {
+			return true
+		}
+		for _, d := range op.Directives {
+			if d.Name != nil && d.Name.Value == transactionDirective {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// transactionHeader reports whether a request sets TransactionHeader to true
+func transactionHeader(r *http.Request) bool {
+	on, _ := strconv.ParseBool(r.Header.Get(TransactionHeader))
+	return on
+}
+
+// executeInTransaction runs an operation in a transaction, committing only when
+// every field succeeded. Data of a rolled back operation is dropped since none
+// of it was kept.
+func (h *Handler) executeInTransaction(ctx context.Context, params graphql.Params) *graphql.Result {
+	tx, err := h.resolver.db.BeginTx(ctx, nil)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to begin operation transaction")
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{*operationError(InternalErrorCode, "failed to start transaction")}}
+	}
+
+	params.Context = withOperationTx(params.Context, tx)
+	result := graphql.Do(params)
+	if result.HasErrors() {
+		tx.Rollback()
+		result.Data = nil
+		result.Errors = append(result.Errors, *operationError(TransactionRolledBackCode, "transaction rolled back"))
+		return result
+	}
+	if err := tx.Commit(); err != nil {
+		h.logger.Error().Err(err).Msg("failed to commit operation transaction")
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{*operationError(TransactionRolledBackCode, "failed to commit transaction")}}
+	}
+	return result
+}
+
+// ConflictError is returned by update mutations whose expected version no
+// longer matches the row
+type ConflictError struct {
+	Table  string
+	Column string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s was modified concurrently: %s does not match the expected value", e.Table, e.Column)
+}
+
+// Extensions reports the conflict in extensions.code
+func (e *ConflictError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": ConflictCode, "column": e.Column}
+}
+
+// versionColumn returns the column used for optimistic locking: an integer
+// version column, else a timestamp updated_at column, else nil
+func versionColumn(table Table) *Column {
+	var updatedAt *Column
+	for idx, col := range table.Columns {
+		switch {
+		case col.Name == "version" && isIntegerType(col.DataType):
+			return &table.Columns[idx]
+		case col.Name == "updated_at" && strings.HasPrefix(col.DataType, "timestamp"):
+			updatedAt = &table.Columns[idx]
+		}
+	}
+	return updatedAt
+}
+
+// expectedVersionArg names the update argument carrying the expected value of
+// the version column, e.g. expectedVersion or expectedUpdatedAt
+func expectedVersionArg(col *Column) string {
+	return strcase.ToLowerCamel("expected_" + col.Name)
+}
+
+// versionBump returns the SET clause advancing the version column of an updated
+// row, or an empty string when the table has none or set, the values assigned by
+// column, already assigns it
+func versionBump(table Table, set map[string]interface{}) string {
+	col := versionColumn(table)
+	if col == nil {
+		return ""
+	}
+	if _, ok := set[col.Name]; ok {
+		return ""
+	}
+	if col.Name == "version" {
+		return `"version" = "version" + 1`
+	}
+	return fmt.Sprintf(`"%s" = now()`, col.Name)
+}
+
+func isIntegerType(dataType string) bool {
+	switch dataType {
+	case "smallint", "integer", "bigint":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package graphql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func versionedTable() Table {
+	return Table{
+		Name: "documents",
+		Columns: []Column{
+			{Name: "id", DataType: "integer", IsPK: true},
+			{Name: "body", DataType: "text", IsNullable: true},
+			{Name: "version", DataType: "integer"},
+			{Name: "updated_at", DataType: "timestamp with time zone"},
+		},
+	}
+}
+
+func TestWantsTransaction(t *testing.T) {
+	cases := []struct {
+		name, query, operationName, header string
+		expected                           bool
+	}{
+		{name: "plain mutation", query: `mutation { a }`},
+		{name: "directive", query: `mutation @transaction { a }`, expected: true},
+		{name: "header", query: `mutation { a }`, header: "true", expected: true},
+		{name: "queries never run in one", query: `query @transaction { a }`, header: "true"},
+		{name: "selected operation", query: `query Q { a } mutation M @transaction { a }`, operationName: "M", expected: true},
+		{name: "other operation", query: `query Q { a } mutation M @transaction { a }`, operationName: "Q"},
+		{name: "unparsable", query: `mutation {`, header: "true"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+			if tc.header != "" {
+				r.Header.Set(TransactionHeader, tc.header)
+			}
+			assert.Equal(t, tc.expected, wantsTransaction(tc.query, tc.operationName, transactionHeader(r)))
+		})
+	}
+}
+
+func TestVersionColumn(t *testing.T) {
+	table := versionedTable()
+	require.NotNil(t, versionColumn(table))
+	assert.Equal(t, "version", versionColumn(table).Name, "version wins over updated_at")
+	assert.Equal(t, `"version" = "version" + 1`, versionBump(table, map[string]interface{}{"body": "x"}))
+	assert.Equal(t, "", versionBump(table, map[string]interface{}{"version": 7}), "explicit versions are kept")
+
+	table.Columns = table.Columns[:2]
+	table.Columns = append(table.Columns, Column{Name: "updated_at", DataType: "timestamp without time zone"})
+	assert.Equal(t, "expectedUpdatedAt", expectedVersionArg(versionColumn(table)))
+	assert.Equal(t, `"updated_at" = now()`, versionBump(table, nil))
+
+	assert.Nil(t, versionColumn(filterTestTable()))
+}
+
+func TestGenerate_TransactionsAndExpectedVersion(t *testing.T) {
+	schema, err := NewSchemaGenerator(NewResolver(nil)).Generate("tenant_test", &SchemaMetadata{
+		Tables: []Table{versionedTable()},
+	})
+	require.NoError(t, err)
+
+	var expected *graphql.Argument
+	for _, arg := range schema.MutationType().Fields()["updateDocuments"].Args {
+		if arg.Name() == "expectedVersion" {
+			expected = arg
+		}
+	}
+	require.NotNil(t, expected)
+	assert.Equal(t, "Int", expected.Type.String())
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(`mutation @transaction { updateDocuments(id: 1, body: "x", expectedVersion: 3) { id } }`),
+	})})
+	require.NoError(t, err)
+	assert.True(t, graphql.ValidateDocument(schema, doc, nil).IsValid, "@transaction is declared")
+}
+
+func TestConflictError_Extensions(t *testing.T) {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"update": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return nil, &ConflictError{Table: "documents", Column: "version"}
+					},
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+
+	result := graphql.Do(graphql.Params{Schema: schema, RequestString: `{ update }`})
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "documents was modified concurrently: version does not match the expected value", result.Errors[0].Message)
+	assert.Equal(t, map[string]interface{}{"code": ConflictCode, "column": "version"}, result.Errors[0].Extensions)
+}
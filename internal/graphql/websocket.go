@@ -0,0 +1,519 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+)
+
+// graphqlTransportWS is the sub-protocol of the graphql-ws library
+const graphqlTransportWS = "graphql-transport-ws"
+
+const (
+	// wsInitTimeout is how long a client has to send connection_init
+	wsInitTimeout = 10 * time.Second
+	// wsWriteTimeout bounds every write to the socket
+	wsWriteTimeout = 10 * time.Second
+	// wsPingInterval is how often the server pings idle clients
+	wsPingInterval = 30 * time.Second
+)
+
+// graphql-ws message types
+const (
+	wsConnectionInit = "connection_init"
+	wsConnectionAck  = "connection_ack"
+	wsPing           = "ping"
+	wsPong           = "pong"
+	wsSubscribe      = "subscribe"
+	wsNext           = "next"
+	wsError          = "error"
+	wsComplete       = "complete"
+)
+
+// graphql-ws close codes
+const (
+	wsCloseBadRequest          = 4400
+	wsCloseUnauthorized        = 4401
+	wsCloseForbidden           = 4403
+	wsCloseBadSubprotocol      = 4406
+	wsCloseInitTimeout         = 4408
+	wsCloseDuplicateSubscriber = 4409
+	wsCloseTooManyInits        = 4429
+)
+
+var wsUpgrader = websocket.Upgrader{
+	HandshakeTimeout: wsInitTimeout,
+	Subprotocols:     []string{graphqlTransportWS},
+}
+
+// WebSocketAuthenticator builds the session of a graphql-ws client from the bearer
+// token and role of its connection_init payload. Browsers cannot send headers
+// with the upgrade request, so this is how they authenticate.
+type WebSocketAuthenticator func(ctx context.Context, t *tenant.Tenant, token, role string) (*Session, error)
+
+// SetWebSocketAuthenticator sets how connection_init tokens are validated;
+// without one, only upgrades authenticated by their headers are served
+func (h *Handler) SetWebSocketAuthenticator(auth WebSocketAuthenticator) {
+	h.wsAuth = auth
+}
+
+// SetAllowedOrigins sets the origins, besides the server's own, that may open
+// WebSockets; "*" allows any and a single "*" inside an origin matches like CORS
+func (h *Handler) SetAllowedOrigins(origins []string) {
+	h.origins = origins
+}
+
+// checkOrigin accepts upgrades from the server's own origin and the allowed
+// ones. Requests without an Origin do not come from browsers.
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range h.origins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if i := strings.Index(allowed, "*"); i >= 0 {
+			prefix, suffix := allowed[:i], allowed[i+1:]
+			if len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsCredentials reads the bearer token and role of a connection_init payload,
+// given as its Authorization and X-Kapok-Role entries or those of its headers
+// object, in any case
+func wsCredentials(payload json.RawMessage) (token, role string) {
+	var params map[string]interface{}
+	if len(payload) == 0 || json.Unmarshal(payload, &params) != nil {
+		return "", ""
+	}
+	lookup := func(name string) string {
+		for _, v := range []interface{}{params, params["headers"]} {
+			obj, _ := v.(map[string]interface{})
+			for key, value := range obj {
+				if s, ok := value.(string); ok && strings.EqualFold(key, name) {
+					return s
+				}
+			}
+		}
+		return ""
+	}
+	if auth := lookup("Authorization"); len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		token = auth[len("Bearer "):]
+	}
+	return token, lookup("X-Kapok-Role")
+}
+
+// wsMessage is a graphql-ws protocol message
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsSubscribePayload is the payload of a subscribe message
+type wsSubscribePayload struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// wsConnection serves the operations of one graphql-ws client
+type wsConnection struct {
+	conn    *websocket.Conn
+	handler *Handler
+	tenant  *tenant.Tenant
+	schema  *graphql.Schema
+	limits  tenant.QueryLimits
+	ctx     context.Context
+	logger  zerolog.Logger
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	initialised bool
+	acked       bool
+	operations  map[string]context.CancelFunc
+	// session replaces the upgrade's once connection_init carried a token
+	session *Session
+	// expiry closes the socket when the session's token expires
+	expiry *time.Timer
+}
+
+// serveWebSocket upgrades the request and serves the graphql-ws protocol until the
+// client disconnects. The request context carries the tenant, so every operation
+// executes against that tenant's schema only. A nil schema means the upgrade was
+// not authenticated: the client must send a token in connection_init, which
+// loads the schema of its role.
+func (h *Handler) serveWebSocket(w http.ResponseWriter, r *http.Request, schema *graphql.Schema, limits tenant.QueryLimits) {
+	upgrader := wsUpgrader
+	upgrader.CheckOrigin = h.checkOrigin
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an HTTP error
+		h.logger.Debug().Err(err).Msg("websocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != graphqlTransportWS {
+		closeWebSocket(conn, wsCloseBadSubprotocol, "Subprotocol not acceptable")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// The tenant decides which persisted operations may run
+	t, _ := tenant.GetTenant(r.Context())
+
+	c := &wsConnection{
+		conn:       conn,
+		handler:    h,
+		tenant:     t,
+		schema:     schema,
+		limits:     limits,
+		ctx:        ctx,
+		logger:     h.logger,
+		operations: make(map[string]context.CancelFunc),
+	}
+	c.expireWith(SessionFromContext(r.Context()))
+	defer c.expireWith(nil)
+	c.serve()
+}
+
+// expireWith closes the socket with 4403 when the token of session expires,
+// replacing the expiry of the previous session; nil stops it
+func (c *wsConnection) expireWith(session *Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry = nil
+	}
+	if session == nil || session.ExpiresAt.IsZero() {
+		return
+	}
+	c.expiry = time.AfterFunc(time.Until(session.ExpiresAt), func() {
+		c.logger.Debug().Msg("websocket token expired")
+		closeWebSocket(c.conn, wsCloseForbidden, "Token expired")
+	})
+}
+
+// serve runs the read loop; operations run in their own goroutines
+func (c *wsConnection) serve() {
+	// Server timeouts set before the upgrade do not apply to a long-lived socket
+	c.conn.SetReadDeadline(time.Now().Add(wsInitTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+	})
+
+	initTimer := time.AfterFunc(wsInitTimeout, func() {
+		c.mu.Lock()
+		acked := c.acked
+		c.mu.Unlock()
+		if !acked {
+			closeWebSocket(c.conn, wsCloseInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	go c.keepAlive()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+			closeWebSocket(c.conn, wsCloseBadRequest, "Invalid message received")
+			return
+		}
+		if !c.handle(msg) {
+			return
+		}
+	}
+}
+
+// handle processes one client message; it returns false once the socket is closed
+func (c *wsConnection) handle(msg wsMessage) bool {
+	switch msg.Type {
+	case wsConnectionInit:
+		c.mu.Lock()
+		already := c.initialised
+		c.initialised = true
+		c.mu.Unlock()
+		if already {
+			closeWebSocket(c.conn, wsCloseTooManyInits, "Too many initialisation requests")
+			return false
+		}
+		if !c.authenticate(msg.Payload) {
+			return false
+		}
+		c.mu.Lock()
+		c.acked = true
+		c.mu.Unlock()
+		c.conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+		c.write(wsMessage{Type: wsConnectionAck})
+
+	case wsPing:
+		c.write(wsMessage{Type: wsPong, Payload: msg.Payload})
+
+	case wsPong:
+
+	case wsSubscribe:
+		c.mu.Lock()
+		acked := c.acked
+		_, exists := c.operations[msg.ID]
+		c.mu.Unlock()
+		if !acked {
+			closeWebSocket(c.conn, wsCloseUnauthorized, "Unauthorized")
+			return false
+		}
+
+		var payload wsSubscribePayload
+		if msg.ID == "" || json.Unmarshal(msg.Payload, &payload) != nil ||
+			(payload.Query == "" && persistedQueryHash(payload.Extensions) == "") {
+			closeWebSocket(c.conn, wsCloseBadRequest, "Invalid message received")
+			return false
+		}
+		if exists {
+			closeWebSocket(c.conn, wsCloseDuplicateSubscriber, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+			return false
+		}
+
+		opCtx, cancel := context.WithCancel(c.ctx)
+		c.mu.Lock()
+		c.operations[msg.ID] = cancel
+		c.mu.Unlock()
+		go c.execute(opCtx, msg.ID, payload)
+
+	case wsComplete:
+		c.mu.Lock()
+		cancel, ok := c.operations[msg.ID]
+		delete(c.operations, msg.ID)
+		c.mu.Unlock()
+		if ok {
+			cancel()
+		}
+
+	default:
+		closeWebSocket(c.conn, wsCloseBadRequest, "Invalid message received")
+		return false
+	}
+	return true
+}
+
+// authenticate runs the client as the bearer token of its connection_init
+// payload, if any; clients whose upgrade was not authenticated must send one. It
+// closes the socket and returns false when the client cannot be served.
+func (c *wsConnection) authenticate(payload json.RawMessage) bool {
+	token, role := wsCredentials(payload)
+	if token == "" {
+		if c.schema == nil {
+			closeWebSocket(c.conn, wsCloseForbidden, "Forbidden")
+			return false
+		}
+		return true
+	}
+
+	var session *Session
+	err := errors.New("websocket authentication is not configured")
+	if c.handler.wsAuth != nil && c.tenant != nil {
+		session, err = c.handler.wsAuth(c.ctx, c.tenant, token, role)
+	}
+	if err != nil {
+		c.logger.Debug().Err(err).Msg("websocket authentication failed")
+		closeWebSocket(c.conn, wsCloseForbidden, "Forbidden")
+		return false
+	}
+
+	cached, err := c.handler.getRoleSchema(WithSession(c.ctx, session), c.tenant)
+	if errors.Is(err, ErrRoleNotAllowed) {
+		closeWebSocket(c.conn, wsCloseForbidden, "Forbidden")
+		return false
+	}
+	if err != nil {
+		c.logger.Error().Err(err).Str("schema_name", c.tenant.SchemaName).Msg("failed to get schema")
+		closeWebSocket(c.conn, websocket.CloseInternalServerErr, "Failed to load schema")
+		return false
+	}
+
+	c.mu.Lock()
+	c.session, c.schema = session, cached.schema
+	c.mu.Unlock()
+	c.expireWith(session)
+	return true
+}
+
+// execute runs one operation. Subscriptions stream a next message per event;
+// queries and mutations send a single result.
+func (c *wsConnection) execute(ctx context.Context, id string, payload wsSubscribePayload) {
+	defer func() {
+		c.mu.Lock()
+		cancel, ok := c.operations[id]
+		delete(c.operations, id)
+		c.mu.Unlock()
+		if ok {
+			cancel()
+		}
+	}()
+
+	c.mu.Lock()
+	schema, session := c.schema, c.session
+	c.mu.Unlock()
+	if session != nil {
+		ctx = WithSession(ctx, session)
+	}
+
+	// Persisted queries and over-budget operations fail like any other error before data
+	query := payload.Query
+	if c.tenant != nil {
+		resolved, opErr := c.handler.resolveOperation(ctx, c.tenant, payload.Query, payload.Extensions)
+		if opErr != nil {
+			errs, _ := json.Marshal([]gqlerrors.FormattedError{*opErr})
+			c.write(wsMessage{ID: id, Type: wsError, Payload: errs})
+			return
+		}
+		query = resolved
+	}
+	cost := analyzeQuery(schema, query, payload.OperationName, payload.Variables, c.limits.MaxNodes)
+	if errs := cost.Check(c.limits); len(errs) > 0 {
+		payload, _ := json.Marshal(errs)
+		c.write(wsMessage{ID: id, Type: wsError, Payload: payload})
+		return
+	}
+
+	params := graphql.Params{
+		Schema:         *schema,
+		RequestString:  query,
+		VariableValues: payload.Variables,
+		OperationName:  payload.OperationName,
+		Context:        WithLoader(ctx, NewLoader()),
+	}
+
+	var results <-chan *graphql.Result
+	if operationType(query, payload.OperationName) == ast.OperationTypeSubscription {
+		results = graphql.Subscribe(params)
+	} else if wantsTransaction(query, payload.OperationName, false) {
+		single := make(chan *graphql.Result, 1)
+		single <- c.handler.executeInTransaction(ctx, params)
+		close(single)
+		results = single
+	} else {
+		single := make(chan *graphql.Result, 1)
+		single <- graphql.Do(params)
+		close(single)
+		results = single
+	}
+
+	first := true
+	for result := range results {
+		// Failures before any data (parse, validation, subscribe errors) end the operation
+		if first && result.Data == nil && result.HasErrors() {
+			errs, _ := json.Marshal(result.Errors)
+			c.write(wsMessage{ID: id, Type: wsError, Payload: errs})
+			return
+		}
+		first = false
+
+		// Keep draining after cancellation so the executor goroutine can exit
+		if ctx.Err() != nil {
+			continue
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			c.logger.Error().Err(err).Msg("failed to encode subscription result")
+			continue
+		}
+		c.write(wsMessage{ID: id, Type: wsNext, Payload: data})
+	}
+
+	// A client-initiated complete needs no reply
+	if ctx.Err() == nil {
+		c.write(wsMessage{ID: id, Type: wsComplete})
+	}
+}
+
+// keepAlive pings the client so dead connections are detected by the read deadline
+func (c *wsConnection) keepAlive() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write sends a protocol message; gorilla connections allow a single concurrent writer
+func (c *wsConnection) write(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.logger.Debug().Err(err).Str("type", msg.Type).Msg("websocket write failed")
+	}
+}
+
+// closeWebSocket sends a close frame with a graphql-ws close code
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+	conn.Close()
+}
+
+// operationType returns the type of the operation that will be executed, or an
+// empty string when the document cannot be parsed (execution reports the error)
+func operationType(query, operationName string) string {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+	if err != nil {
+		return ""
+	}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation
+		}
+	}
+	return ""
+}
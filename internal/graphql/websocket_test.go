@@ -0,0 +1,253 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/kapok/kapok/internal/tenant"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsTestSchema has a query and a subscription emitting three numbers
+func wsTestSchema(t *testing.T) *graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"hello": &graphql.Field{
+					Type:    graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) { return "world", nil },
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"counter": &graphql.Field{
+					Type: graphql.Int,
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ch := make(chan interface{})
+						go func() {
+							defer close(ch)
+							for i := 1; i <= 3; i++ {
+								select {
+								case ch <- i:
+								case <-p.Context.Done():
+									return
+								}
+							}
+						}()
+						return ch, nil
+					},
+					Resolve: resolveSource,
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	return &schema
+}
+
+func dialTestWebSocket(t *testing.T) *websocket.Conn {
+	h := &Handler{logger: zerolog.Nop()}
+	schema := wsTestSchema(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serveWebSocket(w, r, schema, DefaultQueryLimits())
+	}))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readTestMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	var msg wsMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestWebSocket_SubscribeStreamsUntilComplete(t *testing.T) {
+	conn := dialTestWebSocket(t)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInit}))
+	assert.Equal(t, wsConnectionAck, readTestMessage(t, conn).Type)
+
+	payload, _ := json.Marshal(wsSubscribePayload{Query: "subscription { counter }"})
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: wsSubscribe, Payload: payload}))
+
+	for i := 1; i <= 3; i++ {
+		msg := readTestMessage(t, conn)
+		assert.Equal(t, wsNext, msg.Type)
+		assert.Equal(t, "1", msg.ID)
+		assert.JSONEq(t, `{"data":{"counter":`+strconv.Itoa(i)+`}}`, string(msg.Payload))
+	}
+	msg := readTestMessage(t, conn)
+	assert.Equal(t, wsComplete, msg.Type)
+	assert.Equal(t, "1", msg.ID)
+}
+
+func TestWebSocket_QueryAndPing(t *testing.T) {
+	conn := dialTestWebSocket(t)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsConnectionInit}))
+	assert.Equal(t, wsConnectionAck, readTestMessage(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: wsPing}))
+	assert.Equal(t, wsPong, readTestMessage(t, conn).Type)
+
+	payload, _ := json.Marshal(wsSubscribePayload{Query: "{ hello }"})
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "q", Type: wsSubscribe, Payload: payload}))
+
+	msg := readTestMessage(t, conn)
+	assert.Equal(t, wsNext, msg.Type)
+	assert.JSONEq(t, `{"data":{"hello":"world"}}`, string(msg.Payload))
+	assert.Equal(t, wsComplete, readTestMessage(t, conn).Type)
+
+	// Validation failures are reported with an error message
+	payload, _ = json.Marshal(wsSubscribePayload{Query: "subscription { missing }"})
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "bad", Type: wsSubscribe, Payload: payload}))
+	msg = readTestMessage(t, conn)
+	assert.Equal(t, wsError, msg.Type)
+	assert.Equal(t, "bad", msg.ID)
+}
+
+func TestWebSocket_SubscribeBeforeInitIsUnauthorized(t *testing.T) {
+	conn := dialTestWebSocket(t)
+
+	payload, _ := json.Marshal(wsSubscribePayload{Query: "subscription { counter }"})
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: wsSubscribe, Payload: payload}))
+
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, wsCloseUnauthorized, closeErr.Code)
+}
+
+// dialTenantWebSocket serves h to a tenant whose upgrades carry no session, like
+// browser clients that authenticate in connection_init
+func dialTenantWebSocket(t *testing.T, h *Handler) *websocket.Conn {
+	ten := &tenant.Tenant{ID: "t1", SchemaName: "tenant_test"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), ten)))
+	}))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{graphqlTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocket_ConnectionInitAuthenticates(t *testing.T) {
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits()}
+	h.schemaCache.Store("tenant_test", &cachedSchema{schema: wsTestSchema(t), expiresAt: time.Now().Add(time.Minute)})
+	var roles []string
+	h.SetWebSocketAuthenticator(func(ctx context.Context, ten *tenant.Tenant, token, role string) (*Session, error) {
+		if token != "secret" {
+			return nil, errors.New("invalid token")
+		}
+		roles = append(roles, role)
+		return &Session{Role: AdminRole}, nil
+	})
+
+	forbidden := func(payload string) {
+		conn := dialTenantWebSocket(t, h)
+		msg := wsMessage{Type: wsConnectionInit}
+		if payload != "" {
+			msg.Payload = json.RawMessage(payload)
+		}
+		require.NoError(t, conn.WriteJSON(msg))
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		require.ErrorAs(t, err, &closeErr, payload)
+		assert.Equal(t, wsCloseForbidden, closeErr.Code, payload)
+	}
+	forbidden("")
+	forbidden(`{"Authorization": "Bearer wrong"}`)
+
+	conn := dialTenantWebSocket(t, h)
+	require.NoError(t, conn.WriteJSON(wsMessage{
+		Type:    wsConnectionInit,
+		Payload: json.RawMessage(`{"headers": {"authorization": "Bearer secret", "x-kapok-role": "admin"}}`),
+	}))
+	assert.Equal(t, wsConnectionAck, readTestMessage(t, conn).Type)
+	assert.Equal(t, []string{"admin"}, roles)
+
+	payload, _ := json.Marshal(wsSubscribePayload{Query: "{ hello }"})
+	require.NoError(t, conn.WriteJSON(wsMessage{ID: "q", Type: wsSubscribe, Payload: payload}))
+	msg := readTestMessage(t, conn)
+	assert.Equal(t, wsNext, msg.Type)
+	assert.JSONEq(t, `{"data":{"hello":"world"}}`, string(msg.Payload))
+}
+
+func TestWebSocket_ClosesWhenTokenExpires(t *testing.T) {
+	h := &Handler{logger: zerolog.Nop(), limits: DefaultQueryLimits()}
+	h.schemaCache.Store("tenant_test", &cachedSchema{schema: wsTestSchema(t), expiresAt: time.Now().Add(time.Minute)})
+	h.SetWebSocketAuthenticator(func(ctx context.Context, ten *tenant.Tenant, token, role string) (*Session, error) {
+		return &Session{Role: AdminRole, ExpiresAt: time.Now().Add(200 * time.Millisecond)}, nil
+	})
+
+	conn := dialTenantWebSocket(t, h)
+	require.NoError(t, conn.WriteJSON(wsMessage{
+		Type:    wsConnectionInit,
+		Payload: json.RawMessage(`{"Authorization": "Bearer secret"}`),
+	}))
+	assert.Equal(t, wsConnectionAck, readTestMessage(t, conn).Type)
+
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, wsCloseForbidden, closeErr.Code)
+	assert.Equal(t, "Token expired", closeErr.Text)
+}
+
+func TestHandler_CheckOrigin(t *testing.T) {
+	h := &Handler{}
+	h.SetAllowedOrigins([]string{"https://app.example.com", "https://*.preview.example.com"})
+
+	cases := map[string]bool{
+		"":                                 true,
+		"http://kapok.local":               true,
+		"https://app.example.com":          true,
+		"https://APP.example.com":          true,
+		"https://pr-1.preview.example.com": true,
+		"https://evil.example.com":         false,
+		"http://app.example.com":           false,
+	}
+	for origin, want := range cases {
+		r := httptest.NewRequest(http.MethodGet, "http://kapok.local/graphql", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		assert.Equal(t, want, h.checkOrigin(r), origin)
+	}
+
+	h.SetAllowedOrigins([]string{"*"})
+	r := httptest.NewRequest(http.MethodGet, "http://kapok.local/graphql", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	assert.True(t, h.checkOrigin(r))
+}
+
+func TestOperationType(t *testing.T) {
+	assert.Equal(t, "subscription", operationType("subscription { posts { id } }", ""))
+	assert.Equal(t, "query", operationType("{ posts { id } }", ""))
+	assert.Equal(t, "mutation", operationType("query A { a } mutation B { b }", "B"))
+	assert.Equal(t, "", operationType("{", ""))
+}
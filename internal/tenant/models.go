@@ -31,10 +31,42 @@ type Tenant struct {
 	IsolationLevel   string       `json:"isolation_level"`
 	StorageUsedBytes int64        `json:"storage_used_bytes"`
 	LastActivity     *time.Time   `json:"last_activity"`
+	QueryLimits      QueryLimits  `json:"query_limits"`
+	StrictOperations bool         `json:"strict_operations"`
 	CreatedAt        time.Time    `json:"created_at"`
 	UpdatedAt        time.Time    `json:"updated_at"`
 }
 
+// QueryLimits bounds the GraphQL operations a tenant may run. Zero values fall
+// back to the server defaults.
+type QueryLimits struct {
+	MaxDepth int `json:"max_depth"`
+	MaxNodes int `json:"max_nodes"`
+	MaxCost  int `json:"max_cost"`
+}
+
+// WithDefaults fills the unset limits from defaults
+func (l QueryLimits) WithDefaults(defaults QueryLimits) QueryLimits {
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = defaults.MaxDepth
+	}
+	if l.MaxNodes <= 0 {
+		l.MaxNodes = defaults.MaxNodes
+	}
+	if l.MaxCost <= 0 {
+		l.MaxCost = defaults.MaxCost
+	}
+	return l
+}
+
+// Validate rejects negative limits
+func (l QueryLimits) Validate() error {
+	if l.MaxDepth < 0 || l.MaxNodes < 0 || l.MaxCost < 0 {
+		return fmt.Errorf("query limits cannot be negative")
+	}
+	return nil
+}
+
 // Validation constants
 const (
 	MaxTenantNameLength = 50
@@ -153,6 +153,8 @@ func (p *Provisioner) ListTenants(ctx context.Context, status TenantStatus, limi
 		SELECT id, name, schema_name, status,
 		       COALESCE(slug, ''), COALESCE(isolation_level, 'schema'),
 		       COALESCE(storage_used_bytes, 0), last_activity,
+		       COALESCE(max_query_depth, 0), COALESCE(max_query_nodes, 0),
+		       COALESCE(max_query_cost, 0), COALESCE(strict_operations, false),
 		       created_at, updated_at
 		FROM tenants
 	`
@@ -200,6 +202,10 @@ func (p *Provisioner) ListTenants(ctx context.Context, status TenantStatus, limi
 			&tenant.IsolationLevel,
 			&tenant.StorageUsedBytes,
 			&tenant.LastActivity,
+			&tenant.QueryLimits.MaxDepth,
+			&tenant.QueryLimits.MaxNodes,
+			&tenant.QueryLimits.MaxCost,
+			&tenant.StrictOperations,
 			&tenant.CreatedAt,
 			&tenant.UpdatedAt,
 		)
@@ -226,6 +232,8 @@ func (p *Provisioner) GetTenantByID(ctx context.Context, id string) (*Tenant, er
 		SELECT id, name, schema_name, status,
 		       COALESCE(slug, ''), COALESCE(isolation_level, 'schema'),
 		       COALESCE(storage_used_bytes, 0), last_activity,
+		       COALESCE(max_query_depth, 0), COALESCE(max_query_nodes, 0),
+		       COALESCE(max_query_cost, 0), COALESCE(strict_operations, false),
 		       created_at, updated_at
 		FROM tenants
 		WHERE id = $1
@@ -241,6 +249,10 @@ func (p *Provisioner) GetTenantByID(ctx context.Context, id string) (*Tenant, er
 		&tenant.IsolationLevel,
 		&tenant.StorageUsedBytes,
 		&tenant.LastActivity,
+		&tenant.QueryLimits.MaxDepth,
+		&tenant.QueryLimits.MaxNodes,
+		&tenant.QueryLimits.MaxCost,
+		&tenant.StrictOperations,
 		&tenant.CreatedAt,
 		&tenant.UpdatedAt,
 	)
@@ -260,6 +272,8 @@ func (p *Provisioner) GetTenantByName(ctx context.Context, name string) (*Tenant
 		SELECT id, name, schema_name, status,
 		       COALESCE(slug, ''), COALESCE(isolation_level, 'schema'),
 		       COALESCE(storage_used_bytes, 0), last_activity,
+		       COALESCE(max_query_depth, 0), COALESCE(max_query_nodes, 0),
+		       COALESCE(max_query_cost, 0), COALESCE(strict_operations, false),
 		       created_at, updated_at
 		FROM tenants
 		WHERE name = $1
@@ -275,6 +289,10 @@ func (p *Provisioner) GetTenantByName(ctx context.Context, name string) (*Tenant
 		&tenant.IsolationLevel,
 		&tenant.StorageUsedBytes,
 		&tenant.LastActivity,
+		&tenant.QueryLimits.MaxDepth,
+		&tenant.QueryLimits.MaxNodes,
+		&tenant.QueryLimits.MaxCost,
+		&tenant.StrictOperations,
 		&tenant.CreatedAt,
 		&tenant.UpdatedAt,
 	)
@@ -288,6 +306,67 @@ func (p *Provisioner) GetTenantByName(ctx context.Context, name string) (*Tenant
 	return &tenant, nil
 }
 
+// UpdateQueryLimits sets the GraphQL query limits of a tenant; zero values
+// restore the server defaults
+func (p *Provisioner) UpdateQueryLimits(ctx context.Context, id string, limits QueryLimits) (*Tenant, error) {
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE tenants
+		SET max_query_depth = NULLIF($1, 0), max_query_nodes = NULLIF($2, 0),
+		    max_query_cost = NULLIF($3, 0), updated_at = $4
+		WHERE id = $5
+	`
+	res, err := p.db.ExecContext(ctx, query, limits.MaxDepth, limits.MaxNodes, limits.MaxCost, time.Now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update query limits: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("tenant not found: %s", id)
+	}
+
+	p.logger.Info().
+		Str("tenant_id", id).
+		Int("max_depth", limits.MaxDepth).
+		Int("max_nodes", limits.MaxNodes).
+		Int("max_cost", limits.MaxCost).
+		Msg("tenant query limits updated")
+
+	// Log to audit trail
+	p.logAudit(ctx, id, "tenant.query_limits", fmt.Sprintf("tenant:%s", id))
+
+	return p.GetTenantByID(ctx, id)
+}
+
+// SetStrictOperations enables or disables strict mode, in which the tenant's
+// GraphQL endpoint only runs allowlisted persisted operations
+func (p *Provisioner) SetStrictOperations(ctx context.Context, id string, enabled bool) (*Tenant, error) {
+	query := `
+		UPDATE tenants
+		SET strict_operations = $1, updated_at = $2
+		WHERE id = $3
+	`
+	res, err := p.db.ExecContext(ctx, query, enabled, time.Now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update strict operations: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("tenant not found: %s", id)
+	}
+
+	p.logger.Info().
+		Str("tenant_id", id).
+		Bool("strict_operations", enabled).
+		Msg("tenant strict operations updated")
+
+	// Log to audit trail
+	p.logAudit(ctx, id, "tenant.strict_operations", fmt.Sprintf("tenant:%s", id))
+
+	return p.GetTenantByID(ctx, id)
+}
+
 // DeleteTenant soft-deletes a tenant (preserves schema for recovery)
 func (p *Provisioner) DeleteTenant(ctx context.Context, id string) error {
 	p.logger.Info().
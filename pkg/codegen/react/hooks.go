@@ -158,10 +158,15 @@ func (g *HooksGenerator) GenerateAllHooks(table *codegen.Table) string {
 	// Add imports
 	sb.WriteString("import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';\n")
 	sb.WriteString("import { useKapokClient } from '../provider';\n")
-	sb.WriteString(fmt.Sprintf("import type { %s, Create%sInput, Update%sInput } from '../types';\n\n",
+	typeNames := []string{
 		g.typeMapper.ToTypeName(table.Name),
-		g.typeMapper.ToTypeName(table.Name),
-		g.typeMapper.ToTypeName(table.Name)))
+		"Create" + g.typeMapper.ToTypeName(table.Name) + "Input",
+		"Update" + g.typeMapper.ToTypeName(table.Name) + "Input",
+	}
+	if table.HasCompositeKey() {
+		typeNames = append(typeNames, g.typeMapper.ToTypeName(table.Name)+"Key")
+	}
+	sb.WriteString(fmt.Sprintf("import type { %s } from '../types';\n\n", strings.Join(typeNames, ", ")))
 
 	// Generate hooks
 	sb.WriteString(g.GenerateListHook(table))
@@ -182,6 +187,10 @@ func (g *HooksGenerator) getPrimaryKeyType(table *codegen.Table) string {
 	if table.PrimaryKey == nil || len(table.PrimaryKey.ColumnNames) == 0 {
 		return "number" // default
 	}
+	// Composite keys are passed as key objects (e.g., PostTagsKey)
+	if table.HasCompositeKey() {
+		return g.typeMapper.ToTypeName(table.Name) + "Key"
+	}
 
 	pkColName := table.PrimaryKey.ColumnNames[0]
 	for _, col := range table.Columns {
@@ -183,6 +183,26 @@ func TestGenerateAllHooks(t *testing.T) {
 	assert.Contains(t, result, "export function useDeleteUsers")
 }
 
+func TestGenerateAllHooks_CompositeKey(t *testing.T) {
+	gen := NewHooksGenerator()
+
+	table := &codegen.Table{
+		Name: "post_tags",
+		Columns: []*codegen.Column{
+			{Name: "post_id", DataType: "integer"},
+			{Name: "tag_id", DataType: "integer"},
+		},
+		PrimaryKey: &codegen.PrimaryKey{ColumnNames: []string{"post_id", "tag_id"}},
+	}
+
+	result := gen.GenerateAllHooks(table)
+
+	assert.Contains(t, result, "import type { PostTags, CreatePostTagsInput, UpdatePostTagsInput, PostTagsKey }")
+	assert.Contains(t, result, "export function usePostTagsById(id: PostTagsKey)")
+	assert.Contains(t, result, "{ id, input }: { id: PostTagsKey; input: UpdatePostTagsInput }")
+	assert.Contains(t, result, "mutationFn: (id: PostTagsKey) => client.postTags.delete(id)")
+}
+
 func TestGetPrimaryKeyType(t *testing.T) {
 	gen := NewHooksGenerator()
 
@@ -212,6 +232,18 @@ func TestGetPrimaryKeyType(t *testing.T) {
 			table:    &codegen.Table{Columns: []*codegen.Column{}},
 			expected: "number",
 		},
+		{
+			name: "composite pk",
+			table: &codegen.Table{
+				Name: "post_tags",
+				Columns: []*codegen.Column{
+					{Name: "post_id", DataType: "integer"},
+					{Name: "tag_id", DataType: "integer"},
+				},
+				PrimaryKey: &codegen.PrimaryKey{ColumnNames: []string{"post_id", "tag_id"}},
+			},
+			expected: "PostTagsKey",
+		},
 	}
 
 	for _, tt := range tests {
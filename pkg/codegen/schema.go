@@ -18,6 +18,7 @@ type Table struct {
 	Schema     string
 	Columns    []*Column
 	PrimaryKey *PrimaryKey
+	Comment    string
 }
 
 // Column represents a table column
@@ -27,6 +28,7 @@ type Column struct {
 	IsNullable   bool
 	DefaultValue *string
 	Position     int
+	Comment      string
 }
 
 // PrimaryKey represents a table's primary key
@@ -34,10 +36,12 @@ type PrimaryKey struct {
 	ColumnNames []string
 }
 
+// HasCompositeKey reports whether the table's primary key spans several columns
+func (t *Table) HasCompositeKey() bool {
+	return t.PrimaryKey != nil && len(t.PrimaryKey.ColumnNames) > 1
+}
+
 // SchemaIntrospector queries PostgreSQL information_schema
-// Note: The current SDK generator has limited support for composite primary keys.
-// Tables with composite PKs will trigger a warning, and SDK generation may not work correctly.
-// Consider using a single-column primary key (e.g., surrogate key) for best results.
 type SchemaIntrospector struct {
 	db *sql.DB
 }
@@ -78,23 +82,64 @@ func (s *SchemaIntrospector) IntrospectSchema(schemaName string) (*Schema, error
 				Err(err).
 				Msg("Failed to retrieve primary key, table will have no PK defined")
 		}
-		
-		// Warn about composite primary keys (not fully supported yet)
-		if pk != nil && len(pk.ColumnNames) > 1 {
-			log.Warn().
-				Str("table", table.Name).
-				Strs("pk_columns", pk.ColumnNames).
-				Msg("Composite primary key detected - SDK generation may not work correctly")
-		}
-		
+
 		table.PrimaryKey = pk
 
 		schema.Tables = append(schema.Tables, table)
 	}
 
+	if err := s.addComments(schemaName, schema.Tables); err != nil {
+		return nil, fmt.Errorf("failed to get comments: %w", err)
+	}
+
 	return schema, nil
 }
 
+// addComments fills the table and column comments of a schema in one query
+func (s *SchemaIntrospector) addComments(schemaName string, tables []*Table) error {
+	query := `
+		SELECT c.relname, COALESCE(a.attname, ''), d.description
+		FROM pg_description d
+		JOIN pg_class c ON c.oid = d.objoid AND d.classoid = 'pg_class'::regclass
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.objsubid AND d.objsubid > 0
+		WHERE n.nspname = $1
+	`
+
+	rows, err := s.db.Query(query, schemaName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byName := make(map[string]*Table, len(tables))
+	for _, table := range tables {
+		byName[table.Name] = table
+	}
+
+	for rows.Next() {
+		var tableName, columnName, comment string
+		if err := rows.Scan(&tableName, &columnName, &comment); err != nil {
+			return err
+		}
+		table, ok := byName[tableName]
+		if !ok {
+			continue
+		}
+		if columnName == "" {
+			table.Comment = comment
+			continue
+		}
+		for _, col := range table.Columns {
+			if col.Name == columnName {
+				col.Comment = comment
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
 // getTables retrieves all tables from the schema
 func (s *SchemaIntrospector) getTables(schemaName string) ([]*Table, error) {
 	query := `
@@ -54,10 +54,7 @@ func (g *ClientGenerator) GenerateClient(schema *codegen.Schema) string {
 	
 	// Import all types
 	for _, table := range schema.Tables {
-		typeName := g.typeMapper.ToTypeName(table.Name)
-		sb.WriteString(fmt.Sprintf("  %s,\n", typeName))
-		sb.WriteString(fmt.Sprintf("  Create%sInput,\n", typeName))
-		sb.WriteString(fmt.Sprintf("  Update%sInput,\n", typeName))
+		g.writeTypeImports(&sb, table)
 	}
 	sb.WriteString("} from './types';\n\n")
 
@@ -105,6 +102,17 @@ func (g *ClientGenerator) GenerateClient(schema *codegen.Schema) string {
 	return sb.String()
 }
 
+// writeTypeImports writes the import list entries of a table's types
+func (g *ClientGenerator) writeTypeImports(sb *strings.Builder, table *codegen.Table) {
+	typeName := g.typeMapper.ToTypeName(table.Name)
+	sb.WriteString(fmt.Sprintf("  %s,\n", typeName))
+	sb.WriteString(fmt.Sprintf("  Create%sInput,\n", typeName))
+	sb.WriteString(fmt.Sprintf("  Update%sInput,\n", typeName))
+	if table.HasCompositeKey() {
+		sb.WriteString(fmt.Sprintf("  %s,\n", g.typeMapper.ToKeyTypeName(table.Name)))
+	}
+}
+
 // GenerateIndexFile generates the main index.ts barrel export
 func (g *ClientGenerator) GenerateIndexFile(schema *codegen.Schema) string {
 	var sb strings.Builder
@@ -114,6 +122,7 @@ func (g *ClientGenerator) GenerateIndexFile(schema *codegen.Schema) string {
 
 	sb.WriteString("export * from './types';\n")
 	sb.WriteString("export * from './api';\n")
+	sb.WriteString("export * from './errors';\n")
 	sb.WriteString("export { KapokClient } from './client';\n")
 
 	return sb.String()
@@ -132,6 +141,10 @@ func (g *ClientGenerator) GenerateTypesIndexFile(schema *codegen.Schema) string
 		sb.WriteString("\n")
 		sb.WriteString(g.typeMapper.GenerateUpdateInput(table))
 		sb.WriteString("\n")
+		if keyType := g.typeMapper.GenerateKeyType(table); keyType != "" {
+			sb.WriteString(keyType)
+			sb.WriteString("\n")
+		}
 	}
 
 	return sb.String()
@@ -146,12 +159,10 @@ func (g *ClientGenerator) GenerateAPIIndexFile(schema *codegen.Schema) string {
 	// Import types
 	sb.WriteString("import {\n")
 	for _, table := range schema.Tables {
-		typeName := g.typeMapper.ToTypeName(table.Name)
-		sb.WriteString(fmt.Sprintf("  %s,\n", typeName))
-		sb.WriteString(fmt.Sprintf("  Create%sInput,\n", typeName))
-		sb.WriteString(fmt.Sprintf("  Update%sInput,\n", typeName))
+		g.writeTypeImports(&sb, table)
 	}
-	sb.WriteString("} from '../types';\n\n")
+	sb.WriteString("} from '../types';\n")
+	sb.WriteString("import { KapokRequestError } from '../errors';\n\n")
 
 	// Generate all CRUD functions
 	for i, table := range schema.Tables {
@@ -238,6 +249,7 @@ func (g *ClientGenerator) WriteSDK(outputDir string, schema *codegen.Schema, pro
 	files := map[string]string{
 		filepath.Join(srcDir, "index.ts"):       g.GenerateIndexFile(schema),
 		filepath.Join(srcDir, "client.ts"):      g.GenerateClient(schema),
+		filepath.Join(srcDir, "errors.ts"):      g.GenerateErrorsFile(),
 		filepath.Join(typesDir, "index.ts"):     g.GenerateTypesIndexFile(schema),
 		filepath.Join(apiDir, "index.ts"):       g.GenerateAPIIndexFile(schema),
 	}
@@ -288,7 +300,8 @@ func (g *ClientGenerator) generateReadme(projectName string) string {
 	sb.WriteString("import { KapokClient } from './")
 	sb.WriteString(projectName)
 	sb.WriteString("';\n\n")
-	sb.WriteString("const client = new KapokClient('http://localhost:8080/api');\n\n")
+	sb.WriteString("// The REST endpoints of your tenant's tables\n")
+	sb.WriteString("const client = new KapokClient('http://localhost:8080/api/v1/tenants/<tenant-id>/rest');\n\n")
 	sb.WriteString("// Use the SDK\n")
 	sb.WriteString("const user = await client.users.create({\n")
 	sb.WriteString("  email: 'user@example.com',\n")
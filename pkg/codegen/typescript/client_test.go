@@ -89,6 +89,33 @@ func TestClientGenerator_GenerateTypesIndexFile(t *testing.T) {
 	assert.Contains(t, result, "export interface UpdateUsersInput")
 }
 
+func TestClientGenerator_CompositeKeyTypes(t *testing.T) {
+	generator := NewClientGenerator()
+
+	schema := &codegen.Schema{
+		Tables: []*codegen.Table{
+			{
+				Name:   "post_tags",
+				Schema: "public",
+				Columns: []*codegen.Column{
+					{Name: "post_id", DataType: "integer", IsNullable: false},
+					{Name: "tag_id", DataType: "integer", IsNullable: false},
+				},
+				PrimaryKey: &codegen.PrimaryKey{ColumnNames: []string{"post_id", "tag_id"}},
+			},
+		},
+	}
+
+	assert.Contains(t, generator.GenerateTypesIndexFile(schema), "export interface PostTagsKey {")
+
+	client := generator.GenerateClient(schema)
+	assert.Contains(t, client, "  PostTagsKey,\n")
+	assert.Contains(t, client, "getById: (id: PostTagsKey) => getPostTagsById(this.baseUrl, id)")
+	assert.Contains(t, client, "update: (id: PostTagsKey, input: UpdatePostTagsInput)")
+
+	assert.Contains(t, generator.GenerateAPIIndexFile(schema), "  PostTagsKey,\n")
+}
+
 func TestClientGenerator_GenerateAPIIndexFile(t *testing.T) {
 	generator := NewClientGenerator()
 
@@ -191,6 +218,7 @@ func TestClientGenerator_WriteSDK(t *testing.T) {
 		filepath.Join(tmpDir, "README.md"),
 		filepath.Join(tmpDir, "src", "index.ts"),
 		filepath.Join(tmpDir, "src", "client.ts"),
+		filepath.Join(tmpDir, "src", "errors.ts"),
 		filepath.Join(tmpDir, "src", "types", "index.ts"),
 		filepath.Join(tmpDir, "src", "api", "index.ts"),
 	}
@@ -204,12 +232,25 @@ func TestClientGenerator_WriteSDK(t *testing.T) {
 	indexContent, err := ioutil.ReadFile(filepath.Join(tmpDir, "src", "index.ts"))
 	require.NoError(t, err)
 	assert.Contains(t, string(indexContent), "export * from './types'")
+	assert.Contains(t, string(indexContent), "export * from './errors'")
 
 	packageJSON, err := ioutil.ReadFile(filepath.Join(tmpDir, "package.json"))
 	require.NoError(t, err)
 	assert.Contains(t, string(packageJSON), "test-sdk")
 }
 
+func TestClientGenerator_GenerateErrorsFile(t *testing.T) {
+	result := NewClientGenerator().GenerateErrorsFile()
+
+	assert.Contains(t, result, "  | 'UNIQUE_VIOLATION'\n")
+	assert.Contains(t, result, "export interface UniqueViolationError extends KapokErrorBase<'UNIQUE_VIOLATION'> {\n  table?: string;\n  constraint: string;")
+	assert.Contains(t, result, "export interface NotNullViolationError extends KapokErrorBase<'NOT_NULL_VIOLATION'> {\n  table?: string;\n  column: string;\n}")
+	assert.Contains(t, result, "export type InternalServerError = KapokErrorBase<'INTERNAL_SERVER_ERROR'>;")
+	assert.Contains(t, result, "export type KapokError =\n  | UniqueViolationError\n")
+	assert.Contains(t, result, "export class KapokRequestError extends Error {")
+	assert.Contains(t, result, "export function isKapokError<C extends KapokErrorCode>(")
+}
+
 func TestClientGenerator_MultipleTablesIntegration(t *testing.T) {
 	generator := NewClientGenerator()
 
@@ -35,8 +35,7 @@ func (g *CRUDGenerator) GenerateCreateFunction(table *codegen.Table) string {
 	sb.WriteString("    body: JSON.stringify(input),\n")
 	sb.WriteString("  });\n")
 	sb.WriteString("  if (!response.ok) {\n")
-	sb.WriteString("    const error = await response.json().catch(() => ({ message: response.statusText }));\n")
-	sb.WriteString("    throw new Error(error.message || `Failed to create: ${response.statusText}`);\n")
+	sb.WriteString("    throw await KapokRequestError.fromResponse(response, 'Failed to create');\n")
 	sb.WriteString("  }\n")
 	sb.WriteString("  return response.json();\n")
 	sb.WriteString("}\n")
@@ -57,10 +56,9 @@ func (g *CRUDGenerator) GenerateGetByIdFunction(table *codegen.Table) string {
 	sb.WriteString(fmt.Sprintf("export async function %s(", functionName))
 	sb.WriteString(fmt.Sprintf("baseUrl: string, id: %s", pkType))
 	sb.WriteString(fmt.Sprintf("): Promise<%s> {\n", typeName))
-	sb.WriteString(fmt.Sprintf("  const response = await fetch(`${baseUrl}/%s/${id}`);\n", table.Name))
+	sb.WriteString(fmt.Sprintf("  const response = await fetch(`${baseUrl}/%s/%s`);\n", table.Name, g.keyPath(table)))
 	sb.WriteString("  if (!response.ok) {\n")
-	sb.WriteString("    const error = await response.json().catch(() => ({ message: response.statusText }));\n")
-	sb.WriteString("    throw new Error(error.message || `Failed to fetch: ${response.statusText}`);\n")
+	sb.WriteString("    throw await KapokRequestError.fromResponse(response, 'Failed to fetch');\n")
 	sb.WriteString("  }\n")
 	sb.WriteString("  return response.json();\n")
 	sb.WriteString("}\n")
@@ -89,8 +87,7 @@ func (g *CRUDGenerator) GenerateListFunction(table *codegen.Table) string {
 	sb.WriteString("  }\n")
 	sb.WriteString("  const response = await fetch(url);\n")
 	sb.WriteString("  if (!response.ok) {\n")
-	sb.WriteString("    const error = await response.json().catch(() => ({ message: response.statusText }));\n")
-	sb.WriteString("    throw new Error(error.message || `Failed to fetch list: ${response.statusText}`);\n")
+	sb.WriteString("    throw await KapokRequestError.fromResponse(response, 'Failed to fetch list');\n")
 	sb.WriteString("  }\n")
 	sb.WriteString("  return response.json();\n")
 	sb.WriteString("}\n")
@@ -111,14 +108,13 @@ func (g *CRUDGenerator) GenerateUpdateFunction(table *codegen.Table) string {
 	sb.WriteString(fmt.Sprintf("export async function %s(", functionName))
 	sb.WriteString(fmt.Sprintf("baseUrl: string, id: %s, input: Update%sInput", pkType, typeName))
 	sb.WriteString(fmt.Sprintf("): Promise<%s> {\n", typeName))
-	sb.WriteString(fmt.Sprintf("  const response = await fetch(`${baseUrl}/%s/${id}`, {\n", table.Name))
+	sb.WriteString(fmt.Sprintf("  const response = await fetch(`${baseUrl}/%s/%s`, {\n", table.Name, g.keyPath(table)))
 	sb.WriteString("    method: 'PUT',\n")
 	sb.WriteString("    headers: { 'Content-Type': 'application/json' },\n")
 	sb.WriteString("    body: JSON.stringify(input),\n")
 	sb.WriteString("  });\n")
 	sb.WriteString("  if (!response.ok) {\n")
-	sb.WriteString("    const error = await response.json().catch(() => ({ message: response.statusText }));\n")
-	sb.WriteString("    throw new Error(error.message || `Failed to update: ${response.statusText}`);\n")
+	sb.WriteString("    throw await KapokRequestError.fromResponse(response, 'Failed to update');\n")
 	sb.WriteString("  }\n")
 	sb.WriteString("  return response.json();\n")
 	sb.WriteString("}\n")
@@ -139,12 +135,11 @@ func (g *CRUDGenerator) GenerateDeleteFunction(table *codegen.Table) string {
 	sb.WriteString(fmt.Sprintf("export async function %s(", functionName))
 	sb.WriteString(fmt.Sprintf("baseUrl: string, id: %s", pkType))
 	sb.WriteString("): Promise<void> {\n")
-	sb.WriteString(fmt.Sprintf("  const response = await fetch(`${baseUrl}/%s/${id}`, {\n", table.Name))
+	sb.WriteString(fmt.Sprintf("  const response = await fetch(`${baseUrl}/%s/%s`, {\n", table.Name, g.keyPath(table)))
 	sb.WriteString("    method: 'DELETE',\n")
 	sb.WriteString("  });\n")
 	sb.WriteString("  if (!response.ok) {\n")
-	sb.WriteString("    const error = await response.json().catch(() => ({ message: response.statusText }));\n")
-	sb.WriteString("    throw new Error(error.message || `Failed to delete: ${response.statusText}`);\n")
+	sb.WriteString("    throw await KapokRequestError.fromResponse(response, 'Failed to delete');\n")
 	sb.WriteString("  }\n")
 	sb.WriteString("}\n")
 
@@ -152,11 +147,15 @@ func (g *CRUDGenerator) GenerateDeleteFunction(table *codegen.Table) string {
 }
 
 // getPrimaryKeyTSType returns the TypeScript type for the table's primary key
-// Returns "string" for UUID/TEXT types, "number" for integer types
+// Returns "string" for UUID/TEXT types, "number" for integer types and the key
+// object type (e.g. PostTagsKey) for composite keys
 func (g *CRUDGenerator) getPrimaryKeyTSType(table *codegen.Table) string {
 	if table.PrimaryKey == nil || len(table.PrimaryKey.ColumnNames) == 0 {
 		return "number" // default fallback
 	}
+	if table.HasCompositeKey() {
+		return g.typeMapper.ToKeyTypeName(table.Name)
+	}
 	
 	pkColName := table.PrimaryKey.ColumnNames[0]
 	for _, col := range table.Columns {
@@ -167,6 +166,19 @@ func (g *CRUDGenerator) getPrimaryKeyTSType(table *codegen.Table) string {
 	return "number" // fallback if PK column not found
 }
 
+// keyPath returns the URL path segment identifying a row: the id itself, or the
+// comma-separated key columns of a composite key (e.g. /post_tags/1,2)
+func (g *CRUDGenerator) keyPath(table *codegen.Table) string {
+	if !table.HasCompositeKey() {
+		return "${id}"
+	}
+	parts := make([]string, len(table.PrimaryKey.ColumnNames))
+	for i, name := range table.PrimaryKey.ColumnNames {
+		parts[i] = fmt.Sprintf("${encodeURIComponent(String(id.%s))}", g.typeMapper.ToFieldName(name))
+	}
+	return strings.Join(parts, ",")
+}
+
 // GenerateAllCRUD generates all CRUD functions for a table
 func (g *CRUDGenerator) GenerateAllCRUD(table *codegen.Table) string {
 	var sb strings.Builder
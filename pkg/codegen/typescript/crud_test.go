@@ -36,7 +36,7 @@ func TestCRUDGenerator_GenerateCreateFunction(t *testing.T) {
 
 	// Verify error handling
 	assert.Contains(t, result, "if (!response.ok)")
-	assert.Contains(t, result, "throw new Error")
+	assert.Contains(t, result, "throw await KapokRequestError.fromResponse(response, 'Failed to create')")
 }
 
 func TestCRUDGenerator_GenerateGetByIdFunction(t *testing.T) {
@@ -220,3 +220,33 @@ func TestCRUDGenerator_TypeScriptSyntax(t *testing.T) {
 	count := strings.Count(result, "export async function")
 	assert.Equal(t, 5, count, "Should have 5 exported functions (create, get, list, update, delete)")
 }
+
+func TestCRUDGenerator_CompositeKey(t *testing.T) {
+	generator := NewCRUDGenerator()
+
+	table := &codegen.Table{
+		Name:   "post_tags",
+		Schema: "public",
+		Columns: []*codegen.Column{
+			{Name: "post_id", DataType: "integer", IsNullable: false},
+			{Name: "tag_id", DataType: "integer", IsNullable: false},
+		},
+		PrimaryKey: &codegen.PrimaryKey{
+			ColumnNames: []string{"post_id", "tag_id"},
+		},
+	}
+
+	keyPath := "${encodeURIComponent(String(id.postId))},${encodeURIComponent(String(id.tagId))}"
+
+	get := generator.GenerateGetByIdFunction(table)
+	assert.Contains(t, get, "baseUrl: string, id: PostTagsKey")
+	assert.Contains(t, get, "fetch(`${baseUrl}/post_tags/"+keyPath+"`)")
+
+	update := generator.GenerateUpdateFunction(table)
+	assert.Contains(t, update, "id: PostTagsKey, input: UpdatePostTagsInput")
+	assert.Contains(t, update, "fetch(`${baseUrl}/post_tags/"+keyPath+"`, {")
+
+	del := generator.GenerateDeleteFunction(table)
+	assert.Contains(t, del, "baseUrl: string, id: PostTagsKey")
+	assert.Contains(t, del, "fetch(`${baseUrl}/post_tags/"+keyPath+"`, {")
+}
@@ -0,0 +1,158 @@
+package typescript
+
+import (
+	"fmt"
+	"strings"
+)
+
+// errorKind is an error code the server reports in extensions.code, with the
+// fields its errors carry besides code, message and correlationId
+type errorKind struct {
+	Code      string
+	Interface string
+	Fields    []string
+}
+
+// errorKinds mirrors the codes of the GraphQL server (internal/graphql)
+var errorKinds = []errorKind{
+	{Code: "UNIQUE_VIOLATION", Interface: "UniqueViolationError", Fields: []string{"table?: string", "constraint: string", "column?: string", "columns?: string[]"}},
+	{Code: "FOREIGN_KEY_VIOLATION", Interface: "ForeignKeyViolationError", Fields: []string{"table?: string", "constraint: string", "column?: string", "columns?: string[]"}},
+	{Code: "NOT_NULL_VIOLATION", Interface: "NotNullViolationError", Fields: []string{"table?: string", "column: string"}},
+	{Code: "CHECK_VIOLATION", Interface: "CheckViolationError", Fields: []string{"table?: string", "constraint: string"}},
+	{Code: "PERMISSION_DENIED", Interface: "PermissionDeniedError", Fields: []string{"table?: string"}},
+	{Code: "INVALID_INPUT", Interface: "InvalidInputError", Fields: []string{"table?: string", "column?: string"}},
+	{Code: "CONFLICT", Interface: "ConflictError", Fields: []string{"column: string"}},
+	{Code: "SERIALIZATION_FAILURE", Interface: "SerializationFailureError"},
+	{Code: "TRANSACTION_ROLLED_BACK", Interface: "TransactionRolledBackError"},
+	{Code: "TIMEOUT", Interface: "TimeoutError"},
+	{Code: "NOT_FOUND", Interface: "NotFoundError"},
+	{Code: "QUERY_LIMIT_EXCEEDED", Interface: "QueryLimitExceededError"},
+	{Code: "PERSISTED_QUERY_NOT_FOUND", Interface: "PersistedQueryNotFoundError"},
+	{Code: "PERSISTED_QUERY_HASH_MISMATCH", Interface: "PersistedQueryHashMismatchError"},
+	{Code: "OPERATION_NOT_ALLOWED", Interface: "OperationNotAllowedError"},
+	{Code: "ACTION_FAILED", Interface: "ActionFailedError", Fields: []string{"action: string"}},
+	{Code: "REMOTE_SCHEMA_FAILED", Interface: "RemoteSchemaFailedError", Fields: []string{"remoteSchema: string"}},
+	{Code: "INTERNAL_SERVER_ERROR", Interface: "InternalServerError"},
+}
+
+// GenerateErrorsFile generates the errors.ts file: the KapokError union of the
+// errors the server reports and the KapokRequestError thrown by API functions
+func (g *ClientGenerator) GenerateErrorsFile() string {
+	var sb strings.Builder
+
+	sb.WriteString("// Auto-generated error types\n\n")
+
+	sb.WriteString("export type KapokErrorCode =\n")
+	for i, kind := range errorKinds {
+		sb.WriteString(fmt.Sprintf("  | '%s'", kind.Code))
+		if i == len(errorKinds)-1 {
+			sb.WriteString(";\n\n")
+		} else {
+			sb.WriteString("\n")
+		}
+	}
+
+	sb.WriteString("interface KapokErrorBase<C extends KapokErrorCode> {\n")
+	sb.WriteString("  code: C;\n")
+	sb.WriteString("  message: string;\n")
+	sb.WriteString("  correlationId?: string;\n")
+	sb.WriteString("}\n\n")
+
+	for _, kind := range errorKinds {
+		if len(kind.Fields) == 0 {
+			sb.WriteString(fmt.Sprintf("export type %s = KapokErrorBase<'%s'>;\n\n", kind.Interface, kind.Code))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("export interface %s extends KapokErrorBase<'%s'> {\n", kind.Interface, kind.Code))
+		for _, field := range kind.Fields {
+			sb.WriteString(fmt.Sprintf("  %s;\n", field))
+		}
+		sb.WriteString("}\n\n")
+	}
+
+	sb.WriteString("export type KapokError =\n")
+	for i, kind := range errorKinds {
+		sb.WriteString(fmt.Sprintf("  | %s", kind.Interface))
+		if i == len(errorKinds)-1 {
+			sb.WriteString(";\n\n")
+		} else {
+			sb.WriteString("\n")
+		}
+	}
+
+	sb.WriteString(`/** Error thrown by the API functions when a request fails. */
+export class KapokRequestError extends Error {
+  constructor(
+    readonly status: number,
+    readonly errors: KapokError[],
+  ) {
+    super(errors[0].message);
+    this.name = 'KapokRequestError';
+  }
+
+  /** The code of the first error. */
+  get code(): KapokErrorCode {
+    return this.errors[0].code;
+  }
+
+  /** Reads the errors of a failed response, GraphQL ({ errors }) or REST ({ error } / { message }). */
+  static async fromResponse(response: Response, fallback: string): Promise<KapokRequestError> {
+    const body: any = await response.json().catch(() => ({}));
+    if (Array.isArray(body?.errors) && body.errors.length > 0) {
+      return new KapokRequestError(
+        response.status,
+        body.errors.map((e: any) => toKapokError(e?.extensions?.code, e?.message || fallback, e?.extensions)),
+      );
+    }
+    const message = body?.error || body?.message || ` + "`${fallback}: ${response.statusText}`" + `;
+    return new KapokRequestError(response.status, [toKapokError(body?.code ?? statusCode(response.status), message, body)]);
+  }
+}
+
+/** Narrows an error to a KapokRequestError, optionally of one code. */
+export function isKapokError<C extends KapokErrorCode>(
+  error: unknown,
+  code?: C,
+): error is KapokRequestError & { errors: [Extract<KapokError, { code: C }>, ...KapokError[]] } {
+  return error instanceof KapokRequestError && (code === undefined || error.code === code);
+}
+
+function toKapokError(code: unknown, message: string, details?: any): KapokError {
+  return {
+    ...(details ?? {}),
+    code: isKapokErrorCode(code) ? code : 'INTERNAL_SERVER_ERROR',
+    message,
+  } as KapokError;
+}
+
+function isKapokErrorCode(code: unknown): code is KapokErrorCode {
+  return typeof code === 'string' && kapokErrorCodes.includes(code as KapokErrorCode);
+}
+
+function statusCode(status: number): KapokErrorCode {
+  switch (status) {
+    case 401:
+    case 403:
+      return 'PERMISSION_DENIED';
+    case 400:
+    case 422:
+      return 'INVALID_INPUT';
+    case 404:
+      return 'NOT_FOUND';
+    case 409:
+      return 'CONFLICT';
+    default:
+      return 'INTERNAL_SERVER_ERROR';
+  }
+}
+
+`)
+
+	sb.WriteString("const kapokErrorCodes: KapokErrorCode[] = [\n")
+	for _, kind := range errorKinds {
+		sb.WriteString(fmt.Sprintf("  '%s',\n", kind.Code))
+	}
+	sb.WriteString("];\n")
+
+	return sb.String()
+}
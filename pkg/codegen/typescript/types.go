@@ -97,7 +97,8 @@ func (tm *TypeMapper) GenerateInterface(table *codegen.Table) string {
 	
 	typeName := tm.ToTypeName(table.Name)
 	
-	// Write interface declaration
+	// Write interface declaration, documented with the table comment
+	sb.WriteString(docComment(table.Comment, ""))
 	sb.WriteString(fmt.Sprintf("export interface %s {\n", typeName))
 	
 	// Write fields
@@ -105,6 +106,7 @@ func (tm *TypeMapper) GenerateInterface(table *codegen.Table) string {
 		fieldName := tm.ToFieldName(col.Name)
 		tsType := tm.MapType(col.DataType, col.IsNullable)
 		
+		sb.WriteString(docComment(col.Comment, "  "))
 		sb.WriteString(fmt.Sprintf("  %s: %s;\n", fieldName, tsType))
 	}
 	
@@ -113,6 +115,35 @@ func (tm *TypeMapper) GenerateInterface(table *codegen.Table) string {
 	return sb.String()
 }
 
+// ToKeyTypeName returns the name of the key object type of a table with a composite primary key
+func (tm *TypeMapper) ToKeyTypeName(tableName string) string {
+	return tm.ToTypeName(tableName) + "Key"
+}
+
+// GenerateKeyType generates the key object type identifying a row of a table with a
+// composite primary key; tables with a single-column key get none
+func (tm *TypeMapper) GenerateKeyType(table *codegen.Table) string {
+	if !table.HasCompositeKey() {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("export interface %s {\n", tm.ToKeyTypeName(table.Name)))
+	for _, name := range table.PrimaryKey.ColumnNames {
+		tsType := "any"
+		for _, col := range table.Columns {
+			if col.Name == name {
+				tsType = tm.mapBaseType(col.DataType)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("  %s: %s;\n", tm.ToFieldName(name), tsType))
+	}
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
 // GenerateCreateInput generates Create input type (excludes auto-generated fields)
 func (tm *TypeMapper) GenerateCreateInput(table *codegen.Table) string {
 	var sb strings.Builder
@@ -211,3 +242,19 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
+
+// docComment renders a database comment as a JSDoc block, or nothing when empty
+func docComment(comment, indent string) string {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(indent + "/**\n")
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.ReplaceAll(strings.TrimRight(line, " \t\r"), "*/", "*\\/")
+		sb.WriteString(strings.TrimRight(indent+" * "+line, " ") + "\n")
+	}
+	sb.WriteString(indent + " */\n")
+	return sb.String()
+}
@@ -128,6 +128,26 @@ func TestTypeMapper_GenerateInterface(t *testing.T) {
 	assert.Contains(t, got, "isActive: boolean;")
 }
 
+func TestTypeMapper_GenerateInterface_Comments(t *testing.T) {
+	tm := typescript.NewTypeMapper()
+
+	table := &codegen.Table{
+		Name:    "users",
+		Schema:  "public",
+		Comment: "Registered accounts",
+		Columns: []*codegen.Column{
+			{Name: "id", DataType: "integer", Position: 1},
+			{Name: "email", DataType: "text", Position: 2, Comment: "Login address\nnever shown publicly */"},
+		},
+	}
+
+	got := tm.GenerateInterface(table)
+
+	assert.Contains(t, got, "/**\n * Registered accounts\n */\nexport interface Users {")
+	assert.Contains(t, got, "  /**\n   * Login address\n   * never shown publicly *\\/\n   */\n  email: string;")
+	assert.Contains(t, got, "{\n  id: number;", "columns without comments get no doc block")
+}
+
 func TestTypeMapper_GenerateCreateInput(t *testing.T) {
 	tm := typescript.NewTypeMapper()
 
@@ -215,3 +235,31 @@ func TestTypeMapper_GenerateUpdateInput(t *testing.T) {
 	assert.NotContains(t, got, "createdAt") // Auto-timestamp excluded
 	assert.NotContains(t, got, "updatedAt") // Auto-timestamp excluded
 }
+
+func TestTypeMapper_GenerateKeyType(t *testing.T) {
+	tm := typescript.NewTypeMapper()
+
+	table := &codegen.Table{
+		Name:   "post_tags",
+		Schema: "public",
+		Columns: []*codegen.Column{
+			{Name: "post_id", DataType: "integer", IsNullable: false, Position: 1},
+			{Name: "tag_slug", DataType: "text", IsNullable: false, Position: 2},
+			{Name: "position", DataType: "integer", IsNullable: true, Position: 3},
+		},
+		PrimaryKey: &codegen.PrimaryKey{
+			ColumnNames: []string{"post_id", "tag_slug"},
+		},
+	}
+
+	got := tm.GenerateKeyType(table)
+
+	assert.Contains(t, got, "export interface PostTagsKey {")
+	assert.Contains(t, got, "postId: number;")
+	assert.Contains(t, got, "tagSlug: string;")
+	assert.NotContains(t, got, "position")
+
+	// Single-column keys are passed as plain values
+	table.PrimaryKey.ColumnNames = []string{"post_id"}
+	assert.Empty(t, tm.GenerateKeyType(table))
+}
@@ -34,6 +34,23 @@ function PlaygroundContent() {
     [graphqlEndpoint],
   );
 
+  const [schemaError, setSchemaError] = useState("");
+
+  async function downloadSchema() {
+    setSchemaError("");
+    try {
+      const sdl = await api.getGraphQLSchema(selectedTenantId);
+      const url = URL.createObjectURL(new Blob([sdl], { type: "text/plain" }));
+      const link = document.createElement("a");
+      link.href = url;
+      link.download = "schema.graphql";
+      link.click();
+      URL.revokeObjectURL(url);
+    } catch (e) {
+      setSchemaError(e instanceof Error ? e.message : "Download failed");
+    }
+  }
+
   return (
     <Shell>
       <div className="flex items-center justify-between">
@@ -43,20 +60,44 @@ function PlaygroundContent() {
             Test queries against your tenant&apos;s GraphQL API
           </p>
         </div>
-        <select
-          value={selectedTenantId}
-          onChange={(e) => setSelectedTenantId(e.target.value)}
-          className="rounded-lg border border-gray-300 px-3 py-2 text-sm focus:border-kapok-500 focus:outline-none focus:ring-1 focus:ring-kapok-500"
-        >
-          <option value="">Select tenant...</option>
-          {tenants?.map((t: Tenant) => (
-            <option key={t.id} value={t.id}>
-              {t.name}
-            </option>
-          ))}
-        </select>
+        <div className="flex items-center gap-2">
+          {selectedTenantId && (
+            <>
+              <button
+                onClick={downloadSchema}
+                className="rounded-lg border border-gray-300 px-3 py-2 text-sm text-gray-700 hover:bg-gray-50"
+              >
+                Download schema
+              </button>
+              <a
+                href={api.getGraphiQLUrl(selectedTenantId)}
+                target="_blank"
+                rel="noopener noreferrer"
+                className="rounded-lg border border-gray-300 px-3 py-2 text-sm text-gray-700 hover:bg-gray-50"
+              >
+                Open GraphiQL
+              </a>
+            </>
+          )}
+          <select
+            value={selectedTenantId}
+            onChange={(e) => setSelectedTenantId(e.target.value)}
+            className="rounded-lg border border-gray-300 px-3 py-2 text-sm focus:border-kapok-500 focus:outline-none focus:ring-1 focus:ring-kapok-500"
+          >
+            <option value="">Select tenant...</option>
+            {tenants?.map((t: Tenant) => (
+              <option key={t.id} value={t.id}>
+                {t.name}
+              </option>
+            ))}
+          </select>
+        </div>
       </div>
 
+      {schemaError && (
+        <p className="mt-2 text-sm text-red-600">{schemaError}</p>
+      )}
+
       <div className="mt-6 overflow-hidden rounded-xl border border-gray-200 bg-white">
         {!selectedTenantId ? (
           <div className="flex h-[500px] items-center justify-center text-gray-400">
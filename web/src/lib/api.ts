@@ -146,6 +146,29 @@ export const api = {
     return `${API_URL}/api/v1/tenants/${tenantId}/graphql`;
   },
 
+  // The tenant's schema in SDL, as the signed-in role sees it
+  async getGraphQLSchema(tenantId: string): Promise<string> {
+    validateUUID(tenantId);
+    const token = getToken();
+    const res = await fetch(
+      `${API_URL}/api/v1/tenants/${tenantId}/graphql/schema.graphql`,
+      { headers: token ? { Authorization: `Bearer ${token}` } : {} },
+    );
+    if (!res.ok) {
+      throw new ApiError(res.status, await res.text());
+    }
+    return res.text();
+  },
+
+  // The tenant's GraphiQL page. The session token travels in the fragment,
+  // which browsers do not send to the server.
+  getGraphiQLUrl(tenantId: string): string {
+    validateUUID(tenantId);
+    const token = getToken();
+    const fragment = token ? `#token=${encodeURIComponent(token)}` : "";
+    return `${API_URL}/api/v1/tenants/${tenantId}/graphiql${fragment}`;
+  },
+
   getAuthToken(): string | null {
     return getToken();
   },